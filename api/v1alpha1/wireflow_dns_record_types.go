@@ -0,0 +1,78 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WireflowDNSRecordSpec defines a DNS record served by the agents of a
+// network.
+type WireflowDNSRecordSpec struct {
+	// Network is the WireflowNetwork whose agents serve the record. The
+	// network must have DNS enabled.
+	Network string `json:"network"`
+
+	// Name is the owner of the record. A relative name ("db") lives in the
+	// zone of the network, db.<network>.<domain>; a name ending with a dot
+	// ("db.corp.internal.") is served as is, and the agents route its
+	// queries to the overlay DNS.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Type of the record.
+	// +kubebuilder:validation:Enum=A;AAAA;CNAME;SRV;TXT
+	Type string `json:"type"`
+
+	// TTL of the record in seconds; 60 when unset.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTL int32 `json:"ttl,omitempty"`
+
+	// Values are the data of the record in zone file syntax, one record
+	// each: an address for A and AAAA, a name for CNAME,
+	// "<priority> <weight> <port> <target>" for SRV and a string for TXT.
+	// Names not ending with a dot are relative to the zone of the network.
+	// +kubebuilder:validation:MinItems=1
+	Values []string `json:"values"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=wfdns
+// +kubebuilder:printcolumn:name="NETWORK",type="string",JSONPath=".spec.network"
+// +kubebuilder:printcolumn:name="NAME",type="string",JSONPath=".spec.name"
+// +kubebuilder:printcolumn:name="TYPE",type="string",JSONPath=".spec.type"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// WireflowDNSRecord is a custom DNS record of a network.
+type WireflowDNSRecord struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec WireflowDNSRecordSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// WireflowDNSRecordList contains a list of WireflowDNSRecord.
+type WireflowDNSRecordList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WireflowDNSRecord `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WireflowDNSRecord{}, &WireflowDNSRecordList{})
+}
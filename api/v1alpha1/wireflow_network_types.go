@@ -15,6 +15,8 @@
 package v1alpha1
 
 import (
+	"time"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -32,6 +34,11 @@ type WireflowNetworkSpec struct {
 
 	CIDR string `json:"cidr,omitempty"`
 
+	// Mtu is the MTU of the WireGuard interface of every peer in the
+	// network. Peers use 1280 when unset.
+	// +kubebuilder:validation:Minimum=576
+	// +kubebuilder:validation:Maximum=9000
+	// +optional
 	Mtu int `json:"mtu,omitempty"`
 
 	Dns DNSConfig `json:"dns,omitempty"`
@@ -41,6 +48,113 @@ type WireflowNetworkSpec struct {
 	PeerSelector map[string]string `json:"peerSelector,omitempty"`
 
 	Policies []string `json:"policies,omitempty"`
+
+	// KeyRotation enables periodic WireGuard key rotation for every peer in
+	// the network. Keys are never rotated when unset.
+	// +optional
+	KeyRotation *KeyRotationPolicy `json:"keyRotation,omitempty"`
+
+	// PresharedKeys gives every pair of peers in the network its own WireGuard
+	// preshared key, mixed into the handshake as a post-quantum safeguard.
+	// The gateway link to a peered network gets one when either network
+	// enables them.
+	// +optional
+	PresharedKeys bool `json:"presharedKeys,omitempty"`
+
+	// ICEServers are the STUN and TURN servers the peers of the network use
+	// for NAT traversal. When unset the servers of the workspace apply (see
+	// ICEServersAnnotation), and failing those the ones peers are configured
+	// with (--stun-url).
+	// +optional
+	ICEServers []ICEServer `json:"iceServers,omitempty"`
+
+	// Connections controls when the peers of the network connect to each
+	// other. Every peer connects to all the peers it may reach as soon as it
+	// starts when unset.
+	// +optional
+	Connections *ConnectionPolicy `json:"connections,omitempty"`
+}
+
+// ConnectionMode is when peers set up their tunnels.
+// +kubebuilder:validation:Enum=Eager;Lazy
+type ConnectionMode string
+
+const (
+	// ConnectionModeEager connects every pair of peers at start.
+	ConnectionModeEager ConnectionMode = "Eager"
+	// ConnectionModeLazy connects a pair of peers on the first packet or
+	// signal between them, which suits large networks where most peers
+	// never talk to each other.
+	ConnectionModeLazy ConnectionMode = "Lazy"
+)
+
+// ConnectionPolicy controls when peers set up their tunnels.
+type ConnectionPolicy struct {
+	// Mode is Eager or Lazy. Defaults to Eager.
+	// +optional
+	Mode ConnectionMode `json:"mode,omitempty"`
+
+	// IdleTimeout is how long a lazy connection may carry no traffic before
+	// it is torn down, e.g. "10m". Defaults to 5m.
+	// +optional
+	IdleTimeout metav1.Duration `json:"idleTimeout,omitempty"`
+}
+
+// DefaultIdleTimeout applies when ConnectionPolicy.IdleTimeout is unset.
+const DefaultIdleTimeout = 5 * time.Minute
+
+// Lazy reports whether peers connect on demand.
+func (p *ConnectionPolicy) Lazy() bool {
+	return p != nil && p.Mode == ConnectionModeLazy
+}
+
+// GetIdleTimeout returns the configured idle timeout or the default.
+func (p *ConnectionPolicy) GetIdleTimeout() time.Duration {
+	if p == nil || p.IdleTimeout.Duration <= 0 {
+		return DefaultIdleTimeout
+	}
+	return p.IdleTimeout.Duration
+}
+
+// ICEServersAnnotation on a workspace Namespace holds the JSON list of
+// ICEServers used by the networks of the workspace that name none.
+const ICEServersAnnotation = "wireflow.run/ice-servers"
+
+// ICEServer is a STUN or TURN server.
+type ICEServer struct {
+	// URLs of the server, e.g. "stun:stun.example.com:3478" or
+	// "turn:turn.example.com:3478?transport=udp".
+	// +kubebuilder:validation:MinItems=1
+	URLs []string `json:"urls"`
+
+	// CredentialRef is the name of a Secret in the same namespace that holds
+	// the TURN credentials. The Secret must have keys "username" and
+	// "credential".
+	// +optional
+	CredentialRef string `json:"credentialRef,omitempty"`
+}
+
+// KeyRotationPolicy controls how often peers rotate their WireGuard keys.
+type KeyRotationPolicy struct {
+	// MaxKeyAge is the maximum age of a peer key before the controller asks
+	// the agent to rotate it, e.g. "720h".
+	MaxKeyAge metav1.Duration `json:"maxKeyAge"`
+
+	// GracePeriod is how long remote peers keep accepting the previous key
+	// after a rotation. Defaults to 10m.
+	// +optional
+	GracePeriod metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+// DefaultKeyRotationGracePeriod applies when KeyRotationPolicy.GracePeriod is unset.
+const DefaultKeyRotationGracePeriod = 10 * time.Minute
+
+// GetGracePeriod returns the configured grace period or the default.
+func (p *KeyRotationPolicy) GetGracePeriod() time.Duration {
+	if p == nil || p.GracePeriod.Duration <= 0 {
+		return DefaultKeyRotationGracePeriod
+	}
+	return p.GracePeriod.Duration
 }
 
 // WireflowNetworkStatus defines the observed state of WireflowNetwork.
@@ -75,9 +189,38 @@ type IPAllocation struct {
 	AllocatedAt metav1.Time `json:"allocatedAt"`
 }
 
+// DNSConfig configures the overlay DNS served by the agents of the network.
 type DNSConfig struct {
-	Enabled bool     `json:"enabled"`
+	// Enabled publishes the peers of the network as
+	// <peer>.<network>.<domain> to the agents running with --enable-dns.
+	Enabled bool `json:"enabled"`
+
+	// Servers are the resolvers the agents forward other names to, as
+	// "host" or "host:port". Agents use the resolvers of their host when
+	// unset.
+	// +optional
 	Servers []string `json:"servers,omitempty"`
+
+	// Domain is the DNS suffix of the workspace; wireflow.internal when
+	// unset.
+	// +optional
+	Domain string `json:"domain,omitempty"`
+
+	// Forwarders send the queries for a domain to dedicated resolvers, such
+	// as a resolver in the subnet of a subnet router.
+	// +optional
+	Forwarders []DNSForwarder `json:"forwarders,omitempty"`
+}
+
+// DNSForwarder forwards the queries for a domain and its subdomains.
+type DNSForwarder struct {
+	// Domain is the forwarded domain, e.g. "corp.internal".
+	// +kubebuilder:validation:MinLength=1
+	Domain string `json:"domain"`
+
+	// Servers are the resolvers of the domain, as "host" or "host:port".
+	// +kubebuilder:validation:MinItems=1
+	Servers []string `json:"servers"`
 }
 
 // +kubebuilder:object:root=true
@@ -34,14 +34,19 @@ type WireflowPeerSpec struct {
 	// platform which node runs on
 	Platform string `json:"platform,omitempty"`
 
-	PrivateKey string `json:"privateKey,omitempty"`
-
+	// PublicKey is the WireGuard public key submitted by the agent at
+	// registration. The matching private key is generated on the node and
+	// never leaves it.
 	PublicKey string `json:"publicKey,omitempty"`
 
 	AllowedIPs []string `json:"allowedIPs,omitempty"`
 
 	DNSServers []string `json:"dnsServers,omitempty"`
 
+	// MTU overrides the MTU of the network for this peer.
+	// +kubebuilder:validation:Minimum=576
+	// +kubebuilder:validation:Maximum=9000
+	// +optional
 	MTU int `json:"mtu,omitempty"`
 
 	PeerId string `json:"peerId,omitempty"`
@@ -50,6 +55,20 @@ type WireflowPeerSpec struct {
 
 	NetworkPolicies []string `json:"networkPolicies,omitempty"`
 
+	// ExitNode advertises this peer as an exit node: clients may route all
+	// their internet traffic through it. Only peers allowed by policy to send
+	// it unrestricted egress traffic are offered the exit node.
+	ExitNode bool `json:"exitNode,omitempty"`
+
+	// AdvertisedRoutes are the subnets behind this peer that it offers to
+	// route for the network, e.g. an office LAN. Set by the agent with
+	// --advertise-routes.
+	AdvertisedRoutes []string `json:"advertisedRoutes,omitempty"`
+
+	// ApprovedRoutes are the advertised routes an admin has approved. Only
+	// routes both advertised and approved are distributed to other peers.
+	ApprovedRoutes []string `json:"approvedRoutes,omitempty"`
+
 	// WrrpUrl is the TCP address of the WRRP relay server assigned to this peer.
 	// Populated by the relay settings controller when a relay is bound to the peer's workspace.
 	WrrpUrl string `json:"wrrpUrl,omitempty"`
@@ -92,6 +111,38 @@ type WireflowPeerStatus struct {
 
 	// client applied version
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Routes are the subnet routes this peer currently serves: advertised,
+	// approved and free of overlaps.
+	Routes []string `json:"routes,omitempty"`
+
+	// KeyRotation records the rotation state of the peer's WireGuard key.
+	// +optional
+	KeyRotation *KeyRotationStatus `json:"keyRotation,omitempty"`
+}
+
+// KeyRotationStatus tracks the age of a peer's key and any rotation in flight.
+type KeyRotationStatus struct {
+	// KeyCreatedAt is when the current public key was registered.
+	KeyCreatedAt *metav1.Time `json:"keyCreatedAt,omitempty"`
+
+	// Pending is set by the controller when the key is due for rotation and
+	// cleared once the agent has submitted a new public key.
+	Pending bool `json:"pending,omitempty"`
+
+	// RequestedAt is when the pending rotation was requested.
+	RequestedAt *metav1.Time `json:"requestedAt,omitempty"`
+
+	// PreviousPublicKey is the key replaced by the last rotation. Remote peers
+	// keep accepting it until PreviousKeyExpiresAt.
+	PreviousPublicKey string `json:"previousPublicKey,omitempty"`
+
+	PreviousKeyExpiresAt *metav1.Time `json:"previousKeyExpiresAt,omitempty"`
+
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+
+	// Rotations counts completed rotations.
+	Rotations int `json:"rotations,omitempty"`
 }
 
 type Status string
@@ -130,6 +181,9 @@ const (
 
 	// NodeConditionPolicyApplied 策略是否已应用
 	NodeConditionPolicyApplied = "PolicyApplied"
+
+	// NodeConditionRoutesReady 通告的子网路由是否全部生效
+	NodeConditionRoutesReady = "RoutesReady"
 )
 
 // Condition Reasons
@@ -143,6 +197,9 @@ const (
 	ReasonLeaving          = "Leaving"
 	ReasonAllocationFailed = "AllocationFailed"
 	ReasonConfigFailed     = "ConfigurationFailed"
+	ReasonRoutesPending    = "PendingApproval"
+	ReasonRoutesOverlap    = "Overlap"
+	ReasonRoutesInvalid    = "InvalidRoute"
 )
 
 // +kubebuilder:object:root=true
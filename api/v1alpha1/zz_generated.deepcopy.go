@@ -23,6 +23,22 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectionPolicy) DeepCopyInto(out *ConnectionPolicy) {
+	*out = *in
+	out.IdleTimeout = in.IdleTimeout
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectionPolicy.
+func (in *ConnectionPolicy) DeepCopy() *ConnectionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConnectionSummary) DeepCopyInto(out *ConnectionSummary) {
 	*out = *in
@@ -46,6 +62,13 @@ func (in *DNSConfig) DeepCopyInto(out *DNSConfig) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Forwarders != nil {
+		in, out := &in.Forwarders, &out.Forwarders
+		*out = make([]DNSForwarder, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSConfig.
@@ -58,6 +81,26 @@ func (in *DNSConfig) DeepCopy() *DNSConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSForwarder) DeepCopyInto(out *DNSForwarder) {
+	*out = *in
+	if in.Servers != nil {
+		in, out := &in.Servers, &out.Servers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSForwarder.
+func (in *DNSForwarder) DeepCopy() *DNSForwarder {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSForwarder)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EgressRule) DeepCopyInto(out *EgressRule) {
 	*out = *in
@@ -85,6 +128,26 @@ func (in *EgressRule) DeepCopy() *EgressRule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ICEServer) DeepCopyInto(out *ICEServer) {
+	*out = *in
+	if in.URLs != nil {
+		in, out := &in.URLs, &out.URLs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ICEServer.
+func (in *ICEServer) DeepCopy() *ICEServer {
+	if in == nil {
+		return nil
+	}
+	out := new(ICEServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAllocation) DeepCopyInto(out *IPAllocation) {
 	*out = *in
@@ -143,6 +206,54 @@ func (in *IngressRule) DeepCopy() *IngressRule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeyRotationPolicy) DeepCopyInto(out *KeyRotationPolicy) {
+	*out = *in
+	out.MaxKeyAge = in.MaxKeyAge
+	out.GracePeriod = in.GracePeriod
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeyRotationPolicy.
+func (in *KeyRotationPolicy) DeepCopy() *KeyRotationPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(KeyRotationPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeyRotationStatus) DeepCopyInto(out *KeyRotationStatus) {
+	*out = *in
+	if in.KeyCreatedAt != nil {
+		in, out := &in.KeyCreatedAt, &out.KeyCreatedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.RequestedAt != nil {
+		in, out := &in.RequestedAt, &out.RequestedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.PreviousKeyExpiresAt != nil {
+		in, out := &in.PreviousKeyExpiresAt, &out.PreviousKeyExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRotationTime != nil {
+		in, out := &in.LastRotationTime, &out.LastRotationTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeyRotationStatus.
+func (in *KeyRotationStatus) DeepCopy() *KeyRotationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KeyRotationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkPolicyPort) DeepCopyInto(out *NetworkPolicyPort) {
 	*out = *in
@@ -394,6 +505,84 @@ func (in *WireflowClusterStatus) DeepCopy() *WireflowClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WireflowDNSRecord) DeepCopyInto(out *WireflowDNSRecord) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireflowDNSRecord.
+func (in *WireflowDNSRecord) DeepCopy() *WireflowDNSRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(WireflowDNSRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WireflowDNSRecord) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WireflowDNSRecordList) DeepCopyInto(out *WireflowDNSRecordList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WireflowDNSRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireflowDNSRecordList.
+func (in *WireflowDNSRecordList) DeepCopy() *WireflowDNSRecordList {
+	if in == nil {
+		return nil
+	}
+	out := new(WireflowDNSRecordList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WireflowDNSRecordList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WireflowDNSRecordSpec) DeepCopyInto(out *WireflowDNSRecordSpec) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireflowDNSRecordSpec.
+func (in *WireflowDNSRecordSpec) DeepCopy() *WireflowDNSRecordSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WireflowDNSRecordSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WireflowEndpoint) DeepCopyInto(out *WireflowEndpoint) {
 	*out = *in
@@ -930,6 +1119,23 @@ func (in *WireflowNetworkSpec) DeepCopyInto(out *WireflowNetworkSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.KeyRotation != nil {
+		in, out := &in.KeyRotation, &out.KeyRotation
+		*out = new(KeyRotationPolicy)
+		**out = **in
+	}
+	if in.ICEServers != nil {
+		in, out := &in.ICEServers, &out.ICEServers
+		*out = make([]ICEServer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Connections != nil {
+		in, out := &in.Connections, &out.Connections
+		*out = new(ConnectionPolicy)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireflowNetworkSpec.
@@ -1046,6 +1252,16 @@ func (in *WireflowPeerSpec) DeepCopyInto(out *WireflowPeerSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.AdvertisedRoutes != nil {
+		in, out := &in.AdvertisedRoutes, &out.AdvertisedRoutes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ApprovedRoutes != nil {
+		in, out := &in.ApprovedRoutes, &out.ApprovedRoutes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireflowPeerSpec.
@@ -1088,6 +1304,16 @@ func (in *WireflowPeerStatus) DeepCopyInto(out *WireflowPeerStatus) {
 		in, out := &in.LastSyncTime, &out.LastSyncTime
 		*out = (*in).DeepCopy()
 	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KeyRotation != nil {
+		in, out := &in.KeyRotation, &out.KeyRotation
+		*out = new(KeyRotationStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WireflowPeerStatus.
@@ -28,7 +28,10 @@ func newTurnCmd() *cobra.Command {
 		Use:          "turn",
 		SilenceUsage: true,
 		Short:        "start a turn server",
-		Long:         `Start a TURN server that provides relay transport when direct (P2P) connections are unavailable.`,
+		Long: `Start a TURN server that provides relay transport when direct (P2P) connections are unavailable.
+
+Agents authenticate with short-lived credentials issued by the management
+server; both must share the same turn.secret (WIREFLOW_TURN_SECRET).`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runTurn(cmd.Context())
 		},
@@ -53,5 +56,6 @@ func runTurn(ctx context.Context) error {
 		PublicIP: config.Conf.PublicIP,
 		Port:     config.Conf.Port,
 		Users:    users,
+		Secret:   config.Conf.TURN.Secret,
 	}).Start(ctx)
 }
@@ -0,0 +1,67 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"wireflow/internal/config"
+	"wireflow/node"
+
+	"github.com/spf13/cobra"
+)
+
+func captureCmd() *cobra.Command {
+	var opts node.CaptureOptions
+	cmd := &cobra.Command{
+		Use:   "capture -w <file>",
+		Short: "Capture the decrypted overlay traffic to a pcapng file",
+		Long: `Record the packets crossing the tunnel interface of the running agent, after
+WireGuard decrypted them, to a pcapng file for Wireshark or tcpdump. Every
+packet carries the peer it belongs to in its comment, and its direction. With
+the userspace firewall, packets its policy dropped are recorded too, with
+"dropped by policy" in their comment.
+
+--filter takes a subset of the tcpdump expression language: host, net and
+port with an optional src or dst, the protocols ip, ip6, tcp, udp, icmp and
+icmp6, and "tcp port N" or "udp port N", combined with and, or, not and
+parentheses. --peer keeps the traffic of one peer, by name or app id.
+
+--underlay also records the encrypted WireGuard messages on a second
+interface. Their IP and UDP headers are rebuilt from the peer endpoint, with
+an unspecified local address; relayed peers show their relay placeholder
+address.
+
+Use -w - to write to stdout, e.g. to pipe into wireshark -k -i -.`,
+		Example: `  wireflow capture -w overlay.pcapng
+  wireflow capture --peer office -f "tcp port 5432" -w db.pcapng
+  wireflow capture --underlay -c 100 -w - | tcpdump -r -`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Output == "" {
+				return fmt.Errorf("-w is required")
+			}
+			if opts.Count < 0 {
+				return fmt.Errorf("--count must not be negative")
+			}
+			return node.CapturePackets(config.Conf, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.Peer, "peer", "", "capture only the traffic of this peer")
+	cmd.Flags().StringVarP(&opts.Filter, "filter", "f", "", "tcpdump-like filter expression")
+	cmd.Flags().StringVarP(&opts.Output, "write", "w", "", `pcapng file to write, "-" for stdout`)
+	cmd.Flags().BoolVar(&opts.Underlay, "underlay", false, "also capture the encrypted WireGuard traffic")
+	cmd.Flags().IntVarP(&opts.Count, "count", "c", 0, "stop after this many packets (0: until interrupted)")
+	return cmd
+}
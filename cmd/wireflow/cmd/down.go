@@ -0,0 +1,42 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"wireflow/internal/config"
+	"wireflow/node"
+
+	"github.com/spf13/cobra"
+)
+
+func downCmd() *cobra.Command {
+	var purge bool
+	cmd := &cobra.Command{
+		Use:   "down",
+		Short: "Disconnect this node and remove its network changes",
+		Long: `Stop the running Wireflow node. On the way out the node removes every route,
+address and firewall rule it installed on this host.
+
+Use --purge after a crash or a kill -9: it also reverts the changes recorded by
+an agent that is no longer running.`,
+		Example: `  wireflow down
+  wireflow down --purge`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return node.Down(config.Conf, purge)
+		},
+	}
+	cmd.Flags().BoolVar(&purge, "purge", false, "also revert changes left behind by an agent that is no longer running")
+	return cmd
+}
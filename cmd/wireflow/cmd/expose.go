@@ -0,0 +1,76 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"wireflow/internal/config"
+	"wireflow/internal/localapi"
+	"wireflow/node"
+
+	"github.com/spf13/cobra"
+)
+
+func exposeCmd() *cobra.Command {
+	var (
+		name       string
+		listenPort int
+		remove     string
+		jsonOut    bool
+	)
+	cmd := &cobra.Command{
+		Use:   "expose [tcp:<port>]",
+		Short: "Publish a local service on the overlay address of this node",
+		Long: `Ask the running agent to accept connections on a port of its overlay address
+and relay them to a service on localhost, so peers can reach a service that
+only listens on 127.0.0.1 without routing a subnet.
+
+The port sits behind the overlay interface like any other: the network's
+FirewallRule decides which peers may connect, and the listing shows the
+sources the current policy admits. A network without a policy admits every
+peer: on a kernel interface nothing filters the port then, and every overlay
+peer can connect. Services last until removed with --remove or until the
+agent stops.
+
+Without arguments the exposed services are listed.`,
+		Example: `  wireflow expose tcp:5432 --as db
+  wireflow expose tcp:8080 --as web --port 80
+  wireflow expose
+  wireflow expose --remove db`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if remove != "" {
+				return node.RemoveService(config.Conf, remove, false)
+			}
+			if len(args) == 0 {
+				return node.ExposeService(config.Conf, nil, jsonOut)
+			}
+			protocol, port, err := node.ParseExposeSpec(args[0])
+			if err != nil {
+				return err
+			}
+			return node.ExposeService(config.Conf, &localapi.ExposeRequest{
+				Name:       name,
+				Protocol:   protocol,
+				Port:       port,
+				ListenPort: listenPort,
+			}, jsonOut)
+		},
+	}
+	cmd.Flags().StringVar(&name, "as", "", "name of the service (default <protocol>-<port>)")
+	cmd.Flags().IntVar(&listenPort, "port", 0, "overlay port peers connect to (default the local port)")
+	cmd.Flags().StringVar(&remove, "remove", "", "stop exposing the service with this name")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print the services as JSON")
+	return cmd
+}
@@ -0,0 +1,69 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"wireflow/internal/config"
+	"wireflow/internal/localapi"
+	"wireflow/node"
+
+	"github.com/spf13/cobra"
+)
+
+func forwardCmd() *cobra.Command {
+	var (
+		remove  string
+		jsonOut bool
+	)
+	cmd := &cobra.Command{
+		Use:   "forward [<peer>:<port> [<listen-address>]]",
+		Short: "Forward a local port to a port of a peer",
+		Long: `Ask the running agent to accept connections on a local address and relay them
+through the tunnel to a port on a peer, by name or app id. Host routing is not
+touched, and the network's FirewallRule applies to the relayed connections as
+to any other traffic of this node.
+
+The local address is host:port, or a bare port on 127.0.0.1, and defaults to
+the peer's port on 127.0.0.1. Forwards last until removed with --remove or
+until the agent stops.
+
+Without arguments the active forwards are listed.`,
+		Example: `  wireflow forward office:8080 localhost:18080
+  wireflow forward lab:5432 15432
+  wireflow forward
+  wireflow forward --remove localhost:18080`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if remove != "" {
+				return node.RemoveService(config.Conf, remove, true)
+			}
+			if len(args) == 0 {
+				return node.ForwardPort(config.Conf, nil, jsonOut)
+			}
+			peer, port, err := node.ParseForwardSpec(args[0])
+			if err != nil {
+				return err
+			}
+			req := &localapi.ForwardRequest{Peer: peer, Port: port}
+			if len(args) == 2 {
+				req.Listen = args[1]
+			}
+			return node.ForwardPort(config.Conf, req, jsonOut)
+		},
+	}
+	cmd.Flags().StringVar(&remove, "remove", "", "stop the forward on this local address")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print the forwards as JSON")
+	return cmd
+}
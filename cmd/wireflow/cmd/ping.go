@@ -0,0 +1,65 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"wireflow/internal/config"
+	"wireflow/internal/localapi"
+	"wireflow/node"
+
+	"github.com/spf13/cobra"
+)
+
+func pingCmd() *cobra.Command {
+	var opts node.PingOptions
+	cmd := &cobra.Command{
+		Use:   "ping <peer>",
+		Short: "Probe a peer through the overlay and show the path in use",
+		Long: `Send ICMP echo requests to the overlay address of a peer, by name or app id,
+through the running agent, and report the path the traffic takes: the active
+transport (ICE for a direct path, TURN for ICE through the TURN relay, WRRP
+for the WRRP relay), the ICE candidate pair,
+the age of the last WireGuard handshake and the round-trip time of each probe.
+
+--path sends the probes over ICE, TURN or WRRP even when another one is active,
+to compare them. The peer's WireGuard endpoint is switched for the duration of
+the ping and restored afterwards; replies return along the path the remote
+peer uses, so only the outbound leg is forced.
+
+The remote firewall policy must allow ICMP from this node for replies to come
+back.`,
+		Example: `  wireflow ping office
+  wireflow ping office -c 10 --path wrrp
+  wireflow ping office --json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch strings.ToUpper(opts.Path) {
+			case "", "ICE", "TURN", "WRRP":
+			default:
+				return fmt.Errorf("--path must be ice, turn or wrrp, got %q", opts.Path)
+			}
+			if opts.Count < 1 || opts.Count > localapi.MaxPingCount {
+				return fmt.Errorf("--count must be between 1 and %d", localapi.MaxPingCount)
+			}
+			return node.PingPeer(config.Conf, args[0], opts)
+		},
+	}
+	cmd.Flags().IntVarP(&opts.Count, "count", "c", localapi.DefaultPingCount, "number of probes to send")
+	cmd.Flags().StringVar(&opts.Path, "path", "", "force the probes over ice, turn or wrrp")
+	cmd.Flags().BoolVar(&opts.JSON, "json", false, "print the result as JSON")
+	return cmd
+}
@@ -75,11 +75,17 @@ func init() {
 	fs.StringP("config-dir", "", "", "config directory (default: ~/.wireflow)")
 	fs.StringP("server-url", "", "", "management server URL")
 	fs.StringP("signaling-url", "", "", "signaling server URL")
+	fs.StringP("interface-name", "", "", "WireGuard interface of the agent; selects the network to talk to when several are joined")
 	fs.BoolP("version", "", false, "print version information")
 	fs.BoolP("save", "", false, "persist flags to config file")
 
 	rootCmd.AddCommand(upCmd())
+	rootCmd.AddCommand(downCmd())
 	rootCmd.AddCommand(statusCmd())
+	rootCmd.AddCommand(pingCmd())
+	rootCmd.AddCommand(exposeCmd())
+	rootCmd.AddCommand(forwardCmd())
+	rootCmd.AddCommand(captureCmd())
 	rootCmd.AddCommand(token.NewTokenCommand())
 	rootCmd.AddCommand(workspace.NewWorkspaceCommand())
 	rootCmd.AddCommand(policy.NewPolicyCommand())
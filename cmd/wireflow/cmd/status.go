@@ -22,32 +22,45 @@ import (
 )
 
 func statusCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts node.StatusOptions
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show the current node status and connected peers",
 		Long: `Display the WireGuard interface information and the status of all peers.
 
-A peer is considered connected if a WireGuard handshake was completed within
-the last 3 minutes. Traffic counters show bytes sent (↑) and received (↓)
-since the interface was last started.
+The status is read from the local API of the running agent, which reports the
+probe state and transport (ICE or WRRP) of every peer. A peer is connected once
+its probe succeeded. Traffic counters show bytes sent (↑) and received (↓)
+since the interface was last started. Agents without the local API are reported
+from the WireGuard device, where a peer counts as connected if a handshake was
+completed within the last 3 minutes.
+
+Use --json for machine-readable output and --watch to refresh every 2 seconds
+until interrupted; together they print one JSON object per line.
 
 Example output:
 
   Interface : wg0
-  Address   : 10.100.0.1/24
+  Name      : laptop
+  Address   : 10.100.0.1
   Public Key: abc123...=
   Port      : 51820
+  Network   : default (config 42)
+  Firewall  : nftables
 
   Peers: 2 total, 1 connected
 
-    Peer      : xyz456...=
-    Address   : 10.100.0.2/32
+    Peer      : server (4f1c...)
+    Address   : 10.100.0.2
     Endpoint  : 203.0.113.1:51820
     Handshake : 12 seconds ago
     Traffic   : ↑ 1.2 MB  ↓ 3.4 MB
-    Status    : connected`,
+    Status    : connected via ICE`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return node.Status(config.Conf)
+			return node.Status(config.Conf, opts)
 		},
 	}
+	cmd.Flags().BoolVar(&opts.JSON, "json", false, "print the status as JSON")
+	cmd.Flags().BoolVarP(&opts.Watch, "watch", "w", false, "refresh the status until interrupted")
+	return cmd
 }
@@ -48,7 +48,16 @@ Use --save to persist the current flags back to the config file.`,
   wireflow up --token <token> --server-url <server-url> --signaling-url <signaling-url> --save
 
   # enable the WRRP relay for restrictive NAT environments
-  wireflow up --token <token> --server-url <server-url> --signaling-url <signaling-url> --enable-wrrp --wrrper-url <wrrp-url>`,
+  wireflow up --token <token> --server-url <server-url> --signaling-url <signaling-url> --enable-wrrp --wrrper-url <wrrp-url>
+
+  # route the office LAN for the workspace (approve it in spec.approvedRoutes)
+  wireflow up --token <token> --server-url <server-url> --signaling-url <signaling-url> --advertise-routes 192.168.1.0/24
+
+  # join a second network on its own interface (wf1) and port (51821)
+  wireflow up --token <prod-token> --join staging=<staging-token> --server-url <server-url> --signaling-url <signaling-url>
+
+  # run without root: reach peers through the SOCKS5 proxy, expose local port 8080 to them
+  wireflow up --token <token> --server-url <server-url> --signaling-url <signaling-url> --netstack --netstack-forward 8080`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 
 			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -97,6 +106,14 @@ Use --save to persist the current flags back to the config file.`,
 			if em, _ := cmd.Flags().GetBool("enable-metric"); em {
 				config.Conf.EnableMetric = em
 			}
+			joins, _ := cmd.Flags().GetStringArray("join")
+			for _, join := range joins {
+				network, err := node.ParseNetworkFlag(join)
+				if err != nil {
+					return err
+				}
+				config.Conf.Networks = append(config.Conf.Networks, network)
+			}
 
 			return node.Start(ctx, config.Conf)
 		},
@@ -108,9 +125,20 @@ Use --save to persist the current flags back to the config file.`,
 	fs.StringP("wrrper-url", "", "", "WRRP relay server URL (required when --enable-wrrp)")
 	fs.StringP("wrrp-quic-url", "", "", "QUIC WRRP relay server address (e.g. server:6267)")
 	fs.BoolP("enable-wrrp", "", false, "use WRRP relay for NAT traversal")
+	fs.StringP("stun-url", "", "", "STUN/TURN servers for NAT traversal, comma separated (e.g. stun:host:3478,turn:host:3478); the network can override them")
 	fs.StringP("vm-endpoint", "", "", "use to push tele")
 	fs.BoolP("enable-metric", "", false, "expose Prometheus metrics endpoint")
 	fs.BoolP("enable-sys-log", "", false, "enable verbose WireGuard and ICE debug logging")
 	fs.IntP("wg-port", "", 51820, "UDP port for WireGuard and ICE (default 51820)")
+	fs.StringP("firewall", "", "auto", "policy enforcement backend: auto (host firewall) or userspace (in the TUN path)")
+	fs.StringP("exit-node", "", "", "route all internet traffic through this peer (name or app id); it must advertise itself as exit node")
+	fs.StringSliceP("advertise-routes", "", nil, "subnets behind this node to route for the network, e.g. 192.168.1.0/24; each must be approved by an admin")
+	fs.BoolP("pmtu-discovery", "", false, "probe the path MTU to each peer and lower the interface MTU when a path drops full-size packets")
+	fs.StringArrayP("join", "", nil, "also join another network as name=token, with its own interface, port and firewall rules; repeatable")
+	fs.BoolP("enable-dns", "", false, "resolve peers as <peer>.<network>.<domain> on the overlay address and route that domain to it (split DNS on Linux)")
+	fs.BoolP("netstack", "", false, "run the overlay on a userspace TCP/IP stack instead of a TUN interface; needs no root privileges")
+	fs.StringP("socks5-listen", "", "127.0.0.1:1080", "SOCKS5 proxy address into the overlay in netstack mode; empty disables it")
+	fs.StringP("http-proxy-listen", "", "127.0.0.1:3128", "HTTP proxy address into the overlay in netstack mode; empty disables it")
+	fs.StringArrayP("netstack-forward", "", nil, "forward an overlay TCP port to a local service in netstack mode, as port or port=host:port; repeatable")
 	return cmd
 }
@@ -0,0 +1,182 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"wireflow/internal/infra"
+)
+
+// mutationResolvConf is reverted by withdrawing the nameserver of the
+// interface Args[0] from /etc/resolv.conf.
+const mutationResolvConf = "resolv-conf"
+
+func init() {
+	infra.RegisterMutationKind(mutationResolvConf, func(args []string) error {
+		if len(args) != 1 {
+			return nil
+		}
+		return hostResolvConf.remove(args[0])
+	})
+}
+
+// resolvConfFiles is a resolv.conf shared by the overlay DNS of every
+// network on the host. Each network registers its nameserver in a file of
+// its own under servers, and conf is rebuilt from the registered nameservers
+// followed by the backup, the file as it was before the first network
+// changed it. Networks can thus come and go in any order: the backup is
+// restored once the last one is gone.
+type resolvConfFiles struct {
+	conf, backup, servers string
+}
+
+var (
+	hostResolvConf = resolvConfFiles{
+		conf:    ResolvConf,
+		backup:  OriginalResolvConf,
+		servers: ResolvConf + ".wireflow.d",
+	}
+	// resolvConfMu serializes the networks of one agent; the files are
+	// not shared with other agents.
+	resolvConfMu sync.Mutex
+)
+
+// add points conf at server for iface.
+func (f resolvConfFiles) add(iface string, server netip.Addr) error {
+	resolvConfMu.Lock()
+	defer resolvConfMu.Unlock()
+	if _, err := os.Stat(f.backup); errors.Is(err, os.ErrNotExist) {
+		original, err := os.ReadFile(f.conf)
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(f.backup, original, 0o644); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.servers, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(f.servers, iface), []byte(server.String()+"\n"), 0o644); err != nil {
+		return err
+	}
+	return f.rewrite()
+}
+
+// remove withdraws the nameserver of iface from conf.
+func (f resolvConfFiles) remove(iface string) error {
+	resolvConfMu.Lock()
+	defer resolvConfMu.Unlock()
+	if err := os.Remove(filepath.Join(f.servers, iface)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if _, err := os.Stat(f.backup); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return f.rewrite()
+}
+
+// rewrite builds conf from the registered nameservers and the backup, or
+// restores the backup when none is left.
+func (f resolvConfFiles) rewrite() error {
+	original, err := os.ReadFile(f.backup)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(f.servers)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var servers []string
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(f.servers, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if server := strings.TrimSpace(string(data)); server != "" && !slices.Contains(servers, server) {
+			servers = append(servers, server)
+		}
+	}
+
+	if len(servers) == 0 {
+		if err = os.WriteFile(f.conf, original, 0o644); err != nil {
+			return err
+		}
+		if err = os.Remove(f.servers); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return os.Remove(f.backup)
+	}
+	var conf bytes.Buffer
+	fmt.Fprintf(&conf, "# Generated by wireflow; the original is restored when the agent stops.\n")
+	for _, server := range servers {
+		fmt.Fprintf(&conf, "nameserver %s\n", server)
+	}
+	conf.Write(original)
+	return os.WriteFile(f.conf, conf.Bytes(), 0o644)
+}
+
+// ConfigureSplitDNS sends the queries for domains to server, the overlay DNS
+// listening on iface, and returns the Mutation that reverts it, already
+// recorded in journal.
+//
+// With systemd-resolved the domains are routed to the link, so only their
+// names reach server. Otherwise server is added in front of the nameservers
+// of /etc/resolv.conf and forwards the rest to the original ones.
+func ConfigureSplitDNS(journal *infra.Journal, iface string, server netip.Addr, domains []string) (infra.Mutation, error) {
+	if usesResolved() {
+		m := infra.CommandMutation("resolvectl", "revert", iface)
+		journal.Record(m)
+		if err := resolvectl("dns", iface, server.String()); err != nil {
+			return m, err
+		}
+		args := []string{"domain", iface}
+		for _, domain := range domains {
+			args = append(args, "~"+domain)
+		}
+		return m, resolvectl(args...)
+	}
+
+	m := infra.Mutation{Kind: mutationResolvConf, Args: []string{iface}}
+	journal.Record(m)
+	return m, hostResolvConf.add(iface, server)
+}
+
+// usesResolved reports whether systemd-resolved manages the DNS of the host.
+func usesResolved() bool {
+	if _, err := exec.LookPath("resolvectl"); err != nil {
+		return false
+	}
+	_, err := os.Stat("/run/systemd/resolve/resolv.conf")
+	return err == nil
+}
+
+func resolvectl(args ...string) error {
+	if out, err := exec.Command("resolvectl", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("resolvectl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
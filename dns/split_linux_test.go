@@ -0,0 +1,89 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolvConfFiles(t *testing.T) {
+	dir := t.TempDir()
+	f := resolvConfFiles{
+		conf:    filepath.Join(dir, "resolv.conf"),
+		backup:  filepath.Join(dir, "resolv.conf.wireflow"),
+		servers: filepath.Join(dir, "resolv.conf.wireflow.d"),
+	}
+	original := "search example.com\nnameserver 192.168.1.1\n"
+	if err := os.WriteFile(f.conf, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	nameservers := func() []string {
+		data, err := os.ReadFile(f.conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var servers []string
+		for _, line := range strings.Split(string(data), "\n") {
+			if server, ok := strings.CutPrefix(line, "nameserver "); ok {
+				servers = append(servers, server)
+			}
+		}
+		return servers
+	}
+
+	if err := f.add("wf0", netip.MustParseAddr("10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.add("wf1", netip.MustParseAddr("10.1.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(nameservers(), " "); got != "10.0.0.1 10.1.0.1 192.168.1.1" {
+		t.Fatalf("nameservers %s", got)
+	}
+
+	// The first network leaves; the second keeps its nameserver and the
+	// original ones.
+	if err := f.remove("wf0"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(nameservers(), " "); got != "10.1.0.1 192.168.1.1" {
+		t.Fatalf("nameservers after the first network left: %s", got)
+	}
+
+	if err := f.remove("wf1"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(f.conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Fatalf("resolv.conf not restored:\n%s", data)
+	}
+	for _, path := range []string{f.backup, f.servers} {
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s left behind", path)
+		}
+	}
+
+	// Reverting again, as a journal replayed after a crash would, is a no-op.
+	if err = f.remove("wf1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"runtime"
+	"wireflow/internal/infra"
+)
+
+// ConfigureSplitDNS is only implemented on Linux; elsewhere the overlay DNS
+// must be added to the resolvers of the host by hand.
+func ConfigureSplitDNS(journal *infra.Journal, iface string, server netip.Addr, domains []string) (infra.Mutation, error) {
+	return infra.Mutation{}, fmt.Errorf("split DNS is not supported on %s", runtime.GOOS)
+}
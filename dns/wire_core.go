@@ -14,12 +14,8 @@
 
 package dns
 
-import (
-	"bytes"
-	"encoding/json"
-	"net/http"
-)
-
+// Record is a DNS record in zone file terms; Data is the data of one
+// record, e.g. "10 5 5432 db" for an SRV record.
 type Record struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
@@ -27,45 +23,9 @@ type Record struct {
 	Data string `json:"data"`
 }
 
-// DnsClient root dns using coredns, client will add/remove a record to coredns.
+// DnsClient manages the records of a zone. Zone implements it for the
+// overlay DNS served by the agent.
 type DnsClient interface {
 	AddRecord(record Record) error
 	RemoveRecord(record Record) error
 }
-
-type client struct {
-	httpClient http.Client
-}
-
-func NewDnsClient() DnsClient {
-	return &client{
-		httpClient: http.Client{},
-	}
-}
-
-func (c *client) AddRecord(record Record) error {
-	var (
-		err  error
-		bs   []byte
-		resp *http.Response
-	)
-	bs, err = json.Marshal(record)
-	if err != nil {
-		return err
-	}
-	resp, err = c.httpClient.Post(
-		"http://linkany.io:9001/api/v1/zones/example.com",
-		"Content-Type: application/json",
-		bytes.NewReader(bs),
-	)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close() //nolint:errcheck
-
-	return nil
-}
-
-func (c *client) RemoveRecord(record Record) error {
-	return nil
-}
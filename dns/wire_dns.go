@@ -15,140 +15,285 @@
 package dns
 
 import (
-	"fmt"
-	"log"
+	"errors"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wireflow/internal/log"
 
 	"github.com/miekg/dns"
 )
 
+// ResolvConf is the resolver configuration of the host.
+const ResolvConf = "/etc/resolv.conf"
+
+// OriginalResolvConf keeps ResolvConf as it was before the overlay DNS was
+// added to it, while it is.
+const OriginalResolvConf = ResolvConf + ".wireflow"
+
+const forwardTimeout = 5 * time.Second
+
+// LinkDNS is the DNS server of the agent. It answers the names of the
+// overlay zone and forwards the domains with a forwarder for everyone. Other
+// queries go to the upstream resolvers only when they come from this host:
+// the server listens on the overlay, and must not resolve the internet for
+// every peer there.
 type LinkDNS struct {
-	listenAddr  string
-	upstreamDNS string
+	logger     *log.Logger
+	listenAddr string
+	// listenIP is the address of listenAddr, invalid when unspecified.
+	listenIP netip.Addr
+
+	zone       atomic.Pointer[Zone]
+	upstreams  atomic.Pointer[[]string]
+	forwarders atomic.Pointer[[]forwarder]
+
+	mu      sync.Mutex
+	servers []*dns.Server
 }
 
 type DNSConfig struct {
-	Records       map[string]string `json:"records"`
-	UpstreamDNS   string            `json:"upstream_dns"`
-	ListenAddress string            `json:"listen_address"`
+	// ListenAddress is the host:port the server listens on, over UDP and
+	// TCP; :53 when empty.
+	ListenAddress string
+	// Upstreams are the resolvers queries outside the zone are forwarded
+	// to. They can be replaced later with SetUpstreams.
+	Upstreams []string
+	Logger    *log.Logger
 }
 
 func NewNativeDNS(cfg *DNSConfig) *LinkDNS {
 	if cfg.ListenAddress == "" {
 		cfg.ListenAddress = ":53"
 	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.GetLogger("dns")
+	}
 
-	if cfg.UpstreamDNS == "" {
-		cfg.UpstreamDNS = "81.68.109.143:53"
+	l := &LinkDNS{
+		logger:     cfg.Logger,
+		listenAddr: cfg.ListenAddress,
+	}
+	if addr, err := netip.ParseAddrPort(cfg.ListenAddress); err == nil && !addr.Addr().IsUnspecified() {
+		l.listenIP = addr.Addr().Unmap()
 	}
+	l.SetUpstreams(cfg.Upstreams)
+	return l
+}
+
+// SetZone replaces the overlay zone; nil answers nothing locally.
+func (l *LinkDNS) SetZone(zone *Zone) {
+	l.zone.Store(zone)
+}
 
-	return &LinkDNS{
-		listenAddr:  cfg.ListenAddress,
-		upstreamDNS: cfg.UpstreamDNS,
+// forwarder sends the queries for suffix, a fully qualified domain, and its
+// subdomains to upstreams.
+type forwarder struct {
+	suffix    string
+	upstreams []string
+}
+
+// SetUpstreams replaces the resolvers queries are forwarded to. Servers
+// given without a port use 53; the address of the server itself is
+// skipped so queries never loop.
+func (l *LinkDNS) SetUpstreams(servers []string) {
+	upstreams := l.normalize(servers)
+	l.upstreams.Store(&upstreams)
+}
+
+// SetForwarders replaces the per-domain resolvers, keyed by domain. They
+// take precedence over the upstreams, the most specific domain first.
+func (l *LinkDNS) SetForwarders(forwarders map[string][]string) {
+	list := make([]forwarder, 0, len(forwarders))
+	for domain, servers := range forwarders {
+		list = append(list, forwarder{
+			suffix:    dns.Fqdn(strings.ToLower(domain)),
+			upstreams: l.normalize(servers),
+		})
 	}
+	sort.Slice(list, func(i, j int) bool { return len(list[i].suffix) > len(list[j].suffix) })
+	l.forwarders.Store(&list)
 }
 
-//func loadConfig(filename string) error {
-//	configLock.Lock()
-//	defer configLock.Unlock()
-//
-//	data, err := ioutil.ReadFile(filename)
-//	if err != nil {
-//		return err
-//	}
-//
-//	return json.Unmarshal(data, &config)
-//}
+func (l *LinkDNS) normalize(servers []string) []string {
+	upstreams := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		if server == l.listenAddr {
+			continue
+		}
+		upstreams = append(upstreams, server)
+	}
+	return upstreams
+}
 
-func (l *LinkDNS) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
-	m := new(dns.Msg)
-	m.SetReply(r)
-	m.Authoritative = true
-
-	for _, q := range r.Question {
-		switch q.Qtype {
-		case dns.TypeA:
-			log.Printf("查询域名: %s", q.Name)
-
-			// 使用读锁读取配置
-			//configLock.RLock()
-			//ip, exists := config.Records[q.Name]
-			//upstream := config.UpstreamDNS
-			//configLock.RUnlock()
-
-			//if exists {
-			//	rr, err := dns.NewRR(fmt.Sprintf("%s A %s", q.Name, ip))
-			//	if err == nil {
-			//		m.Answer = append(m.Answer, rr)
-			//		log.Printf("本地解析 %s -> %s", q.Name, ip)
-			//	}
-			//} else if l.upstreamDNS != "" {
-			// 转发到上游服务器
-			upstreamMsg := new(dns.Msg)
-			upstreamMsg.SetQuestion(q.Name, q.Qtype)
-			upstreamMsg.RecursionDesired = true
-
-			c := new(dns.Client)
-			response, _, err := c.Exchange(upstreamMsg, l.upstreamDNS)
-
-			if err == nil && response != nil {
-				m.Answer = append(m.Answer, response.Answer...)
-				log.Printf("从上游服务器解析: %s", q.Name)
-			} else {
-				log.Printf("上游 DNS 查询失败: %v", err)
+// upstreamsFor returns the resolvers of name, and whether they are those of
+// a forwarded domain rather than the general upstreams.
+func (l *LinkDNS) upstreamsFor(name string) ([]string, bool) {
+	name = strings.ToLower(name)
+	if forwarders := l.forwarders.Load(); forwarders != nil {
+		for _, f := range *forwarders {
+			if name == f.suffix || strings.HasSuffix(name, "."+f.suffix) {
+				return f.upstreams, true
 			}
-			//	}
 		}
 	}
+	return *l.upstreams.Load(), false
+}
+
+// fromHost reports whether a query sent from addr comes from this host:
+// over loopback, or from the address the server listens on, which is the
+// source the host picks to reach it.
+func (l *LinkDNS) fromHost(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	}
+	src, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	src = src.Unmap()
+	return src.IsLoopback() || src == l.listenIP
+}
 
-	err := w.WriteMsg(m)
+// SystemResolvers returns the nameservers of the host, read from
+// /etc/resolv.conf; nil where there is none. While the overlay DNS of a
+// network is listed there, the original file is read instead, so that no
+// network forwards to the overlay DNS of another.
+func SystemResolvers() []string {
+	conf, err := dns.ClientConfigFromFile(OriginalResolvConf)
+	if err != nil {
+		conf, err = dns.ClientConfigFromFile(ResolvConf)
+	}
 	if err != nil {
-		fmt.Println(err)
+		return nil
+	}
+	servers := make([]string, 0, len(conf.Servers))
+	for _, server := range conf.Servers {
+		servers = append(servers, net.JoinHostPort(server, conf.Port))
 	}
+	return servers
 }
 
-func startServer(net, addr string) {
-	server := &dns.Server{Addr: addr, Net: net}
-	log.Printf("启动 DNS 服务器在 %s (%s)", addr, net)
+func (l *LinkDNS) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) != 1 {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeFormatError)
+		l.write(w, m)
+		return
+	}
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("无法启动 %s 服务器: %s", net, err.Error())
+	if zone := l.zone.Load(); zone != nil {
+		if rrs, rcode, chase, ok := zone.answer(r.Question[0]); ok {
+			m := new(dns.Msg)
+			m.SetRcode(r, rcode)
+			m.Authoritative = true
+			m.RecursionAvailable = true
+			m.Answer = rrs
+			if chase != "" {
+				// The CNAME chain leaves the zone; complete it upstream as
+				// stub resolvers do not follow it themselves.
+				q := new(dns.Msg)
+				q.SetQuestion(chase, r.Question[0].Qtype)
+				if resp := l.forward(w, q); resp.Rcode == dns.RcodeSuccess {
+					m.Answer = append(m.Answer, resp.Answer...)
+				}
+			}
+			l.write(w, m)
+			return
+		}
 	}
+	if _, forwarded := l.upstreamsFor(r.Question[0].Name); !forwarded && !l.fromHost(w.RemoteAddr()) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		l.write(w, m)
+		return
+	}
+	l.write(w, l.forward(w, r))
 }
 
-// nolint:all
-func watchConfigFile(filename string) {
-	// 这里可以添加代码来监视配置文件变化
-	// 为简单起见，这里省略了该功能
+// forward relays r to the resolvers of its name in turn, over the transport
+// it came in on, and returns the first response.
+func (l *LinkDNS) forward(w dns.ResponseWriter, r *dns.Msg) *dns.Msg {
+	client := &dns.Client{Net: "udp", Timeout: forwardTimeout}
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		client.Net = "tcp"
+	}
+	upstreams, _ := l.upstreamsFor(r.Question[0].Name)
+	for _, upstream := range upstreams {
+		resp, _, err := client.Exchange(r, upstream)
+		if err != nil {
+			l.logger.Debug("upstream DNS query failed", "upstream", upstream, "name", r.Question[0].Name, "err", err)
+			continue
+		}
+		resp.Id = r.Id
+		return resp
+	}
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeServerFailure)
+	return m
 }
 
+func (l *LinkDNS) write(w dns.ResponseWriter, m *dns.Msg) {
+	if err := w.WriteMsg(m); err != nil {
+		l.logger.Debug("failed to write DNS response", "err", err)
+	}
+}
+
+// Start listens on the configured address over UDP and TCP and serves in
+// the background. Binding errors are returned.
 func (l *LinkDNS) Start() error {
-	//if len(os.Args) < 2 {
-	//	log.Fatalf("用法: %s config.json", os.Args[0])
-	//}
-	//
-	//configFile := os.Args[1]
-	//if err := loadConfig(configFile); err != nil {
-	//	log.Fatalf("加载配置失败: %v", err)
-	//}
-	//
-	//go watchConfigFile(configFile)
-
-	dns.HandleFunc(".", l.handleDNSRequest)
-
-	// 默认监听地址
-	//listenAddr := ":53"
-	//if config.ListenAddress != "" {
-	//	listenAddr = config.ListenAddress
-	//}
-
-	// 启动服务器
-	go startServer("udp", l.listenAddr)
-	go startServer("tcp", l.listenAddr)
+	pc, err := net.ListenPacket("udp", l.listenAddr)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", l.listenAddr)
+	if err != nil {
+		_ = pc.Close()
+		return err
+	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.servers = []*dns.Server{
+		{PacketConn: pc, Handler: l},
+		{Listener: ln, Handler: l},
+	}
+	// Shutdown only works on a server that runs, so Start returns once both
+	// do.
+	var started sync.WaitGroup
+	for _, server := range l.servers {
+		started.Add(1)
+		server.NotifyStartedFunc = started.Done
+		go func(server *dns.Server) {
+			if err := server.ActivateAndServe(); err != nil && !errors.Is(err, net.ErrClosed) {
+				l.logger.Warn("DNS server stopped", "addr", l.listenAddr, "err", err)
+			}
+		}(server)
+	}
+	started.Wait()
+	l.logger.Debug("DNS server listening", "addr", l.listenAddr)
 	return nil
-	//// 等待退出信号
-	//sig := make(chan os.Signal, 1)
-	//signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	//<-sig
-	//log.Println("DNS 服务器关闭")
+}
+
+// Stop closes the listeners of the server.
+func (l *LinkDNS) Stop() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var errs []error
+	for _, server := range l.servers {
+		errs = append(errs, server.Shutdown())
+	}
+	l.servers = nil
+	return errors.Join(errs...)
 }
@@ -0,0 +1,193 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// recorder is a dns.ResponseWriter keeping the response. Queries come from
+// loopback unless remote is set.
+type recorder struct {
+	dns.ResponseWriter
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func (r *recorder) RemoteAddr() net.Addr {
+	if r.remote != nil {
+		return r.remote
+	}
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}
+}
+
+func (r *recorder) WriteMsg(m *dns.Msg) error { r.msg = m; return nil }
+
+func query(t *testing.T, l *LinkDNS, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+	return queryFrom(t, l, nil, name, qtype)
+}
+
+func queryFrom(t *testing.T, l *LinkDNS, remote net.Addr, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	w := &recorder{remote: remote}
+	l.ServeDNS(w, req)
+	if w.msg == nil {
+		t.Fatalf("no response to %s", name)
+	}
+	return w.msg
+}
+
+// startUpstream runs a resolver answering every A query with addr.
+func startUpstream(t *testing.T, addr string) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A " + addr)
+		m.Answer = append(m.Answer, rr)
+		_ = w.WriteMsg(m)
+	})}
+	started := make(chan struct{})
+	upstream.NotifyStartedFunc = func() { close(started) }
+	go func() { _ = upstream.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = upstream.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func TestLinkDNS(t *testing.T) {
+	l := NewNativeDNS(&DNSConfig{ListenAddress: "127.0.0.1:53", Upstreams: []string{startUpstream(t, "192.0.2.1")}})
+	zone := NewZone("office.wireflow.internal")
+	zone.Add("laptop", netip.MustParseAddr("10.0.0.2"))
+	zone.Add("Server", netip.MustParseAddr("10.0.0.3"))
+	l.SetZone(zone)
+
+	m := query(t, l, "Laptop.office.wireflow.internal.", dns.TypeA)
+	if !m.Authoritative || len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "10.0.0.2" {
+		t.Fatalf("unexpected answer for laptop: %v", m)
+	}
+	if m = query(t, l, "laptop.office.wireflow.internal.", dns.TypeAAAA); m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 {
+		t.Fatalf("AAAA of an IPv4 peer must be empty: %v", m)
+	}
+	if m = query(t, l, "printer.office.wireflow.internal.", dns.TypeA); m.Rcode != dns.RcodeNameError {
+		t.Fatalf("unknown peer must be NXDOMAIN: %v", m)
+	}
+	m = query(t, l, "3.0.0.10.in-addr.arpa.", dns.TypePTR)
+	if len(m.Answer) != 1 || m.Answer[0].(*dns.PTR).Ptr != "server.office.wireflow.internal." {
+		t.Fatalf("unexpected PTR answer: %v", m)
+	}
+
+	m = query(t, l, "example.com.", dns.TypeA)
+	if len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.0.2.1" {
+		t.Fatalf("names outside the zone must be forwarded: %v", m)
+	}
+
+	l.SetUpstreams(nil)
+	if m = query(t, l, "example.com.", dns.TypeA); m.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("without upstreams forwarding must fail: %v", m)
+	}
+}
+
+func TestLinkDNSRecords(t *testing.T) {
+	l := NewNativeDNS(&DNSConfig{ListenAddress: "127.0.0.1:53", Upstreams: []string{startUpstream(t, "192.0.2.1")}})
+	l.SetForwarders(map[string][]string{"corp.internal": {startUpstream(t, "192.168.1.1")}})
+
+	zone := NewZone("office.wireflow.internal")
+	zone.Add("db", netip.MustParseAddr("10.0.0.5"))
+	for _, r := range []Record{
+		{Name: "wiki", Type: "CNAME", Data: "db"},
+		{Name: "mirror", Type: "cname", Data: "example.com."},
+		{Name: "_pg._tcp", Type: "SRV", TTL: 300, Data: "10 5 5432 db"},
+		{Name: "info", Type: "TXT", Data: "v=spf1 include:corp.example -all"},
+		{Name: "git.corp.internal.", Type: "A", Data: "10.0.0.9"},
+	} {
+		if err := zone.AddRecord(r); err != nil {
+			t.Fatalf("AddRecord(%+v): %v", r, err)
+		}
+	}
+	if err := zone.AddRecord(Record{Name: "mx", Type: "MX", Data: "10 mail"}); err == nil {
+		t.Fatal("unsupported record types must be refused")
+	}
+	l.SetZone(zone)
+
+	m := query(t, l, "wiki.office.wireflow.internal.", dns.TypeA)
+	if len(m.Answer) != 2 || m.Answer[1].(*dns.A).A.String() != "10.0.0.5" || m.Answer[1].Header().Name != "db.office.wireflow.internal." {
+		t.Fatalf("CNAME inside the zone must be followed: %v", m)
+	}
+	m = query(t, l, "mirror.office.wireflow.internal.", dns.TypeA)
+	if len(m.Answer) != 2 || m.Answer[1].(*dns.A).A.String() != "192.0.2.1" {
+		t.Fatalf("CNAME leaving the zone must be completed upstream: %v", m)
+	}
+	m = query(t, l, "_pg._tcp.office.wireflow.internal.", dns.TypeSRV)
+	if len(m.Answer) != 1 || m.Answer[0].(*dns.SRV).Target != "db.office.wireflow.internal." || m.Answer[0].Header().Ttl != 300 {
+		t.Fatalf("unexpected SRV answer: %v", m)
+	}
+	m = query(t, l, "info.office.wireflow.internal.", dns.TypeTXT)
+	if len(m.Answer) != 1 || m.Answer[0].(*dns.TXT).Txt[0] != "v=spf1 include:corp.example -all" {
+		t.Fatalf("unexpected TXT answer: %v", m)
+	}
+
+	// Records override single names of a forwarded domain, the rest goes
+	// to its resolver.
+	if m = query(t, l, "git.corp.internal.", dns.TypeA); !m.Authoritative || m.Answer[0].(*dns.A).A.String() != "10.0.0.9" {
+		t.Fatalf("unexpected answer for git.corp.internal: %v", m)
+	}
+	if m = query(t, l, "jira.corp.internal.", dns.TypeA); len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.168.1.1" {
+		t.Fatalf("corp.internal must use its forwarder: %v", m)
+	}
+
+	if err := zone.RemoveRecord(Record{Name: "git.corp.internal.", Type: "A", Data: "10.0.0.9"}); err != nil {
+		t.Fatal(err)
+	}
+	if m = query(t, l, "git.corp.internal.", dns.TypeA); m.Authoritative {
+		t.Fatalf("removed record still served: %v", m)
+	}
+}
+
+func TestLinkDNSPeers(t *testing.T) {
+	l := NewNativeDNS(&DNSConfig{ListenAddress: "10.0.0.1:53", Upstreams: []string{startUpstream(t, "192.0.2.1")}})
+	l.SetForwarders(map[string][]string{"corp.internal": {startUpstream(t, "192.168.1.1")}})
+	zone := NewZone("office.wireflow.internal")
+	zone.Add("laptop", netip.MustParseAddr("10.0.0.2"))
+	l.SetZone(zone)
+
+	peer := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5353}
+	if m := queryFrom(t, l, peer, "laptop.office.wireflow.internal.", dns.TypeA); len(m.Answer) != 1 {
+		t.Fatalf("peers must get the zone: %v", m)
+	}
+	if m := queryFrom(t, l, peer, "jira.corp.internal.", dns.TypeA); len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.168.1.1" {
+		t.Fatalf("peers must get the forwarded domains: %v", m)
+	}
+	if m := queryFrom(t, l, peer, "example.com.", dns.TypeA); m.Rcode != dns.RcodeRefused {
+		t.Fatalf("other names must be refused to peers: %v", m)
+	}
+
+	// The host reaches the server from the address it listens on.
+	host := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 40000}
+	if m := queryFrom(t, l, host, "example.com.", dns.TypeA); len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "192.0.2.1" {
+		t.Fatalf("the host must get every name: %v", m)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// recordTTL is the TTL of the answers of the overlay zone. It is short
+// because addresses follow the network map.
+const recordTTL = 60
+
+// maxCNAMEChain bounds the CNAME records followed inside a zone.
+const maxCNAMEChain = 8
+
+var _ DnsClient = (*Zone)(nil)
+
+// Zone is the overlay zone of one network: the names of its peers under a
+// domain, the reverse names of their addresses, and custom records, which
+// may also live outside the domain.
+type Zone struct {
+	domain  string
+	records map[string][]dns.RR
+	ptr     map[string]string
+}
+
+// NewZone returns an empty zone for domain, e.g. "office.wireflow.internal".
+func NewZone(domain string) *Zone {
+	return &Zone{
+		domain:  dns.Fqdn(strings.ToLower(domain)),
+		records: make(map[string][]dns.RR),
+		ptr:     make(map[string]string),
+	}
+}
+
+// Domain returns the domain of the zone without the trailing dot.
+func (z *Zone) Domain() string {
+	return strings.TrimSuffix(z.domain, ".")
+}
+
+// Add makes label answer with addrs. The first label added for an address
+// is the one its reverse name points to.
+func (z *Zone) Add(label string, addrs ...netip.Addr) {
+	name := strings.ToLower(label) + "." + z.domain
+	for _, addr := range addrs {
+		hdr := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: recordTTL}
+		if addr.Is4() {
+			hdr.Rrtype = dns.TypeA
+			z.records[name] = append(z.records[name], &dns.A{Hdr: hdr, A: addr.AsSlice()})
+		} else {
+			hdr.Rrtype = dns.TypeAAAA
+			z.records[name] = append(z.records[name], &dns.AAAA{Hdr: hdr, AAAA: addr.AsSlice()})
+		}
+		reverse, err := dns.ReverseAddr(addr.String())
+		if err != nil {
+			continue
+		}
+		if _, ok := z.ptr[reverse]; !ok {
+			z.ptr[reverse] = name
+		}
+	}
+}
+
+// AddRecord adds a custom record. Its name, and the names in its data, are
+// relative to the domain of the zone unless they end with a dot.
+func (z *Zone) AddRecord(record Record) error {
+	rr, err := z.parse(record)
+	if err != nil {
+		return err
+	}
+	name := rr.Header().Name
+	for _, existing := range z.records[name] {
+		if dns.IsDuplicate(existing, rr) {
+			return nil
+		}
+	}
+	z.records[name] = append(z.records[name], rr)
+	return nil
+}
+
+// RemoveRecord removes a record added with AddRecord.
+func (z *Zone) RemoveRecord(record Record) error {
+	rr, err := z.parse(record)
+	if err != nil {
+		return err
+	}
+	name := rr.Header().Name
+	rrs := z.records[name]
+	for i, existing := range rrs {
+		if dns.IsDuplicate(existing, rr) {
+			rrs = append(rrs[:i], rrs[i+1:]...)
+			break
+		}
+	}
+	if len(rrs) == 0 {
+		delete(z.records, name)
+	} else {
+		z.records[name] = rrs
+	}
+	return nil
+}
+
+func (z *Zone) parse(record Record) (dns.RR, error) {
+	rrtype := strings.ToUpper(record.Type)
+	switch rrtype {
+	case "A", "AAAA", "CNAME", "SRV", "TXT":
+	default:
+		return nil, fmt.Errorf("unsupported record type %q", record.Type)
+	}
+	data := record.Data
+	if rrtype == "TXT" && !strings.HasPrefix(data, `"`) {
+		data = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(data) + `"`
+	}
+	ttl := record.TTL
+	if ttl <= 0 {
+		ttl = recordTTL
+	}
+
+	parser := dns.NewZoneParser(strings.NewReader(fmt.Sprintf("%s %d IN %s %s", record.Name, ttl, rrtype, data)), z.domain, "")
+	rr, ok := parser.Next()
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("invalid %s record %s: %w", rrtype, record.Name, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid %s record %s", rrtype, record.Name)
+	}
+	rr.Header().Name = strings.ToLower(rr.Header().Name)
+	return rr, nil
+}
+
+// Len returns the number of names in the zone.
+func (z *Zone) Len() int {
+	return len(z.records)
+}
+
+// answer resolves q. ok is false when q is not for the zone and must be
+// forwarded. When a CNAME chain leaves the zone, chase is the name the
+// answer must be completed with.
+func (z *Zone) answer(q dns.Question) (rrs []dns.RR, rcode int, chase string, ok bool) {
+	name := strings.ToLower(q.Name)
+
+	if target, found := z.ptr[name]; found {
+		if q.Qtype == dns.TypePTR {
+			hdr := dns.RR_Header{Name: q.Name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: recordTTL}
+			rrs = append(rrs, &dns.PTR{Hdr: hdr, Ptr: target})
+		}
+		return rrs, dns.RcodeSuccess, "", true
+	}
+
+	inDomain := name == z.domain || strings.HasSuffix(name, "."+z.domain)
+	if _, found := z.records[name]; !found {
+		switch {
+		case !inDomain:
+			return nil, 0, "", false
+		case name == z.domain:
+			return nil, dns.RcodeSuccess, "", true
+		default:
+			return nil, dns.RcodeNameError, "", true
+		}
+	}
+
+	owner := q.Name
+	for range maxCNAMEChain {
+		var cname *dns.CNAME
+		for _, rr := range z.records[name] {
+			if c, isCNAME := rr.(*dns.CNAME); isCNAME && q.Qtype != dns.TypeCNAME {
+				cname = c
+			} else if rr.Header().Rrtype != q.Qtype && q.Qtype != dns.TypeANY {
+				continue
+			}
+			rr = dns.Copy(rr)
+			rr.Header().Name = owner
+			rrs = append(rrs, rr)
+		}
+		if cname == nil {
+			break
+		}
+		owner, name = cname.Target, strings.ToLower(cname.Target)
+		if _, found := z.records[name]; !found {
+			if !strings.HasSuffix(name, "."+z.domain) {
+				chase = cname.Target
+			}
+			break
+		}
+	}
+	return rrs, dns.RcodeSuccess, chase, true
+}
@@ -30,6 +30,7 @@ export const updateSystemRole = (id: string, systemRole: string) =>
 
 export const listPeer = (data?: any) => request.get('/peers/list', data)
 export const updatePeer = (data?: any) => request.put('/peers/update', data)
+export const getPeerConnectivity = () => request.get('/peers/connectivity')
 
 export const getMe = (data?: any) => request.get('/users/getme', data)
 export const updateMe = (data?: any) => request.put('/profile/updateProfile', data)
@@ -0,0 +1,356 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+)
+
+// packet holds the header fields a Filter matches on.
+type packet struct {
+	version  int
+	src, dst netip.Addr
+	proto    uint8
+	sport    uint16
+	dport    uint16
+	hasPorts bool
+}
+
+// decode reads the IP header of b and, for TCP and UDP, the ports. IPv6
+// extension headers are not followed.
+func decode(b []byte) (packet, bool) {
+	var p packet
+	if len(b) < 1 {
+		return p, false
+	}
+	var payload []byte
+	switch b[0] >> 4 {
+	case 4:
+		if len(b) < 20 {
+			return p, false
+		}
+		ihl := int(b[0]&0x0f) * 4
+		if ihl < 20 || len(b) < ihl {
+			return p, false
+		}
+		p.version = 4
+		p.proto = b[9]
+		p.src = netip.AddrFrom4([4]byte(b[12:16]))
+		p.dst = netip.AddrFrom4([4]byte(b[16:20]))
+		// only the first fragment carries the transport header
+		if binary.BigEndian.Uint16(b[6:8])&0x1fff == 0 {
+			payload = b[ihl:]
+		}
+	case 6:
+		if len(b) < 40 {
+			return p, false
+		}
+		p.version = 6
+		p.proto = b[6]
+		p.src = netip.AddrFrom16([16]byte(b[8:24]))
+		p.dst = netip.AddrFrom16([16]byte(b[24:40]))
+		payload = b[40:]
+	default:
+		return p, false
+	}
+	if (p.proto == protoTCP || p.proto == protoUDP) && len(payload) >= 4 {
+		p.sport = binary.BigEndian.Uint16(payload[0:2])
+		p.dport = binary.BigEndian.Uint16(payload[2:4])
+		p.hasPorts = true
+	}
+	return p, true
+}
+
+// Filter selects packets with a subset of the tcpdump expression language:
+//
+//	[src|dst] host ADDR
+//	[src|dst] net PREFIX
+//	[tcp|udp] [src|dst] port N
+//	ip | ip6 | tcp | udp | icmp | icmp6
+//
+// combined with and/&&, or/||, not/! and parentheses. An empty expression
+// matches every packet.
+type Filter struct {
+	expr string
+	fn   func(*packet) bool
+}
+
+// ParseFilter compiles expr.
+func ParseFilter(expr string) (*Filter, error) {
+	f := &Filter{expr: strings.TrimSpace(expr)}
+	if f.expr == "" {
+		return f, nil
+	}
+	p := &parser{tokens: tokenize(f.expr)}
+	fn, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", f.expr, err)
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q", f.expr, tok)
+	}
+	f.fn = fn
+	return f, nil
+}
+
+// Match reports whether the IP packet b is selected by the filter.
+func (f *Filter) Match(b []byte) bool {
+	if f == nil || f.fn == nil {
+		return true
+	}
+	p, ok := decode(b)
+	if !ok {
+		return false
+	}
+	return f.fn(&p)
+}
+
+// String returns the expression the filter was compiled from.
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+func tokenize(expr string) []string {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		case c == '(' || c == ')':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == '!' && (i+1 >= len(expr) || expr[i+1] != '='):
+			flush()
+			tokens = append(tokens, "!")
+		case (c == '&' || c == '|') && i+1 < len(expr) && expr[i+1] == c:
+			flush()
+			tokens = append(tokens, expr[i:i+2])
+			i++
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) or() (func(*packet) bool, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok == "or" || tok == "||"; tok = p.peek() {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(pkt *packet) bool { return l(pkt) || right(pkt) }
+	}
+	return left, nil
+}
+
+func (p *parser) and() (func(*packet) bool, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok == "and" || tok == "&&"; tok = p.peek() {
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(pkt *packet) bool { return l(pkt) && right(pkt) }
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (func(*packet) bool, error) {
+	switch p.peek() {
+	case "not", "!":
+		p.next()
+		fn, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(pkt *packet) bool { return !fn(pkt) }, nil
+	case "(":
+		p.next()
+		fn, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return fn, nil
+	}
+	return p.primitive()
+}
+
+// direction is the address or port a primitive applies to.
+type direction int
+
+const (
+	srcOrDst direction = iota
+	srcOnly
+	dstOnly
+)
+
+func (p *parser) primitive() (func(*packet) bool, error) {
+	tok := p.next()
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "ip":
+		return func(pkt *packet) bool { return pkt.version == 4 }, nil
+	case "ip6":
+		return func(pkt *packet) bool { return pkt.version == 6 }, nil
+	case "icmp":
+		return protoIs(protoICMP), nil
+	case "icmp6":
+		return protoIs(protoICMPv6), nil
+	case "tcp", "udp":
+		proto := uint8(protoTCP)
+		if tok == "udp" {
+			proto = protoUDP
+		}
+		next := p.peek()
+		if next != "port" && next != "src" && next != "dst" {
+			return protoIs(proto), nil
+		}
+		port, err := p.qualified()
+		if err != nil {
+			return nil, err
+		}
+		return func(pkt *packet) bool { return pkt.proto == proto && port(pkt) }, nil
+	}
+	p.pos--
+	return p.qualified()
+}
+
+// qualified parses [src|dst] host|net|port VALUE.
+func (p *parser) qualified() (func(*packet) bool, error) {
+	dir := srcOrDst
+	switch p.peek() {
+	case "src":
+		dir = srcOnly
+		p.next()
+	case "dst":
+		dir = dstOnly
+		p.next()
+	}
+	kind := p.next()
+	value := p.next()
+	if value == "" {
+		return nil, fmt.Errorf("%s needs a value", kind)
+	}
+	switch kind {
+	case "host":
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		return addrMatch(dir, func(a netip.Addr) bool { return a == addr }), nil
+	case "net":
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		prefix = prefix.Masked()
+		return addrMatch(dir, prefix.Contains), nil
+	case "port":
+		n, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", value)
+		}
+		port := uint16(n)
+		return func(pkt *packet) bool {
+			if !pkt.hasPorts {
+				return false
+			}
+			switch dir {
+			case srcOnly:
+				return pkt.sport == port
+			case dstOnly:
+				return pkt.dport == port
+			}
+			return pkt.sport == port || pkt.dport == port
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown primitive %q", kind)
+}
+
+func protoIs(proto uint8) func(*packet) bool {
+	return func(pkt *packet) bool { return pkt.proto == proto }
+}
+
+func addrMatch(dir direction, match func(netip.Addr) bool) func(*packet) bool {
+	return func(pkt *packet) bool {
+		switch dir {
+		case srcOnly:
+			return match(pkt.src)
+		case dstOnly:
+			return match(pkt.dst)
+		}
+		return match(pkt.src) || match(pkt.dst)
+	}
+}
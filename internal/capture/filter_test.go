@@ -0,0 +1,104 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+)
+
+// ipv4Packet builds an IPv4 packet of proto with the given ports.
+func ipv4Packet(src, dst string, proto uint8, sport, dport uint16) []byte {
+	b := make([]byte, 28)
+	b[0] = 0x45
+	b[9] = proto
+	s, d := netip.MustParseAddr(src).As4(), netip.MustParseAddr(dst).As4()
+	copy(b[12:16], s[:])
+	copy(b[16:20], d[:])
+	binary.BigEndian.PutUint16(b[20:22], sport)
+	binary.BigEndian.PutUint16(b[22:24], dport)
+	return b
+}
+
+func ipv6Packet(src, dst string, proto uint8, sport, dport uint16) []byte {
+	b := make([]byte, 48)
+	b[0] = 0x60
+	b[6] = proto
+	s, d := netip.MustParseAddr(src).As16(), netip.MustParseAddr(dst).As16()
+	copy(b[8:24], s[:])
+	copy(b[24:40], d[:])
+	binary.BigEndian.PutUint16(b[40:42], sport)
+	binary.BigEndian.PutUint16(b[42:44], dport)
+	return b
+}
+
+func TestFilter(t *testing.T) {
+	web := ipv4Packet("10.0.0.2", "10.0.0.3", protoTCP, 40000, 80)
+	dns := ipv4Packet("10.0.0.3", "10.0.0.2", protoUDP, 53, 40001)
+	ping := ipv4Packet("10.0.0.2", "10.0.1.9", protoICMP, 0, 0)
+	v6 := ipv6Packet("fd00::2", "fd00::3", protoTCP, 40002, 443)
+
+	tests := []struct {
+		expr string
+		want []bool // web, dns, ping, v6
+	}{
+		{"", []bool{true, true, true, true}},
+		{"host 10.0.0.3", []bool{true, true, false, false}},
+		{"src host 10.0.0.3", []bool{false, true, false, false}},
+		{"dst host 10.0.0.3", []bool{true, false, false, false}},
+		{"net 10.0.1.0/24", []bool{false, false, true, false}},
+		{"port 80", []bool{true, false, false, false}},
+		{"src port 53", []bool{false, true, false, false}},
+		{"tcp port 53", []bool{false, false, false, false}},
+		{"udp port 53", []bool{false, true, false, false}},
+		{"tcp", []bool{true, false, false, true}},
+		{"icmp", []bool{false, false, true, false}},
+		{"ip6", []bool{false, false, false, true}},
+		{"ip and not icmp", []bool{true, true, false, false}},
+		{"tcp && !port 80", []bool{false, false, false, true}},
+		{"icmp or (udp and port 53)", []bool{false, true, true, false}},
+		{"host fd00::3 || dst port 80", []bool{true, false, false, true}},
+	}
+	packets := [][]byte{web, dns, ping, v6}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", tt.expr, err)
+		}
+		for i, p := range packets {
+			if got := f.Match(p); got != tt.want[i] {
+				t.Errorf("%q on packet %d: got %v, want %v", tt.expr, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"host",
+		"host nope",
+		"net 10.0.0.0",
+		"port http",
+		"tcp and",
+		"(tcp",
+		"tcp)",
+		"bogus 1",
+	} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("ParseFilter(%q) succeeded", expr)
+		}
+	}
+}
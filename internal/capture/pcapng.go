@@ -0,0 +1,159 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// pcapng block types and options; see
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-02.html.
+const (
+	blockSectionHeader   = 0x0A0D0D0A
+	blockInterface       = 0x00000001
+	blockInterfaceStats  = 0x00000005
+	blockEnhancedPacket  = 0x00000006
+	byteOrderMagic       = 0x1A2B3C4D
+	optEndOfOpt          = 0
+	optComment           = 1
+	optSHBUserAppl       = 4
+	optIfName            = 2
+	optIfDescription     = 3
+	optIfTsresol         = 9
+	optEPBFlags          = 2
+	optISBIfRecv         = 4
+	optISBIfDrop         = 5
+	linkTypeRaw          = 101 // raw IPv4 or IPv6, no link-layer header
+	epbFlagInbound       = 1
+	epbFlagOutbound      = 2
+	nanosecondResolution = 9
+)
+
+// Writer writes a pcapng section with raw IP interfaces and nanosecond
+// timestamps.
+type Writer struct {
+	w      *bufio.Writer
+	ifaces int
+}
+
+// NewWriter writes the section header to w.
+func NewWriter(w io.Writer) (*Writer, error) {
+	pw := &Writer{w: bufio.NewWriter(w)}
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, byteOrderMagic)
+	body = binary.LittleEndian.AppendUint16(body, 1) // major version
+	body = binary.LittleEndian.AppendUint16(body, 0) // minor version
+	body = binary.LittleEndian.AppendUint64(body, ^uint64(0))
+	body = appendOption(body, optSHBUserAppl, []byte("wireflow"))
+	body = appendEndOfOpt(body)
+	return pw, pw.block(blockSectionHeader, body)
+}
+
+// AddInterface describes the next interface and returns its id.
+func (w *Writer) AddInterface(name, description string) (int, error) {
+	var body []byte
+	body = binary.LittleEndian.AppendUint16(body, linkTypeRaw)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0) // no snap length
+	body = appendOption(body, optIfName, []byte(name))
+	if description != "" {
+		body = appendOption(body, optIfDescription, []byte(description))
+	}
+	body = appendOption(body, optIfTsresol, []byte{nanosecondResolution})
+	body = appendEndOfOpt(body)
+	if err := w.block(blockInterface, body); err != nil {
+		return 0, err
+	}
+	w.ifaces++
+	return w.ifaces - 1, nil
+}
+
+// WritePacket writes an enhanced packet block: data captured on iface at ts,
+// with its direction and an optional comment.
+func (w *Writer) WritePacket(iface int, ts time.Time, data []byte, inbound bool, comment string) error {
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, uint32(iface))
+	body = appendTimestamp(body, ts)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+	body = append(body, data...)
+	body = appendPadding(body)
+	flags := uint32(epbFlagOutbound)
+	if inbound {
+		flags = epbFlagInbound
+	}
+	body = appendOption(body, optEPBFlags, binary.LittleEndian.AppendUint32(nil, flags))
+	if comment != "" {
+		body = appendOption(body, optComment, []byte(comment))
+	}
+	body = appendEndOfOpt(body)
+	return w.block(blockEnhancedPacket, body)
+}
+
+// WriteStats writes the interface statistics of iface: the packets received
+// by the capture and those it dropped.
+func (w *Writer) WriteStats(iface int, ts time.Time, received, dropped uint64) error {
+	var body []byte
+	body = binary.LittleEndian.AppendUint32(body, uint32(iface))
+	body = appendTimestamp(body, ts)
+	body = appendOption(body, optISBIfRecv, binary.LittleEndian.AppendUint64(nil, received))
+	body = appendOption(body, optISBIfDrop, binary.LittleEndian.AppendUint64(nil, dropped))
+	body = appendEndOfOpt(body)
+	return w.block(blockInterfaceStats, body)
+}
+
+// Flush writes the buffered blocks to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) block(blockType uint32, body []byte) error {
+	length := uint32(12 + len(body))
+	var buf []byte
+	buf = binary.LittleEndian.AppendUint32(buf, blockType)
+	buf = binary.LittleEndian.AppendUint32(buf, length)
+	buf = append(buf, body...)
+	buf = binary.LittleEndian.AppendUint32(buf, length)
+	_, err := w.w.Write(buf)
+	return err
+}
+
+func appendTimestamp(b []byte, ts time.Time) []byte {
+	ns := uint64(ts.UnixNano())
+	b = binary.LittleEndian.AppendUint32(b, uint32(ns>>32))
+	return binary.LittleEndian.AppendUint32(b, uint32(ns))
+}
+
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return appendPadding(b)
+}
+
+func appendEndOfOpt(b []byte) []byte {
+	return binary.LittleEndian.AppendUint32(b, optEndOfOpt)
+}
+
+// appendPadding pads b to a multiple of 4 bytes.
+func appendPadding(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
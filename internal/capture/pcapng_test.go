@@ -0,0 +1,142 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+type block struct {
+	typ  uint32
+	body []byte
+}
+
+// readBlocks splits a pcapng stream into its blocks, checking the framing.
+func readBlocks(t *testing.T, b []byte) []block {
+	t.Helper()
+	var blocks []block
+	for len(b) > 0 {
+		if len(b) < 12 {
+			t.Fatalf("truncated block: %d bytes left", len(b))
+		}
+		typ := binary.LittleEndian.Uint32(b[0:4])
+		length := binary.LittleEndian.Uint32(b[4:8])
+		if length%4 != 0 || int(length) > len(b) {
+			t.Fatalf("block %#x: bad length %d", typ, length)
+		}
+		if trailer := binary.LittleEndian.Uint32(b[length-4 : length]); trailer != length {
+			t.Fatalf("block %#x: trailing length %d, want %d", typ, trailer, length)
+		}
+		blocks = append(blocks, block{typ: typ, body: b[8 : length-4]})
+		b = b[length:]
+	}
+	return blocks
+}
+
+// options parses the options that body starts with.
+func options(body []byte) map[uint16][]byte {
+	opts := make(map[uint16][]byte)
+	for len(body) >= 4 {
+		code := binary.LittleEndian.Uint16(body[0:2])
+		n := int(binary.LittleEndian.Uint16(body[2:4]))
+		if code == optEndOfOpt {
+			break
+		}
+		opts[code] = body[4 : 4+n]
+		body = body[4+(n+3)&^3:]
+	}
+	return opts
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface, err := w.AddInterface("wf0", "overlay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Unix(1700000000, 123456789)
+	packet := ipv4Packet("10.0.0.2", "10.0.0.3", protoUDP, 1, 2)[:27]
+	if err = w.WritePacket(iface, ts, packet, true, "peer=alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteStats(iface, ts, 5, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := readBlocks(t, buf.Bytes())
+	if len(blocks) != 4 {
+		t.Fatalf("got %d blocks, want 4", len(blocks))
+	}
+	wantTypes := []uint32{blockSectionHeader, blockInterface, blockEnhancedPacket, blockInterfaceStats}
+	for i, b := range blocks {
+		if b.typ != wantTypes[i] {
+			t.Fatalf("block %d: type %#x, want %#x", i, b.typ, wantTypes[i])
+		}
+	}
+
+	if magic := binary.LittleEndian.Uint32(blocks[0].body); magic != byteOrderMagic {
+		t.Fatalf("byte-order magic %#x", magic)
+	}
+
+	idb := blocks[1].body
+	if lt := binary.LittleEndian.Uint16(idb[0:2]); lt != linkTypeRaw {
+		t.Fatalf("link type %d, want %d", lt, linkTypeRaw)
+	}
+	idbOpts := options(idb[8:])
+	if name := string(idbOpts[optIfName]); name != "wf0" {
+		t.Fatalf("interface name %q", name)
+	}
+	if res := idbOpts[optIfTsresol]; len(res) != 1 || res[0] != nanosecondResolution {
+		t.Fatalf("timestamp resolution %v", res)
+	}
+
+	epb := blocks[2].body
+	if id := binary.LittleEndian.Uint32(epb[0:4]); id != uint32(iface) {
+		t.Fatalf("interface id %d", id)
+	}
+	high, low := binary.LittleEndian.Uint32(epb[4:8]), binary.LittleEndian.Uint32(epb[8:12])
+	if got := int64(high)<<32 | int64(low); got != ts.UnixNano() {
+		t.Fatalf("timestamp %d, want %d", got, ts.UnixNano())
+	}
+	captured := binary.LittleEndian.Uint32(epb[12:16])
+	if int(captured) != len(packet) || !bytes.Equal(epb[20:20+captured], packet) {
+		t.Fatalf("packet data mismatch")
+	}
+	epbOpts := options(epb[20+(captured+3)&^3:])
+	if flags := binary.LittleEndian.Uint32(epbOpts[optEPBFlags]); flags != epbFlagInbound {
+		t.Fatalf("flags %d, want inbound", flags)
+	}
+	if comment := string(epbOpts[optComment]); comment != "peer=alice" {
+		t.Fatalf("comment %q", comment)
+	}
+
+	isbOpts := options(blocks[3].body[12:])
+	if recv := binary.LittleEndian.Uint64(isbOpts[optISBIfRecv]); recv != 5 {
+		t.Fatalf("ifrecv %d", recv)
+	}
+	if drop := binary.LittleEndian.Uint64(isbOpts[optISBIfDrop]); drop != 2 {
+		t.Fatalf("ifdrop %d", drop)
+	}
+}
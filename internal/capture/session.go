@@ -0,0 +1,271 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// queueSize is how many packets a Session holds while the writer catches up.
+// Packets beyond it are dropped rather than stalling the tunnel.
+const queueSize = 4096
+
+// Resolver names the peer a packet belongs to: the owner of an overlay
+// address, or the peer reached at an underlay endpoint. An empty name means
+// no known peer.
+type Resolver interface {
+	OverlayPeer(addr netip.Addr) string
+	UnderlayPeer(endpoint netip.AddrPort) string
+}
+
+// Options select what a Session captures.
+type Options struct {
+	// Filter selects packets; nil captures all of them.
+	Filter *Filter
+	// Peer keeps only the packets of this peer, as named by the Resolver.
+	Peer string
+	// Underlay also captures the encrypted WireGuard messages, on a second
+	// interface, with IP and UDP headers rebuilt around them.
+	Underlay bool
+	// Count stops the capture after that many packets; zero means no limit.
+	Count int
+	// Interface names the overlay interface in the capture file.
+	Interface string
+	// Port is the local WireGuard port, used in the rebuilt underlay headers.
+	Port uint16
+	// Resolver annotates packets with their peer; it may be nil when Peer is
+	// empty.
+	Resolver Resolver
+}
+
+const (
+	ifaceOverlay = iota
+	ifaceUnderlay
+)
+
+type record struct {
+	iface   int
+	ts      time.Time
+	data    []byte
+	inbound bool
+	peer    string
+	// denied marks an overlay packet the userspace firewall dropped.
+	denied bool
+}
+
+// Session is a capture in progress. It is an infra.PacketTap: the data path
+// hands it packets, which are filtered and queued, and Run writes them out.
+type Session struct {
+	opts     Options
+	queue    chan record
+	received [2]atomic.Uint64
+	dropped  [2]atomic.Uint64
+}
+
+func NewSession(opts Options) *Session {
+	return &Session{opts: opts, queue: make(chan record, queueSize)}
+}
+
+// Overlay implements infra.PacketTap.
+func (s *Session) Overlay(packet []byte, inbound bool) {
+	s.overlay(packet, inbound, false)
+}
+
+// Denied implements infra.PacketTap. The packet is written with a comment
+// saying that policy dropped it.
+func (s *Session) Denied(packet []byte, inbound bool) {
+	s.overlay(packet, inbound, true)
+}
+
+func (s *Session) overlay(packet []byte, inbound, denied bool) {
+	if !s.opts.Filter.Match(packet) {
+		return
+	}
+	peer := ""
+	if s.opts.Resolver != nil {
+		if p, ok := decode(packet); ok {
+			remote := p.dst
+			if inbound {
+				remote = p.src
+			}
+			peer = s.opts.Resolver.OverlayPeer(remote)
+		}
+	}
+	if s.opts.Peer != "" && peer != s.opts.Peer {
+		return
+	}
+	s.enqueue(record{iface: ifaceOverlay, data: append([]byte(nil), packet...), inbound: inbound, peer: peer, denied: denied})
+}
+
+// Underlay implements infra.PacketTap.
+func (s *Session) Underlay(msg []byte, endpoint netip.AddrPort, inbound bool) {
+	if !s.opts.Underlay {
+		return
+	}
+	packet := encapsulate(msg, endpoint, s.opts.Port, inbound)
+	if !s.opts.Filter.Match(packet) {
+		return
+	}
+	peer := ""
+	if s.opts.Resolver != nil {
+		peer = s.opts.Resolver.UnderlayPeer(endpoint)
+	}
+	if s.opts.Peer != "" && peer != s.opts.Peer {
+		return
+	}
+	s.enqueue(record{iface: ifaceUnderlay, data: packet, inbound: inbound, peer: peer})
+}
+
+func (s *Session) enqueue(rec record) {
+	s.received[rec.iface].Add(1)
+	rec.ts = time.Now()
+	select {
+	case s.queue <- rec:
+	default:
+		s.dropped[rec.iface].Add(1)
+	}
+}
+
+// Run writes the captured packets to w as pcapng until ctx is done or Count
+// packets were written, then closes the section with the interface
+// statistics. Output is flushed whenever the queue runs empty, so a reader
+// of w sees packets as they arrive.
+func (s *Session) Run(ctx context.Context, w io.Writer) error {
+	pw, err := NewWriter(w)
+	if err != nil {
+		return err
+	}
+	name := s.opts.Interface
+	if name == "" {
+		name = "wireflow"
+	}
+	if _, err = pw.AddInterface(name, "decrypted overlay traffic"); err != nil {
+		return err
+	}
+	if s.opts.Underlay {
+		if _, err = pw.AddInterface(name+"-underlay", "encrypted WireGuard traffic"); err != nil {
+			return err
+		}
+	}
+	if err = pw.Flush(); err != nil {
+		return err
+	}
+
+	written := 0
+	for s.opts.Count == 0 || written < s.opts.Count {
+		var rec record
+		select {
+		case <-ctx.Done():
+			return s.finish(pw)
+		case rec = <-s.queue:
+		}
+		var comments []string
+		if rec.peer != "" {
+			comments = append(comments, "peer="+rec.peer)
+		}
+		if rec.denied {
+			comments = append(comments, "dropped by policy")
+		}
+		comment := strings.Join(comments, " ")
+		if err = pw.WritePacket(rec.iface, rec.ts, rec.data, rec.inbound, comment); err != nil {
+			return err
+		}
+		written++
+		if len(s.queue) == 0 {
+			if err = pw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return s.finish(pw)
+}
+
+func (s *Session) finish(pw *Writer) error {
+	now := time.Now()
+	ifaces := 1
+	if s.opts.Underlay {
+		ifaces = 2
+	}
+	for i := 0; i < ifaces; i++ {
+		if err := pw.WriteStats(i, now, s.received[i].Load(), s.dropped[i].Load()); err != nil {
+			return err
+		}
+	}
+	return pw.Flush()
+}
+
+// encapsulate rebuilds the IP and UDP headers of a WireGuard message
+// exchanged with endpoint, so that capture tools can dissect it. The local
+// address is unknown at this layer and left unspecified.
+func encapsulate(msg []byte, endpoint netip.AddrPort, port uint16, inbound bool) []byte {
+	remote := endpoint.Addr().Unmap()
+	local := netip.IPv4Unspecified()
+	if remote.Is6() {
+		local = netip.IPv6Unspecified()
+	}
+	src, dst := local, remote
+	sport, dport := port, endpoint.Port()
+	if inbound {
+		src, dst = dst, src
+		sport, dport = dport, sport
+	}
+
+	udpLen := 8 + len(msg)
+	var b []byte
+	if src.Is4() {
+		b = make([]byte, 20, 20+udpLen)
+		b[0] = 0x45
+		binary.BigEndian.PutUint16(b[2:4], uint16(20+udpLen))
+		b[8] = 64
+		b[9] = protoUDP
+		s4, d4 := src.As4(), dst.As4()
+		copy(b[12:16], s4[:])
+		copy(b[16:20], d4[:])
+		binary.BigEndian.PutUint16(b[10:12], checksum(b[:20]))
+	} else {
+		b = make([]byte, 40, 40+udpLen)
+		b[0] = 0x60
+		binary.BigEndian.PutUint16(b[4:6], uint16(udpLen))
+		b[6] = protoUDP
+		b[7] = 64
+		s16, d16 := src.As16(), dst.As16()
+		copy(b[8:24], s16[:])
+		copy(b[24:40], d16[:])
+	}
+	// The UDP checksum is left zero: it is optional over IPv4 and capture
+	// tools do not verify it by default.
+	b = binary.BigEndian.AppendUint16(b, sport)
+	b = binary.BigEndian.AppendUint16(b, dport)
+	b = binary.BigEndian.AppendUint16(b, uint16(udpLen))
+	b = binary.BigEndian.AppendUint16(b, 0)
+	return append(b, msg...)
+}
+
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,139 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+type staticResolver map[string]string
+
+func (r staticResolver) OverlayPeer(addr netip.Addr) string {
+	return r[addr.String()]
+}
+
+func (r staticResolver) UnderlayPeer(endpoint netip.AddrPort) string {
+	return r[endpoint.String()]
+}
+
+func TestSession(t *testing.T) {
+	f, err := ParseFilter("udp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession(Options{
+		Filter:   f,
+		Peer:     "alice",
+		Underlay: true,
+		Count:    3,
+		Port:     51820,
+		Resolver: staticResolver{
+			"10.0.0.3":          "alice",
+			"10.0.0.4":          "bob",
+			"198.51.100.7:4000": "alice",
+		},
+	})
+
+	s.Overlay(ipv4Packet("10.0.0.2", "10.0.0.3", protoUDP, 1000, 53), false) // kept
+	s.Overlay(ipv4Packet("10.0.0.2", "10.0.0.3", protoTCP, 1000, 80), false) // filtered out
+	s.Overlay(ipv4Packet("10.0.0.4", "10.0.0.2", protoUDP, 53, 1000), true)  // other peer
+	s.Overlay(ipv4Packet("10.0.0.3", "10.0.0.2", protoUDP, 53, 1000), true)  // kept
+	msg := []byte{4, 0, 0, 0, 1, 2, 3, 4}
+	s.Underlay(msg, netip.MustParseAddrPort("198.51.100.7:4000"), true)      // kept
+	s.Overlay(ipv4Packet("10.0.0.2", "10.0.0.3", protoUDP, 1000, 53), false) // beyond Count
+
+	var buf bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = s.Run(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Run did not stop after Count packets")
+	}
+
+	var packets []block
+	var stats []block
+	for _, b := range readBlocks(t, buf.Bytes()) {
+		switch b.typ {
+		case blockEnhancedPacket:
+			packets = append(packets, b)
+		case blockInterfaceStats:
+			stats = append(stats, b)
+		}
+	}
+	if len(packets) != 3 {
+		t.Fatalf("got %d packets, want 3", len(packets))
+	}
+	if len(stats) != 2 {
+		t.Fatalf("got %d statistics blocks, want one per interface", len(stats))
+	}
+
+	underlay := packets[2].body
+	if id := binary.LittleEndian.Uint32(underlay[0:4]); id != ifaceUnderlay {
+		t.Fatalf("underlay packet on interface %d", id)
+	}
+	data := underlay[20 : 20+binary.LittleEndian.Uint32(underlay[12:16])]
+	p, ok := decode(data)
+	if !ok {
+		t.Fatal("underlay packet does not decode")
+	}
+	if p.src != netip.MustParseAddr("198.51.100.7") || p.sport != 4000 || p.dport != 51820 {
+		t.Fatalf("underlay headers %+v", p)
+	}
+	if checksum(data[:20]) != 0 {
+		t.Fatal("bad IPv4 header checksum")
+	}
+	if !bytes.Equal(data[28:], msg) {
+		t.Fatal("underlay payload mismatch")
+	}
+	if comment := string(options(underlay[20+(len(data)+3)&^3:])[optComment]); comment != "peer=alice" {
+		t.Fatalf("comment %q", comment)
+	}
+}
+
+func TestSessionDenied(t *testing.T) {
+	s := NewSession(Options{
+		Count:    2,
+		Resolver: staticResolver{"10.0.0.3": "alice"},
+	})
+	s.Overlay(ipv4Packet("10.0.0.3", "10.0.0.2", protoUDP, 53, 1000), true)
+	s.Denied(ipv4Packet("10.0.0.3", "10.0.0.2", protoTCP, 1000, 22), true)
+
+	var buf bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Run(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var comments []string
+	for _, b := range readBlocks(t, buf.Bytes()) {
+		if b.typ != blockEnhancedPacket {
+			continue
+		}
+		length := binary.LittleEndian.Uint32(b.body[12:16])
+		comments = append(comments, string(options(b.body[20+(length+3)&^3:])[optComment]))
+	}
+	want := []string{"peer=alice", "peer=alice dropped by policy"}
+	if len(comments) != len(want) || comments[0] != want[0] || comments[1] != want[1] {
+		t.Fatalf("comments %q, want %q", comments, want)
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	wflog "wireflow/internal/log"
 
@@ -270,15 +271,39 @@ type Config struct {
 	ServerUrl     string `mapstructure:"server-url"`
 	WrrperURL     string `mapstructure:"wrrper-url"`   // Wrrper relay 地址，默认 :6266
 	WrrpQuicURL   string `mapstructure:"wrrp-quic-url"` // QUIC relay server address
-	TurnServerURL string `mapstructure:"stun-url"`   // TURN/STUN 地址
+	TurnServerURL string `mapstructure:"stun-url"`   // TURN/STUN 地址，逗号分隔；网络下发时以网络为准
 	PublicIP      string `mapstructure:"public-ip"`
-	Port          int    `mapstructure:"port"`    // TURN 业务端口，默认 3478
-	WgPort        int    `mapstructure:"wg-port"` // WireGuard/ICE UDP 监听端口，默认 51820
+	Port          int    `mapstructure:"port"`      // TURN 业务端口，默认 3478
+	WgPort        int    `mapstructure:"wg-port"`   // WireGuard/ICE UDP 监听端口，默认 51820
+	Firewall      string `mapstructure:"firewall"`  // 策略执行后端：auto（默认，主机防火墙）/ userspace
+	ExitNode      string `mapstructure:"exit-node"` // 出口节点（peer 名称或 app id），全部外网流量经其转发
+
+	// AdvertiseRoutes 是本节点作为子网路由器通告的网段（如办公室 LAN），
+	// 需管理员在 WireflowPeer.spec.approvedRoutes 中批准后才会下发给其他 peer。
+	AdvertiseRoutes []string `mapstructure:"advertise-routes"`
+
+	// Networks 是本节点在 token 所属网络之外同时加入的网络。每个网络单独注册，
+	// 使用独立的接口、端口、密钥、路由和防火墙链，由同一个 agent 进程管理。
+	Networks []NetworkConfig `mapstructure:"networks"`
+
+	// PMTUDiscovery 开启后，每个 peer 的传输建立时探测路径 MTU，
+	// 路径（如 IPSec 封装的广域网链路）放不下整包时调低接口 MTU。
+	PMTUDiscovery bool `mapstructure:"pmtu-discovery"`
+
+	// Netstack 用进程内的用户态 TCP/IP 协议栈代替内核 TUN，无需 root 和 iptables；
+	// 通过本地 SOCKS5 / HTTP 代理访问 overlay，NetstackForwards 把 overlay 端口转发到本机服务。
+	Netstack         bool     `mapstructure:"netstack"`
+	Socks5Listen     string   `mapstructure:"socks5-listen"`     // SOCKS5 代理监听地址，空值关闭
+	HTTPProxyListen  string   `mapstructure:"http-proxy-listen"` // HTTP 代理监听地址，空值关闭
+	NetstackForwards []string `mapstructure:"netstack-forward"`  // port 或 port=host:port，仅 TCP
 
 	// ── 功能开关 ──────────────────────────────────────────────────
 	EnableWrrp   bool `mapstructure:"enable-wrrp"`
 	EnableTLS    bool `mapstructure:"enable-tls"`
 	EnableMetric bool `mapstructure:"enable-metric"`
+	// EnableDNS 在本机 overlay 地址上提供 DNS，解析网络内的 peer 名，
+	// 其余查询仅为本机转发给系统 DNS，其他 peer 只能查询网络域名与转发域；
+	// Linux 上同时配置 split DNS。
 	EnableDNS    bool `mapstructure:"enable-dns"`
 	EnableSysLog bool `mapstructure:"enable-sys-log"`
 	EnableDaemon bool `mapstructure:"enable-daemon"`
@@ -304,10 +329,19 @@ type Config struct {
 	JWT       JWTConfig       `mapstructure:"jwt"`
 	Dex       DexConfig       `mapstructure:"dex"`
 	AI        AIConfig        `mapstructure:"ai"`
+	TURN      TURNConfig      `mapstructure:"turn"`
 }
 
 // AIConfig 聚合 AI 功能相关配置。
 // AI 功能为弱依赖：Enabled=false 或 APIKey 为空时所有 /api/v1/ai/* 接口返回 503。
+// NetworkConfig 是一个额外加入的网络（wireflow up --join name=token）。
+type NetworkConfig struct {
+	Name          string `mapstructure:"name"`           // 本地名称，决定状态目录 networks/<name>
+	Token         string `mapstructure:"token"`          // 该网络的 enrollment token
+	InterfaceName string `mapstructure:"interface-name"` // 为空时依次使用 wf1、wf2…
+	WgPort        int    `mapstructure:"wg-port"`        // 为空时依次使用 wg-port+1、wg-port+2…
+}
+
 type AIConfig struct {
 	// Enabled 是否启用 AI 功能，默认 false。
 	// 对应环境变量: WIREFLOW_AI_ENABLED
@@ -382,6 +416,20 @@ type JWTConfig struct {
 	ExpireHours int    `mapstructure:"expire_hours"`
 }
 
+// TURNConfig 配置 TURN relay 的短期凭证（TURN REST API 方式）。
+// management 按 peer 签发限时用户名/密码，turn 服务用同一 Secret 校验，
+// 无需为每个 peer 预置账号。
+type TURNConfig struct {
+	// URLs 是下发给 agent 的 TURN 地址，逗号分隔，如 "turn:turn.example.com:3478"。
+	// 为空或 Secret 为空时不签发凭证，agent 不收集 relay candidate。
+	URLs string `mapstructure:"urls"`
+	// Secret 是 management 与 turn 服务共享的签名密钥。
+	// 对应环境变量: WIREFLOW_TURN_SECRET
+	Secret string `mapstructure:"secret"`
+	// TTL 是凭证有效期，默认 1h；agent 在过期前自动续期。
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
 type DexConfig struct {
 	Issur       string   `mapstructure:"issur"`
 	ProviderUrl string   `mapstructure:"providerUrl"`
@@ -504,6 +552,22 @@ func inferDatabaseDriver(cfg *Config) {
 // GetConfigFilePath 返回主配置文件路径（向后兼容）。
 func GetConfigFilePath() string { return GetManager().dir + "/wireflow.yaml" }
 
+// GetConfigDir 返回解析后的配置目录；Load 尚未执行时回退到默认目录。
+// agent 的本地状态（WireGuard 私钥等）同样保存在该目录下。
+func GetConfigDir() string {
+	if dir := GetManager().dir; dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("WIREFLOW_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	if home == "/" {
+		return "/etc/wireflow"
+	}
+	return home + "/.wireflow"
+}
+
 // peekConfigDir 在完整加载之前提前获取配置目录，优先级：
 // --config-dir > WIREFLOW_CONFIG_DIR > ~/.wireflow
 func peekConfigDir(cmd *cobra.Command) string {
@@ -555,6 +619,11 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("database.driver", "sqlite")
 	v.SetDefault("database.dsn", "")
 
+	// turn.urls / turn.secret 为空 = 不签发 TURN 凭证
+	v.SetDefault("turn.urls", "")
+	v.SetDefault("turn.secret", "")
+	v.SetDefault("turn.ttl", time.Hour)
+
 	v.SetDefault("dex.providerUrl", "") // 空 = 禁用 Dex OIDC
 	v.SetDefault("monitor.address", "")
 
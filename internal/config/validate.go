@@ -16,6 +16,7 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"strings"
@@ -67,6 +68,12 @@ func applyServerDefaults(cfg *Config) error {
 
 // runClientValidation 对 agent 模式执行严格的字段校验。
 func runClientValidation(cfg *Config) error {
+	for _, route := range cfg.AdvertiseRoutes {
+		if _, err := netip.ParsePrefix(route); err != nil {
+			return fmt.Errorf("invalid advertise-routes entry %q: %w", route, err)
+		}
+	}
+
 	fields := []configField{
 		{name: "signaling-url", value: cfg.SignalingURL, suggestion: "--signaling-url nats://<HOST>:4222"},
 		{name: "server-url", value: cfg.ServerUrl, suggestion: "--server-url http://<HOST>:8080"},
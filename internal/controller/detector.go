@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 	v1alpha1 "wireflow/api/v1alpha1"
@@ -44,6 +45,11 @@ type PeerStateSnapshot struct {
 	Policies []*v1alpha1.WireflowPolicy
 	Peers    []*v1alpha1.WireflowPeer
 	Labels   map[string]string
+	// Routes are the subnet routes of the network, keyed by router name.
+	Routes map[string]*peerRoutes
+	// DNSRecords are the custom DNS records of the network, when it has DNS
+	// enabled.
+	DNSRecords []*v1alpha1.WireflowDNSRecord
 }
 
 func NewGenerator(client client.Client) *Generator {
@@ -308,19 +314,61 @@ func (d *Generator) generate(ctx context.Context, current *v1alpha1.WireflowPeer
 	}
 
 	msg.Current.Labels = snapshot.Labels
+	if routes := snapshot.Routes[current.Name]; routes != nil {
+		msg.Current.Routes = routes.Active
+	}
+
+	// 密钥已到期（KeyRotationReconciler 置位 Pending），通知 agent 本地生成新密钥并上报公钥
+	if kr := current.Status.KeyRotation; kr != nil && kr.Pending {
+		msg.Changes = &infra.DetailsInfo{
+			KeyChanged:   true,
+			TotalChanges: 1,
+			Reason: []*infra.Entry{{
+				Type:    "key",
+				Action:  "rotate",
+				Message: "WireGuard key exceeded the network maxKeyAge",
+			}},
+		}
+	}
+
+	// 节点自身的 MTU 优先于网络的设置
+	msg.Network.Mtu = current.Spec.MTU
+	if msg.Network.Mtu == 0 && snapshot.Network != nil {
+		msg.Network.Mtu = snapshot.Network.Spec.Mtu
+	}
 
 	// 填充网络信息
 	if snapshot.Network != nil {
 		msg.Network.NetworkId = snapshot.Network.Name
 		msg.Network.NetworkName = snapshot.Network.Spec.Name
+		msg.Network.Address = snapshot.Network.Status.ActiveCIDR
+		if msg.Network.Address == "" {
+			msg.Network.Address = snapshot.Network.Spec.CIDR
+		}
+		if msg.Network.ICEServers, err = d.iceServers(ctx, snapshot.Network); err != nil {
+			return nil, err
+		}
+		if snapshot.Network.Spec.Dns.Enabled {
+			msg.Network.DNS = dnsZone(snapshot.Network, snapshot.DNSRecords)
+		}
+		if policy := snapshot.Network.Spec.Connections; policy.Lazy() {
+			msg.Network.Lazy = &infra.LazyConnections{IdleTimeout: int(policy.GetIdleTimeout().Seconds())}
+		}
 
 		// 填充 peers，按 Name 排序保证 hash 稳定
+		// 没有公钥的 peer（agent 尚未注册）无法建立隧道，暂不下发
 		for _, p := range snapshot.Peers {
-			if p.Status.AllocatedAddress == nil {
+			if p.Status.AllocatedAddress == nil || p.Spec.PublicKey == "" {
 				continue
 			}
 
-			msg.Network.Peers = append(msg.Network.Peers, transferToPeer(p))
+			peer := transferToPeer(p)
+			// 已批准且无冲突的子网路由作为 AllowedIPs 下发
+			if routes := snapshot.Routes[p.Name]; routes != nil && len(routes.Active) > 0 {
+				peer.Routes = routes.Active
+				peer.AllowedIPs += "," + strings.Join(routes.Active, ",")
+			}
+			msg.Network.Peers = append(msg.Network.Peers, peer)
 		}
 		sort.Slice(msg.Network.Peers, func(i, j int) bool {
 			return msg.Network.Peers[i].Name < msg.Network.Peers[j].Name
@@ -331,6 +379,16 @@ func (d *Generator) generate(ctx context.Context, current *v1alpha1.WireflowPeer
 	if err != nil {
 		return nil, err
 	}
+	// 出口节点只提供给策略允许向其发送全部流量的 peer
+	msg.ComputedPeers = offerExitNodes(msg.Current, msg.ComputedPeers, snapshot.Policies)
+
+	// 开启 PresharedKeys 的网络为每一对 peer 派生独立的 PSK；
+	// 与对端网络之间的链路只要任一网络开启即使用 PSK
+	if snapshot.Network != nil {
+		if err = d.applyPresharedKeys(ctx, msg, snapshot.Network); err != nil {
+			return nil, err
+		}
+	}
 
 	if snapshot.Policies != nil {
 		msg.Policies = make([]*infra.Policy, 0)
@@ -472,3 +530,49 @@ func (d *Generator) getPeerFromLabels(ctx context.Context, namespace, networkNam
 
 	return result, nil
 }
+
+// dnsZone returns the overlay DNS zone of network: its peers answer as
+// <peer>.<network>.<domain>, next to the custom records and forwarders.
+// Records are sorted so the configuration hash stays stable.
+func dnsZone(network *v1alpha1.WireflowNetwork, records []*v1alpha1.WireflowDNSRecord) *infra.DNSConfig {
+	domain := strings.Trim(strings.ToLower(network.Spec.Dns.Domain), ".")
+	if domain == "" {
+		domain = infra.DefaultDNSDomain
+	}
+	label := infra.DNSLabel(network.Spec.Name)
+	if label == "" {
+		label = infra.DNSLabel(network.Name)
+	}
+	zone := &infra.DNSConfig{
+		Domain:  label + "." + domain,
+		Servers: network.Spec.Dns.Servers,
+	}
+
+	for _, f := range network.Spec.Dns.Forwarders {
+		zone.Forwarders = append(zone.Forwarders, infra.DNSForwarder{
+			Domain:  strings.Trim(strings.ToLower(f.Domain), "."),
+			Servers: f.Servers,
+		})
+	}
+	for _, r := range records {
+		name := strings.ToLower(r.Spec.Name)
+		if strings.HasSuffix(name, ".") {
+			name = strings.TrimSuffix(name, ".")
+		} else {
+			name += "." + zone.Domain
+		}
+		zone.Records = append(zone.Records, infra.DNSRecord{
+			Name:   name,
+			Type:   strings.ToUpper(r.Spec.Type),
+			TTL:    r.Spec.TTL,
+			Values: r.Spec.Values,
+		})
+	}
+	sort.SliceStable(zone.Records, func(i, j int) bool {
+		if zone.Records[i].Name != zone.Records[j].Name {
+			return zone.Records[i].Name < zone.Records[j].Name
+		}
+		return zone.Records[i].Type < zone.Records[j].Type
+	})
+	return zone
+}
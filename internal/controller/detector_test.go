@@ -0,0 +1,56 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"testing"
+	"wireflow/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDNSZone(t *testing.T) {
+	network := &v1alpha1.WireflowNetwork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "wf-team", Name: "net-1"},
+		Spec: v1alpha1.WireflowNetworkSpec{
+			Name: "Office LAN",
+			Dns:  v1alpha1.DNSConfig{Enabled: true, Servers: []string{"1.1.1.1"}},
+		},
+	}
+	zone := dnsZone(network, nil)
+	if zone.Domain != "office-lan.wireflow.internal" || len(zone.Servers) != 1 {
+		t.Fatalf("unexpected zone %+v", zone)
+	}
+
+	network.Spec.Name = ""
+	network.Spec.Dns.Domain = "Corp.Example."
+	network.Spec.Dns.Forwarders = []v1alpha1.DNSForwarder{{Domain: "Corp.Internal.", Servers: []string{"192.168.1.53"}}}
+	records := []*v1alpha1.WireflowDNSRecord{
+		{Spec: v1alpha1.WireflowDNSRecordSpec{Network: "net-1", Name: "wiki", Type: "cname", Values: []string{"db"}}},
+		{Spec: v1alpha1.WireflowDNSRecordSpec{Network: "net-1", Name: "DB.corp.internal.", Type: "A", Values: []string{"192.168.1.10"}}},
+	}
+	zone = dnsZone(network, records)
+	if zone.Domain != "net-1.corp.example" {
+		t.Fatalf("unexpected domain %q", zone.Domain)
+	}
+	if len(zone.Forwarders) != 1 || zone.Forwarders[0].Domain != "corp.internal" {
+		t.Fatalf("unexpected forwarders %+v", zone.Forwarders)
+	}
+	if len(zone.Records) != 2 ||
+		zone.Records[0].Name != "db.corp.internal" ||
+		zone.Records[1].Name != "wiki.net-1.corp.example" || zone.Records[1].Type != "CNAME" {
+		t.Fatalf("unexpected records %+v", zone.Records)
+	}
+}
@@ -52,10 +52,11 @@ func (r *firewallRuleResolver) ResolveRules(ctx context.Context, currentPeer *in
 	// [Step 1] 构建当前网络内所有 Peer 的 IP 集合。
 	// getPeerFromLabels 会跨全集群查询，这里用网络内的 IP 做二次过滤，
 	// 确保只有同一网络内的 Peer IP 才会写入防火墙规则。
-	networkPeerIPs := make(map[string]struct{}, len(network.Peers))
+	// 值为该 Peer 作为子网路由器所服务的网段，随其 IP 一起放行。
+	networkPeerIPs := make(map[string][]string, len(network.Peers))
 	for _, p := range network.Peers {
 		if p.Address != nil {
-			networkPeerIPs[cleanIP(p.Address)] = struct{}{}
+			networkPeerIPs[cleanIP(p.Address)] = p.Routes
 		}
 	}
 
@@ -72,13 +73,14 @@ func (r *firewallRuleResolver) ResolveRules(ctx context.Context, currentPeer *in
 					continue
 				}
 				// 只允许同一网络内的 Peer，过滤掉来自其他网络的 IP
-				if _, inNetwork := networkPeerIPs[srcIP]; !inNetwork {
+				routes, inNetwork := networkPeerIPs[srcIP]
+				if !inNetwork {
 					log.Info("Skipping peer not in current network", "peer", sourcePeer.Name, "ip", srcIP)
 					continue
 				}
 				trafficRule := infra.TrafficRule{
 					ChainName: "WIREFLOW-INGRESS",
-					Peers:     []string{srcIP},
+					Peers:     append([]string{srcIP}, routes...),
 					Port:      rule.Port,
 					Protocol:  rule.Protocol,
 					Action:    "ACCEPT",
@@ -99,13 +101,14 @@ func (r *firewallRuleResolver) ResolveRules(ctx context.Context, currentPeer *in
 				if destIP == "" {
 					continue
 				}
-				if _, inNetwork := networkPeerIPs[destIP]; !inNetwork {
+				routes, inNetwork := networkPeerIPs[destIP]
+				if !inNetwork {
 					log.Info("Skipping peer not in current network", "peer", destPeer.Name, "ip", destIP)
 					continue
 				}
 				trafficRule := infra.TrafficRule{
 					ChainName: "WIREFLOW-EGRESS",
-					Peers:     []string{destIP},
+					Peers:     append([]string{destIP}, routes...),
 					Port:      rule.Port,
 					Protocol:  rule.Protocol,
 					Action:    "ACCEPT",
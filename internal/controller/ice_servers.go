@@ -0,0 +1,124 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"wireflow/api/v1alpha1"
+	"wireflow/internal/infra"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Secret data keys holding the credentials of a TURN server.
+const (
+	iceUsernameField   = "username"
+	iceCredentialField = "credential"
+)
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// networkICEServers returns the ICE servers that apply to network: its own,
+// or those of its workspace when it names none.
+func networkICEServers(ctx context.Context, c client.Reader, network *v1alpha1.WireflowNetwork) ([]v1alpha1.ICEServer, error) {
+	if len(network.Spec.ICEServers) > 0 {
+		return network.Spec.ICEServers, nil
+	}
+	var ns corev1.Namespace
+	if err := c.Get(ctx, types.NamespacedName{Name: network.Namespace}, &ns); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return workspaceICEServers(&ns)
+}
+
+// workspaceICEServers parses the ICEServersAnnotation of a workspace.
+func workspaceICEServers(ns *corev1.Namespace) ([]v1alpha1.ICEServer, error) {
+	raw := ns.Annotations[v1alpha1.ICEServersAnnotation]
+	if raw == "" {
+		return nil, nil
+	}
+	var servers []v1alpha1.ICEServer
+	if err := json.Unmarshal([]byte(raw), &servers); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation on namespace %s: %w", v1alpha1.ICEServersAnnotation, ns.Name, err)
+	}
+	return servers, nil
+}
+
+// iceServers resolves the ICE servers of network for the network map,
+// reading the credentials of TURN servers from their Secrets.
+func (d *Generator) iceServers(ctx context.Context, network *v1alpha1.WireflowNetwork) ([]infra.ICEServer, error) {
+	servers, err := networkICEServers(ctx, d.client, network)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []infra.ICEServer
+	for _, server := range servers {
+		s := infra.ICEServer{URLs: server.URLs}
+		if server.CredentialRef != "" {
+			key := types.NamespacedName{Namespace: network.Namespace, Name: server.CredentialRef}
+			var secret corev1.Secret
+			if err = d.client.Get(ctx, key, &secret); err != nil {
+				return nil, fmt.Errorf("TURN credentials %s: %w", key, err)
+			}
+			s.Username = string(secret.Data[iceUsernameField])
+			s.Credential = string(secret.Data[iceCredentialField])
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// mapNamespaceForNodes enqueues the peers of the networks that use the ICE
+// servers of a workspace.
+func (r *PeerReconciler) mapNamespaceForNodes(ctx context.Context, obj client.Object) []reconcile.Request {
+	var networks v1alpha1.WireflowNetworkList
+	if err := r.List(ctx, &networks, client.InNamespace(obj.GetName())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range networks.Items {
+		if len(networks.Items[i].Spec.ICEServers) == 0 {
+			requests = append(requests, r.mapNetworkForNodes(ctx, &networks.Items[i])...)
+		}
+	}
+	return requests
+}
+
+// mapSecretForNodes enqueues the peers of the networks whose TURN
+// credentials a Secret holds, so rotated credentials reach the agents.
+func (r *PeerReconciler) mapSecretForNodes(ctx context.Context, obj client.Object) []reconcile.Request {
+	var networks v1alpha1.WireflowNetworkList
+	if err := r.List(ctx, &networks, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range networks.Items {
+		servers, err := networkICEServers(ctx, r.Client, &networks.Items[i])
+		if err != nil {
+			continue
+		}
+		if slices.ContainsFunc(servers, func(s v1alpha1.ICEServer) bool { return s.CredentialRef == obj.GetName() }) {
+			requests = append(requests, r.mapNetworkForNodes(ctx, &networks.Items[i])...)
+		}
+	}
+	return requests
+}
@@ -0,0 +1,79 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"wireflow/api/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGeneratorICEServers(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	workspace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: "wf-ws",
+		Annotations: map[string]string{
+			v1alpha1.ICEServersAnnotation: `[{"urls":["turn:turn.example.com:3478"],"credentialRef":"turn"}]`,
+		},
+	}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "wf-ws", Name: "turn"},
+		Data:       map[string][]byte{"username": []byte("wf"), "credential": []byte("pw")},
+	}
+	g := NewGenerator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(workspace, secret).Build())
+	ctx := context.Background()
+
+	inherited := &v1alpha1.WireflowNetwork{ObjectMeta: metav1.ObjectMeta{Namespace: "wf-ws", Name: "net"}}
+	servers, err := g.iceServers(ctx, inherited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].URLs[0] != "turn:turn.example.com:3478" ||
+		servers[0].Username != "wf" || servers[0].Credential != "pw" {
+		t.Fatalf("unexpected workspace servers %+v", servers)
+	}
+
+	own := &v1alpha1.WireflowNetwork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "wf-ws", Name: "own"},
+		Spec: v1alpha1.WireflowNetworkSpec{ICEServers: []v1alpha1.ICEServer{
+			{URLs: []string{"stun:stun.example.com:3478"}},
+		}},
+	}
+	if servers, err = g.iceServers(ctx, own); err != nil || len(servers) != 1 || servers[0].URLs[0] != "stun:stun.example.com:3478" {
+		t.Fatalf("the servers of the network must win, got %+v: %v", servers, err)
+	}
+
+	missing := &v1alpha1.WireflowNetwork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "wf-ws", Name: "missing"},
+		Spec: v1alpha1.WireflowNetworkSpec{ICEServers: []v1alpha1.ICEServer{
+			{URLs: []string{"turn:turn.example.com:3478"}, CredentialRef: "absent"},
+		}},
+	}
+	if _, err = g.iceServers(ctx, missing); err == nil {
+		t.Fatal("expected an error for a missing credentials Secret")
+	}
+}
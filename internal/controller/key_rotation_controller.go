@@ -0,0 +1,208 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"wireflow/api/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// KeyRotationReconciler drives WireGuard key rotation for peers whose network
+// sets a KeyRotationPolicy. It never generates keys itself: once a peer's key
+// is older than MaxKeyAge it marks the rotation as pending, which the
+// PeerReconciler turns into a KeyChanged message for the agent. The agent
+// generates the new key locally and submits only its public half through the
+// rotateKey NATS endpoint. When the grace window of the replaced key has
+// passed, the reconciler drops it from status so remote peers stop accepting it.
+type KeyRotationReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// +kubebuilder:rbac:groups=wireflowcontroller.wireflow.run,resources=wireflowpeers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=wireflowcontroller.wireflow.run,resources=wireflowpeers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=wireflowcontroller.wireflow.run,resources=wireflownetworks,verbs=get;list;watch
+
+func (r *KeyRotationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx).WithValues("peer", req.NamespacedName)
+
+	var peer v1alpha1.WireflowPeer
+	if err := r.Get(ctx, req.NamespacedName, &peer); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// Shadow peers mirror remote networks and have no agent to rotate.
+	if peer.GetLabels()[LabelShadow] == "true" || peer.Spec.PublicKey == "" {
+		return ctrl.Result{}, nil
+	}
+
+	policy, err := r.getPolicy(ctx, &peer)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	enabled := policy != nil && policy.MaxKeyAge.Duration > 0
+	if !enabled && peer.Status.KeyRotation == nil {
+		return ctrl.Result{}, nil
+	}
+
+	now := time.Now()
+	patch := peer.DeepCopy()
+	if patch.Status.KeyRotation == nil {
+		patch.Status.KeyRotation = &v1alpha1.KeyRotationStatus{}
+	}
+	status := patch.Status.KeyRotation
+
+	var requeueAfter time.Duration
+	requeue := func(d time.Duration) {
+		if requeueAfter == 0 || d < requeueAfter {
+			requeueAfter = d
+		}
+	}
+
+	// The replaced key is no longer accepted once its grace window is over.
+	if status.PreviousPublicKey != "" {
+		if status.PreviousKeyExpiresAt == nil || !now.Before(status.PreviousKeyExpiresAt.Time) {
+			r.event(&peer, corev1.EventTypeNormal, "PreviousKeyExpired",
+				"previous key %s is no longer accepted", status.PreviousPublicKey)
+			status.PreviousPublicKey = ""
+			status.PreviousKeyExpiresAt = nil
+		} else {
+			requeue(status.PreviousKeyExpiresAt.Sub(now))
+		}
+	}
+
+	if status.KeyCreatedAt == nil {
+		// Peers registered before rotation was tracked have no record of when
+		// their key was created; count from the peer's creation instead.
+		createdAt := peer.CreationTimestamp
+		status.KeyCreatedAt = &createdAt
+	}
+
+	switch {
+	case !enabled:
+		// Rotation was switched off; withdraw a request the agent has not served yet.
+		status.Pending = false
+		status.RequestedAt = nil
+	case !status.Pending:
+		due := status.KeyCreatedAt.Add(policy.MaxKeyAge.Duration)
+		if now.Before(due) {
+			requeue(due.Sub(now))
+			break
+		}
+		requestedAt := metav1.NewTime(now)
+		status.Pending = true
+		status.RequestedAt = &requestedAt
+		log.Info("Key exceeded maxKeyAge, requesting rotation", "keyCreatedAt", status.KeyCreatedAt, "maxKeyAge", policy.MaxKeyAge.Duration)
+		r.event(&peer, corev1.EventTypeNormal, "KeyRotationRequested",
+			"key created at %s exceeds maxKeyAge %s", status.KeyCreatedAt.Format(time.RFC3339), policy.MaxKeyAge.Duration)
+	}
+
+	if !equality.Semantic.DeepEqual(peer.Status.KeyRotation, patch.Status.KeyRotation) {
+		if err = r.Status().Patch(ctx, patch, client.MergeFrom(&peer)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// getPolicy returns the rotation policy of the peer's network, or nil when the
+// peer has no network or the network does not rotate keys.
+func (r *KeyRotationReconciler) getPolicy(ctx context.Context, peer *v1alpha1.WireflowPeer) (*v1alpha1.KeyRotationPolicy, error) {
+	if peer.Spec.Network == nil {
+		return nil, nil
+	}
+	var network v1alpha1.WireflowNetwork
+	if err := r.Get(ctx, types.NamespacedName{Namespace: peer.Namespace, Name: *peer.Spec.Network}, &network); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return network.Spec.KeyRotation, nil
+}
+
+func (r *KeyRotationReconciler) event(peer *v1alpha1.WireflowPeer, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder != nil {
+		r.Recorder.Eventf(peer, eventType, reason, messageFmt, args...)
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *KeyRotationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("wireflow-key-rotation-controller")
+	}
+
+	// Status-only updates do not bump the generation, so rotation state changes
+	// (written by this controller and by the rotateKey endpoint) need their own check.
+	keyRotationChanged := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldPeer, ok1 := e.ObjectOld.(*v1alpha1.WireflowPeer)
+			newPeer, ok2 := e.ObjectNew.(*v1alpha1.WireflowPeer)
+			if !ok1 || !ok2 {
+				return false
+			}
+			return !equality.Semantic.DeepEqual(oldPeer.Status.KeyRotation, newPeer.Status.KeyRotation)
+		},
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.WireflowPeer{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, keyRotationChanged))).
+		Watches(&v1alpha1.WireflowNetwork{},
+			handler.EnqueueRequestsFromMapFunc(r.mapNetworkForPeers),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Named("keyrotation").
+		Complete(r)
+}
+
+// mapNetworkForPeers enqueues every peer of a network whose spec changed, so a
+// new or modified rotation policy takes effect without waiting for a requeue.
+func (r *KeyRotationReconciler) mapNetworkForPeers(ctx context.Context, obj client.Object) []reconcile.Request {
+	network := obj.(*v1alpha1.WireflowNetwork)
+
+	var peers v1alpha1.WireflowPeerList
+	if err := r.List(ctx, &peers, client.InNamespace(network.Namespace),
+		client.MatchingLabels{fmt.Sprintf("wireflow.run/network-%s", network.Name): "true"}); err != nil {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(peers.Items))
+	for _, peer := range peers.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: peer.Namespace, Name: peer.Name},
+		})
+	}
+	return requests
+}
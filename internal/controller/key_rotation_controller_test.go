@@ -0,0 +1,124 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wireflow/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newKeyRotationReconciler(t *testing.T, maxAge time.Duration, peer *v1alpha1.WireflowPeer) *KeyRotationReconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	network := &v1alpha1.WireflowNetwork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: peer.Namespace, Name: *peer.Spec.Network},
+		Spec: v1alpha1.WireflowNetworkSpec{
+			KeyRotation: &v1alpha1.KeyRotationPolicy{MaxKeyAge: metav1.Duration{Duration: maxAge}},
+		},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(network, peer).
+		WithStatusSubresource(peer).
+		Build()
+	return &KeyRotationReconciler{Client: c, Scheme: scheme}
+}
+
+func newRotationPeer(status *v1alpha1.KeyRotationStatus) *v1alpha1.WireflowPeer {
+	network := "net"
+	return &v1alpha1.WireflowPeer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "peer"},
+		Spec: v1alpha1.WireflowPeerSpec{
+			Network:   &network,
+			PublicKey: "08v7fO4FCBQutPFgUEZvUNj8KYE3IvOynDJD7OYAemc=",
+		},
+		Status: v1alpha1.WireflowPeerStatus{KeyRotation: status},
+	}
+}
+
+func TestKeyRotationReconciler(t *testing.T) {
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "peer"}}
+
+	t.Run("requests rotation once the key is too old", func(t *testing.T) {
+		created := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+		r := newKeyRotationReconciler(t, time.Hour, newRotationPeer(&v1alpha1.KeyRotationStatus{KeyCreatedAt: &created}))
+
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+
+		var peer v1alpha1.WireflowPeer
+		if err := r.Get(context.Background(), req.NamespacedName, &peer); err != nil {
+			t.Fatal(err)
+		}
+		if !peer.Status.KeyRotation.Pending || peer.Status.KeyRotation.RequestedAt == nil {
+			t.Fatalf("expected a pending rotation, got %+v", peer.Status.KeyRotation)
+		}
+	})
+
+	t.Run("requeues until the key is due", func(t *testing.T) {
+		created := metav1.NewTime(time.Now())
+		r := newKeyRotationReconciler(t, time.Hour, newRotationPeer(&v1alpha1.KeyRotationStatus{KeyCreatedAt: &created}))
+
+		result, err := r.Reconcile(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RequeueAfter <= 0 || result.RequeueAfter > time.Hour {
+			t.Fatalf("RequeueAfter = %s, want within maxKeyAge", result.RequeueAfter)
+		}
+
+		var peer v1alpha1.WireflowPeer
+		if err = r.Get(context.Background(), req.NamespacedName, &peer); err != nil {
+			t.Fatal(err)
+		}
+		if peer.Status.KeyRotation.Pending {
+			t.Fatal("rotation requested before the key was due")
+		}
+	})
+
+	t.Run("drops the previous key after the grace period", func(t *testing.T) {
+		created := metav1.NewTime(time.Now())
+		expired := metav1.NewTime(time.Now().Add(-time.Minute))
+		r := newKeyRotationReconciler(t, time.Hour, newRotationPeer(&v1alpha1.KeyRotationStatus{
+			KeyCreatedAt:         &created,
+			PreviousPublicKey:    "oldkey",
+			PreviousKeyExpiresAt: &expired,
+		}))
+
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+
+		var peer v1alpha1.WireflowPeer
+		if err := r.Get(context.Background(), req.NamespacedName, &peer); err != nil {
+			t.Fatal(err)
+		}
+		if peer.Status.KeyRotation.PreviousPublicKey != "" || peer.Status.KeyRotation.PreviousKeyExpiresAt != nil {
+			t.Fatalf("previous key still present: %+v", peer.Status.KeyRotation)
+		}
+	})
+}
@@ -33,6 +33,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -64,6 +65,7 @@ type PeerReconciler struct {
 // +kubebuilder:rbac:groups=wireflowcontroller.wireflow.run,resources=wireflowpeers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=wireflowcontroller.wireflow.run,resources=wireflowpeers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=wireflowcontroller.wireflow.run,resources=wireflowpeers/finalizers,verbs=update
+// +kubebuilder:rbac:groups=wireflowcontroller.wireflow.run,resources=wireflowdnsrecords,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -169,17 +171,15 @@ func (r *PeerReconciler) reconcileJoinNetwork(ctx context.Context, peer *v1alpha
 		labels[fmt.Sprintf("wireflow.run/network-%s", network.Name)] = "true"
 		node.SetLabels(labels)
 
-		if node.Spec.PrivateKey == "" {
+		// 私钥由 agent 本地生成并保存，控制面只记录 Register 上报的公钥；
+		// 若 PeerId 缺失（例如手工创建的 peer），从公钥补齐。
+		if node.Spec.PublicKey != "" && node.Spec.PeerId == "" {
 			var key wgtypes.Key
-			key, err = wgtypes.GeneratePrivateKey()
+			key, err = wgtypes.ParseKey(node.Spec.PublicKey)
 			if err != nil {
 				return err
 			}
-
-			node.Spec.PrivateKey = key.String()
-			node.Spec.PublicKey = key.PublicKey().String()
-			// generate peerId
-			node.Spec.PeerId = fmt.Sprintf("%d", infra.FromKey(key.PublicKey()).ToUint64())
+			node.Spec.PeerId = fmt.Sprintf("%d", infra.FromKey(key).ToUint64())
 		}
 
 		return nil
@@ -190,7 +190,7 @@ func (r *PeerReconciler) reconcileJoinNetwork(ctx context.Context, peer *v1alpha
 	}
 
 	if ok {
-		// 注意：当 Spec.PrivateKey 已经由 Register API 预填充时，updateSpec 只会修改 Labels（元数据），
+		// 注意：当 Spec.PublicKey 已经由 Register API 预填充时，updateSpec 只会修改 Labels（元数据），
 		// Labels 变化不会增加 generation，GenerationChangedPredicate 不会触发重入队。
 		// 因此无论 spec 还是 labels 发生变化，都必须显式 RequeueAfter 驱动后续流程。
 		return ctrl.Result{RequeueAfter: time.Millisecond * 100}, nil
@@ -259,6 +259,17 @@ func (r *PeerReconciler) lastReconcile(ctx context.Context, peer *v1alpha1.Wiref
 	// 1) 每次都重新构建 snapshot（不再做 changes 检查）
 	snapshot := r.getPeerStateSnapshot(ctx, peer, request)
 
+	// 子网路由的审批和冲突结果写回 status，供管理员查看
+	status := peer.Status.DeepCopy()
+	if setRouteStatus(status, snapshot.Routes[peer.Name], peer.Generation) {
+		if _, err := r.updateStatus(ctx, peer, func(node *v1alpha1.WireflowPeer) {
+			node.Status.Routes = status.Routes
+			node.Status.Conditions = status.Conditions
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	// 2) 用 WireflowPolicy 计算 computedPeers / computedRules，并生成最终 message
 	message, err := r.generator.generate(ctx, peer, snapshot, r.generator.generateConfigVersion())
 	if err != nil {
@@ -616,8 +627,50 @@ func (r *PeerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		GenericFunc: func(e event.GenericEvent) bool { return false },
 	}
 
+	// 密钥轮换：公钥变化（spec）或轮换状态变化（status，不改变 generation）时，
+	// 同网络内所有 peer 都需要重新生成配置，以便及时切换到新公钥并在宽限期内保留旧公钥。
+	keyRotationPredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldPeer, ok1 := e.ObjectOld.(*v1alpha1.WireflowPeer)
+			newPeer, ok2 := e.ObjectNew.(*v1alpha1.WireflowPeer)
+			if !ok1 || !ok2 {
+				return false
+			}
+			if oldPeer.Spec.PublicKey != newPeer.Spec.PublicKey {
+				return true
+			}
+			// 出口节点与子网路由同样体现在其他 peer 的配置中
+			if oldPeer.Spec.ExitNode != newPeer.Spec.ExitNode ||
+				!reflect.DeepEqual(oldPeer.Spec.AdvertisedRoutes, newPeer.Spec.AdvertisedRoutes) ||
+				!reflect.DeepEqual(oldPeer.Spec.ApprovedRoutes, newPeer.Spec.ApprovedRoutes) {
+				return true
+			}
+			oldKr, newKr := oldPeer.Status.KeyRotation, newPeer.Status.KeyRotation
+			if oldKr == nil || newKr == nil {
+				return oldKr != newKr
+			}
+			return oldKr.Pending != newKr.Pending || oldKr.PreviousPublicKey != newKr.PreviousPublicKey
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+	}
+
+	// 工作空间（Namespace）的 ICE servers 注解变化时，使用它的网络需要重新下发
+	iceServersAnnotationPredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.GetAnnotations()[v1alpha1.ICEServersAnnotation] != e.ObjectNew.GetAnnotations()[v1alpha1.ICEServersAnnotation]
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.WireflowPeer{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&v1alpha1.WireflowPeer{},
+			handler.EnqueueRequestsFromMapFunc(r.mapKeyRotationForNodes),
+			builder.WithPredicates(keyRotationPredicate)).
 		Watches(&v1alpha1.WireflowNetwork{},
 			handler.EnqueueRequestsFromMapFunc(r.mapNetworkForNodes),
 			builder.WithPredicates(networkReadyPredicate)).
@@ -627,6 +680,14 @@ func (r *PeerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Watches(&corev1.ConfigMap{},
 			handler.EnqueueRequestsFromMapFunc(r.mapConfigMapForNodes),
 			builder.WithPredicates(predicate.And(configMapPredicate, ownedCMPredicate))).
+		Watches(&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.mapNamespaceForNodes),
+			builder.WithPredicates(iceServersAnnotationPredicate)).
+		Watches(&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.mapSecretForNodes)).
+		Watches(&v1alpha1.WireflowDNSRecord{},
+			r.dnsRecordHandler(),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Watches(&v1alpha1.WireflowPolicy{},
 			handler.EnqueueRequestsFromMapFunc(r.mapPolicyForNodes),
 			// 不加 onlyUpdatePredicate：新建策略（Create）必须触发 peer reconcile 才能下发配置；
@@ -661,6 +722,81 @@ func (r *PeerReconciler) mapNetworkForNodes(ctx context.Context, obj client.Obje
 	return requests
 }
 
+// dnsRecordHandler enqueues the peers of the network serving a record. A
+// record moved to another network also enqueues the peers of the network it
+// left, which still serve it until they are reconciled.
+func (r *PeerReconciler) dnsRecordHandler() handler.EventHandler {
+	enqueue := func(ctx context.Context, q workqueue.TypedRateLimitingInterface[reconcile.Request], objs ...client.Object) {
+		for _, obj := range objs {
+			for _, req := range r.mapDNSRecordForNodes(ctx, obj) {
+				q.Add(req)
+			}
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, q, e.Object)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			oldRecord, newRecord := e.ObjectOld.(*v1alpha1.WireflowDNSRecord), e.ObjectNew.(*v1alpha1.WireflowDNSRecord)
+			if oldRecord.Spec.Network != newRecord.Spec.Network {
+				enqueue(ctx, q, oldRecord)
+			}
+			enqueue(ctx, q, newRecord)
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, q, e.Object)
+		},
+		GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, q, e.Object)
+		},
+	}
+}
+
+// mapDNSRecordForNodes returns the peers of the network serving the record.
+func (r *PeerReconciler) mapDNSRecordForNodes(ctx context.Context, obj client.Object) []reconcile.Request {
+	record := obj.(*v1alpha1.WireflowDNSRecord)
+	networkLabel := fmt.Sprintf("wireflow.run/network-%s", record.Spec.Network)
+	nodeList := &v1alpha1.WireflowPeerList{}
+	if err := r.List(ctx, nodeList, client.InNamespace(record.Namespace), client.MatchingLabels(map[string]string{networkLabel: "true"})); err != nil {
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(nodeList.Items))
+	for _, node := range nodeList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: node.Namespace, Name: node.Name},
+		})
+	}
+	return requests
+}
+
+// mapKeyRotationForNodes returns the rotated peer together with every peer in its network.
+func (r *PeerReconciler) mapKeyRotationForNodes(ctx context.Context, obj client.Object) []reconcile.Request {
+	peer := obj.(*v1alpha1.WireflowPeer)
+	requests := []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Namespace: peer.Namespace, Name: peer.Name},
+	}}
+	if peer.Spec.Network == nil {
+		return requests
+	}
+
+	nodeList := &v1alpha1.WireflowPeerList{}
+	networkLabel := fmt.Sprintf("wireflow.run/network-%s", *peer.Spec.Network)
+	if err := r.List(ctx, nodeList, client.InNamespace(peer.Namespace), client.MatchingLabels(map[string]string{networkLabel: "true"})); err != nil {
+		return requests
+	}
+	for _, node := range nodeList.Items {
+		if node.Name == peer.Name {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: node.Namespace, Name: node.Name},
+		})
+	}
+	return requests
+}
+
 func (r *PeerReconciler) mapConfigMapForNodes(ctx context.Context, obj client.Object) []reconcile.Request {
 	cm := obj.(*corev1.ConfigMap)
 	var requests []reconcile.Request
@@ -780,6 +916,13 @@ func (r *PeerReconciler) getPeerStateSnapshot(ctx context.Context, current *v1al
 		for _, item := range peerList.Items {
 			snapshot.Peers = append(snapshot.Peers, &item)
 		}
+		snapshot.Routes = resolveRoutes(&network, snapshot.Peers)
+
+		if network.Spec.Dns.Enabled {
+			if snapshot.DNSRecords, err = r.findDNSRecordsByNetwork(ctx, &network); err != nil {
+				return snapshot
+			}
+		}
 	}
 
 	//获取网络策略
@@ -806,6 +949,21 @@ func (r *PeerReconciler) findPeersByNetwork(ctx context.Context, network *v1alph
 	return &peers, nil
 }
 
+// findDNSRecordsByNetwork returns the custom DNS records of network.
+func (r *PeerReconciler) findDNSRecordsByNetwork(ctx context.Context, network *v1alpha1.WireflowNetwork) ([]*v1alpha1.WireflowDNSRecord, error) {
+	var recordList v1alpha1.WireflowDNSRecordList
+	if err := r.List(ctx, &recordList, client.InNamespace(network.Namespace)); err != nil {
+		return nil, err
+	}
+	var records []*v1alpha1.WireflowDNSRecord
+	for i := range recordList.Items {
+		if recordList.Items[i].Spec.Network == network.Name {
+			records = append(records, &recordList.Items[i])
+		}
+	}
+	return records, nil
+}
+
 func (r *PeerReconciler) filterPoliciesForNode(ctx context.Context, peer *v1alpha1.WireflowPeer) ([]*v1alpha1.WireflowPolicy, error) {
 	var policyList v1alpha1.WireflowPolicyList
 	if err := r.List(ctx, &policyList, client.InNamespace(peer.Namespace)); err != nil {
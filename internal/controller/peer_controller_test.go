@@ -16,11 +16,16 @@ package controller
 
 import (
 	"context"
+	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -80,3 +85,48 @@ var _ = Describe("WireflowPeer Controller", func() {
 		})
 	})
 })
+
+func TestDNSRecordHandler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	peer := func(name, network string) *v1alpha1.WireflowPeer {
+		return &v1alpha1.WireflowPeer{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Labels:    map[string]string{"wireflow.run/network-" + network: "true"},
+		}}
+	}
+	r := &PeerReconciler{Client: fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(peer("a1", "net-a"), peer("b1", "net-b"), peer("b2", "net-b")).
+		Build()}
+	record := func(network string) *v1alpha1.WireflowDNSRecord {
+		return &v1alpha1.WireflowDNSRecord{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+			Spec:       v1alpha1.WireflowDNSRecordSpec{Network: network},
+		}
+	}
+
+	updated := func(old, new *v1alpha1.WireflowDNSRecord) []string {
+		q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+		defer q.ShutDown()
+		r.dnsRecordHandler().Update(context.Background(), event.UpdateEvent{ObjectOld: old, ObjectNew: new}, q)
+		var names []string
+		for q.Len() > 0 {
+			req, _ := q.Get()
+			names = append(names, req.Name)
+			q.Done(req)
+		}
+		return names
+	}
+
+	if got := updated(record("net-b"), record("net-b")); len(got) != 2 {
+		t.Fatalf("update within a network enqueued %v, want b1 and b2", got)
+	}
+	got := updated(record("net-a"), record("net-b"))
+	if len(got) != 3 || got[0] != "a1" {
+		t.Fatalf("moving the record enqueued %v, want a1, b1 and b2", got)
+	}
+}
@@ -92,6 +92,42 @@ func GetComputedPeers(current *infra.Peer, network *infra.Network, policies []*v
 	return result
 }
 
+// offerExitNodes clears ExitNode on the peers current may not use as its exit
+// node. Routing all traffic through a peer is only allowed when a policy
+// selecting current has an egress rule without ports that targets the peer.
+func offerExitNodes(current *infra.Peer, peers []*infra.Peer, policies []*v1alpha1.WireflowPolicy) []*infra.Peer {
+	for i, peer := range peers {
+		if !peer.ExitNode || exitNodeAllowed(current, peer, policies) {
+			continue
+		}
+		// peers are shared with Network.Peers, which still advertises the
+		// exit node; only this node's view loses it.
+		denied := *peer
+		denied.ExitNode = false
+		peers[i] = &denied
+	}
+	return peers
+}
+
+func exitNodeAllowed(current, exitNode *infra.Peer, policies []*v1alpha1.WireflowPolicy) bool {
+	for _, policy := range policies {
+		if !matchLabels(current, &policy.Spec.PeerSelector) {
+			continue
+		}
+		for _, egress := range policy.Spec.Egress {
+			if len(egress.Ports) > 0 {
+				continue
+			}
+			for _, selection := range egress.To {
+				if len(resolveSelectionToPeers(selection, []*infra.Peer{exitNode})) > 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 func matchLabels(current *infra.Peer, peerSelector *metav1.LabelSelector) bool {
 	selector, _ := metav1.LabelSelectorAsSelector(peerSelector)
 	// 1. 检查当前 Policy 是否适用于当前节点 (Selector 匹配)
@@ -16,6 +16,10 @@ package controller
 
 import (
 	"testing"
+	"wireflow/api/v1alpha1"
+	"wireflow/internal/infra"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestPeerResolver_ResolvePeers(t *testing.T) {
@@ -24,3 +28,42 @@ func TestPeerResolver_ResolvePeers(t *testing.T) {
 
 	})
 }
+
+func TestOfferExitNodes(t *testing.T) {
+	selector := func(role string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{"role": role}}
+	}
+	current := &infra.Peer{Name: "laptop", Labels: map[string]string{"role": "staff"}}
+	office := &infra.Peer{Name: "office", ExitNode: true, Labels: map[string]string{"role": "office"}}
+	db := &infra.Peer{Name: "db", ExitNode: true, Labels: map[string]string{"role": "db"}}
+
+	policies := []*v1alpha1.WireflowPolicy{{
+		Spec: v1alpha1.WireflowPolicySpec{
+			PeerSelector: *selector("staff"),
+			Egress: []v1alpha1.EgressRule{
+				{To: []v1alpha1.PeerSelection{{PeerSelector: selector("office")}}},
+				// A port-restricted rule does not cover internet traffic.
+				{
+					To:    []v1alpha1.PeerSelection{{PeerSelector: selector("db")}},
+					Ports: []v1alpha1.NetworkPolicyPort{{Port: 5432, Protocol: "tcp"}},
+				},
+			},
+		},
+	}}
+
+	peers := offerExitNodes(current, []*infra.Peer{db, office}, policies)
+	if peers[0].ExitNode {
+		t.Error("db must not be offered as exit node")
+	}
+	if !db.ExitNode {
+		t.Error("offerExitNodes must not modify the shared peer")
+	}
+	if !peers[1].ExitNode {
+		t.Error("office must be offered as exit node")
+	}
+
+	other := &infra.Peer{Name: "ci", Labels: map[string]string{"role": "ci"}}
+	if peers = offerExitNodes(other, []*infra.Peer{office}, policies); peers[0].ExitNode {
+		t.Error("exit node offered to a peer no policy selects")
+	}
+}
@@ -128,11 +128,11 @@ func (r *NetworkPeeringReconciler) reconcileNormal(ctx context.Context, peering
 
 	// 4. Create/update shadow peer of GatewayA in NamespaceB.
 	//    GatewayB will connect to this shadow to establish the inter-gateway tunnel.
-	if err := r.ensureShadowPeer(ctx, peering, gatewayA, peering.Spec.NamespaceB, networkB.Name, cidrA); err != nil {
+	if err := r.ensureShadowPeer(ctx, peering, gatewayA, networkA, peering.Spec.NamespaceB, networkB.Name, cidrA); err != nil {
 		return ctrl.Result{}, fmt.Errorf("shadow peer for gateway A in namespace B: %w", err)
 	}
 	// 5. Create/update shadow peer of GatewayB in NamespaceA.
-	if err := r.ensureShadowPeer(ctx, peering, gatewayB, peering.Spec.NamespaceA, networkA.Name, cidrB); err != nil {
+	if err := r.ensureShadowPeer(ctx, peering, gatewayB, networkB, peering.Spec.NamespaceA, networkA.Name, cidrB); err != nil {
 		return ctrl.Result{}, fmt.Errorf("shadow peer for gateway B in namespace A: %w", err)
 	}
 
@@ -236,11 +236,12 @@ func (r *NetworkPeeringReconciler) removeAnnotation(ctx context.Context, peer *v
 }
 
 // ensureShadowPeer creates or updates the shadow WireflowPeer that represents
-// srcGateway in the given target namespace.
+// srcGateway of srcNetwork in the given target namespace.
 func (r *NetworkPeeringReconciler) ensureShadowPeer(
 	ctx context.Context,
 	peering *v1alpha1.WireflowNetworkPeering,
 	srcGateway *v1alpha1.WireflowPeer,
+	srcNetwork *v1alpha1.WireflowNetwork,
 	targetNS, targetNetwork, srcCIDR string,
 ) error {
 	name := shadowPeerName(peering.Name)
@@ -253,6 +254,8 @@ func (r *NetworkPeeringReconciler) ensureShadowPeer(
 			Labels: map[string]string{
 				LabelShadow:   "true",
 				networkLabel:  "true",
+				LabelShadowNamespace: srcNetwork.Namespace,
+				LabelShadowNetwork:   srcNetwork.Name,
 			},
 			Annotations: map[string]string{
 				AnnotationShadowAllowedIPs: srcCIDR,
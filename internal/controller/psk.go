@@ -0,0 +1,172 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"wireflow/api/v1alpha1"
+	"wireflow/internal/infra"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// presharedKeySeedField is the Secret data key holding a network's PSK seed.
+const presharedKeySeedField = "seed"
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create
+
+// presharedKeySecretName returns the name of the Secret holding the PSK seed of a network.
+func presharedKeySecretName(network string) string {
+	return fmt.Sprintf("%s-psk", network)
+}
+
+// presharedKeySeed returns the random seed from which the PSKs of a network are
+// derived, creating it on first use. The seed Secret is owned by the network
+// and is garbage-collected with it.
+func (d *Generator) presharedKeySeed(ctx context.Context, network *v1alpha1.WireflowNetwork) ([]byte, error) {
+	key := types.NamespacedName{Namespace: network.Namespace, Name: presharedKeySecretName(network.Name)}
+
+	var secret corev1.Secret
+	err := d.client.Get(ctx, key, &secret)
+	if err == nil {
+		seed := secret.Data[presharedKeySeedField]
+		if len(seed) != sha256.Size {
+			return nil, fmt.Errorf("preshared key seed %s is malformed", key)
+		}
+		return seed, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	seed := make([]byte, sha256.Size)
+	if _, err = rand.Read(seed); err != nil {
+		return nil, err
+	}
+	secret = corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "wireflow-controller",
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{presharedKeySeedField: seed},
+	}
+	if err = controllerutil.SetOwnerReference(network, &secret, d.client.Scheme()); err != nil {
+		return nil, err
+	}
+	// A concurrent reconcile may have created the seed first; AlreadyExists is
+	// returned so the request is retried and picks up the stored seed.
+	if err = d.client.Create(ctx, &secret); err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+// derivePresharedKey derives the PSK shared by two peers from the network seed
+// and both public keys. The result does not depend on argument order, so each
+// side computes the same key, and it changes whenever either peer rotates its
+// WireGuard key.
+func derivePresharedKey(seed []byte, a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	mac := hmac.New(sha256.New, seed)
+	mac.Write([]byte("wireflow psk v1\x00"))
+	mac.Write([]byte(a))
+	mac.Write([]byte{0})
+	mac.Write([]byte(b))
+
+	var key wgtypes.Key
+	copy(key[:], mac.Sum(nil))
+	return key.String()
+}
+
+// applyPresharedKeys fills in the PSK of every computed peer of msg. Peers of
+// the same network get one when the network enables PresharedKeys. A shadow
+// peer of a peered network gets one when either network enables them, derived
+// from the seed of the lexically smaller network so that both gateways arrive
+// at the same key. Shadow peers of a cluster peering are left without one:
+// the seed of a network in another cluster cannot be read here.
+func (d *Generator) applyPresharedKeys(ctx context.Context, msg *infra.Message, network *v1alpha1.WireflowNetwork) error {
+	var local []byte
+	for i, p := range msg.ComputedPeers {
+		if p.PublicKey == "" {
+			continue
+		}
+		var (
+			seed []byte
+			err  error
+		)
+		if p.Labels[LabelShadow] == "true" {
+			if seed, err = d.peeringSeed(ctx, network, p); err != nil {
+				return err
+			}
+		} else if network.Spec.PresharedKeys {
+			if local == nil {
+				if local, err = d.presharedKeySeed(ctx, network); err != nil {
+					return err
+				}
+			}
+			seed = local
+		}
+		if seed == nil {
+			continue
+		}
+		// ComputedPeers may share entries with Network.Peers; the PSK only
+		// belongs on the copy sent as a computed peer.
+		peer := *p
+		peer.PresharedKey = derivePresharedKey(seed, msg.Current.PublicKey, p.PublicKey)
+		msg.ComputedPeers[i] = &peer
+	}
+	return nil
+}
+
+// peeringSeed returns the seed shared by network and the peered network that
+// shadow stands in for, or nil when neither enables PresharedKeys or the
+// shadow does not name its network.
+func (d *Generator) peeringSeed(ctx context.Context, network *v1alpha1.WireflowNetwork, shadow *infra.Peer) ([]byte, error) {
+	key := types.NamespacedName{Namespace: shadow.Labels[LabelShadowNamespace], Name: shadow.Labels[LabelShadowNetwork]}
+	if key.Name == "" {
+		return nil, nil
+	}
+	var remote v1alpha1.WireflowNetwork
+	if err := d.client.Get(ctx, key, &remote); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !network.Spec.PresharedKeys && !remote.Spec.PresharedKeys {
+		return nil, nil
+	}
+	owner := network
+	if key.String() < client.ObjectKeyFromObject(network).String() {
+		owner = &remote
+	}
+	return d.presharedKeySeed(ctx, owner)
+}
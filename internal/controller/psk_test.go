@@ -0,0 +1,151 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"wireflow/api/v1alpha1"
+	"wireflow/internal/infra"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDerivePresharedKey(t *testing.T) {
+	seed := bytes.Repeat([]byte{1}, 32)
+	a, b, c := "peer-a", "peer-b", "peer-c"
+
+	ab := derivePresharedKey(seed, a, b)
+	if _, err := wgtypes.ParseKey(ab); err != nil {
+		t.Fatalf("derived PSK is not a valid key: %v", err)
+	}
+	if ab != derivePresharedKey(seed, b, a) {
+		t.Fatal("both sides of a pair must derive the same PSK")
+	}
+	if ab == derivePresharedKey(seed, a, c) {
+		t.Fatal("different pairs must not share a PSK")
+	}
+	if ab == derivePresharedKey(bytes.Repeat([]byte{2}, 32), a, b) {
+		t.Fatal("different seeds must not yield the same PSK")
+	}
+}
+
+func TestApplyPresharedKeys(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	network := &v1alpha1.WireflowNetwork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "net", UID: "uid"},
+		Spec:       v1alpha1.WireflowNetworkSpec{PresharedKeys: true},
+	}
+	g := NewGenerator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(network).Build())
+
+	shared := &infra.Peer{AppID: "b", PublicKey: "key-b"}
+	msg := &infra.Message{
+		Current: &infra.Peer{AppID: "a", PublicKey: "key-a"},
+		Network: &infra.Network{Peers: []*infra.Peer{shared}},
+		ComputedPeers: []*infra.Peer{
+			shared,
+			{AppID: "s", PublicKey: "key-s", Labels: map[string]string{LabelShadow: "true"}},
+		},
+	}
+
+	if err := g.applyPresharedKeys(context.Background(), msg, network); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ComputedPeers[0].PresharedKey == "" {
+		t.Fatal("expected a PSK for a peer of the same network")
+	}
+	if shared.PresharedKey != "" {
+		t.Fatal("the PSK must not leak into Network.Peers")
+	}
+	if msg.ComputedPeers[1].PresharedKey != "" {
+		t.Fatal("shadow peers must not get a PSK")
+	}
+
+	// The seed is persisted, so the next generation derives the same key.
+	first := msg.ComputedPeers[0].PresharedKey
+	msg.ComputedPeers[0] = shared
+	if err := g.applyPresharedKeys(context.Background(), msg, network); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ComputedPeers[0].PresharedKey != first {
+		t.Fatal("PSK changed between generations without a key rotation")
+	}
+}
+
+func TestApplyPresharedKeysPeered(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	// Only one side enables PSKs; the link between the gateways needs one all
+	// the same, and both sides must derive the same key.
+	networkA := &v1alpha1.WireflowNetwork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ws-a", Name: "net", UID: "uid-a"},
+		Spec:       v1alpha1.WireflowNetworkSpec{PresharedKeys: true},
+	}
+	networkB := &v1alpha1.WireflowNetwork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ws-b", Name: "net", UID: "uid-b"},
+	}
+	g := NewGenerator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(networkA, networkB).Build())
+
+	shadowOf := func(network *v1alpha1.WireflowNetwork, key string) *infra.Peer {
+		return &infra.Peer{AppID: "gw-" + network.Namespace, PublicKey: key, Labels: map[string]string{
+			LabelShadow:          "true",
+			LabelShadowNamespace: network.Namespace,
+			LabelShadowNetwork:   network.Name,
+		}}
+	}
+	msgA := &infra.Message{
+		Current:       &infra.Peer{AppID: "gw-ws-a", PublicKey: "key-a"},
+		ComputedPeers: []*infra.Peer{shadowOf(networkB, "key-b")},
+	}
+	msgB := &infra.Message{
+		Current:       &infra.Peer{AppID: "gw-ws-b", PublicKey: "key-b"},
+		ComputedPeers: []*infra.Peer{shadowOf(networkA, "key-a")},
+	}
+	if err := g.applyPresharedKeys(context.Background(), msgA, networkA); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.applyPresharedKeys(context.Background(), msgB, networkB); err != nil {
+		t.Fatal(err)
+	}
+	pskA, pskB := msgA.ComputedPeers[0].PresharedKey, msgB.ComputedPeers[0].PresharedKey
+	if pskA == "" || pskA != pskB {
+		t.Fatalf("gateways derived PSKs %q and %q, want the same non-empty key", pskA, pskB)
+	}
+
+	// A cluster peering shadow names no network and stays without a PSK.
+	msgA.ComputedPeers = []*infra.Peer{{AppID: "remote", PublicKey: "key-r", Labels: map[string]string{LabelShadow: "true"}}}
+	if err := g.applyPresharedKeys(context.Background(), msgA, networkA); err != nil {
+		t.Fatal(err)
+	}
+	if msgA.ComputedPeers[0].PresharedKey != "" {
+		t.Fatal("a shadow peer of another cluster must not get a PSK")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
+	"wireflow/api/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// peerRoutes is the outcome of the subnet routes advertised by one peer.
+type peerRoutes struct {
+	// Active routes are approved and free of overlaps; they are distributed
+	// to other peers as AllowedIPs of the router.
+	Active []string
+	// Pending routes are advertised but not approved yet.
+	Pending []string
+	// Rejected routes cannot be served.
+	Rejected []rejectedRoute
+}
+
+type rejectedRoute struct {
+	Route  string
+	Reason string
+	Cause  string
+}
+
+// resolveRoutes decides which advertised routes each peer of the network
+// serves. A route must parse as an IPv4 subnet, be approved, and overlap
+// neither the network itself, a peered network, nor a route already claimed
+// by another peer. Claims are settled in peer name order so every reconcile
+// of every peer comes to the same result.
+func resolveRoutes(network *v1alpha1.WireflowNetwork, peers []*v1alpha1.WireflowPeer) map[string]*peerRoutes {
+	type claim struct {
+		prefix netip.Prefix
+		owner  string
+	}
+	var claimed []claim
+	for _, cidr := range networkCIDRs(network, peers) {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			claimed = append(claimed, claim{prefix: prefix.Masked()})
+		}
+	}
+
+	routers := make([]*v1alpha1.WireflowPeer, 0, len(peers))
+	for _, p := range peers {
+		if len(p.Spec.AdvertisedRoutes) > 0 && p.GetLabels()[LabelShadow] != "true" {
+			routers = append(routers, p)
+		}
+	}
+	sort.Slice(routers, func(i, j int) bool { return routers[i].Name < routers[j].Name })
+
+	result := make(map[string]*peerRoutes, len(routers))
+	for _, p := range routers {
+		routes := &peerRoutes{}
+		result[p.Name] = routes
+
+		approved := make(map[netip.Prefix]struct{}, len(p.Spec.ApprovedRoutes))
+		for _, cidr := range p.Spec.ApprovedRoutes {
+			if prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr)); err == nil {
+				approved[prefix.Masked()] = struct{}{}
+			}
+		}
+
+		seen := make(map[netip.Prefix]struct{}, len(p.Spec.AdvertisedRoutes))
+	next:
+		for _, cidr := range p.Spec.AdvertisedRoutes {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+			switch {
+			case err != nil || !prefix.Addr().Is4():
+				routes.Rejected = append(routes.Rejected, rejectedRoute{cidr, v1alpha1.ReasonRoutesInvalid, "not an IPv4 subnet"})
+				continue
+			case prefix.Bits() == 0:
+				routes.Rejected = append(routes.Rejected, rejectedRoute{cidr, v1alpha1.ReasonRoutesInvalid, "default route, use exitNode instead"})
+				continue
+			}
+			prefix = prefix.Masked()
+			if _, dup := seen[prefix]; dup {
+				continue
+			}
+			seen[prefix] = struct{}{}
+
+			if _, ok := approved[prefix]; !ok {
+				routes.Pending = append(routes.Pending, prefix.String())
+				continue
+			}
+			for _, c := range claimed {
+				if !c.prefix.Overlaps(prefix) {
+					continue
+				}
+				cause := fmt.Sprintf("overlaps network %s", c.prefix)
+				if c.owner != "" {
+					cause = fmt.Sprintf("overlaps %s routed by %s", c.prefix, c.owner)
+				}
+				routes.Rejected = append(routes.Rejected, rejectedRoute{prefix.String(), v1alpha1.ReasonRoutesOverlap, cause})
+				continue next
+			}
+			claimed = append(claimed, claim{prefix: prefix, owner: p.Name})
+			routes.Active = append(routes.Active, prefix.String())
+		}
+	}
+	return result
+}
+
+// networkCIDRs returns the subnets already reachable in the network: its own
+// CIDR and those of peered networks, carried by shadow and gateway peers.
+func networkCIDRs(network *v1alpha1.WireflowNetwork, peers []*v1alpha1.WireflowPeer) []string {
+	var cidrs []string
+	if network != nil {
+		if network.Status.ActiveCIDR != "" {
+			cidrs = append(cidrs, network.Status.ActiveCIDR)
+		}
+		if network.Spec.CIDR != "" && network.Spec.CIDR != network.Status.ActiveCIDR {
+			cidrs = append(cidrs, network.Spec.CIDR)
+		}
+	}
+	for _, p := range peers {
+		for k, v := range p.GetAnnotations() {
+			if k == AnnotationShadowAllowedIPs || strings.HasPrefix(k, AnnotationPeeringRoutePrefix) {
+				cidrs = append(cidrs, strings.Split(v, ",")...)
+			}
+		}
+	}
+	return cidrs
+}
+
+// routesCondition summarises routes as the RoutesReady condition of the
+// router. Rejections outrank pending approvals.
+func routesCondition(routes *peerRoutes, generation int64) metav1.Condition {
+	c := metav1.Condition{
+		Type:               v1alpha1.NodeConditionRoutesReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             v1alpha1.ReasonReady,
+		Message:            fmt.Sprintf("serving %s", strings.Join(routes.Active, ", ")),
+		ObservedGeneration: generation,
+	}
+	switch {
+	case len(routes.Rejected) > 0:
+		causes := make([]string, 0, len(routes.Rejected))
+		for _, r := range routes.Rejected {
+			causes = append(causes, fmt.Sprintf("%s: %s", r.Route, r.Cause))
+		}
+		c.Status, c.Reason, c.Message = metav1.ConditionFalse, routes.Rejected[0].Reason, strings.Join(causes, "; ")
+	case len(routes.Pending) > 0:
+		c.Status, c.Reason = metav1.ConditionFalse, v1alpha1.ReasonRoutesPending
+		c.Message = fmt.Sprintf("awaiting approval: %s", strings.Join(routes.Pending, ", "))
+	}
+	return c
+}
+
+// setRouteStatus records routes on the status of peer; nil routes clear it.
+// It reports whether anything changed.
+func setRouteStatus(status *v1alpha1.WireflowPeerStatus, routes *peerRoutes, generation int64) bool {
+	before := status.DeepCopy()
+	if routes == nil {
+		status.Routes = nil
+		meta.RemoveStatusCondition(&status.Conditions, v1alpha1.NodeConditionRoutesReady)
+	} else {
+		status.Routes = routes.Active
+		meta.SetStatusCondition(&status.Conditions, routesCondition(routes, generation))
+	}
+	return !reflect.DeepEqual(before.Routes, status.Routes) || !reflect.DeepEqual(before.Conditions, status.Conditions)
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"wireflow/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveRoutes(t *testing.T) {
+	router := func(name string, advertised, approved []string) *v1alpha1.WireflowPeer {
+		return &v1alpha1.WireflowPeer{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       v1alpha1.WireflowPeerSpec{AdvertisedRoutes: advertised, ApprovedRoutes: approved},
+		}
+	}
+	network := &v1alpha1.WireflowNetwork{Spec: v1alpha1.WireflowNetworkSpec{CIDR: "10.10.0.0/16"}}
+	shadow := &v1alpha1.WireflowPeer{ObjectMeta: metav1.ObjectMeta{
+		Name:        "shadow",
+		Labels:      map[string]string{LabelShadow: "true"},
+		Annotations: map[string]string{AnnotationShadowAllowedIPs: "10.20.0.0/24"},
+	}}
+
+	routes := resolveRoutes(network, []*v1alpha1.WireflowPeer{
+		// Sorted before office-b, so office-a wins the shared subnet.
+		router("office-b", []string{"192.168.1.0/24", "172.16.0.0/16"}, []string{"192.168.1.0/24", "172.16.0.0/16"}),
+		router("office-a", []string{"192.168.1.10/24", "10.10.5.0/24", "10.20.0.0/16", "0.0.0.0/0", "bogus"},
+			[]string{"192.168.1.0/24", "10.10.5.0/24", "10.20.0.0/16"}),
+		router("lab", []string{"172.31.0.0/16"}, nil),
+		shadow,
+	})
+
+	if _, ok := routes["shadow"]; ok {
+		t.Error("shadow peers never route subnets")
+	}
+	a := routes["office-a"]
+	if !reflect.DeepEqual(a.Active, []string{"192.168.1.0/24"}) {
+		t.Errorf("office-a active = %v", a.Active)
+	}
+	reasons := map[string]string{}
+	for _, r := range a.Rejected {
+		reasons[r.Route] = r.Reason
+	}
+	want := map[string]string{
+		"10.10.5.0/24": v1alpha1.ReasonRoutesOverlap, // inside the network
+		"10.20.0.0/16": v1alpha1.ReasonRoutesOverlap, // covers a peered network
+		"0.0.0.0/0":    v1alpha1.ReasonRoutesInvalid,
+		"bogus":        v1alpha1.ReasonRoutesInvalid,
+	}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("office-a rejected = %v, want %v", reasons, want)
+	}
+
+	b := routes["office-b"]
+	if !reflect.DeepEqual(b.Active, []string{"172.16.0.0/16"}) || len(b.Rejected) != 1 || b.Rejected[0].Route != "192.168.1.0/24" {
+		t.Errorf("office-b = %+v", b)
+	}
+	if lab := routes["lab"]; len(lab.Active) != 0 || !reflect.DeepEqual(lab.Pending, []string{"172.31.0.0/16"}) {
+		t.Errorf("lab = %+v", lab)
+	}
+}
+
+func TestSetRouteStatus(t *testing.T) {
+	var status v1alpha1.WireflowPeerStatus
+	if !setRouteStatus(&status, &peerRoutes{Pending: []string{"192.168.1.0/24"}}, 1) {
+		t.Fatal("expected a change")
+	}
+	c := status.Conditions[0]
+	if c.Status != metav1.ConditionFalse || c.Reason != v1alpha1.ReasonRoutesPending {
+		t.Fatalf("unexpected condition %+v", c)
+	}
+	if setRouteStatus(&status, &peerRoutes{Pending: []string{"192.168.1.0/24"}}, 1) {
+		t.Fatal("an unchanged outcome must not report a change")
+	}
+
+	setRouteStatus(&status, &peerRoutes{Active: []string{"192.168.1.0/24"}}, 2)
+	if c = status.Conditions[0]; c.Status != metav1.ConditionTrue || !reflect.DeepEqual(status.Routes, []string{"192.168.1.0/24"}) {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	if !setRouteStatus(&status, nil, 3) || len(status.Conditions) != 0 || status.Routes != nil {
+		t.Fatalf("routes must be cleared once nothing is advertised: %+v", status)
+	}
+}
@@ -182,6 +182,13 @@ func Start(flags *config.Config) error {
 		setupLog.Error(err, "unable to create controller", "controller", "WireflowPeer")
 		return err
 	}
+	if err := (&KeyRotationReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KeyRotation")
+		return err
+	}
 	if err := (&NetworkReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
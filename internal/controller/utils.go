@@ -30,6 +30,12 @@ const (
 	// NetworkPeeringReconciler. PeerReconciler skips shadow peers.
 	LabelShadow = "wireflow.run/shadow"
 
+	// LabelShadowNamespace and LabelShadowNetwork name the network a shadow
+	// peer of a WireflowNetworkPeering stands in for. Shadow peers of a
+	// cluster peering carry neither.
+	LabelShadowNamespace = "wireflow.run/shadow-namespace"
+	LabelShadowNetwork   = "wireflow.run/shadow-network"
+
 	// AnnotationShadowAllowedIPs is set on shadow peers and contains the CIDR
 	// of the remote network that should be routed through this peer.
 	// Example: "10.0.1.0/24"
@@ -134,12 +140,20 @@ func transferToPeer(peer *wireflowv1alpha1.WireflowPeer) *infra.Peer {
 		Address:       peer.Status.AllocatedAddress,
 		PublicKey:     peer.Spec.PublicKey,
 		Labels:        peer.GetLabels(),
+		ExitNode:      peer.Spec.ExitNode,
 	}
 
 	if peer.Status.AllocatedAddress != nil {
 		p.AllowedIPs = fmt.Sprintf("%s/32", *peer.Status.AllocatedAddress)
 	}
 
+	// After a rotation the replaced key stays valid on remote peers until the
+	// grace window closes, so in-flight sessions are not cut off.
+	if kr := peer.Status.KeyRotation; kr != nil && kr.PreviousPublicKey != "" && kr.PreviousKeyExpiresAt != nil {
+		p.PreviousPublicKey = kr.PreviousPublicKey
+		p.PreviousKeyExpiresAt = kr.PreviousKeyExpiresAt.Unix()
+	}
+
 	// Shadow peers carry the remote network CIDR in an annotation so that any
 	// peer routing through them gets a route for the entire remote subnet.
 	if shadowCIDR := peer.GetAnnotations()[AnnotationShadowAllowedIPs]; shadowCIDR != "" {
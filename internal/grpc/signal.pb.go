@@ -30,6 +30,7 @@ const (
 	PacketType_OFFER         PacketType = 3 // 业务数据：Offer
 	PacketType_ANSWER        PacketType = 4 //
 	PacketType_MESSAGE       PacketType = 5
+	PacketType_LEAVE         PacketType = 6 // 节点即将离开：立即拆除与其的连接
 )
 
 // Enum value maps for PacketType.
@@ -41,6 +42,7 @@ var (
 		3: "OFFER",
 		4: "ANSWER",
 		5: "MESSAGE",
+		6: "LEAVE",
 	}
 	PacketType_value = map[string]int32{
 		"UNKNOWN":       0,
@@ -49,6 +51,7 @@ var (
 		"OFFER":         3,
 		"ANSWER":        4,
 		"MESSAGE":       5,
+		"LEAVE":         6,
 	}
 )
 
@@ -498,17 +501,18 @@ var file_signal_proto_rawDesc = []byte{
 	0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28,
 	0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x1b, 0x0a, 0x09,
 	0x70, 0x65, 0x65, 0x72, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52,
-	0x08, 0x70, 0x65, 0x65, 0x72, 0x49, 0x6e, 0x66, 0x6f, 0x2a, 0x63, 0x0a, 0x0a, 0x50, 0x61, 0x63,
+	0x08, 0x70, 0x65, 0x65, 0x72, 0x49, 0x6e, 0x66, 0x6f, 0x2a, 0x6e, 0x0a, 0x0a, 0x50, 0x61, 0x63,
 	0x6b, 0x65, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f,
 	0x57, 0x4e, 0x10, 0x00, 0x12, 0x11, 0x0a, 0x0d, 0x48, 0x41, 0x4e, 0x44, 0x53, 0x48, 0x41, 0x4b,
 	0x45, 0x5f, 0x53, 0x59, 0x4e, 0x10, 0x01, 0x12, 0x11, 0x0a, 0x0d, 0x48, 0x41, 0x4e, 0x44, 0x53,
 	0x48, 0x41, 0x4b, 0x45, 0x5f, 0x41, 0x43, 0x4b, 0x10, 0x02, 0x12, 0x09, 0x0a, 0x05, 0x4f, 0x46,
 	0x46, 0x45, 0x52, 0x10, 0x03, 0x12, 0x0a, 0x0a, 0x06, 0x41, 0x4e, 0x53, 0x57, 0x45, 0x52, 0x10,
-	0x04, 0x12, 0x0b, 0x0a, 0x07, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x10, 0x05, 0x2a, 0x1f,
-	0x0a, 0x0a, 0x44, 0x69, 0x61, 0x6c, 0x65, 0x72, 0x54, 0x79, 0x70, 0x65, 0x12, 0x07, 0x0a, 0x03,
-	0x49, 0x43, 0x45, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x57, 0x52, 0x52, 0x50, 0x10, 0x01, 0x42,
-	0x0f, 0x5a, 0x0d, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x67, 0x72, 0x70, 0x63,
-	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x04, 0x12, 0x0b, 0x0a, 0x07, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x10, 0x05, 0x12, 0x09,
+	0x0a, 0x05, 0x4c, 0x45, 0x41, 0x56, 0x45, 0x10, 0x06, 0x2a, 0x1f, 0x0a, 0x0a, 0x44, 0x69, 0x61,
+	0x6c, 0x65, 0x72, 0x54, 0x79, 0x70, 0x65, 0x12, 0x07, 0x0a, 0x03, 0x49, 0x43, 0x45, 0x10, 0x00,
+	0x12, 0x08, 0x0a, 0x04, 0x57, 0x52, 0x52, 0x50, 0x10, 0x01, 0x42, 0x0f, 0x5a, 0x0d, 0x69, 0x6e,
+	0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
 }
 
 var (
@@ -40,6 +40,13 @@ type NodeInterface interface {
 	RemovePeer(peer *Peer) error
 
 	RemoveAllPeers()
+
+	// ListPeers returns every peer the node currently knows about, itself included.
+	ListPeers() []*Peer
+
+	// RotateKey replaces the local WireGuard key pair with a freshly generated
+	// one and registers its public key with the control plane.
+	RotateKey(ctx context.Context) error
 }
 
 // KeyManager manage the device keys
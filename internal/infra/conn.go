@@ -49,6 +49,14 @@ type DefaultBind struct {
 	PublicKey    wgtypes.Key
 	keyManager   KeyManager
 	wrrperClient Wrrp
+	// relays carries the traffic of peers reached through a TURN relay of
+	// this node; relayDone ends its ReceiveFunc when the bind closes.
+	relays    *RelayConns
+	relayDone chan struct{}
+	// onDemand receives what WireGuard sends to peers not connected yet.
+	onDemand *OnDemand
+	// taps observe the encrypted traffic sent and received.
+	taps *Taps
 
 	// passThroughCh receives non-STUN packets forwarded by FilteringUDPMux (v4).
 	// makeReceiveIPv4 reads from here instead of the raw socket.
@@ -82,10 +90,13 @@ type BindConfig struct {
 	PassThrough6 <-chan PassThroughPacket // non-STUN v6 packets from FilteringUDPMux (v6)
 	WrrpClient   Wrrp
 	KeyManager   KeyManager
+	Relays       *RelayConns
+	OnDemand     *OnDemand
+	Taps         *Taps
 }
 
 func NewBind(cfg *BindConfig) *DefaultBind {
-	return &DefaultBind{
+	b := &DefaultBind{
 		logger:        cfg.Logger,
 		v4conn:        cfg.V4Conn,
 		v6conn:        cfg.V6Conn,
@@ -93,6 +104,9 @@ func NewBind(cfg *BindConfig) *DefaultBind {
 		passThrough6Ch: cfg.PassThrough6,
 		keyManager:    cfg.KeyManager,
 		wrrperClient:  cfg.WrrpClient,
+		relays:        cfg.Relays,
+		onDemand:      cfg.OnDemand,
+		taps:          cfg.Taps,
 		udpAddrPool: sync.Pool{
 			New: func() any {
 				return &net.UDPAddr{
@@ -123,7 +137,12 @@ func NewBind(cfg *BindConfig) *DefaultBind {
 			},
 		},
 	}
-
+	if cfg.OnDemand != nil {
+		cfg.OnDemand.mu.Lock()
+		cfg.OnDemand.bind = b
+		cfg.OnDemand.mu.Unlock()
+	}
+	return b
 }
 
 func (b *DefaultBind) GetPackectConn4() net.PacketConn {
@@ -172,6 +191,22 @@ func (b *DefaultBind) ParseEndpoint(s string) (conn.Endpoint, error) {
 		}, nil
 	}
 
+	if IsRelayFakeAddr(e.Addr()) {
+		return &WRRPEndpoint{
+			Addr:          e,
+			RemoteId:      RemoteIdFromWrrpFakeAddr(e.Addr()),
+			TransportType: TURN,
+		}, nil
+	}
+
+	if IsLazyFakeAddr(e.Addr()) {
+		return &WRRPEndpoint{
+			Addr:          e,
+			RemoteId:      RemoteIdFromWrrpFakeAddr(e.Addr()),
+			TransportType: LAZY,
+		}, nil
+	}
+
 	return &WRRPEndpoint{
 		Addr:          e,
 		TransportType: ICE,
@@ -253,6 +288,17 @@ func (b *DefaultBind) Open(uport uint16) ([]conn.ReceiveFunc, uint16, error) {
 		fns = append(fns, b.wrrperClient.ReceiveFunc())
 	}
 
+	if b.relays != nil {
+		b.relayDone = make(chan struct{})
+		fns = append(fns, b.relays.ReceiveFunc(b.relayDone))
+	}
+
+	if b.taps != nil {
+		for i, fn := range fns {
+			fns[i] = b.taps.tapReceive(fn)
+		}
+	}
+
 	return fns, uint16(port), nil
 }
 
@@ -319,6 +365,11 @@ func (b *DefaultBind) Close() error {
 		b.ipv6PC = nil
 	}
 
+	if b.relayDone != nil {
+		close(b.relayDone)
+		b.relayDone = nil
+	}
+
 	b.blackhole4 = false
 	b.blackhole6 = false
 	if err1 != nil {
@@ -339,6 +390,10 @@ func (b *DefaultBind) Send(bufs [][]byte, endpoint conn.Endpoint) error {
 		return fmt.Errorf("endpoint is not WRRPEndpoint")
 	}
 
+	if e.TransportType != LAZY {
+		b.taps.underlay(bufs, e, false)
+	}
+
 	if e.TransportType == WRRP {
 		for _, buf := range bufs {
 			err := b.wrrperClient.Send(context.Background(), e.RemoteId, wrrp.Forward, buf)
@@ -349,6 +404,17 @@ func (b *DefaultBind) Send(bufs [][]byte, endpoint conn.Endpoint) error {
 		return nil
 	}
 
+	if e.TransportType == TURN {
+		return b.relays.Send(e.RemoteId, bufs)
+	}
+
+	if e.TransportType == LAZY {
+		if b.onDemand != nil {
+			b.onDemand.send(e.RemoteId, bufs)
+		}
+		return nil
+	}
+
 	b.mu.Lock()
 	blackhole := b.blackhole4
 	conn := b.ipv4
@@ -0,0 +1,42 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import "time"
+
+// HandshakeTimeout is how long after its last WireGuard handshake a tunnel
+// still counts as up. WireGuard re-handshakes every two minutes while
+// traffic or keepalives flow and drops a session after three.
+const HandshakeTimeout = 3 * time.Minute
+
+// PeerConnection is the state of the tunnel to one remote peer, as reported
+// by an agent with its heartbeat.
+type PeerConnection struct {
+	AppID string `json:"appId"`
+	// Transport carries the WireGuard traffic once connected: ICE, TURN or
+	// WRRP. ICEState is the state of the ICE session.
+	Transport     string    `json:"transport,omitempty"`
+	ICEState      string    `json:"iceState,omitempty"`
+	Endpoint      string    `json:"endpoint,omitempty"`
+	LastHandshake time.Time `json:"lastHandshake,omitzero"`
+	RxBytes       int64     `json:"rxBytes"`
+	TxBytes       int64     `json:"txBytes"`
+}
+
+// Connected reports whether the tunnel is up at now: WireGuard completed a
+// handshake within HandshakeTimeout.
+func (c PeerConnection) Connected(now time.Time) bool {
+	return !c.LastHandshake.IsZero() && now.Sub(c.LastHandshake) < HandshakeTimeout
+}
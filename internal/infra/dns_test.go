@@ -0,0 +1,41 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import "testing"
+
+func TestDNSLabel(t *testing.T) {
+	cases := map[string]string{
+		"office":           "office",
+		"Office-PC":        "office-pc",
+		"dev_box.local":    "dev-box-local",
+		"--edge--":         "edge",
+		"___":              "",
+		"":                 "",
+		"wf-7f3a/laptop 2": "wf-7f3a-laptop-2",
+	}
+	for in, want := range cases {
+		if got := DNSLabel(in); got != want {
+			t.Errorf("DNSLabel(%q) = %q, want %q", in, got, want)
+		}
+	}
+	long := ""
+	for i := 0; i < 70; i++ {
+		long += "a"
+	}
+	if got := DNSLabel(long); len(got) != 63 {
+		t.Errorf("DNSLabel of 70 chars has length %d, want 63", len(got))
+	}
+}
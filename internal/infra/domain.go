@@ -22,6 +22,15 @@ var ShowNetLog bool
 
 const (
 	DefaultMTU = 1280
+	// MinMTU is the smallest interface MTU the agent applies.
+	MinMTU = 576
+	// WrrpOverhead is the header WRRP adds to every relayed packet.
+	WrrpOverhead = 28
+	// TurnOverhead is the framing a TURN relay adds to every packet. Until
+	// the channel is bound data goes out in a Send indication: a 20-byte
+	// STUN header, a 12-byte XOR-PEER-ADDRESS, the 4-byte DATA attribute
+	// header and up to 3 bytes of padding. ChannelData needs only 4.
+	TurnOverhead = 40
 	// ConsoleDomain domain for service
 	ConsoleDomain         = "http://console.wireflow.run"
 	ManagementDomain      = "console.wireflow.run"
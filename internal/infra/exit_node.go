@@ -0,0 +1,51 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import "strings"
+
+// ExitNodeMark is the firewall mark put on the agent's underlay sockets while
+// an exit node is in use, and the routing table holding the default route
+// through the tunnel. Marked packets skip that table, so encapsulated traffic
+// never loops back into the interface it came from.
+const ExitNodeMark = 51820
+
+// defaultRoutes are the AllowedIPs added to the exit node peer.
+var defaultRoutes = []string{"0.0.0.0/0", "::/0"}
+
+// ExitNodeAllowedIPs extends allowedIPs, a comma-separated list, with the
+// default routes so the exit node peer accepts and receives all traffic.
+func ExitNodeAllowedIPs(allowedIPs string) string {
+	return AppendAllowedIPs(allowedIPs, defaultRoutes...)
+}
+
+// AppendAllowedIPs adds prefixes to allowedIPs, a comma-separated list,
+// skipping those already present.
+func AppendAllowedIPs(allowedIPs string, extra ...string) string {
+	var prefixes []string
+	seen := make(map[string]struct{})
+	for _, p := range append(strings.Split(allowedIPs, ","), extra...) {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		prefixes = append(prefixes, p)
+	}
+	return strings.Join(prefixes, ",")
+}
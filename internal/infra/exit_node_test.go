@@ -0,0 +1,41 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExitNodeAllowedIPs(t *testing.T) {
+	cases := map[string]string{
+		"":                        "0.0.0.0/0,::/0",
+		"10.0.0.2/32":             "10.0.0.2/32,0.0.0.0/0,::/0",
+		"10.0.0.2/32, 0.0.0.0/0":  "10.0.0.2/32,0.0.0.0/0,::/0",
+		"10.0.0.2/32,10.1.0.0/24": "10.0.0.2/32,10.1.0.0/24,0.0.0.0/0,::/0",
+	}
+	for in, want := range cases {
+		if got := ExitNodeAllowedIPs(in); got != want {
+			t.Errorf("ExitNodeAllowedIPs(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSetPeerAllowedIPs(t *testing.T) {
+	conf := (&SetPeer{AllowedIPs: "10.0.0.2/32,0.0.0.0/0"}).String()
+	if !strings.Contains(conf, "allowed_ip=10.0.0.2/32\nallowed_ip=0.0.0.0/0\n") {
+		t.Fatalf("expected one allowed_ip line per prefix, got:\n%s", conf)
+	}
+}
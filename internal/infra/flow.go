@@ -14,6 +14,11 @@ type TransportType int
 const (
 	ICE TransportType = iota
 	WRRP
+	// TURN is an ICE connection through a TURN relay allocated by this node.
+	TURN
+	// LAZY stands for a peer that is not connected yet; sending to it asks
+	// for a connection.
+	LAZY
 )
 
 func (t TransportType) String() string {
@@ -22,6 +27,10 @@ func (t TransportType) String() string {
 		return "ICE"
 	case WRRP:
 		return "WRRP"
+	case TURN:
+		return "TURN"
+	case LAZY:
+		return "LAZY"
 	default:
 		return "Unknown"
 	}
@@ -31,6 +40,7 @@ func (t TransportType) String() string {
 const (
 	PriorityDirect uint8 = 100 // 比如 LAN 直连
 	PriorityICE    uint8 = 80  // P2P 穿透 (STUN)
+	PriorityTURN   uint8 = 60  // TURN 中转 (ICE relay candidate)
 	PriorityRelay  uint8 = 50  // WRRP 中转 (NATS/Server)
 )
 
@@ -0,0 +1,229 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"wireflow/internal/log"
+)
+
+// JournalFileName is the file, relative to the config directory, recording the
+// kernel changes made by the running agent.
+const JournalFileName = "mutations.json"
+
+// Mutation kinds, selecting how a Mutation is reverted.
+const (
+	// MutationCommand is reverted by running Args as a command.
+	MutationCommand = "command"
+	// MutationNftTable is reverted by deleting the inet table named Args[0].
+	MutationNftTable = "nftables-table"
+	// MutationRestoreFile is reverted by copying the backup Args[1] over the
+	// file Args[0] and removing the backup.
+	MutationRestoreFile = "restore-file"
+)
+
+// Mutation is one change the agent made to the host, described by how to
+// revert it.
+type Mutation struct {
+	Kind string   `json:"kind"`
+	Args []string `json:"args"`
+}
+
+// CommandMutation returns the Mutation reverted by running argv.
+func CommandMutation(argv ...string) Mutation {
+	return Mutation{Kind: MutationCommand, Args: argv}
+}
+
+// mutationKinds are the kinds registered by other packages with
+// RegisterMutationKind, by how they are reverted.
+var mutationKinds = make(map[string]func(args []string) error)
+
+// RegisterMutationKind makes mutations of kind revertible by undo, for changes
+// whose revert logic lives outside this package. It must be called from init,
+// before any journal is opened.
+func RegisterMutationKind(kind string, undo func(args []string) error) {
+	if _, ok := mutationKinds[kind]; ok {
+		panic("infra: mutation kind " + kind + " registered twice")
+	}
+	mutationKinds[kind] = undo
+}
+
+func (m Mutation) key() string {
+	return m.Kind + "\x00" + strings.Join(m.Args, "\x00")
+}
+
+// Journal records every route, address and firewall change the agent makes,
+// on disk, so they can all be reverted: by the agent when it stops, by the
+// next start when the previous agent crashed, or by `wireflow down --purge`.
+// Entries are reverted newest first, so a mutation may depend on the ones
+// recorded before it (a jump rule on its chain, a chain flush on the delete).
+//
+// A nil *Journal records nothing.
+type Journal struct {
+	path   string
+	logger *log.Logger
+
+	mu      sync.Mutex
+	entries []Mutation
+}
+
+// OpenJournal loads the journal stored at path, which may hold entries left
+// behind by an agent that did not shut down cleanly.
+func OpenJournal(path string, logger *log.Logger) (*Journal, error) {
+	j := &Journal{path: path, logger: logger}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return j, nil
+		}
+		return nil, fmt.Errorf("read journal %s: %w", path, err)
+	}
+	if err = json.Unmarshal(data, &j.entries); err != nil {
+		return nil, fmt.Errorf("invalid journal in %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// Len returns the number of recorded mutations.
+func (j *Journal) Len() int {
+	if j == nil {
+		return 0
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.entries)
+}
+
+// Record adds m to the journal. Recording a mutation that is already present
+// is a no-op, so callers can record on every (idempotent) apply.
+func (j *Journal) Record(m Mutation) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range j.entries {
+		if e.key() == m.key() {
+			return
+		}
+	}
+	j.entries = append(j.entries, m)
+	j.persist()
+}
+
+// Forget drops m after the caller reverted it itself.
+func (j *Journal) Forget(m Mutation) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, e := range j.entries {
+		if e.key() == m.key() {
+			j.entries = append(j.entries[:i], j.entries[i+1:]...)
+			j.persist()
+			return
+		}
+	}
+}
+
+// Revert undoes m now and drops it from the journal.
+func (j *Journal) Revert(m Mutation) error {
+	err := undoMutation(m)
+	j.Forget(m)
+	return err
+}
+
+// Undo reverts every recorded mutation, newest first, and removes the journal
+// file. Reverting is best effort: what was already undone, for instance routes
+// that vanished with their interface, fails quietly.
+func (j *Journal) Undo() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if err := undoMutation(j.entries[i]); err != nil {
+			j.logger.Debug("revert failed", "kind", j.entries[i].Kind, "args", j.entries[i].Args, "err", err)
+		}
+	}
+	j.entries = nil
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove journal: %w", err)
+	}
+	return nil
+}
+
+// persist writes the entries atomically; j.mu must be held. A failed write is
+// logged rather than returned: the change it describes has already been made.
+func (j *Journal) persist() {
+	data, err := json.Marshal(j.entries)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(j.path), 0o700)
+	}
+	if err == nil {
+		tmp := j.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			err = os.Rename(tmp, j.path)
+		}
+	}
+	if err != nil {
+		j.logger.Warn("failed to persist mutation journal", "path", j.path, "err", err)
+	}
+}
+
+func undoMutation(m Mutation) error {
+	switch m.Kind {
+	case MutationCommand:
+		if len(m.Args) == 0 {
+			return nil
+		}
+		if out, err := exec.Command(m.Args[0], m.Args[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	case MutationNftTable:
+		if len(m.Args) == 0 {
+			return nil
+		}
+		return deleteNftTable(m.Args[0])
+	case MutationRestoreFile:
+		if len(m.Args) != 2 {
+			return nil
+		}
+		data, err := os.ReadFile(m.Args[1])
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(m.Args[0], data, 0o644); err != nil {
+			return err
+		}
+		return os.Remove(m.Args[1])
+	default:
+		if undo, ok := mutationKinds[m.Kind]; ok {
+			return undo(m.Args)
+		}
+		return fmt.Errorf("unknown mutation kind %q", m.Kind)
+	}
+}
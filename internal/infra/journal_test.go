@@ -0,0 +1,121 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"wireflow/internal/log"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, JournalFileName)
+	out := filepath.Join(dir, "undone")
+	logger := log.GetLogger("journal-test")
+
+	j, err := OpenJournal(path, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendLine := func(s string) Mutation {
+		return CommandMutation("/bin/sh", "-c", "echo "+s+" >> "+out)
+	}
+	j.Record(appendLine("first"))
+	j.Record(appendLine("second"))
+	j.Record(appendLine("first"))
+	j.Record(appendLine("gone"))
+	j.Forget(appendLine("gone"))
+	if j.Len() != 2 {
+		t.Fatalf("Len = %d, want 2: duplicates and forgotten entries must not count", j.Len())
+	}
+
+	// A crashed agent leaves the journal behind for the next one to revert.
+	j, err = OpenJournal(path, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Len() != 2 {
+		t.Fatalf("reopened Len = %d, want 2", j.Len())
+	}
+	if err = j.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second\nfirst\n" {
+		t.Fatalf("undo order = %q, want newest first", data)
+	}
+	if _, err = os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("journal file still present after Undo: %v", err)
+	}
+}
+
+func TestJournalRestoreFile(t *testing.T) {
+	dir := t.TempDir()
+	file, backup := filepath.Join(dir, "resolv.conf"), filepath.Join(dir, "resolv.conf.bak")
+	if err := os.WriteFile(backup, []byte("original\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := OpenJournal(filepath.Join(dir, JournalFileName), log.GetLogger("journal-test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Mutation{Kind: MutationRestoreFile, Args: []string{file, backup}}
+	j.Record(m)
+	if err = j.Revert(m); err != nil {
+		t.Fatal(err)
+	}
+	if j.Len() != 0 {
+		t.Fatalf("Len = %d after Revert, want 0", j.Len())
+	}
+	if data, _ := os.ReadFile(file); string(data) != "original\n" {
+		t.Fatalf("file = %q after Revert, want the backup", data)
+	}
+	if _, err = os.Stat(backup); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("backup still present after Revert: %v", err)
+	}
+}
+
+func TestJournalRegisteredKind(t *testing.T) {
+	var undone []string
+	RegisterMutationKind("journal-test", func(args []string) error {
+		undone = append(undone, args...)
+		return nil
+	})
+	defer delete(mutationKinds, "journal-test")
+
+	j, err := OpenJournal(filepath.Join(t.TempDir(), JournalFileName), log.GetLogger("journal-test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Record(Mutation{Kind: "journal-test", Args: []string{"wf0"}})
+	j.Record(Mutation{Kind: "journal-test", Args: []string{"wf1"}})
+	if err = j.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if len(undone) != 2 || undone[0] != "wf1" || undone[1] != "wf0" {
+		t.Fatalf("undone %v, want newest first", undone)
+	}
+}
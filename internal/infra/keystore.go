@@ -0,0 +1,78 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// PrivateKeyFileName is the file, relative to the config directory, that holds
+// the node's WireGuard private key. The key never leaves the host: only the
+// derived public key is sent to the control plane during registration.
+const PrivateKeyFileName = "private.key"
+
+// LoadOrCreatePrivateKey reads the base64-encoded WireGuard private key stored
+// at path. When the file does not exist a fresh key is generated and persisted
+// with 0600 permissions so that subsequent restarts keep the same identity.
+func LoadOrCreatePrivateKey(path string) (wgtypes.Key, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := wgtypes.ParseKey(strings.TrimSpace(string(data)))
+		if err != nil {
+			return wgtypes.Key{}, fmt.Errorf("invalid private key in %s: %w", path, err)
+		}
+		return key, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return wgtypes.Key{}, fmt.Errorf("read private key %s: %w", path, err)
+	}
+
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return wgtypes.Key{}, err
+	}
+
+	if err = SavePrivateKey(path, key); err != nil {
+		return wgtypes.Key{}, err
+	}
+	return key, nil
+}
+
+// SavePrivateKey atomically writes key to path. The key is first written to a
+// temporary file in the same directory and then renamed, so a crash never
+// leaves a truncated key behind.
+func SavePrivateKey(path string, key wgtypes.Key) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create key dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(key.String()+"\n"), 0o600); err != nil {
+		return fmt.Errorf("write private key: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("persist private key: %w", err)
+	}
+	return nil
+}
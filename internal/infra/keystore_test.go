@@ -0,0 +1,57 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreatePrivateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", PrivateKeyFileName)
+
+	first, err := LoadOrCreatePrivateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("key file permissions = %o, want 600", perm)
+	}
+
+	second, err := LoadOrCreatePrivateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("expected the persisted key to be reused")
+	}
+}
+
+func TestLoadOrCreatePrivateKeyInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), PrivateKeyFileName)
+	if err := os.WriteFile(path, []byte("not-a-key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadOrCreatePrivateKey(path); err == nil {
+		t.Fatal("expected an error for a corrupt key file")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// lazyFakePrefix marks fake IPv6 addresses that stand for peers not
+// connected yet: "fd77:6c61:7a79::", "la"(6c61) + "zy"(7a79). The lower 8
+// bytes carry the RemoteId, as with WRRP.
+var lazyFakePrefix = [6]byte{0xfd, 0x77, 0x6c, 0x61, 0x7a, 0x79}
+
+// LazyFakeAddrPort encodes the RemoteId of a peer that is connected on
+// demand as a fake IPv6 AddrPort, used as its WireGuard endpoint until a
+// connection is set up.
+func LazyFakeAddrPort(remoteId uint64) netip.AddrPort {
+	var b [16]byte
+	copy(b[:6], lazyFakePrefix[:])
+	binary.BigEndian.PutUint64(b[8:], remoteId)
+	return netip.AddrPortFrom(netip.AddrFrom16(b), WrrpFakePort)
+}
+
+// IsLazyFakeAddr reports whether addr was generated by LazyFakeAddrPort.
+func IsLazyFakeAddr(addr netip.Addr) bool {
+	if !addr.Is6() {
+		return false
+	}
+	b := addr.As16()
+	return [6]byte(b[:6]) == lazyFakePrefix
+}
+
+// messageInitiationType and messageInitiationSize identify a WireGuard
+// handshake initiation.
+const (
+	messageInitiationType = 1
+	messageInitiationSize = 148
+)
+
+// OnDemand connects peers when WireGuard first sends to them. A peer that
+// is not connected has the LazyFakeAddrPort endpoint; what WireGuard sends
+// there, a handshake initiation, is held here while the connection is set
+// up, then sent along the new path.
+type OnDemand struct {
+	mu      sync.Mutex
+	pending map[uint64][]byte
+	connect func(remoteId uint64)
+	bind    conn.Bind
+}
+
+func NewOnDemand() *OnDemand {
+	return &OnDemand{pending: make(map[uint64][]byte)}
+}
+
+// SetConnect registers the function that connects to the peer with
+// remoteId. It is called from the WireGuard send path and must not block.
+func (d *OnDemand) SetConnect(connect func(remoteId uint64)) {
+	d.mu.Lock()
+	d.connect = connect
+	d.mu.Unlock()
+}
+
+// send holds the handshake initiation in bufs and asks for a connection.
+// Only the last initiation is kept: WireGuard retransmits it every few
+// seconds, and each one replaces the handshake state of the previous one.
+func (d *OnDemand) send(remoteId uint64, bufs [][]byte) {
+	d.mu.Lock()
+	for _, buf := range bufs {
+		if len(buf) == messageInitiationSize && buf[0] == messageInitiationType {
+			d.pending[remoteId] = append(d.pending[remoteId][:0], buf...)
+		}
+	}
+	connect := d.connect
+	d.mu.Unlock()
+	if connect != nil {
+		connect(remoteId)
+	}
+}
+
+// Flush sends the handshake initiation held for remoteId to endpoint, the
+// path just set up, so that the tunnel comes up without waiting for
+// WireGuard to retransmit it.
+func (d *OnDemand) Flush(remoteId uint64, endpoint string) error {
+	d.mu.Lock()
+	buf := d.pending[remoteId]
+	delete(d.pending, remoteId)
+	bind := d.bind
+	d.mu.Unlock()
+	if buf == nil || bind == nil {
+		return nil
+	}
+	ep, err := bind.ParseEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+	return bind.Send([][]byte{buf}, ep)
+}
+
+// Forget drops what is held for remoteId.
+func (d *OnDemand) Forget(remoteId uint64) {
+	d.mu.Lock()
+	delete(d.pending, remoteId)
+	d.mu.Unlock()
+}
@@ -0,0 +1,100 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+func TestLazyFakeAddr(t *testing.T) {
+	addr := LazyFakeAddrPort(42)
+	if !IsLazyFakeAddr(addr.Addr()) {
+		t.Fatalf("%s not recognized as lazy", addr)
+	}
+	if IsWrrpFakeAddr(addr.Addr()) || IsRelayFakeAddr(addr.Addr()) {
+		t.Fatalf("%s mistaken for a WRRP or relay address", addr)
+	}
+	if IsLazyFakeAddr(WrrpFakeAddrPort(42).Addr()) || IsLazyFakeAddr(RelayFakeAddrPort(42).Addr()) {
+		t.Fatal("WRRP or relay address mistaken for lazy")
+	}
+	if got := RemoteIdFromWrrpFakeAddr(addr.Addr()); got != 42 {
+		t.Fatalf("remote id = %d, want 42", got)
+	}
+}
+
+// recordBind is a conn.Bind that records what is sent through it.
+type recordBind struct {
+	*DefaultBind
+	sent []sentBufs
+}
+
+type sentBufs struct {
+	bufs     [][]byte
+	endpoint conn.Endpoint
+}
+
+func (b *recordBind) Send(bufs [][]byte, ep conn.Endpoint) error {
+	b.sent = append(b.sent, sentBufs{bufs: bufs, endpoint: ep})
+	return nil
+}
+
+func TestOnDemand(t *testing.T) {
+	d := NewOnDemand()
+	bind := NewBind(&BindConfig{OnDemand: d})
+	var asked []uint64
+	d.SetConnect(func(remoteId uint64) { asked = append(asked, remoteId) })
+
+	ep, err := bind.ParseEndpoint(LazyFakeAddrPort(7).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	initiation := make([]byte, messageInitiationSize)
+	initiation[0] = messageInitiationType
+	initiation[4] = 1
+	if err = bind.Send([][]byte{initiation}, ep); err != nil {
+		t.Fatal(err)
+	}
+	// A retransmission replaces the held initiation.
+	initiation[4] = 2
+	if err = bind.Send([][]byte{initiation}, ep); err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 2 || asked[0] != 7 {
+		t.Fatalf("connect called with %v, want 7 twice", asked)
+	}
+
+	// Flush sends the last initiation along the new path, once.
+	rec := &recordBind{DefaultBind: bind}
+	d.bind = rec
+	if err = d.Flush(7, "192.0.2.1:51820"); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.sent) != 1 {
+		t.Fatalf("flush sent %d batches, want 1", len(rec.sent))
+	}
+	if !bytes.Equal(rec.sent[0].bufs[0], initiation) {
+		t.Fatal("flush sent a stale initiation")
+	}
+	if got := rec.sent[0].endpoint.DstToString(); got != netip.MustParseAddrPort("192.0.2.1:51820").String() {
+		t.Fatalf("flush sent to %s", got)
+	}
+	if err = d.Flush(7, "192.0.2.1:51820"); err != nil || len(rec.sent) != 1 {
+		t.Fatalf("second flush sent again (err %v)", err)
+	}
+}
@@ -18,9 +18,11 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -118,32 +120,35 @@ func (c *DetailsInfo) Summary() string {
 
 // Peer is the information of a wireflow peer, contains all the information of a peer
 type Peer struct {
-	Name                string            `json:"name,omitempty"`
-	InterfaceName       string            `json:"interfaceName,omitempty"`
-	Platform            string            `json:"platform,omitempty"`
-	Description         string            `json:"description,omitempty"`
-	NetworkId           string            `json:"NetworkId,omitempty"` // belong to which group
-	CreatedBy           string            `json:"createdBy,omitempty"` // ownerID
-	UserId              uint64            `json:"userId,omitempty"`
-	Hostname            string            `json:"hostname,omitempty"`
-	AppID               string            `json:"appId,omitempty"`
-	Address             *string           `json:"address,omitempty"`
-	Endpoint            string            `json:"endpoint,omitempty"`
-	Remove              bool              `json:"remove,omitempty"` // whether to remove node
-	PresharedKey        string            `json:"presharedKey,omitempty"`
-	PersistentKeepalive int               `json:"persistentKeepalive,omitempty"`
-	PrivateKey          string            `json:"privateKey,omitempty"`
-	PublicKey           string            `json:"publicKey,omitempty"`
-	PeerID              uint64            `json:"peerId,omitempty"`
-	AllowedIPs          string            `json:"allowedIps,omitempty"`
-	ReplacePeers        bool              `json:"replacePeers,omitempty"` // whether to replace peers when updating node
-	Port                int               `json:"port"`
-	GroupName           string            `json:"groupName"`
-	Version             uint64            `json:"version"`
-	LastUpdatedAt       string            `json:"lastUpdatedAt"`
-	Token               string            `json:"token,omitempty"`
-	WrrpUrl             string            `json:"wrrpUrl,omitempty"`
-	Labels              map[string]string `json:"labels,omitempty"`
+	Name                 string            `json:"name,omitempty"`
+	InterfaceName        string            `json:"interfaceName,omitempty"`
+	Platform             string            `json:"platform,omitempty"`
+	Description          string            `json:"description,omitempty"`
+	NetworkId            string            `json:"NetworkId,omitempty"` // belong to which group
+	CreatedBy            string            `json:"createdBy,omitempty"` // ownerID
+	UserId               uint64            `json:"userId,omitempty"`
+	Hostname             string            `json:"hostname,omitempty"`
+	AppID                string            `json:"appId,omitempty"`
+	Address              *string           `json:"address,omitempty"`
+	Endpoint             string            `json:"endpoint,omitempty"`
+	Remove               bool              `json:"remove,omitempty"` // whether to remove node
+	PresharedKey         string            `json:"presharedKey,omitempty"`
+	PersistentKeepalive  int               `json:"persistentKeepalive,omitempty"`
+	PublicKey            string            `json:"publicKey,omitempty"`
+	PreviousPublicKey    string            `json:"previousPublicKey,omitempty"`    // key replaced by the last rotation, accepted until PreviousKeyExpiresAt
+	PreviousKeyExpiresAt int64             `json:"previousKeyExpiresAt,omitempty"` // unix seconds
+	PeerID               uint64            `json:"peerId,omitempty"`
+	AllowedIPs           string            `json:"allowedIps,omitempty"`
+	ReplacePeers         bool              `json:"replacePeers,omitempty"` // whether to replace peers when updating node
+	Port                 int               `json:"port"`
+	GroupName            string            `json:"groupName"`
+	Version              uint64            `json:"version"`
+	LastUpdatedAt        string            `json:"lastUpdatedAt"`
+	Token                string            `json:"token,omitempty"`
+	WrrpUrl              string            `json:"wrrpUrl,omitempty"`
+	Labels               map[string]string `json:"labels,omitempty"`
+	ExitNode             bool              `json:"exitNode,omitempty"` // peer may be used as this node's exit node
+	Routes               []string          `json:"routes,omitempty"`   // approved subnet routes served by the peer
 }
 
 // Network is the network information, contains all peers/policies in the network
@@ -154,6 +159,67 @@ type Network struct {
 	NetworkId   string   `json:"NetworkId"`
 	NetworkName string   `json:"networkName"`
 	Peers       []*Peer  `json:"peers"`
+	// Mtu is the interface MTU the receiving peer should use; zero keeps
+	// DefaultMTU.
+	Mtu int `json:"mtu,omitempty"`
+	// ICEServers replaces the STUN and TURN servers configured on the agent.
+	ICEServers []ICEServer `json:"iceServers,omitempty"`
+	// DNS is set when the network publishes its peers to the overlay DNS.
+	DNS *DNSConfig `json:"dns,omitempty"`
+	// Lazy is set when the peers of the network connect on demand.
+	Lazy *LazyConnections `json:"lazy,omitempty"`
+}
+
+// LazyConnections makes peers connect to each other on the first packet or
+// signal between them rather than at start.
+type LazyConnections struct {
+	// IdleTimeout is how many seconds a connection may carry no traffic
+	// before it is torn down; zero keeps it.
+	IdleTimeout int `json:"idleTimeout,omitempty"`
+}
+
+// DNSConfig is the overlay DNS zone of a network.
+type DNSConfig struct {
+	// Domain is the suffix of the peer names, "<network>.<workspace domain>";
+	// each peer answers as "<peer>.<Domain>".
+	Domain string `json:"domain"`
+	// Servers are the resolvers other names are forwarded to; empty keeps
+	// the resolvers of the host.
+	Servers []string `json:"servers,omitempty"`
+	// Forwarders take precedence over Servers for their domains.
+	Forwarders []DNSForwarder `json:"forwarders,omitempty"`
+	// Records are served next to the peer names.
+	Records []DNSRecord `json:"records,omitempty"`
+}
+
+// DNSForwarder sends the queries for Domain and its subdomains to Servers.
+type DNSForwarder struct {
+	Domain  string   `json:"domain"`
+	Servers []string `json:"servers"`
+}
+
+// DNSRecord is a custom record of the overlay DNS. Name is fully qualified,
+// without the trailing dot; Values hold the data of one record each, in zone
+// file syntax.
+type DNSRecord struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	TTL    int32    `json:"ttl,omitempty"`
+	Values []string `json:"values"`
+}
+
+// ICEServer is a STUN or TURN server used for NAT traversal.
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// TURNCredentials are short-lived credentials for the TURN relays of the
+// control plane, issued to one peer.
+type TURNCredentials struct {
+	Servers   []ICEServer `json:"servers"`
+	ExpiresAt time.Time   `json:"expiresAt"`
 }
 
 type Policy struct {
@@ -167,6 +233,10 @@ type FirewallRule struct {
 	PolicyName string        `json:"policyName"`
 	Ingress    []TrafficRule `json:"ingress,omitempty"`
 	Egress     []TrafficRule `json:"egress,omitempty"`
+	// InternetEgress accepts all egress on the interface, set while the node
+	// routes its internet traffic through an exit node. Overlay destinations
+	// are still subject to the ingress policy of the receiving peer.
+	InternetEgress bool `json:"internetEgress,omitempty"`
 }
 
 type Rule struct {
@@ -177,12 +247,51 @@ type Rule struct {
 
 type TrafficRule struct {
 	ChainName string   `json:"chainName"`
-	Peers     []string `json:"peers,omitempty"` // ip list
+	Peers     []string `json:"peers,omitempty"` // ip or CIDR list
 	Protocol  string   `json:"protocol,omitempty"`
 	Port      int      `json:"port,omitempty"`
 	Action    string   `json:"action,omitempty"` // Accept or drop
 }
 
+// Prefixes parses Peers into IPv4 prefixes; a bare address is a /32. Subnet
+// routes put whole CIDRs next to peer addresses.
+func (tr TrafficRule) Prefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(tr.Peers))
+	for _, peer := range tr.Peers {
+		var (
+			prefix netip.Prefix
+			err    error
+		)
+		if strings.Contains(peer, "/") {
+			prefix, err = netip.ParsePrefix(peer)
+		} else {
+			var addr netip.Addr
+			if addr, err = netip.ParseAddr(peer); err == nil {
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+		}
+		if err != nil || !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("invalid peer address %q", peer)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// IngressSources returns the peer addresses and subnets the ingress rules
+// admit to port over protocol. A rule without protocol and port admits its
+// sources to every port, as in the firewall backends.
+func (r *FirewallRule) IngressSources(protocol string, port int) []string {
+	var sources []string
+	for _, tr := range r.Ingress {
+		if tr.Protocol != "" && tr.Port != 0 && (!strings.EqualFold(tr.Protocol, protocol) || tr.Port != port) {
+			continue
+		}
+		sources = append(sources, tr.Peers...)
+	}
+	return sources
+}
+
 func NewMessage() *Message {
 	return &Message{}
 }
@@ -0,0 +1,32 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import "testing"
+
+func TestIngressSources(t *testing.T) {
+	rule := &FirewallRule{Ingress: []TrafficRule{
+		{Peers: []string{"10.0.0.2"}, Protocol: "tcp", Port: 5432},
+		{Peers: []string{"10.0.0.3"}, Protocol: "tcp", Port: 22},
+		{Peers: []string{"10.0.0.4", "192.168.10.0/24"}},
+	}}
+	got := rule.IngressSources("TCP", 5432)
+	if len(got) != 3 || got[0] != "10.0.0.2" || got[1] != "10.0.0.4" || got[2] != "192.168.10.0/24" {
+		t.Fatalf("IngressSources(tcp, 5432) = %v", got)
+	}
+	if got = rule.IngressSources("udp", 22); len(got) != 2 || got[0] != "10.0.0.4" {
+		t.Fatalf("IngressSources(udp, 22) = %v", got)
+	}
+}
@@ -17,6 +17,7 @@ package infra
 import (
 	"net"
 	"sync"
+	"time"
 
 	"github.com/pion/ice/v4"
 	"github.com/pion/logging"
@@ -42,9 +43,12 @@ type PassThroughPacket struct {
 type FilteringUDPMux struct {
 	// inner is the real UniversalUDPMuxDefault, exposed to ice.Agent via
 	// WithUDPMux / WithUDPMuxSrflx. It holds chanConn as its UDPConn so
-	// its connWorker only consumes packets we explicitly inject.
+	// its connWorker only consumes packets we explicitly inject. Refresh
+	// replaces both.
+	mu       sync.RWMutex
 	inner    *ice.UniversalUDPMuxDefault
 	chanConn *ChanPacketConn
+	logger   logging.LeveledLogger
 
 	realConn      net.PacketConn // true socket; FilteringUDPMux is the sole reader
 	passThroughCh chan<- PassThroughPacket
@@ -57,22 +61,44 @@ type FilteringUDPMux struct {
 // logger may be nil (ICE log disabled).
 // Call SetPassThrough then Start before creating any ICE agents.
 func NewFilteringUDPMux(realConn net.PacketConn, logger logging.LeveledLogger) *FilteringUDPMux {
-	chanConn := newChanPacketConn(realConn)
+	f := &FilteringUDPMux{
+		logger:   logger,
+		realConn: realConn,
+		stopCh:   make(chan struct{}),
+	}
+	f.inner, f.chanConn = f.newInner()
+	return f
+}
+
+func (f *FilteringUDPMux) newInner() (*ice.UniversalUDPMuxDefault, *ChanPacketConn) {
+	chanConn := newChanPacketConn(f.realConn)
 
 	// Give the mux our fake conn, not the real socket.
 	// The mux's connWorker will block on chanConn.ReadFrom, receiving only
 	// packets we inject — it never races with our readLoop.
 	inner := ice.NewUniversalUDPMuxDefault(ice.UniversalUDPMuxParams{
-		Logger:  logger,
+		Logger:  f.logger,
 		UDPConn: chanConn,
 	})
+	return inner, chanConn
+}
 
-	return &FilteringUDPMux{
-		inner:    inner,
-		chanConn: chanConn,
-		realConn: realConn,
-		stopCh:   make(chan struct{}),
-	}
+// Refresh replaces the inner mux. The mux lists the addresses of the host
+// once, when it is created, and ICE gathers its host candidates from that
+// list; after the host network changed, agents created from now on must use
+// a fresh mux. STUN traffic goes to the new mux right away, so the agents of
+// the old one must be restarted; it is closed once grace has passed.
+func (f *FilteringUDPMux) Refresh(grace time.Duration) {
+	inner, chanConn := f.newInner()
+	f.mu.Lock()
+	oldInner, oldConn := f.inner, f.chanConn
+	f.inner, f.chanConn = inner, chanConn
+	f.mu.Unlock()
+
+	time.AfterFunc(grace, func() {
+		_ = oldConn.Close()
+		_ = oldInner.Close()
+	})
 }
 
 // SetPassThrough registers the channel that receives non-STUN (WireGuard)
@@ -83,12 +109,16 @@ func (f *FilteringUDPMux) SetPassThrough(ch chan<- PassThroughPacket) {
 
 // UDPMux returns the UDPMux interface for ice.WithUDPMux (host candidates).
 func (f *FilteringUDPMux) UDPMux() ice.UDPMux {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	return f.inner.UDPMuxDefault
 }
 
 // UDPMuxSrflx returns the UniversalUDPMux interface for ice.WithUDPMuxSrflx
 // (server-reflexive candidates).
 func (f *FilteringUDPMux) UDPMuxSrflx() ice.UniversalUDPMux {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	return f.inner
 }
 
@@ -123,7 +153,10 @@ func (f *FilteringUDPMux) readLoop() {
 
 		if stun.IsMessage(pkt) {
 			// STUN: inject into the mux so connWorker can dispatch by ufrag.
-			f.chanConn.inject(pkt, addr)
+			f.mu.RLock()
+			chanConn := f.chanConn
+			f.mu.RUnlock()
+			chanConn.inject(pkt, addr)
 		} else if f.passThroughCh != nil {
 			// Non-STUN (WireGuard encrypted): forward to DefaultBind.
 			// Allocate a fresh buffer; buf is reused on the next iteration.
@@ -144,6 +177,8 @@ func (f *FilteringUDPMux) Close() error {
 	close(f.stopCh)
 	f.wg.Wait()
 	// Closing chanConn unblocks the mux's connWorker so it can exit.
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	_ = f.chanConn.Close()
 	return f.inner.Close()
 }
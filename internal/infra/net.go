@@ -20,7 +20,15 @@ import (
 	"strings"
 )
 
+// GetCidrFromIP returns the /24 route of an overlay address. An address that
+// already is a CIDR, such as a subnet route, is returned normalised.
 func GetCidrFromIP(address string) string {
+	if strings.Contains(address, "/") {
+		if _, ipNet, err := net.ParseCIDR(address); err == nil {
+			return ipNet.String()
+		}
+		return ""
+	}
 
 	_, ipNet, err := net.ParseCIDR(fmt.Sprint(address, "/24"))
 	if err != nil {
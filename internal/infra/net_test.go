@@ -19,4 +19,8 @@ import "testing"
 func TestGetCidrFromIP(t *testing.T) {
 	s := GetCidrFromIP("10.0.0.2")
 	t.Logf("%s", s)
+
+	if got := GetCidrFromIP("192.168.1.7/16"); got != "192.168.0.0/16" {
+		t.Fatalf("subnet route = %q, want 192.168.0.0/16", got)
+	}
 }
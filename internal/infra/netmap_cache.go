@@ -0,0 +1,172 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// NetworkMapFileName is the file, relative to the config directory, that holds
+// the last network map the agent applied successfully.
+const NetworkMapFileName = "netmap.json"
+
+// networkMapCacheVersion is bumped whenever the on-disk layout changes; files
+// written by another version are ignored rather than misread.
+const networkMapCacheVersion = 1
+
+// cachedNetworkMap is the on-disk envelope of a NetworkMapCache.
+type cachedNetworkMap struct {
+	Version int             `json:"version"`
+	SavedAt int64           `json:"savedAt"`
+	Message json.RawMessage `json:"message"`
+	MAC     string          `json:"mac"`
+}
+
+// NetworkMapCache persists the last applied network map so the agent can bring
+// its data plane up while the control plane is unreachable. Each file is signed
+// with an HMAC keyed from the node's WireGuard private key: a map that was
+// edited on disk, or written under another identity, fails to load.
+type NetworkMapCache struct {
+	path       string
+	keyManager KeyManager
+
+	mu   sync.Mutex
+	last *Message
+}
+
+func NewNetworkMapCache(path string, keyManager KeyManager) *NetworkMapCache {
+	return &NetworkMapCache{path: path, keyManager: keyManager}
+}
+
+// Save atomically replaces the cached network map with msg. Incremental change
+// details are dropped: the cache only describes the desired state, and replaying
+// them on the next start would repeat one-shot actions such as a key rotation.
+// TURN credentials are dropped too, so they never sit on disk; the servers are
+// kept and authenticate again once the control plane sends a fresh map.
+func (c *NetworkMapCache) Save(msg *Message) error {
+	if c == nil || msg == nil {
+		return nil
+	}
+	snapshot := *msg
+	snapshot.Changes = nil
+	if msg.Network != nil && len(msg.Network.ICEServers) > 0 {
+		network := *msg.Network
+		network.ICEServers = make([]ICEServer, len(msg.Network.ICEServers))
+		for i, server := range msg.Network.ICEServers {
+			network.ICEServers[i] = ICEServer{URLs: server.URLs}
+		}
+		snapshot.Network = &network
+	}
+
+	data, err := json.Marshal(&snapshot)
+	if err != nil {
+		return err
+	}
+	entry := cachedNetworkMap{
+		Version: networkMapCacheVersion,
+		SavedAt: time.Now().Unix(),
+		Message: data,
+	}
+	entry.MAC = c.sign(&entry)
+
+	out, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return fmt.Errorf("create network map dir: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err = os.WriteFile(tmp, out, 0o600); err != nil {
+		return fmt.Errorf("write network map: %w", err)
+	}
+	if err = os.Rename(tmp, c.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("persist network map: %w", err)
+	}
+	c.last = &snapshot
+	return nil
+}
+
+// Load returns the cached network map, or nil when nothing has been cached yet.
+func (c *NetworkMapCache) Load() (*Message, error) {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read network map %s: %w", c.path, err)
+	}
+
+	var entry cachedNetworkMap
+	if err = json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("invalid network map in %s: %w", c.path, err)
+	}
+	if entry.Version != networkMapCacheVersion {
+		return nil, fmt.Errorf("network map in %s has version %d, want %d", c.path, entry.Version, networkMapCacheVersion)
+	}
+	if !hmac.Equal([]byte(entry.MAC), []byte(c.sign(&entry))) {
+		return nil, fmt.Errorf("network map in %s failed signature check", c.path)
+	}
+
+	var msg Message
+	if err = json.Unmarshal(entry.Message, &msg); err != nil {
+		return nil, fmt.Errorf("invalid network map in %s: %w", c.path, err)
+	}
+
+	c.mu.Lock()
+	c.last = &msg
+	c.mu.Unlock()
+	return &msg, nil
+}
+
+// Last returns the network map most recently saved or loaded by this cache.
+func (c *NetworkMapCache) Last() *Message {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// sign computes the MAC of entry. The MAC key is derived from the private key
+// rather than being the key itself, so the cache never exposes key material.
+func (c *NetworkMapCache) sign(entry *cachedNetworkMap) string {
+	privateKey := c.keyManager.GetKey()
+	derive := hmac.New(sha256.New, privateKey[:])
+	derive.Write([]byte("wireflow netmap cache v1"))
+
+	mac := hmac.New(sha256.New, derive.Sum(nil))
+	var header [16]byte
+	binary.BigEndian.PutUint64(header[:8], uint64(entry.Version))
+	binary.BigEndian.PutUint64(header[8:], uint64(entry.SavedAt))
+	mac.Write(header[:])
+	mac.Write(entry.Message)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
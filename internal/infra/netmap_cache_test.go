@@ -0,0 +1,109 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func newTestNetworkMapCache(t *testing.T, path string) *NetworkMapCache {
+	t.Helper()
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewNetworkMapCache(path, NewKeyManager(key))
+}
+
+func TestNetworkMapCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), NetworkMapFileName)
+	cache := newTestNetworkMapCache(t, path)
+
+	if msg, err := cache.Load(); err != nil || msg != nil {
+		t.Fatalf("Load on empty cache = %v, %v; want nil, nil", msg, err)
+	}
+
+	msg := &Message{
+		ConfigVersion: "v7",
+		Current:       &Peer{AppID: "a", PublicKey: "key-a"},
+		Changes:       &DetailsInfo{KeyChanged: true},
+		ComputedPeers: []*Peer{{AppID: "b", PublicKey: "key-b"}},
+		Network: &Network{ICEServers: []ICEServer{
+			{URLs: []string{"turn:10.0.0.2:3478"}, Username: "wf", Credential: "turn-secret"},
+		}},
+	}
+	if err := cache.Save(msg); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("cache file permissions = %o, want 600", perm)
+	}
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte("turn-secret")) {
+		t.Fatal("TURN credentials must not be written to disk")
+	}
+
+	loaded, err := cache.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ConfigVersion != "v7" || len(loaded.ComputedPeers) != 1 || loaded.ComputedPeers[0].AppID != "b" {
+		t.Fatalf("unexpected cached map: %+v", loaded)
+	}
+	if loaded.Changes != nil {
+		t.Fatal("incremental changes must not be cached")
+	}
+	if servers := loaded.Network.ICEServers; len(servers) != 1 || servers[0].URLs[0] != "turn:10.0.0.2:3478" {
+		t.Fatalf("unexpected cached ICE servers: %+v", servers)
+	}
+	if msg.Changes == nil || msg.Network.ICEServers[0].Credential == "" {
+		t.Fatal("Save must not modify the applied message")
+	}
+}
+
+func TestNetworkMapCacheRejectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), NetworkMapFileName)
+	cache := newTestNetworkMapCache(t, path)
+	if err := cache.Save(&Message{ConfigVersion: "v1", Current: &Peer{AppID: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, bytes.Replace(data, []byte(`v1`), []byte(`v2`), 1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cache.Load(); err == nil {
+		t.Fatal("expected an error for an edited cache file")
+	}
+
+	// A map signed under a different private key is not ours to apply.
+	if err = cache.Save(&Message{ConfigVersion: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = newTestNetworkMapCache(t, path).Load(); err == nil {
+		t.Fatal("expected an error for a map signed with another key")
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"wireflow/internal/log"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+// nftTableName returns the inet table holding every rule wireflow installs
+// for network. Like the pf anchors, each additional network has a table of
+// its own, named after the network rather than its interface, whose name may
+// change across restarts. The primary network, whose name is empty, keeps the
+// table older agents recorded in their journals.
+func nftTableName(network string) string {
+	if network == "" {
+		return "wireflow"
+	}
+	return "wireflow-" + network
+}
+
+// nftRuleProvisioner programs FirewallRules through nftables. The whole rule
+// set is replaced in a single netlink transaction, so there is never a moment
+// where the interface is unfiltered or only partially filtered, and peer IPs
+// are matched through sets instead of one rule per address.
+type nftRuleProvisioner struct {
+	mu            sync.Mutex
+	interfaceName string
+	network       string
+	logger        *log.Logger
+	journal       *Journal
+	// legacy handles what nftables does not cover yet (Docker NAT) and
+	// removes chains left behind by the iptables backend.
+	legacy *ruleProvisioner
+}
+
+// newNativeRuleProvisioner returns the nftables backend when the host should
+// use it: iptables is missing or is itself the nf_tables shim, and the kernel
+// answers nftables requests. It returns nil when iptables-legacy is in use,
+// since mixing both would evaluate two independent rule sets.
+func newNativeRuleProvisioner(logger *log.Logger, ifaceName, network string, journal *Journal) RuleProvisioner {
+	if out, err := exec.Command("iptables", "-V").Output(); err == nil && !strings.Contains(string(out), "nf_tables") {
+		return nil
+	}
+	conn, err := nftables.New()
+	if err != nil {
+		return nil
+	}
+	if _, err = conn.ListTablesOfFamily(nftables.TableFamilyINet); err != nil {
+		logger.Debug("nftables unavailable, falling back to iptables", "err", err)
+		return nil
+	}
+
+	p := &nftRuleProvisioner{
+		interfaceName: ifaceName,
+		network:       network,
+		logger:        logger,
+		journal:       journal,
+		legacy:        &ruleProvisioner{interfaceName: ifaceName, network: network, logger: logger, journal: journal},
+	}
+	// Chains from an earlier iptables-backed run would keep dropping traffic
+	// next to the new table.
+	p.legacy.removeChains()
+	return p
+}
+
+func (p *nftRuleProvisioner) Name() string {
+	return "nftables"
+}
+
+// Provision atomically replaces the wireflow table with one built from rule.
+// The table is added and deleted before being rebuilt in the same batch: the
+// add makes the delete valid on first use, and the kernel commits the batch as
+// a whole.
+func (p *nftRuleProvisioner) Provision(rule *FirewallRule) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: nftTableName(p.network)}
+	conn.AddTable(table)
+	conn.DelTable(table)
+	conn.AddTable(table)
+
+	if err = p.addChain(conn, table, "ingress", nftables.ChainHookInput, expr.MetaKeyIIFNAME, rule.Ingress, 12, false); err != nil {
+		return err
+	}
+	if err = p.addChain(conn, table, "egress", nftables.ChainHookOutput, expr.MetaKeyOIFNAME, rule.Egress, 16, rule.InternetEgress); err != nil {
+		return err
+	}
+
+	if err = conn.Flush(); err != nil {
+		return fmt.Errorf("nftables commit: %w", err)
+	}
+	p.journal.Record(Mutation{Kind: MutationNftTable, Args: []string{nftTableName(p.network)}})
+	p.logger.Debug("nftables rules applied", "policy", rule.PolicyName, "ingress", len(rule.Ingress), "egress", len(rule.Egress))
+	return nil
+}
+
+// addChain adds one base chain filtering traffic on the wireflow interface:
+// established flows pass, each nftGroup accepts its peers, everything else on
+// the interface is dropped. Traffic on other interfaces, and IPv6, is not
+// touched.
+// addrOffset is the IPv4 header offset of the address to match (12 for the
+// source, 16 for the destination). With acceptAll the chain ends in accept
+// instead, as egress does while an exit node is in use.
+func (p *nftRuleProvisioner) addChain(conn *nftables.Conn, table *nftables.Table, name string, hook *nftables.ChainHook,
+	ifKey expr.MetaKey, rules []TrafficRule, addrOffset uint32, acceptAll bool) error {
+	policy := nftables.ChainPolicyAccept
+	chain := conn.AddChain(&nftables.Chain{
+		Name:     name,
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  hook,
+		Priority: nftables.ChainPriorityFilter,
+		Policy:   &policy,
+	})
+	iface := []expr.Any{
+		&expr.Meta{Key: ifKey, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ifname(p.interfaceName)},
+	}
+	add := func(exprs ...expr.Any) {
+		conn.AddRule(&nftables.Rule{
+			Table: table,
+			Chain: chain,
+			Exprs: append(append([]expr.Any{}, iface...), exprs...),
+		})
+	}
+
+	add(
+		&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitESTABLISHED | expr.CtStateBitRELATED),
+			Xor:            binaryutil.NativeEndian.PutUint32(0),
+		},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(0)},
+		&expr.Verdict{Kind: expr.VerdictAccept},
+	)
+
+	groups, err := nftGroups(rules)
+	if err != nil {
+		return err
+	}
+	for i, g := range groups {
+		set := &nftables.Set{
+			Table:    table,
+			Name:     fmt.Sprintf("%s_%d", name, i),
+			KeyType:  nftables.TypeIPAddr,
+			Interval: true,
+		}
+		if err = conn.AddSet(set, nftIntervals(g.prefixes)); err != nil {
+			return err
+		}
+
+		exprs := append(nftIPv4(),
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: addrOffset, Len: 4},
+			&expr.Lookup{SourceRegister: 1, SetName: set.Name, SetID: set.ID},
+		)
+		if g.proto != 0 {
+			exprs = append(exprs,
+				&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{g.proto}},
+				&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.BigEndian.PutUint16(g.port)},
+			)
+		}
+		add(append(exprs, &expr.Verdict{Kind: expr.VerdictAccept})...)
+	}
+
+	if acceptAll {
+		add(&expr.Verdict{Kind: expr.VerdictAccept})
+		return nil
+	}
+	add(nftDropIPv4()...)
+	return nil
+}
+
+// nftIPv4 matches IPv4 packets; the inet table sees both families.
+func nftIPv4() []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.NFPROTO_IPV4}},
+	}
+}
+
+// nftDropIPv4 ends a chain by dropping the IPv4 traffic no group accepted.
+// IPv6 passes, as with the iptables backend, which programs no ip6tables
+// rules, and the userspace PacketFilter.
+func nftDropIPv4() []expr.Any {
+	return append(nftIPv4(), &expr.Verdict{Kind: expr.VerdictDrop})
+}
+
+// Cleanup removes the wireflow table and with it every rule, chain and set.
+func (p *nftRuleProvisioner) Cleanup() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := deleteNftTable(nftTableName(p.network)); err != nil {
+		return err
+	}
+	p.journal.Forget(Mutation{Kind: MutationNftTable, Args: []string{nftTableName(p.network)}})
+	return nil
+}
+
+// deleteNftTable deletes an inet table, succeeding when it does not exist.
+func deleteNftTable(name string) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+	table := &nftables.Table{Family: nftables.TableFamilyINet, Name: name}
+	conn.AddTable(table)
+	conn.DelTable(table)
+	return conn.Flush()
+}
+
+func (p *nftRuleProvisioner) SetupNAT(interfaceName string) error {
+	return p.legacy.SetupNAT(interfaceName)
+}
+
+// nftGroup is one accept rule: the peers sharing a protocol and port end up in
+// a single set. proto is zero when the rule allows all traffic of its peers.
+type nftGroup struct {
+	proto    byte
+	port     uint16
+	prefixes []netip.Prefix
+}
+
+// nftGroups folds TrafficRules into one group per protocol/port pair, in a
+// stable order so that identical input always yields the same rule set. As
+// with iptables, protocol and port only narrow a rule when both are set.
+func nftGroups(rules []TrafficRule) ([]nftGroup, error) {
+	type groupKey struct {
+		proto byte
+		port  uint16
+	}
+	index := make(map[groupKey]int)
+	seen := make(map[groupKey]map[string]struct{})
+	var groups []nftGroup
+
+	for _, tr := range rules {
+		var key groupKey
+		if tr.Protocol != "" && tr.Port != 0 {
+			switch strings.ToLower(tr.Protocol) {
+			case "tcp":
+				key.proto = unix.IPPROTO_TCP
+			case "udp":
+				key.proto = unix.IPPROTO_UDP
+			case "sctp":
+				key.proto = unix.IPPROTO_SCTP
+			default:
+				return nil, fmt.Errorf("unsupported protocol %q", tr.Protocol)
+			}
+			key.port = uint16(tr.Port)
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			seen[key] = make(map[string]struct{})
+			groups = append(groups, nftGroup{proto: key.proto, port: key.port})
+		}
+		prefixes, err := tr.Prefixes()
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range prefixes {
+			if _, dup := seen[key][prefix.String()]; dup {
+				continue
+			}
+			seen[key][prefix.String()] = struct{}{}
+			groups[i].prefixes = append(groups[i].prefixes, prefix)
+		}
+	}
+
+	sort.SliceStable(groups, func(a, b int) bool {
+		if groups[a].proto != groups[b].proto {
+			return groups[a].proto < groups[b].proto
+		}
+		return groups[a].port < groups[b].port
+	})
+	return groups, nil
+}
+
+// nftIntervals turns prefixes into the elements of an interval set. The kernel
+// rejects overlapping intervals, so covered and adjacent ranges are merged
+// first. Each range is its first address plus the address after its last,
+// flagged as the end; a range reaching 255.255.255.255 stays open.
+func nftIntervals(prefixes []netip.Prefix) []nftables.SetElement {
+	type span struct{ first, last netip.Addr }
+	spans := make([]span, 0, len(prefixes))
+	for _, p := range prefixes {
+		spans = append(spans, span{first: p.Masked().Addr(), last: lastAddr(p)})
+	}
+	sort.Slice(spans, func(a, b int) bool { return spans[a].first.Less(spans[b].first) })
+
+	var merged []span
+	for _, sp := range spans {
+		if n := len(merged); n > 0 {
+			prev := &merged[n-1]
+			if next := prev.last.Next(); !next.IsValid() || !next.Less(sp.first) {
+				if prev.last.Less(sp.last) {
+					prev.last = sp.last
+				}
+				continue
+			}
+		}
+		merged = append(merged, sp)
+	}
+
+	elements := make([]nftables.SetElement, 0, 2*len(merged))
+	for _, sp := range merged {
+		first := sp.first.As4()
+		elements = append(elements, nftables.SetElement{Key: first[:]})
+		if end := sp.last.Next(); end.IsValid() {
+			b := end.As4()
+			elements = append(elements, nftables.SetElement{Key: b[:], IntervalEnd: true})
+		}
+	}
+	return elements
+}
+
+// lastAddr returns the highest IPv4 address of p.
+func lastAddr(p netip.Prefix) netip.Addr {
+	a := p.Masked().Addr().As4()
+	host := uint32(0xffffffff) >> p.Bits()
+	if p.Bits() == 0 {
+		host = 0xffffffff
+	}
+	v := uint32(a[0])<<24 | uint32(a[1])<<16 | uint32(a[2])<<8 | uint32(a[3])
+	v |= host
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
+
+// ifname pads an interface name to IFNAMSIZ as nftables compares it.
+func ifname(name string) []byte {
+	b := make([]byte, unix.IFNAMSIZ)
+	copy(b, name)
+	return b
+}
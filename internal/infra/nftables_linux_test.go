@@ -0,0 +1,129 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+func TestNftGroups(t *testing.T) {
+	groups, err := nftGroups([]TrafficRule{
+		{Peers: []string{"10.0.0.2"}, Protocol: "TCP", Port: 443},
+		{Peers: []string{"10.0.0.3"}},
+		{Peers: []string{"10.0.0.4", "10.0.0.2"}, Protocol: "tcp", Port: 443},
+		{Peers: []string{"10.0.0.5"}, Protocol: "udp", Port: 53},
+		// Without a port the protocol does not narrow the rule, as with iptables.
+		{Peers: []string{"10.0.0.6"}, Protocol: "tcp"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want 3: %+v", len(groups), groups)
+	}
+
+	all, tcp, udp := groups[0], groups[1], groups[2]
+	if all.proto != 0 || len(all.prefixes) != 2 {
+		t.Fatalf("unexpected catch-all group: %+v", all)
+	}
+	if tcp.proto != unix.IPPROTO_TCP || tcp.port != 443 || len(tcp.prefixes) != 2 {
+		t.Fatalf("unexpected tcp group, duplicate peers must collapse: %+v", tcp)
+	}
+	if udp.proto != unix.IPPROTO_UDP || udp.port != 53 || len(udp.prefixes) != 1 {
+		t.Fatalf("unexpected udp group: %+v", udp)
+	}
+}
+
+func TestNftGroupsInvalid(t *testing.T) {
+	if _, err := nftGroups([]TrafficRule{{Peers: []string{"10.0.0.2"}, Protocol: "gre", Port: 1}}); err == nil {
+		t.Fatal("expected an error for an unsupported protocol")
+	}
+	if _, err := nftGroups([]TrafficRule{{Peers: []string{"not-an-ip"}}}); err == nil {
+		t.Fatal("expected an error for an invalid peer address")
+	}
+}
+
+func TestNftIntervals(t *testing.T) {
+	elements := nftIntervals([]netip.Prefix{
+		netip.MustParsePrefix("192.168.1.0/24"),
+		netip.MustParsePrefix("10.0.0.2/32"),
+		// Covered by and adjacent to the /24: both fold into one range.
+		netip.MustParsePrefix("192.168.1.128/25"),
+		netip.MustParsePrefix("192.168.2.0/24"),
+		netip.MustParsePrefix("255.255.255.255/32"),
+	})
+	want := []struct {
+		key string
+		end bool
+	}{
+		{"10.0.0.2", false}, {"10.0.0.3", true},
+		{"192.168.1.0", false}, {"192.168.3.0", true},
+		{"255.255.255.255", false},
+	}
+	if len(elements) != len(want) {
+		t.Fatalf("got %d elements, want %d: %+v", len(elements), len(want), elements)
+	}
+	for i, w := range want {
+		addr, _ := netip.AddrFromSlice(elements[i].Key)
+		if addr.String() != w.key || elements[i].IntervalEnd != w.end {
+			t.Fatalf("element %d = %s (end %v), want %s (end %v)", i, addr, elements[i].IntervalEnd, w.key, w.end)
+		}
+	}
+}
+
+func TestFirewallNames(t *testing.T) {
+	// The primary network and the default interface keep the names older
+	// agents recorded in their journals.
+	if got := nftTableName(""); got != "wireflow" {
+		t.Fatalf("default table = %q", got)
+	}
+	if chains := wireflowChains(DefaultInterfaceName); chains[0].chain != "WIREFLOW-INGRESS" || chains[1].chain != "WIREFLOW-EGRESS" {
+		t.Fatalf("default chains = %+v", chains)
+	}
+
+	// Tables follow the network, not its interface, which may be renumbered.
+	if got := nftTableName("staging"); got != "wireflow-staging" {
+		t.Fatalf("staging table = %q", got)
+	}
+	// iptables limits chain names to 28 characters; interface names are at most 15.
+	for _, c := range wireflowChains("wireflow-stagin") {
+		if len(c.chain) > 28 {
+			t.Fatalf("chain %q is too long for iptables", c.chain)
+		}
+	}
+}
+
+func TestNftDropIPv4(t *testing.T) {
+	exprs := nftDropIPv4()
+	if len(exprs) != 3 {
+		t.Fatalf("drop rule = %d expressions, want 3", len(exprs))
+	}
+	// IPv6 must fall through to the accept policy: the drop matches IPv4 only.
+	meta, ok := exprs[0].(*expr.Meta)
+	if !ok || meta.Key != expr.MetaKeyNFPROTO {
+		t.Fatalf("drop rule does not start with an nfproto match: %#v", exprs[0])
+	}
+	cmp, ok := exprs[1].(*expr.Cmp)
+	if !ok || cmp.Op != expr.CmpOpEq || len(cmp.Data) != 1 || cmp.Data[0] != unix.NFPROTO_IPV4 {
+		t.Fatalf("drop rule does not match IPv4: %#v", exprs[1])
+	}
+	if v, ok := exprs[2].(*expr.Verdict); !ok || v.Kind != expr.VerdictDrop {
+		t.Fatalf("drop rule verdict = %#v", exprs[2])
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package infra
+
+import "wireflow/internal/log"
+
+// newNativeRuleProvisioner returns nil: only Linux has a native backend.
+func newNativeRuleProvisioner(_ *log.Logger, _, _ string, _ *Journal) RuleProvisioner {
+	return nil
+}
+
+// deleteNftTable is a no-op: nftables tables are only created on Linux.
+func deleteNftTable(_ string) error {
+	return nil
+}
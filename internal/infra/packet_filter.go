@@ -0,0 +1,494 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wireflow/internal/log"
+
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// FirewallUserspace selects the userspace firewall backend: policy is enforced
+// by a PacketFilter on the TUN device instead of the host firewall.
+const FirewallUserspace = "userspace"
+
+const (
+	protoICMP = 1
+	protoTCP  = 6
+	protoUDP  = 17
+	protoSCTP = 132
+)
+
+// ICMP errors that quote the packet they report on, the ones conntrack
+// considers RELATED to that packet's flow.
+const (
+	icmpDestUnreachable = 3
+	icmpTimeExceeded    = 11
+	icmpParamProblem    = 12
+)
+
+// Idle timeouts after which a tracked flow no longer counts as established.
+// They follow the spirit of the kernel defaults without modelling TCP state.
+const (
+	flowTimeoutTCP   = 5 * time.Minute
+	flowTimeoutOther = 2 * time.Minute
+	flowSweepEvery   = 30 * time.Second
+	// fragTimeout bounds how long the verdict of a first fragment applies to
+	// the rest of its datagram, like the kernel's ipfrag_time.
+	fragTimeout = 30 * time.Second
+)
+
+// flowKey identifies one direction of a flow. Ports are zero for protocols
+// without them.
+type flowKey struct {
+	proto    uint8
+	src, dst [4]byte
+	sp, dp   uint16
+}
+
+func (k flowKey) reverse() flowKey {
+	return flowKey{proto: k.proto, src: k.dst, dst: k.src, sp: k.dp, dp: k.sp}
+}
+
+// fragKey identifies the fragments of one IPv4 datagram.
+type fragKey struct {
+	proto    uint8
+	src, dst [4]byte
+	id       uint16
+}
+
+// expiry is a deadline in Unix nanoseconds that can be pushed back without
+// holding a lock.
+type expiry struct {
+	at atomic.Int64
+}
+
+func (e *expiry) live(now int64) bool {
+	return now < e.at.Load()
+}
+
+// filterRule is a TrafficRule ready for matching: the peer addresses and
+// routed subnets of the rule and, when both were given, its protocol and
+// destination port.
+type filterRule struct {
+	peers   map[[4]byte]struct{}
+	subnets []netip.Prefix
+	proto   uint8
+	port    uint16
+}
+
+func (r filterRule) matches(addr [4]byte) bool {
+	if _, ok := r.peers[addr]; ok {
+		return true
+	}
+	for _, subnet := range r.subnets {
+		if subnet.Contains(netip.AddrFrom4(addr)) {
+			return true
+		}
+	}
+	return false
+}
+
+type filterRules struct {
+	ingress []filterRule
+	egress  []filterRule
+	// egressAll accepts all outbound traffic (FirewallRule.InternetEgress).
+	egressAll bool
+}
+
+// PacketFilter enforces FirewallRules in userspace with the same semantics as
+// the iptables backend: packets of established flows and the ICMP errors
+// about them (path MTU, unreachable port and the like) pass, new IPv4 traffic
+// passes only when a rule allows it, and everything else on the interface is
+// dropped. Ingress rules match the source address, egress rules the
+// destination address; protocol and destination port narrow a rule only when
+// both are set. Until the first policy is applied all traffic passes, as it
+// does before the host firewall chains are installed.
+//
+// Allow runs for every packet on the TUN device, so it takes no lock: the
+// ruleset is swapped atomically by SetRules and the flow table is a sync.Map
+// whose entries are refreshed in place.
+type PacketFilter struct {
+	rules atomic.Pointer[filterRules]
+
+	// flows maps a flowKey to the *expiry shared by both its directions.
+	flows sync.Map
+	// frags maps a fragKey to the *expiry of a datagram whose first fragment
+	// was allowed.
+	frags     sync.Map
+	lastSweep atomic.Int64
+}
+
+func NewPacketFilter() *PacketFilter {
+	return &PacketFilter{}
+}
+
+// SetRules replaces the policy. Flows already established stay allowed, as
+// they do with conntrack. A nil rule lifts all filtering.
+func (f *PacketFilter) SetRules(rule *FirewallRule) error {
+	if rule == nil {
+		f.rules.Store(nil)
+		return nil
+	}
+	compile := func(trs []TrafficRule) ([]filterRule, error) {
+		out := make([]filterRule, 0, len(trs))
+		for _, tr := range trs {
+			prefixes, err := tr.Prefixes()
+			if err != nil {
+				return nil, err
+			}
+			fr := filterRule{peers: make(map[[4]byte]struct{}, len(prefixes))}
+			for _, prefix := range prefixes {
+				if prefix.IsSingleIP() {
+					fr.peers[prefix.Addr().As4()] = struct{}{}
+				} else {
+					fr.subnets = append(fr.subnets, prefix)
+				}
+			}
+			if tr.Protocol != "" && tr.Port != 0 {
+				switch strings.ToLower(tr.Protocol) {
+				case "tcp":
+					fr.proto = protoTCP
+				case "udp":
+					fr.proto = protoUDP
+				case "sctp":
+					fr.proto = protoSCTP
+				default:
+					return nil, fmt.Errorf("unsupported protocol %q", tr.Protocol)
+				}
+				fr.port = uint16(tr.Port)
+			}
+			out = append(out, fr)
+		}
+		return out, nil
+	}
+
+	ingress, err := compile(rule.Ingress)
+	if err != nil {
+		return err
+	}
+	egress, err := compile(rule.Egress)
+	if err != nil {
+		return err
+	}
+	f.rules.Store(&filterRules{ingress: ingress, egress: egress, egressAll: rule.InternetEgress})
+	return nil
+}
+
+// Allow reports whether packet may pass. inbound is true for packets coming
+// out of the tunnel towards the host.
+func (f *PacketFilter) Allow(packet []byte, inbound bool) bool {
+	rules := f.rules.Load()
+	if rules == nil {
+		return true
+	}
+	if len(packet) < 1 {
+		return false
+	}
+	// Policies only name IPv4 peers and the iptables backend programs no
+	// ip6tables chains, so IPv6 is left unfiltered there; do the same.
+	if packet[0]>>4 == 6 {
+		return true
+	}
+	if packet[0]>>4 != 4 || len(packet) < 20 {
+		return false
+	}
+
+	key, frag, ok := parseFlowKey(packet)
+	if !ok {
+		return false
+	}
+	now := time.Now().UnixNano()
+	f.sweep(now)
+
+	if frag.offset != 0 {
+		return f.allowFragment(rules, key, frag, inbound, now)
+	}
+	if inner, ok := icmpErrorFlow(packet, key); ok && f.established(inner, now) {
+		return true
+	}
+	allowed := f.allow(rules, key, inbound, now)
+	if allowed && frag.more {
+		// The kernel reassembles before filtering, so the whole datagram
+		// shares the verdict of its first fragment; remember it for the
+		// fragments that carry no transport header.
+		e := &expiry{}
+		e.at.Store(now + int64(fragTimeout))
+		f.frags.Store(frag.key, e)
+	}
+	return allowed
+}
+
+// allow decides on a packet that carries its transport header.
+func (f *PacketFilter) allow(rules *filterRules, key flowKey, inbound bool, now int64) bool {
+	if v, ok := f.flows.Load(key); ok {
+		if e := v.(*expiry); e.live(now) {
+			e.at.Store(now + int64(flowTimeout(key.proto)))
+			return true
+		}
+	}
+	if !inbound && rules.egressAll {
+		f.track(key, now)
+		return true
+	}
+
+	list, remote := rules.egress, key.dst
+	if inbound {
+		list, remote = rules.ingress, key.src
+	}
+	for _, r := range list {
+		if !r.matches(remote) {
+			continue
+		}
+		if r.proto != 0 && (r.proto != key.proto || r.port != key.dp) {
+			continue
+		}
+		f.track(key, now)
+		return true
+	}
+	return false
+}
+
+// allowFragment decides on a non-first fragment. It follows the verdict of
+// its first fragment; when that was never seen, only rules without a port
+// can admit it, since a port rule has nothing to match.
+func (f *PacketFilter) allowFragment(rules *filterRules, key flowKey, frag fragInfo, inbound bool, now int64) bool {
+	if v, ok := f.frags.Load(frag.key); ok && v.(*expiry).live(now) {
+		return true
+	}
+	if !inbound && rules.egressAll {
+		return true
+	}
+	list, remote := rules.egress, key.dst
+	if inbound {
+		list, remote = rules.ingress, key.src
+	}
+	for _, r := range list {
+		if r.proto == 0 && r.matches(remote) {
+			return true
+		}
+	}
+	return false
+}
+
+// established reports whether the flow of key is tracked and live.
+func (f *PacketFilter) established(key flowKey, now int64) bool {
+	v, ok := f.flows.Load(key)
+	return ok && v.(*expiry).live(now)
+}
+
+func flowTimeout(proto uint8) time.Duration {
+	if proto == protoTCP {
+		return flowTimeoutTCP
+	}
+	return flowTimeoutOther
+}
+
+// track marks the flow of key and its replies as established.
+func (f *PacketFilter) track(key flowKey, now int64) {
+	e := &expiry{}
+	e.at.Store(now + int64(flowTimeout(key.proto)))
+	f.flows.Store(key, e)
+	f.flows.Store(key.reverse(), e)
+}
+
+// sweep drops expired flows and fragments. Only the caller that wins the
+// swap of lastSweep walks the tables, at most once per flowSweepEvery.
+func (f *PacketFilter) sweep(now int64) {
+	last := f.lastSweep.Load()
+	if now-last < int64(flowSweepEvery) || !f.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+	for _, m := range []*sync.Map{&f.flows, &f.frags} {
+		m.Range(func(k, v any) bool {
+			if !v.(*expiry).live(now) {
+				m.CompareAndDelete(k, v)
+			}
+			return true
+		})
+	}
+}
+
+// fragInfo describes the fragmentation of an IPv4 packet.
+type fragInfo struct {
+	key    fragKey
+	offset uint16
+	more   bool
+}
+
+// parseFlowKey extracts the flow and fragmentation of an IPv4 packet. The
+// ports of non-first fragments stay zero, since their transport header is in
+// another packet.
+func parseFlowKey(packet []byte) (key flowKey, frag fragInfo, ok bool) {
+	ihl := int(packet[0]&0x0f) * 4
+	if ihl < 20 || len(packet) < ihl {
+		return key, frag, false
+	}
+	key.proto = packet[9]
+	copy(key.src[:], packet[12:16])
+	copy(key.dst[:], packet[16:20])
+
+	flags := binary.BigEndian.Uint16(packet[6:8])
+	frag = fragInfo{
+		key:    fragKey{proto: key.proto, src: key.src, dst: key.dst, id: binary.BigEndian.Uint16(packet[4:6])},
+		offset: flags & 0x1fff,
+		more:   flags&0x2000 != 0,
+	}
+	if frag.offset != 0 {
+		return key, frag, true
+	}
+	switch key.proto {
+	case protoTCP, protoUDP, protoSCTP:
+		if len(packet) < ihl+4 {
+			return key, frag, false
+		}
+		key.sp = binary.BigEndian.Uint16(packet[ihl : ihl+2])
+		key.dp = binary.BigEndian.Uint16(packet[ihl+2 : ihl+4])
+	case protoICMP:
+		// Echo requests and replies share their identifier, so it stands in
+		// for both ports and pings are tracked per session.
+		if len(packet) >= ihl+8 && (packet[ihl] == 0 || packet[ihl] == 8) {
+			id := binary.BigEndian.Uint16(packet[ihl+4 : ihl+6])
+			key.sp, key.dp = id, id
+		}
+	}
+	return key, frag, true
+}
+
+// icmpErrorFlow returns the flow an ICMP error is about, taken from the
+// header of the offending packet it quotes. The error travels back to the
+// sender of that packet, so a quote naming anyone else is ignored.
+func icmpErrorFlow(packet []byte, key flowKey) (flowKey, bool) {
+	if key.proto != protoICMP {
+		return flowKey{}, false
+	}
+	ihl := int(packet[0]&0x0f) * 4
+	// The quote is the offending IP header and at least 8 bytes after it.
+	if len(packet) < ihl+8+20 {
+		return flowKey{}, false
+	}
+	switch packet[ihl] {
+	case icmpDestUnreachable, icmpTimeExceeded, icmpParamProblem:
+	default:
+		return flowKey{}, false
+	}
+	quote := packet[ihl+8:]
+	if quote[0]>>4 != 4 {
+		return flowKey{}, false
+	}
+	inner, frag, ok := parseFlowKey(quote)
+	if !ok || frag.offset != 0 || inner.src != key.dst {
+		return flowKey{}, false
+	}
+	return inner, true
+}
+
+// filteredTUN applies a PacketFilter to everything crossing a TUN device.
+// Packets read from the device are leaving the host (egress); packets written
+// to it arrive from the tunnel (ingress). Each verdict is reported to the
+// taps, so a capture shows the policy drops next to the packets that passed.
+type filteredTUN struct {
+	tun.Device
+	filter *PacketFilter
+	taps   *Taps
+}
+
+// NewFilteredTUN wraps device so that every packet is checked by filter and
+// reported to taps.
+func NewFilteredTUN(device tun.Device, filter *PacketFilter, taps *Taps) tun.Device {
+	return &filteredTUN{Device: device, filter: filter, taps: taps}
+}
+
+func (t *filteredTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	n, err := t.Device.Read(bufs, sizes, offset)
+	kept := 0
+	for i := 0; i < n; i++ {
+		packet := bufs[i][offset : offset+sizes[i]]
+		allowed := t.filter.Allow(packet, false)
+		t.taps.overlay(packet, false, allowed)
+		if !allowed {
+			continue
+		}
+		// The caller owns the buffers, so dropped packets are squeezed out by
+		// copying rather than by reordering bufs.
+		if kept != i {
+			copy(bufs[kept][offset:], bufs[i][offset:offset+sizes[i]])
+			sizes[kept] = sizes[i]
+		}
+		kept++
+	}
+	return kept, err
+}
+
+func (t *filteredTUN) Write(bufs [][]byte, offset int) (int, error) {
+	allowed := bufs[:0:0]
+	for _, buf := range bufs {
+		ok := t.filter.Allow(buf[offset:], true)
+		t.taps.overlay(buf[offset:], true, ok)
+		if ok {
+			allowed = append(allowed, buf)
+		}
+	}
+	if len(allowed) == 0 {
+		return len(bufs), nil
+	}
+	if _, err := t.Device.Write(allowed, offset); err != nil {
+		return 0, err
+	}
+	return len(bufs), nil
+}
+
+// userspaceRuleProvisioner is the RuleProvisioner of the userspace backend.
+// It never touches the host firewall, so it works the same on every platform
+// and in containers without iptables or nftables.
+type userspaceRuleProvisioner struct {
+	filter *PacketFilter
+	logger *log.Logger
+}
+
+// NewUserspaceRuleProvisioner returns a RuleProvisioner that programs filter,
+// which must be installed on the TUN device with NewFilteredTUN.
+func NewUserspaceRuleProvisioner(logger *log.Logger, filter *PacketFilter) RuleProvisioner {
+	return &userspaceRuleProvisioner{filter: filter, logger: logger}
+}
+
+func (p *userspaceRuleProvisioner) Name() string {
+	return FirewallUserspace
+}
+
+func (p *userspaceRuleProvisioner) Provision(rule *FirewallRule) error {
+	if err := p.filter.SetRules(rule); err != nil {
+		return err
+	}
+	p.logger.Debug("userspace firewall rules applied", "policy", rule.PolicyName, "ingress", len(rule.Ingress), "egress", len(rule.Egress))
+	return nil
+}
+
+func (p *userspaceRuleProvisioner) Cleanup() error {
+	return p.filter.SetRules(nil)
+}
+
+// SetupNAT is a no-op: NAT is a host firewall feature the userspace backend
+// deliberately stays away from.
+func (p *userspaceRuleProvisioner) SetupNAT(_ string) error {
+	return nil
+}
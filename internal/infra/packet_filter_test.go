@@ -0,0 +1,218 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+)
+
+// ipv4Packet builds a minimal IPv4 packet with a transport header carrying the
+// given ports.
+func ipv4Packet(proto uint8, src, dst string, sp, dp uint16) []byte {
+	b := make([]byte, 28)
+	b[0] = 0x45
+	b[9] = proto
+	s, d := netip.MustParseAddr(src).As4(), netip.MustParseAddr(dst).As4()
+	copy(b[12:16], s[:])
+	copy(b[16:20], d[:])
+	binary.BigEndian.PutUint16(b[20:22], sp)
+	binary.BigEndian.PutUint16(b[22:24], dp)
+	return b
+}
+
+func TestPacketFilter(t *testing.T) {
+	const local, web, other = "10.0.0.1", "10.0.0.2", "10.0.0.3"
+	f := NewPacketFilter()
+
+	if !f.Allow(ipv4Packet(protoTCP, other, local, 1000, 22), true) {
+		t.Fatal("all traffic must pass before a policy is applied")
+	}
+
+	if err := f.SetRules(&FirewallRule{
+		Ingress: []TrafficRule{{Peers: []string{web}, Protocol: "tcp", Port: 22}},
+		Egress:  []TrafficRule{{Peers: []string{web}, Protocol: "tcp", Port: 443}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		packet  []byte
+		inbound bool
+		want    bool
+	}{
+		{"ingress allowed port", ipv4Packet(protoTCP, web, local, 40000, 22), true, true},
+		{"reply to allowed ingress", ipv4Packet(protoTCP, local, web, 22, 40000), false, true},
+		{"ingress other port", ipv4Packet(protoTCP, web, local, 40001, 80), true, false},
+		{"ingress other peer", ipv4Packet(protoTCP, other, local, 40000, 22), true, false},
+		{"ingress wrong protocol", ipv4Packet(protoUDP, web, local, 40000, 22), true, false},
+		{"egress allowed port", ipv4Packet(protoTCP, local, web, 50000, 443), false, true},
+		{"reply to allowed egress", ipv4Packet(protoTCP, web, local, 443, 50000), true, true},
+		{"unsolicited from egress port", ipv4Packet(protoTCP, web, local, 443, 50001), true, false},
+		{"ipv6 is not filtered", append([]byte{0x60}, make([]byte, 39)...), true, true},
+	}
+	for _, tc := range cases {
+		if got := f.Allow(tc.packet, tc.inbound); got != tc.want {
+			t.Errorf("%s: Allow = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Established flows survive a policy change, as they do with conntrack.
+	if err := f.SetRules(&FirewallRule{}); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Allow(ipv4Packet(protoTCP, web, local, 40000, 22), true) {
+		t.Fatal("established flow dropped after policy change")
+	}
+	if f.Allow(ipv4Packet(protoTCP, web, local, 40002, 22), true) {
+		t.Fatal("new flow allowed by a revoked rule")
+	}
+}
+
+// fragment marks packet as the fragment at offset (in 8-byte units) of the
+// datagram id.
+func fragment(packet []byte, id, offset uint16, more bool) []byte {
+	binary.BigEndian.PutUint16(packet[4:6], id)
+	flags := offset
+	if more {
+		flags |= 0x2000
+	}
+	binary.BigEndian.PutUint16(packet[6:8], flags)
+	return packet
+}
+
+func TestPacketFilterFragments(t *testing.T) {
+	const local, web, lan = "10.0.0.1", "10.0.0.2", "10.0.0.3"
+	f := NewPacketFilter()
+	if err := f.SetRules(&FirewallRule{
+		Ingress: []TrafficRule{
+			{Peers: []string{web}, Protocol: "udp", Port: 53},
+			{Peers: []string{lan}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		packet []byte
+		want   bool
+	}{
+		{"first fragment of allowed port", fragment(ipv4Packet(protoUDP, web, local, 1000, 53), 7, 0, true), true},
+		{"rest of allowed datagram", fragment(ipv4Packet(protoUDP, web, local, 0, 0), 7, 185, false), true},
+		{"first fragment of other port", fragment(ipv4Packet(protoUDP, web, local, 1000, 80), 8, 0, true), false},
+		{"rest of denied datagram", fragment(ipv4Packet(protoUDP, web, local, 0, 0), 8, 185, false), false},
+		{"orphan fragment for port rule", fragment(ipv4Packet(protoUDP, web, local, 0, 0), 9, 185, false), false},
+		{"orphan fragment for portless rule", fragment(ipv4Packet(protoUDP, lan, local, 0, 0), 9, 185, false), true},
+	}
+	for _, tc := range cases {
+		if got := f.Allow(tc.packet, true); got != tc.want {
+			t.Errorf("%s: Allow = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// icmpError builds an ICMP error of type typ from src to dst quoting the
+// first 28 bytes of offending.
+func icmpError(typ uint8, src, dst string, offending []byte) []byte {
+	b := ipv4Packet(protoICMP, src, dst, 0, 0)[:20]
+	b = append(b, typ, 0, 0, 0, 0, 0, 0, 0)
+	return append(b, offending[:28]...)
+}
+
+func TestPacketFilterRelatedICMP(t *testing.T) {
+	const local, web, router, other = "10.0.0.1", "10.0.0.2", "10.0.0.254", "10.0.0.3"
+	f := NewPacketFilter()
+	if err := f.SetRules(&FirewallRule{
+		Egress: []TrafficRule{{Peers: []string{web}, Protocol: "tcp", Port: 443}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	out := ipv4Packet(protoTCP, local, web, 50000, 443)
+	if !f.Allow(out, false) {
+		t.Fatal("egress to allowed port dropped")
+	}
+
+	cases := []struct {
+		name   string
+		packet []byte
+		want   bool
+	}{
+		{"fragmentation needed from a router", icmpError(icmpDestUnreachable, router, local, out), true},
+		{"port unreachable from the peer", icmpError(icmpDestUnreachable, web, local, out), true},
+		{"time exceeded", icmpError(icmpTimeExceeded, router, local, out), true},
+		{"error about an untracked flow", icmpError(icmpDestUnreachable, web, local, ipv4Packet(protoTCP, local, web, 50001, 443)), false},
+		{"error sent to another host", icmpError(icmpDestUnreachable, web, other, out), false},
+		{"not an error", icmpError(8, web, local, out), false},
+		{"truncated quote", icmpError(icmpDestUnreachable, web, local, out)[:40], false},
+	}
+	for _, tc := range cases {
+		if got := f.Allow(tc.packet, true); got != tc.want {
+			t.Errorf("%s: Allow = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPacketFilterAllTraffic(t *testing.T) {
+	f := NewPacketFilter()
+	if err := f.SetRules(&FirewallRule{
+		Ingress: []TrafficRule{{Peers: []string{"10.0.0.2"}, Protocol: "tcp"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Without a port the protocol does not narrow the rule.
+	if !f.Allow(ipv4Packet(protoUDP, "10.0.0.2", "10.0.0.1", 1, 53), true) {
+		t.Fatal("a rule without a port must allow all traffic of its peers")
+	}
+}
+
+func TestPacketFilterInternetEgress(t *testing.T) {
+	const local, site = "10.0.0.1", "203.0.113.7"
+	f := NewPacketFilter()
+	if err := f.SetRules(&FirewallRule{InternetEgress: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Allow(ipv4Packet(protoTCP, local, site, 50000, 443), false) {
+		t.Fatal("egress must pass while an exit node is in use")
+	}
+	if !f.Allow(ipv4Packet(protoTCP, site, local, 443, 50000), true) {
+		t.Fatal("reply to internet egress dropped")
+	}
+	if f.Allow(ipv4Packet(protoTCP, site, local, 443, 50001), true) {
+		t.Fatal("unsolicited ingress allowed")
+	}
+}
+
+func TestPacketFilterSubnetRoutes(t *testing.T) {
+	const local, lanHost, outside = "10.0.0.1", "192.168.10.20", "192.168.11.20"
+	f := NewPacketFilter()
+	err := f.SetRules(&FirewallRule{
+		Egress: []TrafficRule{{Peers: []string{"10.0.0.2", "192.168.10.0/24"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Allow(ipv4Packet(protoTCP, local, lanHost, 50000, 443), false) {
+		t.Fatal("egress into a routed subnet dropped")
+	}
+	if f.Allow(ipv4Packet(protoTCP, local, outside, 50000, 443), false) {
+		t.Fatal("egress outside the routed subnet allowed")
+	}
+	if err = f.SetRules(&FirewallRule{Egress: []TrafficRule{{Peers: []string{"192.168.10.0/33"}}}}); err == nil {
+		t.Fatal("expected an error for an invalid prefix")
+	}
+}
@@ -26,6 +26,9 @@ var pfMu sync.Mutex
 
 func (r *routeProvisioner) ApplyRoute(action, address, interfaceName string) error {
 	//example: sudo route -nv add -net 192.168.10.1 -netmask 255.255.255.0 -interface en0
+	if strings.Contains(address, "/") {
+		return r.applySubnetRoute(action, address, interfaceName)
+	}
 	switch action {
 	case "add":
 		//ExecCommand("/bin/sh", "-c", fmt.Sprintf("ifconfig %s %s %s", interfaceName, address, address))
@@ -33,30 +36,79 @@ func (r *routeProvisioner) ApplyRoute(action, address, interfaceName string) err
 		if err := ExecCommand("/bin/sh", "-c", rule); err != nil {
 			return err
 		}
+		r.journal.Record(darwinRouteMutation(address, interfaceName))
 		r.logger.Debug("root command issued", "cmd", fmt.Sprintf("route -nv %s -net %s -netmask 255.255.255.0 -interface %s", action, address, interfaceName))
 	case "delete":
 		rule := fmt.Sprintf("route -nv %s -net %s -netmask 255.255.255.0 -interface %s", action, address, interfaceName)
 		if err := ExecCommand("/bin/sh", "-c", rule); err != nil {
 			return err
 		}
+		r.journal.Forget(darwinRouteMutation(address, interfaceName))
 		r.logger.Debug("root command command", "cmd", fmt.Sprintf("route -nv %s -net %s -netmask 255.255.255.0 -interface %s", action, address, interfaceName))
 	}
 
 	return nil
 }
 
-func (r *routeProvisioner) ApplyIP(action, address, name string) error {
+func darwinRouteMutation(address, interfaceName string) Mutation {
+	return CommandMutation("/bin/sh", "-c", fmt.Sprintf("route -nv delete -net %s -netmask 255.255.255.0 -interface %s", address, interfaceName))
+}
+
+// applySubnetRoute routes a subnet served by a peer, given in CIDR notation,
+// through the interface.
+func (r *routeProvisioner) applySubnetRoute(action, cidr, interfaceName string) error {
+	undo := CommandMutation("route", "-n", "delete", "-net", cidr, "-interface", interfaceName)
 	switch action {
 	case "add":
-		if err := ExecCommand("/bin/sh", "-c", fmt.Sprintf("ifconfig %s %s %s", name, address, address)); err != nil {
+		if err := ExecCommand("route", "-n", "add", "-net", cidr, "-interface", interfaceName); err != nil {
 			return err
 		}
-		if err := ExecCommand("/bin/sh", "-c", fmt.Sprintf("ifconfig %s mtu %d", name, DefaultMTU)); err != nil {
+		r.journal.Record(undo)
+	case "delete":
+		_ = ExecCommand("route", "-n", "delete", "-net", cidr, "-interface", interfaceName)
+		r.journal.Forget(undo)
+	}
+	r.logger.Debug("subnet route", "action", action, "cidr", cidr, "dev", interfaceName)
+	return nil
+}
+
+func (r *routeProvisioner) ApplyIP(action, address, name string) error {
+	switch action {
+	case "add":
+		if err := ExecCommand("/bin/sh", "-c", fmt.Sprintf("ifconfig %s %s %s", name, address, address)); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
 
+func (r *routeProvisioner) SetMTU(name string, mtu int) error {
+	return ExecCommand("/bin/sh", "-c", fmt.Sprintf("ifconfig %s mtu %d", name, mtu))
+}
+
+// ApplyExitNode is not implemented on macOS yet: without socket marks the
+// underlay needs per-endpoint host routes, which change as peers roam.
+func (r *routeProvisioner) ApplyExitNode(action, name string, bypass []string) error {
+	if action == "add" {
+		return fmt.Errorf("exit nodes are not supported on macOS")
 	}
+	return nil
+}
 
+// ServeExitNode is not implemented on macOS; exit nodes run on Linux.
+func (r *routeProvisioner) ServeExitNode(action, name string) error {
+	if action == "add" {
+		return fmt.Errorf("serving as exit node is not supported on macOS")
+	}
+	return nil
+}
+
+// ServeRoutes is not implemented on macOS; subnet routers run on Linux.
+func (r *routeProvisioner) ServeRoutes(name, source string, subnets []string) error {
+	if len(subnets) > 0 {
+		return fmt.Errorf("serving subnet routes is not supported on macOS")
+	}
 	return nil
 }
 
@@ -88,7 +140,7 @@ func (r *ruleProvisioner) Provision(rule *FirewallRule) error {
 	defer pfMu.Unlock()
 
 	var sb strings.Builder
-	anchor := "wireflow"
+	anchor := pfAnchor(r.network)
 
 	if err := ensurePFReady(anchor); err != nil {
 		return err
@@ -125,7 +177,7 @@ func (r *ruleProvisioner) Provision(rule *FirewallRule) error {
 	}
 
 	// 3. 将规则写入临时文件并加载到 anchor
-	tmpFile := "/tmp/wireflow.pf"
+	tmpFile := "/tmp/" + anchor + ".pf"
 	if err := os.WriteFile(tmpFile, []byte(sb.String()), 0644); err != nil {
 		return err
 	}
@@ -135,11 +187,32 @@ func (r *ruleProvisioner) Provision(rule *FirewallRule) error {
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("pfctl command failed: %w\n%s", err, output)
 	}
+	r.journal.Record(pfFlushMutation(anchor))
 	return nil
 }
 
+// pfAnchor returns the pf anchor holding the rules of network. It is keyed by
+// the network rather than by the utun interface, whose number changes across
+// restarts, so that the anchor registered in the main ruleset is reused.
+func pfAnchor(network string) string {
+	if network == "" {
+		return "wireflow"
+	}
+	return "wireflow-" + network
+}
+
+// pfFlushMutation reverts everything loaded into anchor.
+func pfFlushMutation(anchor string) Mutation {
+	return CommandMutation("sudo", "pfctl", "-a", anchor, "-F", "all")
+}
+
 func (p *ruleProvisioner) Cleanup() error {
-	return exec.Command("sudo", "pfctl", "-a", "wireflow", "-F", "all").Run()
+	anchor := pfAnchor(p.network)
+	if err := exec.Command("sudo", "pfctl", "-a", anchor, "-F", "all").Run(); err != nil {
+		return err
+	}
+	p.journal.Forget(pfFlushMutation(anchor))
+	return nil
 }
 
 func (r *ruleProvisioner) SetupNAT(interfaceName string) error {
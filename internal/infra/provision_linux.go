@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"strings"
@@ -34,14 +35,7 @@ func (r *routeProvisioner) ApplyRoute(action, address, name string) error {
 		// error and returns exit status 1.  Holding the mutex makes the
 		// check→add sequence atomic within this process.
 		r.mu.Lock()
-		iptCmds := fmt.Sprintf(
-			"iptables -w 5 -C FORWARD -i %[1]s -j ACCEPT 2>/dev/null || iptables -w 5 -A FORWARD -i %[1]s -j ACCEPT; "+
-				"iptables -w 5 -C FORWARD -o %[1]s -j ACCEPT 2>/dev/null || iptables -w 5 -A FORWARD -o %[1]s -j ACCEPT; "+
-				"DEV=$(ip route show default | awk 'NR==1{print $5}'); "+
-				"iptables -w 5 -t nat -C POSTROUTING -o \"$DEV\" -j MASQUERADE 2>/dev/null || iptables -w 5 -t nat -A POSTROUTING -o \"$DEV\" -j MASQUERADE",
-			name,
-		)
-		iptErr := ExecCommand("/bin/sh", "-c", iptCmds)
+		iptErr := r.ensureForwarding(name)
 		r.mu.Unlock()
 		if iptErr != nil {
 			return iptErr
@@ -50,15 +44,93 @@ func (r *routeProvisioner) ApplyRoute(action, address, name string) error {
 		if err := ExecCommand("/bin/sh", "-c", fmt.Sprintf("ip route replace %s dev %s", cidr, name)); err != nil {
 			return err
 		}
+		r.journal.Record(routeMutation(cidr, name))
 		r.logger.Debug("add route", "cidr", cidr, "dev", name)
 	case "delete":
 		// Ignore "no such process" / "not found" errors — the route may already be gone.
 		_ = ExecCommand("/bin/sh", "-c", fmt.Sprintf("ip route del %s dev %s 2>/dev/null || true", cidr, name))
+		r.journal.Forget(routeMutation(cidr, name))
 		r.logger.Debug("delete route", "cidr", cidr, "dev", name)
 	}
 	return nil
 }
 
+func routeMutation(cidr, name string) Mutation {
+	return CommandMutation("ip", "route", "del", cidr, "dev", name)
+}
+
+// ensureForwarding lets traffic be forwarded through the interface and
+// masquerades it out of the default route.
+func (r *routeProvisioner) ensureForwarding(name string) error {
+	if err := ensureIptablesRule(r.journal, r.network, "filter", "FORWARD", "-i", name, "-j", "ACCEPT"); err != nil {
+		return err
+	}
+	if err := ensureIptablesRule(r.journal, r.network, "filter", "FORWARD", "-o", name, "-j", "ACCEPT"); err != nil {
+		return err
+	}
+	dev, err := defaultRouteDevice()
+	if err != nil {
+		return err
+	}
+	if dev == "" {
+		return nil
+	}
+	return ensureIptablesRule(r.journal, r.network, "nat", "POSTROUTING", "-o", dev, "-j", "MASQUERADE")
+}
+
+// ensureIptablesRule appends rule to chain unless an identical rule exists.
+// Only rules added here are journaled: one that was already present is not
+// ours to remove. The rule is tagged with the network it is added for, so
+// that the agents of two networks needing the same rule each own a copy and
+// stopping one does not take it away from the other.
+func ensureIptablesRule(journal *Journal, network, table, chain string, rule ...string) error {
+	args := func(op string) []string {
+		return append([]string{"-w", "5", "-t", table, op, chain}, ownedRule(network, rule)...)
+	}
+	if exec.Command("iptables", args("-C")...).Run() == nil {
+		return nil
+	}
+	if err := ExecCommand("iptables", args("-A")...); err != nil {
+		return err
+	}
+	journal.Record(CommandMutation(append([]string{"iptables"}, args("-D")...)...))
+	return nil
+}
+
+// ownedRule returns rule with a comment match naming network, in the form
+// used for pf anchors and nftables tables.
+func ownedRule(network string, rule []string) []string {
+	owner := "wireflow"
+	if network != "" {
+		owner += "-" + network
+	}
+	// The match goes before the target, where iptables-save lists it.
+	n := len(rule)
+	if n >= 2 && rule[n-2] == "-j" {
+		n -= 2
+	}
+	owned := append([]string{}, rule[:n]...)
+	owned = append(owned, "-m", "comment", "--comment", owner)
+	return append(owned, rule[n:]...)
+}
+
+// defaultRouteDevice returns the interface of the first default route, or ""
+// when there is none.
+func defaultRouteDevice() (string, error) {
+	out, err := exec.Command("ip", "route", "show", "default").Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	fields := strings.Fields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "dev" {
+			return fields[i+1], nil
+		}
+	}
+	return "", nil
+}
+
 func (r *routeProvisioner) ApplyIP(action, address, name string) error {
 	switch action {
 	case "add":
@@ -69,21 +141,185 @@ func (r *routeProvisioner) ApplyIP(action, address, name string) error {
 		if err := ExecCommand("/bin/sh", "-c", fmt.Sprintf("ip address replace %s dev %s", address, name)); err != nil {
 			return err
 		}
-		if err := ExecCommand("/bin/sh", "-c", fmt.Sprintf("ip link set dev %s mtu %d up", name, DefaultMTU)); err != nil {
+		r.journal.Record(CommandMutation("ip", "address", "del", address, "dev", name))
+		if err := ExecCommand("/bin/sh", "-c", fmt.Sprintf("ip link set dev %s up", name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *routeProvisioner) SetMTU(name string, mtu int) error {
+	return ExecCommand("/bin/sh", "-c", fmt.Sprintf("ip link set dev %s mtu %d", name, mtu))
+}
+
+// Rule priorities of the exit node routing, ahead of the main table (32766).
+// Bypass addresses are looked up in main first; more specific routes in main
+// (LAN, overlay peers) win next; everything not sent by the agent's marked
+// sockets then takes the default route through the tunnel.
+const (
+	exitNodeBypassPriority   = "5200"
+	exitNodeSuppressPriority = "5209"
+	exitNodeTablePriority    = "5210"
+)
+
+// ApplyExitNode installs policy routing in the style of wg-quick: a default
+// route through name in table ExitNodeMark, used by all packets without the
+// mark. The agent's UDP sockets carry the mark (SetSocketMark), so the
+// underlay stays outside the tunnel. IPv6 is best effort, since many hosts
+// run without it.
+func (r *routeProvisioner) ApplyExitNode(action, name string, bypass []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch action {
+	case "add":
+		r.revert(&r.exitNode)
+		// Reverse path filtering only accepts the tunnel's replies to marked
+		// packets when it takes the mark into account.
+		if err := r.setSysctl(&r.exitNode, "net.ipv4.conf.all.src_valid_mark", "1"); err != nil {
+			return err
+		}
+		for _, family := range []string{"-4", "-6"} {
+			if err := r.addExitNodeRoutes(family, name, bypass); err != nil {
+				if family == "-6" {
+					r.logger.Debug("IPv6 exit node routing unavailable", "err", err)
+					continue
+				}
+				r.revert(&r.exitNode)
+				return err
+			}
+		}
+		r.logger.Debug("exit node routing applied", "dev", name, "bypass", bypass)
+	case "delete":
+		r.revert(&r.exitNode)
+		r.logger.Debug("exit node routing removed", "dev", name)
+	}
+	return nil
+}
+
+func (r *routeProvisioner) addExitNodeRoutes(family, name string, bypass []string) error {
+	table := fmt.Sprintf("%d", ExitNodeMark)
+	if err := ExecCommand("ip", family, "route", "replace", "default", "dev", name, "table", table); err != nil {
+		return err
+	}
+	r.record(&r.exitNode, CommandMutation("ip", family, "route", "del", "default", "dev", name, "table", table))
+
+	rules := [][]string{
+		{"table", "main", "suppress_prefixlength", "0", "pref", exitNodeSuppressPriority},
+		{"not", "fwmark", table, "table", table, "pref", exitNodeTablePriority},
+	}
+	for _, addr := range bypass {
+		ip := net.ParseIP(addr)
+		if ip == nil || (ip.To4() != nil) != (family == "-4") {
+			continue
+		}
+		rules = append(rules, []string{"to", ip.String(), "lookup", "main", "pref", exitNodeBypassPriority})
+	}
+	for _, rule := range rules {
+		// ip rule add is not idempotent: drop a copy left by an earlier run.
+		_ = exec.Command("ip", append([]string{family, "rule", "del"}, rule...)...).Run()
+		if err := ExecCommand("ip", append([]string{family, "rule", "add"}, rule...)...); err != nil {
+			return err
+		}
+		r.record(&r.exitNode, CommandMutation(append([]string{"ip", family, "rule", "del"}, rule...)...))
+	}
+	return nil
+}
+
+// ServeExitNode lets the node forward traffic from the tunnel to the internet:
+// IP forwarding is enabled and tunnel traffic is masqueraded out of the default
+// route. The forwarding and NAT rules are shared with ApplyRoute and stay
+// until the agent stops; "delete" only restores the sysctls.
+func (r *routeProvisioner) ServeExitNode(action, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch action {
+	case "add":
+		if err := r.setSysctl(&r.exitServe, "net.ipv4.ip_forward", "1"); err != nil {
+			return err
+		}
+		if err := r.setSysctl(&r.exitServe, "net.ipv6.conf.all.forwarding", "1"); err != nil {
+			r.logger.Debug("IPv6 forwarding unavailable", "err", err)
+		}
+		if err := r.ensureForwarding(name); err != nil {
+			return err
+		}
+		r.logger.Debug("serving as exit node", "dev", name)
+	case "delete":
+		r.revert(&r.exitServe)
+	}
+	return nil
+}
+
+func (r *routeProvisioner) ServeRoutes(name, source string, subnets []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revert(&r.routeServe)
+	if len(subnets) == 0 {
+		return nil
+	}
+	if err := r.setSysctl(&r.routeServe, "net.ipv4.ip_forward", "1"); err != nil {
+		return err
+	}
+	if err := r.ensureForwarding(name); err != nil {
+		return err
+	}
+	for _, subnet := range subnets {
+		rule := []string{"POSTROUTING", "-s", source, "-d", subnet, "-j", "MASQUERADE"}
+		if err := ExecCommand("iptables", append([]string{"-w", "5", "-t", "nat", "-A"}, rule...)...); err != nil {
 			return err
 		}
+		r.record(&r.routeServe, CommandMutation(append([]string{"iptables", "-w", "5", "-t", "nat", "-D"}, rule...)...))
 	}
+	r.logger.Debug("serving subnet routes", "dev", name, "source", source, "subnets", subnets)
+	return nil
+}
 
+// setSysctl sets key to value, recording how to restore the old value.
+func (r *routeProvisioner) setSysctl(reverts *[]Mutation, key, value string) error {
+	out, err := exec.Command("sysctl", "-n", key).Output()
+	if err != nil {
+		return err
+	}
+	old := strings.TrimSpace(string(out))
+	if old == value {
+		return nil
+	}
+	if err = ExecCommand("sysctl", "-qw", key+"="+value); err != nil {
+		return err
+	}
+	r.record(reverts, CommandMutation("sysctl", "-qw", key+"="+old))
 	return nil
 }
 
+func (r *routeProvisioner) record(reverts *[]Mutation, m Mutation) {
+	*reverts = append(*reverts, m)
+	r.journal.Record(m)
+}
+
+// revert undoes reverts, newest first, and empties it.
+func (r *routeProvisioner) revert(reverts *[]Mutation) {
+	for i := len(*reverts) - 1; i >= 0; i-- {
+		m := (*reverts)[i]
+		if err := undoMutation(m); err != nil {
+			r.logger.Debug("revert failed", "args", m.Args, "err", err)
+		}
+		r.journal.Forget(m)
+	}
+	*reverts = nil
+}
+
 func (r *ruleProvisioner) Name() string {
 	return "iptables"
 }
 
 func (r *ruleProvisioner) Provision(rule *FirewallRule) error {
-	inChain := "WIREFLOW-INGRESS"
-	outChain := "WIREFLOW-EGRESS"
+	chains := wireflowChains(r.interfaceName)
+	inChain, outChain := chains[0].chain, chains[1].chain
 
 	// 1. 初始化链
 	r.initChain(inChain, "INPUT", "-i")
@@ -125,6 +361,13 @@ func (r *ruleProvisioner) Provision(rule *FirewallRule) error {
 		}
 	}
 
+	// 经由出口节点访问外网时放行全部出站流量
+	if rule.InternetEgress {
+		if err := exec.Command("iptables", "-A", outChain, "-j", "ACCEPT").Run(); err != nil {
+			return err
+		}
+	}
+
 	// 6. 终极封口 (DROP)
 	if err := exec.Command("iptables", "-A", inChain, "-j", "DROP").Run(); err != nil {
 		return err
@@ -166,6 +409,37 @@ func (p *ruleProvisioner) initChain(chain, parent, flag string) {
 			p.logger.Error("failed to bind chain to parent", err, "parent", parent)
 		}
 	}
+
+	for _, m := range chainMutations(chain, parent, flag, p.interfaceName) {
+		p.journal.Record(m)
+	}
+}
+
+// wireflowChains lists the chains created by initChain for iface and where
+// they are bound. The default interface keeps the original chain names; every
+// other interface gets its own pair, so the rules of one network never touch
+// the traffic of another.
+func wireflowChains(iface string) []struct{ chain, parent, flag string } {
+	in, out := "WIREFLOW-INGRESS", "WIREFLOW-EGRESS"
+	if iface != DefaultInterfaceName {
+		// iptables chain names are limited to 28 characters, interface names to 15.
+		in, out = "WIREFLOW-IN-"+iface, "WIREFLOW-OUT-"+iface
+	}
+	return []struct{ chain, parent, flag string }{
+		{in, "INPUT", "-i"},
+		{out, "OUTPUT", "-o"},
+	}
+}
+
+// chainMutations returns the journal entries of a chain bound to parent, in
+// recording order: reverted newest first, the jump goes before the flush, and
+// the flush before the delete.
+func chainMutations(chain, parent, flag, iface string) []Mutation {
+	return []Mutation{
+		CommandMutation("iptables", "-w", "5", "-X", chain),
+		CommandMutation("iptables", "-w", "5", "-F", chain),
+		CommandMutation("iptables", "-w", "5", "-D", parent, flag, iface, "-j", chain),
+	}
 }
 
 // 内部辅助：添加单条规则。
@@ -180,8 +454,24 @@ func (p *ruleProvisioner) addRule(chain, dir, ip string, tr TrafficRule) error {
 	return exec.Command("iptables", args...).Run()
 }
 
+// removeChains detaches and deletes the wireflow chains. Every step tolerates
+// the chain being absent, so it is safe on hosts that never used iptables.
+func (p *ruleProvisioner) removeChains() {
+	for _, c := range wireflowChains(p.interfaceName) {
+		// Delete until it fails: concurrent initChain calls may have bound a chain twice.
+		for exec.Command("iptables", "-w", "5", "-D", c.parent, c.flag, p.interfaceName, "-j", c.chain).Run() == nil {
+		}
+		_ = exec.Command("iptables", "-w", "5", "-F", c.chain).Run()
+		_ = exec.Command("iptables", "-w", "5", "-X", c.chain).Run()
+		for _, m := range chainMutations(c.chain, c.parent, c.flag, p.interfaceName) {
+			p.journal.Forget(m)
+		}
+	}
+}
+
+// Cleanup removes the chains installed by Provision: 删除挂载点 -> 清空链 -> 删除链.
 func (p *ruleProvisioner) Cleanup() error {
-	// 逻辑：删除挂载点 -> 清空链 -> 删除链
+	p.removeChains()
 	return nil
 }
 
@@ -206,33 +496,23 @@ func (r *ruleProvisioner) SetupNAT(interfaceName string) error {
 	}
 
 	// 每条规则先用 -C 检查是否已存在，避免重连时重复追加。
+	// 只有新追加的规则才记入 journal，其删除命令与追加命令使用同一组参数。
 	type natRule struct {
-		check string
-		add   string
+		table string
+		chain string
+		rule  []string
 	}
 	rules := []natRule{
-		{
-			check: fmt.Sprintf("iptables -w 5 -t nat -C POSTROUTING -o %s -j MASQUERADE", interfaceName),
-			add:   fmt.Sprintf("iptables -w 5 -t nat -A POSTROUTING -o %s -j MASQUERADE", interfaceName),
-		},
-		{
-			check: "iptables -w 5 -C FORWARD -j ACCEPT",
-			add:   "iptables -w 5 -A FORWARD -j ACCEPT",
-		},
-		{
-			check: fmt.Sprintf("iptables -w 5 -C FORWARD -i %s -o eth0 -m state --state RELATED,ESTABLISHED -j ACCEPT", interfaceName),
-			add:   fmt.Sprintf("iptables -w 5 -A FORWARD -i %s -o eth0 -m state --state RELATED,ESTABLISHED -j ACCEPT", interfaceName),
-		},
+		{table: "nat", chain: "POSTROUTING", rule: []string{"-o", interfaceName, "-j", "MASQUERADE"}},
+		{table: "filter", chain: "FORWARD", rule: []string{"-j", "ACCEPT"}},
+		{table: "filter", chain: "FORWARD", rule: []string{"-i", interfaceName, "-o", "eth0", "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"}},
 	}
 
 	iptablesMu.Lock()
 	defer iptablesMu.Unlock()
-	for _, r := range rules {
-		if err := ExecCommand("/bin/sh", "-c", r.check); err != nil {
-			// 规则不存在，添加
-			if err := ExecCommand("/bin/sh", "-c", r.add); err != nil {
-				return err
-			}
+	for _, nr := range rules {
+		if err := ensureIptablesRule(r.journal, r.network, nr.table, nr.chain, nr.rule...); err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,39 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestOwnedRule(t *testing.T) {
+	rule := []string{"-o", "eth0", "-j", "MASQUERADE"}
+	primary := ownedRule("", rule)
+	staging := ownedRule("staging", rule)
+
+	want := []string{"-o", "eth0", "-m", "comment", "--comment", "wireflow", "-j", "MASQUERADE"}
+	if !slices.Equal(primary, want) {
+		t.Fatalf("primary rule = %v, want %v", primary, want)
+	}
+	// Two networks needing the same rule each get a copy of their own, so
+	// neither removes the other's when it stops.
+	if slices.Equal(primary, staging) {
+		t.Fatal("rules of different networks must differ")
+	}
+	if !slices.Equal(rule, []string{"-o", "eth0", "-j", "MASQUERADE"}) {
+		t.Fatalf("ownedRule modified its input: %v", rule)
+	}
+}
@@ -21,12 +21,42 @@ import (
 )
 
 func (r *routeProvisioner) ApplyRoute(action, address, interfaceName string) error {
+	if strings.Contains(address, "/") {
+		return r.applySubnetRoute(action, address, interfaceName)
+	}
 	ip := TrimCIDR(address)
 	gateway := GetGatewayFromIP(ip)
 
 	// Use the route command for Windows, add or delete route
 	ExecCommand("cmd", "/C", fmt.Sprintf(
 		"route %s %s mask 255.255.255.0 %s", action, ip, gateway))
+	undo := CommandMutation("cmd", "/C", fmt.Sprintf("route delete %s mask 255.255.255.0 %s", ip, gateway))
+	switch action {
+	case "add":
+		r.journal.Record(undo)
+	case "delete":
+		r.journal.Forget(undo)
+	}
+	return nil
+}
+
+// applySubnetRoute routes a subnet served by a peer, given in CIDR notation,
+// on-link through the interface.
+func (r *routeProvisioner) applySubnetRoute(action, cidr, interfaceName string) error {
+	undo := CommandMutation("cmd", "/C", fmt.Sprintf(
+		"netsh interface ipv4 delete route prefix=%s interface=\"%s\" store=active", cidr, interfaceName))
+	switch action {
+	case "add":
+		if err := ExecCommand("cmd", "/C", fmt.Sprintf(
+			"netsh interface ipv4 add route prefix=%s interface=\"%s\" store=active", cidr, interfaceName)); err != nil {
+			return err
+		}
+		r.journal.Record(undo)
+	case "delete":
+		_ = ExecCommand("cmd", "/C", fmt.Sprintf(
+			"netsh interface ipv4 delete route prefix=%s interface=\"%s\" store=active", cidr, interfaceName))
+		r.journal.Forget(undo)
+	}
 	return nil
 }
 
@@ -46,6 +76,36 @@ func (r *routeProvisioner) ApplyIP(action, address, name string) error {
 	return nil
 }
 
+func (r *routeProvisioner) SetMTU(name string, mtu int) error {
+	return ExecCommand("cmd", "/C", fmt.Sprintf(
+		"netsh interface ipv4 set subinterface \"%s\" mtu=%d store=active", name, mtu))
+}
+
+// ApplyExitNode is not implemented on Windows yet: without socket marks the
+// underlay needs per-endpoint host routes, which change as peers roam.
+func (r *routeProvisioner) ApplyExitNode(action, name string, bypass []string) error {
+	if action == "add" {
+		return fmt.Errorf("exit nodes are not supported on Windows")
+	}
+	return nil
+}
+
+// ServeExitNode is not implemented on Windows; exit nodes run on Linux.
+func (r *routeProvisioner) ServeExitNode(action, name string) error {
+	if action == "add" {
+		return fmt.Errorf("serving as exit node is not supported on Windows")
+	}
+	return nil
+}
+
+// ServeRoutes is not implemented on Windows; subnet routers run on Linux.
+func (r *routeProvisioner) ServeRoutes(name, source string, subnets []string) error {
+	if len(subnets) > 0 {
+		return fmt.Errorf("serving subnet routes is not supported on Windows")
+	}
+	return nil
+}
+
 func (r *ruleProvisioner) Name() string {
 	return "windows-fw"
 }
@@ -53,6 +113,7 @@ func (r *ruleProvisioner) Name() string {
 func (r *ruleProvisioner) Provision(rule *FirewallRule) error {
 	// 1. 清理旧规则 (基于 Name 前缀)
 	r.execPS("Remove-NetFirewallRule -DisplayName 'Wireflow-*'")
+	r.journal.Record(firewallRulesMutation)
 
 	// 2. 处理 Ingress
 	for i, tr := range rule.Ingress {
@@ -85,7 +146,14 @@ func (p *ruleProvisioner) execPS(command string) error {
 	return cmd.Run()
 }
 
+// firewallRulesMutation reverts every firewall rule created by Provision.
+var firewallRulesMutation = CommandMutation("powershell", "-Command", "Remove-NetFirewallRule -DisplayName 'Wireflow-*'")
+
 func (p *ruleProvisioner) Cleanup() error {
+	if err := p.execPS("Remove-NetFirewallRule -DisplayName 'Wireflow-*'"); err != nil {
+		return err
+	}
+	p.journal.Forget(firewallRulesMutation)
 	return nil
 }
 
@@ -20,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"wireflow/internal/log"
 
 	wg "golang.zx2c4.com/wireguard/device"
@@ -45,6 +46,17 @@ type Provisioner interface {
 
 	RemoveAllPeers()
 
+	// SetPeerEndpoint moves an existing peer to endpoint, leaving the rest of
+	// its configuration untouched.
+	SetPeerEndpoint(publicKey, endpoint string) error
+
+	// PeerKeys returns the public keys of all peers configured on the device.
+	PeerKeys() ([]string, error)
+
+	// DeviceStats returns the listen port and the per-peer counters of the
+	// device.
+	DeviceStats() (*DeviceStats, error)
+
 	GetAddress() string
 
 	GetIfaceName() string
@@ -53,6 +65,19 @@ type Provisioner interface {
 type RouteProvisioner interface {
 	ApplyRoute(action, address, name string) error
 	ApplyIP(action, address, name string) error
+	// SetMTU changes the MTU of the interface; WireGuard picks it up live.
+	SetMTU(name string, mtu int) error
+	// ApplyExitNode routes all traffic through the interface ("add") or stops
+	// doing so ("delete"). Traffic to the bypass addresses and the agent's own
+	// underlay traffic keep using the host's routes.
+	ApplyExitNode(action, name string, bypass []string) error
+	// ServeExitNode forwards and masquerades traffic arriving on the
+	// interface for peers using this node as their exit node.
+	ServeExitNode(action, name string) error
+	// ServeRoutes forwards traffic from the overlay source to the subnets
+	// this node routes for the network, masquerading it so hosts there can
+	// reply without knowing the overlay. No subnets stops serving.
+	ServeRoutes(name, source string, subnets []string) error
 }
 
 type RuleProvisioner interface {
@@ -112,7 +137,10 @@ func (p *SetPeer) String() string {
 	printf(&sb, "preshared_key", p.PresharedKey, keyf)
 	printf(&sb, "replace_allowed_ips", strconv.FormatBool(true), nil)
 	printf(&sb, "persistent_keepalive_interval", strconv.Itoa(p.PersistentKeepalived), nil)
-	printf(&sb, "allowed_ip", p.AllowedIPs, nil)
+	// The UAPI takes one prefix per allowed_ip line.
+	for _, prefix := range strings.Split(p.AllowedIPs, ",") {
+		printf(&sb, "allowed_ip", strings.TrimSpace(prefix), nil)
+	}
 	printf(&sb, "endpoint", p.Endpoint, nil)
 	if p.Remove {
 		printf(&sb, "remove", strconv.FormatBool(p.Remove), nil)
@@ -159,6 +187,106 @@ func (p *provisioner) RemoveAllPeers() {
 	p.device.RemoveAllPeers()
 }
 
+func (p *provisioner) SetPeerEndpoint(publicKey, endpoint string) error {
+	key, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		return err
+	}
+	return p.device.IpcSet(fmt.Sprintf("public_key=%s\nupdate_only=true\nendpoint=%s\n", hex.EncodeToString(key[:]), endpoint))
+}
+
+// DeviceStats is the runtime state of the WireGuard device.
+type DeviceStats struct {
+	ListenPort int
+	// Peers is keyed by base64 public key.
+	Peers map[string]*PeerStats
+}
+
+type PeerStats struct {
+	Endpoint      string
+	LastHandshake time.Time
+	RxBytes       int64
+	TxBytes       int64
+}
+
+func (p *provisioner) DeviceStats() (*DeviceStats, error) {
+	conf, err := p.device.IpcGet()
+	if err != nil {
+		return nil, err
+	}
+	return parseDeviceStats(conf)
+}
+
+// parseDeviceStats reads DeviceStats from the UAPI "get" output.
+func parseDeviceStats(conf string) (*DeviceStats, error) {
+	stats := &DeviceStats{Peers: make(map[string]*PeerStats)}
+	var (
+		peer      *PeerStats
+		handshake int64
+	)
+	for _, line := range strings.Split(conf, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "listen_port":
+			stats.ListenPort, _ = strconv.Atoi(value)
+		case "public_key":
+			raw, err := hex.DecodeString(value)
+			if err != nil || len(raw) != wgtypes.KeyLen {
+				return nil, fmt.Errorf("invalid public key in device config: %q", value)
+			}
+			var pub wgtypes.Key
+			copy(pub[:], raw)
+			peer = &PeerStats{}
+			stats.Peers[pub.String()] = peer
+		}
+		if peer == nil {
+			continue
+		}
+		switch key {
+		case "endpoint":
+			peer.Endpoint = value
+		case "last_handshake_time_sec":
+			handshake, _ = strconv.ParseInt(value, 10, 64)
+		case "last_handshake_time_nsec":
+			nsec, _ := strconv.ParseInt(value, 10, 64)
+			if handshake != 0 || nsec != 0 {
+				peer.LastHandshake = time.Unix(handshake, nsec)
+			}
+		case "rx_bytes":
+			peer.RxBytes, _ = strconv.ParseInt(value, 10, 64)
+		case "tx_bytes":
+			peer.TxBytes, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return stats, nil
+}
+
+func (p *provisioner) PeerKeys() ([]string, error) {
+	conf, err := p.device.IpcGet()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, line := range strings.Split(conf, "\n") {
+		value, ok := strings.CutPrefix(line, "public_key=")
+		if !ok {
+			continue
+		}
+		raw, err := hex.DecodeString(value)
+		if err != nil || len(raw) != wgtypes.KeyLen {
+			return nil, fmt.Errorf("invalid public key in device config: %q", value)
+		}
+		var key wgtypes.Key
+		copy(key[:], raw)
+		keys = append(keys, key.String())
+	}
+	return keys, nil
+}
+
 func NewProvisioner(routeProvisioner RouteProvisioner, ruleProvisioner RuleProvisioner, config *Params) Provisioner {
 	return &provisioner{
 		RouteProvisioner: routeProvisioner,
@@ -173,24 +301,51 @@ type routeProvisioner struct {
 	// mu serializes ApplyRoute calls to prevent concurrent iptables check→add
 	// races: without this, two goroutines can both see a rule absent, both try
 	// to add it, and the second one fails with xtables lock error (exit status 1).
-	mu     sync.Mutex //nolint:unused
-	logger *log.Logger
+	mu sync.Mutex //nolint:unused
+	// network tags the iptables rules that the agents of several networks
+	// would otherwise share, as in ruleProvisioner.
+	network string //nolint:unused
+	logger  *log.Logger
+	journal *Journal
+	// exitNode and exitServe hold the reverts of the exit node routing and
+	// of serving as an exit node, routeServe those of serving subnet routes,
+	// newest last.
+	exitNode   []Mutation //nolint:unused
+	exitServe  []Mutation //nolint:unused
+	routeServe []Mutation //nolint:unused
 }
 
-func NewRouteProvisioner(logger *log.Logger) RouteProvisioner {
+// NewRouteProvisioner returns the RouteProvisioner for this platform. Every
+// change it makes is recorded in journal so that it can be reverted on stop.
+func NewRouteProvisioner(logger *log.Logger, network string, journal *Journal) RouteProvisioner {
 	return &routeProvisioner{
-		logger: logger,
+		network: network,
+		logger:  logger,
+		journal: journal,
 	}
 }
 
 type ruleProvisioner struct {
 	interfaceName string // nolint
-	logger        *log.Logger
+	// network names the rules of an additional network apart from those of
+	// the primary one, whose network is empty. Unlike the interface name it
+	// is stable across restarts.
+	network string // nolint
+	logger  *log.Logger
+	journal *Journal
 }
 
-func NewRuleProvisioner(logger *log.Logger, ifaceName string) RuleProvisioner {
+// NewRuleProvisioner returns the firewall backend for this host: the native one
+// where the platform has it (nftables on Linux), otherwise the command-based one.
+func NewRuleProvisioner(logger *log.Logger, ifaceName, network string, journal *Journal) RuleProvisioner {
+	if p := newNativeRuleProvisioner(logger, ifaceName, network, journal); p != nil {
+		logger.Debug("using native firewall backend", "backend", p.Name())
+		return p
+	}
 	return &ruleProvisioner{
 		interfaceName: ifaceName,
+		network:       network,
 		logger:        logger,
+		journal:       journal,
 	}
 }
@@ -0,0 +1,56 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestParseDeviceStats(t *testing.T) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.PublicKey()
+	idle, _ := wgtypes.GeneratePrivateKey()
+
+	conf := "private_key=00\nlisten_port=51820\n" +
+		"public_key=" + hexKey(pub) + "\nendpoint=203.0.113.7:51820\n" +
+		"last_handshake_time_sec=1700000000\nlast_handshake_time_nsec=5\ntx_bytes=10\nrx_bytes=20\n" +
+		"public_key=" + hexKey(idle.PublicKey()) + "\nlast_handshake_time_sec=0\nlast_handshake_time_nsec=0\n" +
+		"errno=0\n"
+
+	stats, err := parseDeviceStats(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ListenPort != 51820 || len(stats.Peers) != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	p := stats.Peers[pub.String()]
+	if p.Endpoint != "203.0.113.7:51820" || p.TxBytes != 10 || p.RxBytes != 20 || p.LastHandshake.Unix() != 1700000000 {
+		t.Fatalf("unexpected peer stats %+v", p)
+	}
+	if !stats.Peers[idle.PublicKey().String()].LastHandshake.IsZero() {
+		t.Fatal("a peer without handshake must report a zero time")
+	}
+}
+
+func hexKey(k wgtypes.Key) string {
+	return hex.EncodeToString(k[:])
+}
@@ -0,0 +1,157 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+// relayFakePrefix marks fake IPv6 addresses that stand for peers reached
+// through a TURN relay: "fd77:7475:726e::", "tu"(7475) + "rn"(726e). The
+// lower 8 bytes carry the RemoteId, as with WRRP.
+var relayFakePrefix = [6]byte{0xfd, 0x77, 0x74, 0x75, 0x72, 0x6e}
+
+// RelayFakeAddrPort encodes the RemoteId of a peer reached through a TURN
+// relay of this node as a fake IPv6 AddrPort, used as its WireGuard endpoint.
+func RelayFakeAddrPort(remoteId uint64) netip.AddrPort {
+	var b [16]byte
+	copy(b[:6], relayFakePrefix[:])
+	binary.BigEndian.PutUint64(b[8:], remoteId)
+	return netip.AddrPortFrom(netip.AddrFrom16(b), WrrpFakePort)
+}
+
+// IsRelayFakeAddr reports whether addr was generated by RelayFakeAddrPort.
+func IsRelayFakeAddr(addr netip.Addr) bool {
+	if !addr.Is6() {
+		return false
+	}
+	b := addr.As16()
+	return [6]byte(b[:6]) == relayFakePrefix
+}
+
+// relayBufSize fits any datagram WireGuard sends.
+const relayBufSize = 65535
+
+type relayPacket struct {
+	remoteId uint64
+	buf      *[]byte
+	n        int
+}
+
+// RelayConns carries the WireGuard traffic of peers whose ICE connection
+// runs through a TURN relay allocated by this node. That traffic cannot use
+// the shared UDP socket: it is written to, and read from, the ICE connection
+// that owns the allocation.
+type RelayConns struct {
+	mu    sync.RWMutex
+	conns map[uint64]net.Conn
+	recv  chan relayPacket
+	pool  sync.Pool
+}
+
+func NewRelayConns() *RelayConns {
+	return &RelayConns{
+		conns: make(map[uint64]net.Conn),
+		recv:  make(chan relayPacket, 256),
+		pool: sync.Pool{
+			New: func() any {
+				buf := make([]byte, relayBufSize)
+				return &buf
+			},
+		},
+	}
+}
+
+// Add routes the traffic of remoteId through c until Remove is called or c
+// fails.
+func (r *RelayConns) Add(remoteId uint64, c net.Conn) {
+	r.mu.Lock()
+	r.conns[remoteId] = c
+	r.mu.Unlock()
+	go r.read(remoteId, c)
+}
+
+// Remove stops routing remoteId through c. A conn that replaced c is kept.
+func (r *RelayConns) Remove(remoteId uint64, c net.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conns[remoteId] == c {
+		delete(r.conns, remoteId)
+	}
+}
+
+func (r *RelayConns) read(remoteId uint64, c net.Conn) {
+	defer r.Remove(remoteId, c)
+	for {
+		buf := r.pool.Get().(*[]byte)
+		n, err := c.Read(*buf)
+		if err != nil {
+			r.pool.Put(buf)
+			return
+		}
+		// Like any UDP socket, drop rather than stall the relay when
+		// WireGuard falls behind.
+		select {
+		case r.recv <- relayPacket{remoteId: remoteId, buf: buf, n: n}:
+		default:
+			r.pool.Put(buf)
+		}
+	}
+}
+
+// Send writes bufs to the relay conn of remoteId.
+func (r *RelayConns) Send(remoteId uint64, bufs [][]byte) error {
+	var c net.Conn
+	if r != nil {
+		r.mu.RLock()
+		c = r.conns[remoteId]
+		r.mu.RUnlock()
+	}
+	if c == nil {
+		return fmt.Errorf("no TURN relay for peer %d", remoteId)
+	}
+	for _, buf := range bufs {
+		if _, err := c.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReceiveFunc hands WireGuard the packets read from the relay conns until
+// done is closed.
+func (r *RelayConns) ReceiveFunc(done <-chan struct{}) conn.ReceiveFunc {
+	return func(bufs [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
+		select {
+		case p := <-r.recv:
+			sizes[0] = copy(bufs[0], (*p.buf)[:p.n])
+			r.pool.Put(p.buf)
+			eps[0] = &WRRPEndpoint{
+				Addr:          RelayFakeAddrPort(p.remoteId),
+				RemoteId:      p.remoteId,
+				TransportType: TURN,
+			}
+			return 1, nil
+		case <-done:
+			return 0, net.ErrClosed
+		}
+	}
+}
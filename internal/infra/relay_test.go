@@ -0,0 +1,73 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"net"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/conn"
+)
+
+func TestRelayFakeAddr(t *testing.T) {
+	addr := RelayFakeAddrPort(42)
+	if !IsRelayFakeAddr(addr.Addr()) || IsWrrpFakeAddr(addr.Addr()) {
+		t.Fatalf("%s not recognised as relay address", addr)
+	}
+	if IsRelayFakeAddr(WrrpFakeAddrPort(42).Addr()) {
+		t.Fatal("WRRP address taken for a relay address")
+	}
+	if got := RemoteIdFromWrrpFakeAddr(addr.Addr()); got != 42 {
+		t.Fatalf("remote id = %d, want 42", got)
+	}
+}
+
+func TestRelayConns(t *testing.T) {
+	relays := NewRelayConns()
+	local, remote := net.Pipe()
+	defer remote.Close()
+	relays.Add(7, local)
+
+	go func() {
+		_ = relays.Send(7, [][]byte{[]byte("to peer")})
+	}()
+	buf := make([]byte, 64)
+	n, err := remote.Read(buf)
+	if err != nil || string(buf[:n]) != "to peer" {
+		t.Fatalf("peer read %q: %v", buf[:n], err)
+	}
+
+	go func() {
+		_, _ = remote.Write([]byte("from peer"))
+	}()
+	done := make(chan struct{})
+	bufs, sizes, eps := [][]byte{make([]byte, 64)}, []int{0}, []conn.Endpoint{nil}
+	if n, err = relays.ReceiveFunc(done)(bufs, sizes, eps); err != nil || n != 1 {
+		t.Fatalf("receive: n=%d err=%v", n, err)
+	}
+	ep := eps[0].(*WRRPEndpoint)
+	if string(bufs[0][:sizes[0]]) != "from peer" || ep.TransportType != TURN || ep.RemoteId != 7 {
+		t.Fatalf("received %q from %+v", bufs[0][:sizes[0]], ep)
+	}
+
+	relays.Remove(7, local)
+	if err = relays.Send(7, [][]byte{[]byte("x")}); err == nil {
+		t.Fatal("send succeeded after the relay was removed")
+	}
+	close(done)
+	if _, err = relays.ReceiveFunc(done)(bufs, sizes, eps); err == nil {
+		t.Fatal("receive did not stop once done was closed")
+	}
+}
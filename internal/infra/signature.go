@@ -0,0 +1,101 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+
+	"filippo.io/edwards25519"
+	"filippo.io/edwards25519/field"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// SignWithKey signs msg with a WireGuard private key, following XEdDSA: the
+// X25519 key is used as an Ed25519 key whose public point has a positive x,
+// so that anyone who knows the WireGuard public key can check the signature
+// with VerifyWithKey. It lets an agent prove to the control plane that it
+// holds its key, which the control plane cannot do with a Diffie-Hellman MAC
+// for lack of a key of its own.
+func SignWithKey(privateKey wgtypes.Key, msg []byte) ([]byte, error) {
+	a, err := edwards25519.NewScalar().SetBytesWithClamping(privateKey[:])
+	if err != nil {
+		return nil, err
+	}
+	public := new(edwards25519.Point).ScalarBaseMult(a).Bytes()
+	if public[31]&0x80 != 0 {
+		a.Negate(a)
+		public[31] &^= 0x80
+	}
+
+	var z [64]byte
+	if _, err = rand.Read(z[:]); err != nil {
+		return nil, err
+	}
+	h := sha512.New()
+	h.Write([]byte{0xfe})
+	for i := 0; i < 31; i++ {
+		h.Write([]byte{0xff})
+	}
+	h.Write(a.Bytes())
+	h.Write(msg)
+	h.Write(z[:])
+	r, err := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	R := new(edwards25519.Point).ScalarBaseMult(r).Bytes()
+
+	h.Reset()
+	h.Write(R)
+	h.Write(public)
+	h.Write(msg)
+	k, err := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	s := edwards25519.NewScalar().MultiplyAdd(k, a, r)
+	return append(R, s.Bytes()...), nil
+}
+
+// VerifyWithKey reports whether sig is a SignWithKey signature of msg by the
+// holder of the private key of publicKey.
+func VerifyWithKey(publicKey wgtypes.Key, msg, sig []byte) bool {
+	u, err := new(field.Element).SetBytes(publicKey[:])
+	if err != nil {
+		return false
+	}
+	// The Edwards y of the Montgomery u is (u-1)/(u+1); XEdDSA fixes the
+	// sign of x to positive, which is the cleared top bit of the encoding.
+	one := new(field.Element).One()
+	den := new(field.Element).Add(u, one)
+	if den.Equal(new(field.Element).Zero()) == 1 {
+		return false
+	}
+	y := new(field.Element).Subtract(u, one)
+	y.Multiply(y, new(field.Element).Invert(den))
+	return len(sig) == ed25519.SignatureSize && ed25519.Verify(y.Bytes(), msg, sig)
+}
+
+// LeaveStatement is what an agent signs to announce to the control plane
+// that it is leaving.
+func LeaveStatement(appId string, publicKey wgtypes.Key, timestamp int64) []byte {
+	b := append([]byte("wireflow leave v1\x00"), appId...)
+	b = append(b, 0)
+	b = append(b, publicKey[:]...)
+	return binary.BigEndian.AppendUint64(b, uint64(timestamp))
+}
@@ -0,0 +1,46 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestSignWithKey(t *testing.T) {
+	msg := LeaveStatement("laptop", wgtypes.Key{}, 1700000000)
+	// Enough keys that both signs of the Edwards point come up.
+	for i := 0; i < 16; i++ {
+		key, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := SignWithKey(key, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyWithKey(key.PublicKey(), msg, sig) {
+			t.Fatal("valid signature rejected")
+		}
+		if VerifyWithKey(key.PublicKey(), append(msg, 0), sig) {
+			t.Fatal("signature accepted for another message")
+		}
+		other, _ := wgtypes.GeneratePrivateKey()
+		if VerifyWithKey(other.PublicKey(), msg, sig) {
+			t.Fatal("signature accepted for another key")
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetSocketMark makes every socket opened by ListenUDP afterwards carry mark
+// as its SO_MARK, so policy routing can tell the agent's underlay traffic
+// apart. It must be called before the sockets are created.
+func SetSocketMark(mark uint32) {
+	controlFns = append(controlFns, func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, int(mark))
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	})
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// PacketTap observes the traffic of the tunnel without altering it. Overlay
+// sees the decrypted IP packets crossing the TUN device, Denied those the
+// userspace firewall dropped on their way, and Underlay the encrypted
+// WireGuard messages exchanged with endpoint. All are called on the data path
+// with buffers owned by the caller: a tap copies what it keeps and must not
+// block.
+type PacketTap interface {
+	Overlay(packet []byte, inbound bool)
+	Denied(packet []byte, inbound bool)
+	Underlay(msg []byte, endpoint netip.AddrPort, inbound bool)
+}
+
+// Taps is the set of PacketTaps attached to a node. It costs a single atomic
+// load per batch while no tap is attached.
+type Taps struct {
+	mu   sync.Mutex
+	taps atomic.Pointer[[]PacketTap]
+}
+
+func NewTaps() *Taps {
+	return &Taps{}
+}
+
+// Add attaches tap and returns the function that detaches it.
+func (t *Taps) Add(tap PacketTap) (remove func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var taps []PacketTap
+	if cur := t.taps.Load(); cur != nil {
+		taps = append(taps, *cur...)
+	}
+	taps = append(taps, tap)
+	t.taps.Store(&taps)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			cur := t.taps.Load()
+			if cur == nil {
+				return
+			}
+			var rest []PacketTap
+			for _, other := range *cur {
+				if other != tap {
+					rest = append(rest, other)
+				}
+			}
+			if len(rest) == 0 {
+				t.taps.Store(nil)
+				return
+			}
+			t.taps.Store(&rest)
+		})
+	}
+}
+
+// load returns the attached taps, nil when there are none.
+func (t *Taps) load() []PacketTap {
+	if t == nil {
+		return nil
+	}
+	if cur := t.taps.Load(); cur != nil {
+		return *cur
+	}
+	return nil
+}
+
+// overlay reports an overlay packet, and whether the firewall allowed it.
+func (t *Taps) overlay(packet []byte, inbound, allowed bool) {
+	for _, tap := range t.load() {
+		if allowed {
+			tap.Overlay(packet, inbound)
+		} else {
+			tap.Denied(packet, inbound)
+		}
+	}
+}
+
+func (t *Taps) underlay(bufs [][]byte, endpoint conn.Endpoint, inbound bool) {
+	taps := t.load()
+	if taps == nil {
+		return
+	}
+	addr := tapAddr(endpoint)
+	for _, buf := range bufs {
+		for _, tap := range taps {
+			tap.Underlay(buf, addr, inbound)
+		}
+	}
+}
+
+// tapAddr is the address reported for endpoint: the remote socket for ICE
+// and, for relayed or parked peers, the fake address carrying their RemoteId.
+func tapAddr(endpoint conn.Endpoint) netip.AddrPort {
+	e, ok := endpoint.(*WRRPEndpoint)
+	if !ok {
+		return netip.AddrPortFrom(endpoint.DstIP(), 0)
+	}
+	if !e.Addr.IsValid() && e.RemoteId != 0 {
+		return WrrpFakeAddrPort(e.RemoteId)
+	}
+	return e.Addr
+}
+
+// tapReceive wraps fn so that what it receives is reported to taps.
+func (t *Taps) tapReceive(fn conn.ReceiveFunc) conn.ReceiveFunc {
+	return func(bufs [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
+		n, err := fn(bufs, sizes, eps)
+		if taps := t.load(); taps != nil {
+			for i := 0; i < n; i++ {
+				addr := tapAddr(eps[i])
+				for _, tap := range taps {
+					tap.Underlay(bufs[i][:sizes[i]], addr, true)
+				}
+			}
+		}
+		return n, err
+	}
+}
+
+// tappedTUN reports every packet crossing a TUN device to the attached taps.
+// Packets read from the device leave the host; packets written to it arrive
+// from the tunnel.
+type tappedTUN struct {
+	tun.Device
+	taps *Taps
+}
+
+// NewTappedTUN wraps device so that its packets are reported to taps, as
+// tcpdump on the interface would see them. A device with a PacketFilter is
+// wrapped by NewFilteredTUN instead, which also reports the denied packets.
+func NewTappedTUN(device tun.Device, taps *Taps) tun.Device {
+	return &tappedTUN{Device: device, taps: taps}
+}
+
+func (t *tappedTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	n, err := t.Device.Read(bufs, sizes, offset)
+	if taps := t.taps.load(); taps != nil {
+		for i := 0; i < n; i++ {
+			for _, tap := range taps {
+				tap.Overlay(bufs[i][offset:offset+sizes[i]], false)
+			}
+		}
+	}
+	return n, err
+}
+
+func (t *tappedTUN) Write(bufs [][]byte, offset int) (int, error) {
+	if taps := t.taps.load(); taps != nil {
+		for _, buf := range bufs {
+			for _, tap := range taps {
+				tap.Overlay(buf[offset:], true)
+			}
+		}
+	}
+	return t.Device.Write(bufs, offset)
+}
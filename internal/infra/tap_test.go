@@ -0,0 +1,150 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"net/netip"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+type countingTap struct {
+	underlay []netip.AddrPort
+	// overlay and denied count the packets per direction: outbound first.
+	overlay, denied [2]int
+}
+
+func (t *countingTap) Overlay(_ []byte, inbound bool) {
+	t.overlay[direction(inbound)]++
+}
+
+func (t *countingTap) Denied(_ []byte, inbound bool) {
+	t.denied[direction(inbound)]++
+}
+
+func direction(inbound bool) int {
+	if inbound {
+		return 1
+	}
+	return 0
+}
+
+func (t *countingTap) Underlay(_ []byte, endpoint netip.AddrPort, _ bool) {
+	t.underlay = append(t.underlay, endpoint)
+}
+
+func TestTaps(t *testing.T) {
+	taps := NewTaps()
+	relayed := &WRRPEndpoint{RemoteId: 42, TransportType: WRRP}
+	direct := &WRRPEndpoint{Addr: netip.MustParseAddrPort("198.51.100.7:51820"), TransportType: ICE}
+	receive := taps.tapReceive(func(bufs [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
+		sizes[0], eps[0] = 4, direct
+		return 1, nil
+	})
+	bufs, sizes, eps := [][]byte{make([]byte, 16)}, make([]int, 1), make([]conn.Endpoint, 1)
+
+	// Without taps nothing is reported, and a nil set is safe to use.
+	var none *Taps
+	none.underlay([][]byte{{1}}, direct, false)
+
+	first, second := &countingTap{}, &countingTap{}
+	removeFirst := taps.Add(first)
+	removeSecond := taps.Add(second)
+	taps.underlay([][]byte{{1}, {2}}, relayed, false)
+	if _, err := receive(bufs, sizes, eps); err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.AddrPort{WrrpFakeAddrPort(42), WrrpFakeAddrPort(42), direct.Addr}
+	for _, tap := range []*countingTap{first, second} {
+		if len(tap.underlay) != len(want) {
+			t.Fatalf("got %v, want %v", tap.underlay, want)
+		}
+		for i := range want {
+			if tap.underlay[i] != want[i] {
+				t.Fatalf("got %v, want %v", tap.underlay, want)
+			}
+		}
+	}
+
+	removeFirst()
+	removeFirst()
+	taps.underlay([][]byte{{1}}, direct, false)
+	if len(first.underlay) != 3 || len(second.underlay) != 4 {
+		t.Fatalf("removed tap still called: %d, %d", len(first.underlay), len(second.underlay))
+	}
+	removeSecond()
+	if taps.load() != nil {
+		t.Fatal("taps left after removing all of them")
+	}
+}
+
+// loopTUN is a tun.Device whose Read returns packets and whose Write records
+// them.
+type loopTUN struct {
+	tun.Device
+	read    [][]byte
+	written int
+}
+
+func (d *loopTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	n := copy(bufs, d.read)
+	for i := 0; i < n; i++ {
+		sizes[i] = copy(bufs[i][offset:], d.read[i])
+	}
+	return n, nil
+}
+
+func (d *loopTUN) Write(bufs [][]byte, offset int) (int, error) {
+	d.written += len(bufs)
+	return len(bufs), nil
+}
+
+func TestFilteredTUNTaps(t *testing.T) {
+	const local, web, other = "10.0.0.1", "10.0.0.2", "10.0.0.3"
+	filter := NewPacketFilter()
+	if err := filter.SetRules(&FirewallRule{
+		Ingress: []TrafficRule{{Peers: []string{web}}},
+		Egress:  []TrafficRule{{Peers: []string{web}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	device := &loopTUN{read: [][]byte{
+		ipv4Packet(protoTCP, local, web, 50000, 443),
+		ipv4Packet(protoTCP, local, other, 50000, 443),
+	}}
+	taps := NewTaps()
+	tap := &countingTap{}
+	taps.Add(tap)
+	filtered := NewFilteredTUN(device, filter, taps)
+
+	bufs, sizes := [][]byte{make([]byte, 64), make([]byte, 64)}, make([]int, 2)
+	if n, err := filtered.Read(bufs, sizes, 0); err != nil || n != 1 {
+		t.Fatalf("Read = %d, %v; want the allowed packet only", n, err)
+	}
+	if _, err := filtered.Write([][]byte{
+		ipv4Packet(protoTCP, web, local, 40000, 22),
+		ipv4Packet(protoTCP, other, local, 40000, 22),
+	}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if device.written != 1 {
+		t.Fatalf("%d packets written to the device, want 1", device.written)
+	}
+	if tap.overlay != [2]int{1, 1} || tap.denied != [2]int{1, 1} {
+		t.Fatalf("tap saw %v passed and %v denied, want one of each per direction", tap.overlay, tap.denied)
+	}
+}
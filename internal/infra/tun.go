@@ -14,7 +14,13 @@
 
 package infra
 
-// nolint:all
-func getInterfaceName() string {
-	return "wf0"
+// DefaultInterfaceName is the interface of the network joined with --token.
+const DefaultInterfaceName = "wf0"
+
+// interfaceName returns name, or DefaultInterfaceName when it is empty.
+func interfaceName(name string) string {
+	if name == "" {
+		return DefaultInterfaceName
+	}
+	return name
 }
@@ -30,7 +30,9 @@ const (
 	utunPrefix      = "utun"
 )
 
-func CreateTUN(mtu int, logger *log.Logger) (string, tun.Device, error) {
+// CreateTUN creates the next free utun device. macOS assigns utun names
+// itself, so the requested name is ignored.
+func CreateTUN(_ string, mtu int, logger *log.Logger) (string, tun.Device, error) {
 	ifIndex := 0
 	var name string
 	var fd int
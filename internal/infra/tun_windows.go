@@ -20,8 +20,9 @@ import (
 	"golang.zx2c4.com/wireguard/tun"
 )
 
-func CreateTUN(mtu int, logger *log.Logger) (string, tun.Device, error) {
-	name := getInterfaceName()
+// CreateTUN creates the TUN device called name, DefaultInterfaceName when empty.
+func CreateTUN(name string, mtu int, logger *log.Logger) (string, tun.Device, error) {
+	name = interfaceName(name)
 	device, err := tun.CreateTUN(name, mtu)
 	return name, device, err
 }
@@ -0,0 +1,148 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"time"
+	"wireflow/internal/log"
+)
+
+// Underlay is the part of the host network the tunnels run over: the default
+// routes of the main table and the addresses of the interfaces they leave
+// through. A change of either, such as a laptop joining another Wi-Fi, moves
+// every path to the peers.
+type Underlay struct {
+	Routes []string `json:"routes"`
+	Addrs  []string `json:"addrs"`
+}
+
+// Equal reports whether u and o describe the same underlay.
+func (u Underlay) Equal(o Underlay) bool {
+	return slices.Equal(u.Routes, o.Routes) && slices.Equal(u.Addrs, o.Addrs)
+}
+
+// Timing of underlayWatcher. Host network changes come in bursts (link up,
+// address, routes), so events are collected for underlaySettle before the
+// underlay is compared. A change less than roamQuiet after the previous one
+// is delayed by an exponential backoff, so a flapping link does not restart
+// every session each time.
+const (
+	underlaySettle = 250 * time.Millisecond
+	roamBackoffMin = time.Second
+	roamBackoffMax = 30 * time.Second
+	roamQuiet      = time.Minute
+)
+
+// WatchUnderlay calls onChange with the new underlay each time it changes,
+// until ctx is done. Interfaces for which ignore is true, the overlay
+// interfaces, are left out. It returns errors.ErrUnsupported where the host
+// cannot report network changes.
+func WatchUnderlay(ctx context.Context, logger *log.Logger, ignore func(iface string) bool, onChange func(Underlay)) error {
+	events, err := underlayEvents(ctx, logger)
+	if err != nil {
+		return err
+	}
+	w := &underlayWatcher{
+		logger:   logger,
+		events:   events,
+		snapshot: func() (Underlay, error) { return underlaySnapshot(ignore) },
+		onChange: onChange,
+		settle:   underlaySettle,
+		backoff:  roamBackoff{min: roamBackoffMin, max: roamBackoffMax, quiet: roamQuiet},
+	}
+	w.run(ctx)
+	return nil
+}
+
+// underlayWatcher turns bursts of host network events into one onChange per
+// actual change of the underlay.
+type underlayWatcher struct {
+	logger   *log.Logger
+	events   <-chan struct{}
+	snapshot func() (Underlay, error)
+	onChange func(Underlay)
+	settle   time.Duration
+	backoff  roamBackoff
+}
+
+func (w *underlayWatcher) run(ctx context.Context) {
+	last, err := w.snapshot()
+	if err != nil {
+		w.logger.Warn("cannot read the underlay network", "err", err)
+	}
+
+	var settle, fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-w.events:
+			if !ok {
+				return
+			}
+			if settle == nil {
+				settle = time.After(w.settle)
+			}
+		case <-settle:
+			settle = nil
+			current, err := w.snapshot()
+			if err != nil {
+				w.logger.Warn("cannot read the underlay network", "err", err)
+				continue
+			}
+			if current.Equal(last) {
+				continue
+			}
+			last = current
+			// A change already waiting for its backoff picks up this one.
+			if fire == nil {
+				fire = time.After(w.backoff.next(time.Now()))
+			}
+		case <-fire:
+			fire = nil
+			w.onChange(last)
+		}
+	}
+}
+
+// roamBackoff spaces out reactions to underlay changes: the first change
+// after a quiet period is handled at once, the following ones after a
+// doubling, jittered delay.
+type roamBackoff struct {
+	min, max, quiet time.Duration
+
+	step int
+	last time.Time
+}
+
+func (b *roamBackoff) next(now time.Time) time.Duration {
+	if b.last.IsZero() || now.Sub(b.last) >= b.quiet {
+		b.step = 0
+	} else {
+		b.step++
+	}
+	b.last = now
+	if b.step == 0 {
+		return 0
+	}
+	delay := b.min << (b.step - 1)
+	if delay <= 0 || delay > b.max {
+		delay = b.max
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
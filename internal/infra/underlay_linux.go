@@ -0,0 +1,169 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"syscall"
+	"wireflow/internal/log"
+
+	"golang.org/x/sys/unix"
+)
+
+// underlayEvents subscribes to the link, address and route notifications of
+// the kernel. Every notification is an event; what changed is found out by
+// comparing snapshots.
+func underlayEvents(ctx context.Context, logger *log.Logger) (<-chan struct{}, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("netlink socket: %w", err)
+	}
+	groups := uint32(unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR |
+		unix.RTMGRP_IPV4_ROUTE | unix.RTMGRP_IPV6_ROUTE)
+	if err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: groups}); err != nil {
+		unix.Close(fd) //nolint:errcheck
+		return nil, fmt.Errorf("netlink bind: %w", err)
+	}
+	// A non-blocking descriptor goes through the runtime poller, so closing
+	// the file unblocks the pending read.
+	sock := os.NewFile(uintptr(fd), "netlink")
+	go func() {
+		<-ctx.Done()
+		sock.Close() //nolint:errcheck
+	}()
+
+	events := make(chan struct{}, 1)
+	go readUnderlayEvents(ctx, logger, sock, events)
+	return events, nil
+}
+
+// readUnderlayEvents turns every message read from r into an event, until r
+// fails or ctx is done, and then closes events.
+func readUnderlayEvents(ctx context.Context, logger *log.Logger, r io.Reader, events chan<- struct{}) {
+	defer close(events)
+	buf := make([]byte, 1<<16)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// ENOBUFS: notifications were dropped; the snapshot still
+			// tells what changed. The file wraps it in an *os.PathError.
+			if errors.Is(err, unix.ENOBUFS) {
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+				continue
+			}
+			logger.Error("underlay notifications stopped", err)
+			return
+		}
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// underlaySnapshot reads the default routes of the main table and the
+// global unicast addresses of their interfaces.
+func underlaySnapshot(ignore func(string) bool) (Underlay, error) {
+	var u Underlay
+	devices := make(map[int]string)
+	for _, family := range []int{unix.AF_INET, unix.AF_INET6} {
+		rib, err := syscall.NetlinkRIB(unix.RTM_GETROUTE, family)
+		if err != nil {
+			return u, fmt.Errorf("dump routes: %w", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(rib)
+		if err != nil {
+			return u, fmt.Errorf("parse routes: %w", err)
+		}
+		for i := range msgs {
+			route, index, ok := defaultRoute(&msgs[i])
+			if !ok {
+				continue
+			}
+			iface, err := net.InterfaceByIndex(index)
+			if err != nil || (ignore != nil && ignore(iface.Name)) {
+				continue
+			}
+			u.Routes = append(u.Routes, route+" dev "+iface.Name)
+			devices[index] = iface.Name
+		}
+	}
+
+	for index, name := range devices {
+		iface, err := net.InterfaceByIndex(index)
+		if err != nil {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+				u.Addrs = append(u.Addrs, ipNet.IP.String()+" dev "+name)
+			}
+		}
+	}
+	sort.Strings(u.Routes)
+	sort.Strings(u.Addrs)
+	return u, nil
+}
+
+// defaultRoute describes m when it is a unicast default route of the main
+// table: "default via <gateway>", or "default" for a point-to-point link,
+// and the index of its interface.
+func defaultRoute(m *syscall.NetlinkMessage) (string, int, bool) {
+	// struct rtmsg: family, dst_len, src_len, tos, table, protocol, scope,
+	// type, flags.
+	if m.Header.Type != unix.RTM_NEWROUTE || len(m.Data) < unix.SizeofRtMsg {
+		return "", 0, false
+	}
+	dstLen, table, kind := m.Data[1], uint32(m.Data[4]), m.Data[7]
+	if dstLen != 0 || kind != unix.RTN_UNICAST {
+		return "", 0, false
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return "", 0, false
+	}
+	route, index := "default", 0
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.RTA_TABLE:
+			if len(attr.Value) >= 4 {
+				table = binary.NativeEndian.Uint32(attr.Value)
+			}
+		case unix.RTA_GATEWAY:
+			route = "default via " + net.IP(attr.Value).String()
+		case unix.RTA_OIF:
+			if len(attr.Value) >= 4 {
+				index = int(binary.NativeEndian.Uint32(attr.Value))
+			}
+		}
+	}
+	return route, index, table == unix.RT_TABLE_MAIN && index != 0
+}
@@ -0,0 +1,75 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+	"wireflow/internal/log"
+
+	"golang.org/x/sys/unix"
+)
+
+// scriptedReader returns the results of reads from a script, then io.EOF.
+type scriptedReader struct {
+	errs []error
+}
+
+func (r *scriptedReader) Read(p []byte) (int, error) {
+	if len(r.errs) == 0 {
+		return 0, io.EOF
+	}
+	err := r.errs[0]
+	r.errs = r.errs[1:]
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func TestReadUnderlayEvents(t *testing.T) {
+	// An *os.File wraps the errno of a failed read in an *os.PathError.
+	overrun := &os.PathError{Op: "read", Path: "netlink", Err: unix.ENOBUFS}
+	r := &scriptedReader{errs: []error{overrun, nil}}
+
+	events := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		readUnderlayEvents(context.Background(), log.GetLogger("underlay-test"), r, events)
+		close(done)
+	}()
+
+	// The overrun itself is reported as an event, since notifications were lost.
+	select {
+	case _, ok := <-events:
+		if !ok {
+			t.Fatal("reader stopped at a wrapped ENOBUFS")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event after a wrapped ENOBUFS")
+	}
+	// The reader goes on past the overrun and stops at io.EOF.
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reader did not stop at io.EOF")
+	}
+	if len(r.errs) != 0 {
+		t.Fatalf("reader stopped with %d reads left", len(r.errs))
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package infra
+
+import (
+	"context"
+	"errors"
+	"wireflow/internal/log"
+)
+
+// underlayEvents is only implemented on Linux, with netlink.
+func underlayEvents(context.Context, *log.Logger) (<-chan struct{}, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func underlaySnapshot(func(string) bool) (Underlay, error) {
+	return Underlay{}, errors.ErrUnsupported
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infra
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"wireflow/internal/log"
+)
+
+func TestUnderlayWatcher(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		current = Underlay{Routes: []string{"default via 192.168.1.1 dev wlan0"}}
+	)
+	setUnderlay := func(u Underlay) {
+		mu.Lock()
+		current = u
+		mu.Unlock()
+	}
+
+	events := make(chan struct{}, 1)
+	changes := make(chan Underlay, 4)
+	w := &underlayWatcher{
+		logger: log.GetLogger("underlay-test"),
+		events: events,
+		snapshot: func() (Underlay, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return current, nil
+		},
+		onChange: func(u Underlay) { changes <- u },
+		settle:   10 * time.Millisecond,
+		backoff:  roamBackoff{min: 200 * time.Millisecond, max: time.Second, quiet: time.Minute},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.run(ctx)
+
+	// An event without a change is not reported.
+	events <- struct{}{}
+	select {
+	case u := <-changes:
+		t.Fatalf("unexpected change %v", u)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The first change is reported once the events settled.
+	moved := Underlay{Routes: []string{"default via 10.0.0.1 dev eth0"}, Addrs: []string{"10.0.0.7 dev eth0"}}
+	setUnderlay(moved)
+	events <- struct{}{}
+	select {
+	case u := <-changes:
+		if !u.Equal(moved) {
+			t.Fatalf("got %v, want %v", u, moved)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("change not reported")
+	}
+
+	// A second change soon after waits for the backoff, and the report
+	// carries the latest underlay.
+	start := time.Now()
+	setUnderlay(Underlay{Routes: []string{"default via 172.16.0.1 dev eth1"}})
+	events <- struct{}{}
+	time.Sleep(30 * time.Millisecond)
+	last := Underlay{Routes: []string{"default via 172.16.0.1 dev eth1"}, Addrs: []string{"172.16.0.9 dev eth1"}}
+	setUnderlay(last)
+	events <- struct{}{}
+	select {
+	case u := <-changes:
+		if !u.Equal(last) {
+			t.Fatalf("got %v, want %v", u, last)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Fatalf("second change reported after %v, want backoff", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("second change not reported")
+	}
+}
+
+func TestRoamBackoff(t *testing.T) {
+	b := roamBackoff{min: time.Second, max: 8 * time.Second, quiet: time.Minute}
+	now := time.Now()
+
+	if d := b.next(now); d != 0 {
+		t.Fatalf("first change delayed by %v", d)
+	}
+	for i, limit := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+		now = now.Add(time.Second)
+		d := b.next(now)
+		if d < limit/2 || d > limit {
+			t.Fatalf("change %d delayed by %v, want within [%v, %v]", i+2, d, limit/2, limit)
+		}
+	}
+
+	// After a quiet period the next change is handled at once again.
+	if d := b.next(now.Add(time.Minute)); d != 0 {
+		t.Fatalf("change after quiet period delayed by %v", d)
+	}
+}
@@ -30,6 +30,8 @@ type Wrrp interface {
 	Send(ctx context.Context, remoteId uint64, wrrpType uint8, data []byte) error
 	Connect() error
 	RemoteAddr() net.Addr
+	// Protocol is what the relay is reached over: "tcp" or "quic".
+	Protocol() string
 	Close() error
 }
 
@@ -78,7 +80,8 @@ func IsWrrpFakeAddr(addr netip.Addr) bool {
 		b[5] == wrrpFakePrefix[5]
 }
 
-// RemoteIdFromWrrpFakeAddr extracts the RemoteId encoded in a fake WRRP address.
+// RemoteIdFromWrrpFakeAddr extracts the RemoteId encoded in a fake WRRP or
+// relay address.
 func RemoteIdFromWrrpFakeAddr(addr netip.Addr) uint64 {
 	b := addr.As16()
 	return binary.BigEndian.Uint64(b[8:])
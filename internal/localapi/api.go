@@ -0,0 +1,246 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package localapi is the agent's control API on a local Unix socket. It
+// reports what the running agent knows beyond the WireGuard device: how each
+// peer is connected, the applied network map and the firewall rules. The API
+// is versioned by path prefix so older clients keep working.
+package localapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"runtime"
+	"time"
+	"wireflow/internal/infra"
+)
+
+// Version is the path prefix of every endpoint served by this package.
+const Version = "v1"
+
+// Status is the answer of GET /v1/status.
+type Status struct {
+	Interface     string `json:"interface"`
+	Name          string `json:"name,omitempty"`
+	AppID         string `json:"appId,omitempty"`
+	Address       string `json:"address,omitempty"`
+	PublicKey     string `json:"publicKey,omitempty"`
+	ListenPort    int    `json:"listenPort,omitempty"`
+	NetworkID     string `json:"networkId,omitempty"`
+	ConfigVersion string `json:"configVersion,omitempty"`
+	// Offline is set while the agent runs from its cached network map
+	// because the control plane is unreachable.
+	Offline  bool   `json:"offline,omitempty"`
+	Firewall string `json:"firewall,omitempty"`
+	Peers    []Peer `json:"peers"`
+}
+
+// Peer is one remote peer as seen by the agent.
+type Peer struct {
+	Name       string   `json:"name,omitempty"`
+	AppID      string   `json:"appId"`
+	Address    string   `json:"address,omitempty"`
+	PublicKey  string   `json:"publicKey,omitempty"`
+	AllowedIPs string   `json:"allowedIps,omitempty"`
+	ExitNode   bool     `json:"exitNode,omitempty"`
+	Routes     []string `json:"routes,omitempty"`
+
+	// ProbeState is "connecting", "connected" or "failed"; empty when no
+	// probe runs for the peer, as for the idle peers of a lazy network.
+	// Transport is ICE or WRRP once connected.
+	ProbeState string `json:"probeState,omitempty"`
+	Transport  string `json:"transport,omitempty"`
+	ICEState   string `json:"iceState,omitempty"`
+
+	// WireGuard device counters.
+	Endpoint      string    `json:"endpoint,omitempty"`
+	LastHandshake time.Time `json:"lastHandshake,omitzero"`
+	RxBytes       int64     `json:"rxBytes"`
+	TxBytes       int64     `json:"txBytes"`
+}
+
+// Rules is the answer of GET /v1/rules.
+type Rules struct {
+	// Backend enforcing the rules: iptables, nftables, userspace, ...
+	Backend string              `json:"backend"`
+	Applied *infra.FirewallRule `json:"applied,omitempty"`
+}
+
+// Ping limits.
+const (
+	DefaultPingCount = 4
+	MaxPingCount     = 100
+)
+
+var (
+	// ErrPeerNotFound is returned by Backend.Ping for unknown peers.
+	ErrPeerNotFound = errors.New("peer not found")
+	// ErrPathUnavailable is returned by Backend.Ping when the forced path
+	// cannot reach the peer.
+	ErrPathUnavailable = errors.New("path not available")
+)
+
+// PingRequest is the body of POST /v1/ping.
+type PingRequest struct {
+	// Peer is the name or app id of the remote peer.
+	Peer  string `json:"peer"`
+	Count int    `json:"count,omitempty"`
+	// Path forces the probes onto one path, ICE or WRRP, for the duration
+	// of the ping. Empty keeps the active one.
+	Path string `json:"path,omitempty"`
+}
+
+// PingResult is the answer of POST /v1/ping.
+type PingResult struct {
+	Peer    string `json:"peer"`
+	AppID   string `json:"appId"`
+	Address string `json:"address"`
+	// Transport is the path the agent uses for the peer; Path is the one
+	// the probes were sent on, which differs when the request forced it.
+	Transport string `json:"transport,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	// CandidatePair is the pair ICE selected, when Path is ICE.
+	CandidatePair string      `json:"candidatePair,omitempty"`
+	Paths         []Path      `json:"paths,omitempty"`
+	LastHandshake time.Time   `json:"lastHandshake,omitzero"`
+	Replies       []PingReply `json:"replies"`
+}
+
+// Path is one way the agent can reach a peer.
+type Path struct {
+	Transport string `json:"transport"`
+	// Protocol is what a WRRP relay is reached over: tcp or quic.
+	Protocol      string `json:"protocol,omitempty"`
+	Endpoint      string `json:"endpoint"`
+	CandidatePair string `json:"candidatePair,omitempty"`
+	// RTT is the round-trip time ICE measured when it selected the pair.
+	RTT time.Duration `json:"rtt,omitempty"`
+}
+
+// PingReply is the outcome of one probe: its round-trip time, or why no
+// reply came back.
+type PingReply struct {
+	Seq   int           `json:"seq"`
+	RTT   time.Duration `json:"rtt,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+var (
+	// ErrServiceNotFound is returned when removing an unknown exposed
+	// service or port forward.
+	ErrServiceNotFound = errors.New("service not found")
+	// ErrServiceExists is returned when a service name or a forwarded local
+	// address is already taken.
+	ErrServiceExists = errors.New("service already exists")
+)
+
+// ExposeRequest is the body of POST /v1/expose.
+type ExposeRequest struct {
+	// Name labels the service; it defaults to "<protocol>-<port>".
+	Name string `json:"name,omitempty"`
+	// Protocol is tcp, the only one supported.
+	Protocol string `json:"protocol"`
+	// Port is the port of the service on localhost.
+	Port int `json:"port"`
+	// ListenPort is the overlay port peers connect to; it defaults to Port.
+	ListenPort int `json:"listenPort,omitempty"`
+}
+
+// Service is a local service published on the overlay address of the agent.
+type Service struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	// Address is where peers connect, Target where the agent relays to.
+	Address string `json:"address"`
+	Target  string `json:"target"`
+	// Policy names the firewall policy in force, empty before the first one
+	// is applied and all traffic passes. AllowedFrom lists the peer
+	// addresses and subnets it admits to the service.
+	Policy      string   `json:"policy,omitempty"`
+	AllowedFrom []string `json:"allowedFrom,omitempty"`
+}
+
+// ForwardRequest is the body of POST /v1/forward.
+type ForwardRequest struct {
+	// Peer is the name or app id of the remote peer.
+	Peer string `json:"peer"`
+	Port int    `json:"port"`
+	// Listen is the local address to accept on. A bare port binds
+	// 127.0.0.1; it defaults to Port there.
+	Listen string `json:"listen,omitempty"`
+}
+
+// PortForward relays connections to a local address to a port of a peer.
+type PortForward struct {
+	Listen string `json:"listen"`
+	Peer   string `json:"peer"`
+	AppID  string `json:"appId"`
+	// Remote is the overlay address and port of the peer.
+	Remote string `json:"remote"`
+}
+
+// CaptureRequest is the body of POST /v1/capture. The answer is a pcapng
+// stream of the decrypted overlay packets, written as they cross the TUN
+// device, until Count packets were captured or the client disconnects.
+type CaptureRequest struct {
+	// Peer keeps only the traffic of the peer with this name or app id.
+	Peer string `json:"peer,omitempty"`
+	// Filter selects packets with a tcpdump-like expression, see
+	// capture.ParseFilter.
+	Filter string `json:"filter,omitempty"`
+	// Underlay adds the encrypted WireGuard messages on a second interface.
+	Underlay bool `json:"underlay,omitempty"`
+	// Count stops the capture after that many packets; zero means no limit.
+	Count int `json:"count,omitempty"`
+}
+
+// Backend is what the agent exposes through the API.
+type Backend interface {
+	Status() *Status
+	// NetMap returns the network map last applied, nil before the first.
+	NetMap() *infra.Message
+	Rules() *Rules
+	// Ping sends overlay probes to a peer and reports the path they took.
+	Ping(ctx context.Context, req *PingRequest) (*PingResult, error)
+
+	// Services, Expose and Unexpose manage the local services published on
+	// the overlay address; Forwards, Forward and Unforward the local ports
+	// relayed to peers. Both last until removed or until the agent stops.
+	Services() []Service
+	Expose(req *ExposeRequest) (*Service, error)
+	Unexpose(name string) error
+	Forwards() []PortForward
+	Forward(req *ForwardRequest) (*PortForward, error)
+	Unforward(listen string) error
+
+	// Capture streams the packets selected by req to w as pcapng until ctx
+	// is done. It returns ErrPeerNotFound for an unknown peer before
+	// writing anything.
+	Capture(ctx context.Context, req *CaptureRequest, w io.Writer) error
+}
+
+// SocketPath returns where the agent of interfaceName listens.
+func SocketPath(interfaceName string) string {
+	return filepath.Join(socketDir(), interfaceName+".sock")
+}
+
+func socketDir() string {
+	if runtime.GOOS == "windows" {
+		return `C:\ProgramData\wireflow`
+	}
+	return "/var/run/wireflow"
+}
@@ -0,0 +1,210 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"wireflow/internal/infra"
+)
+
+// ErrNotRunning is returned when no agent listens on the socket.
+var ErrNotRunning = errors.New("wireflow agent is not running")
+
+// Client talks to the local API of a running agent.
+type Client struct {
+	path string
+	http *http.Client
+}
+
+// NewClient returns a client for the agent of interfaceName. With an empty
+// name the only agent running is used; when several networks run, each with
+// its own agent, the choice is ambiguous and an error names them.
+func NewClient(interfaceName string) (*Client, error) {
+	path, err := findSocket(socketDir(), interfaceName)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(path), nil
+}
+
+// findSocket returns the socket of interfaceName in dir or, without a name,
+// the only socket there.
+func findSocket(dir, interfaceName string) (string, error) {
+	if interfaceName != "" {
+		return filepath.Join(dir, interfaceName+".sock"), nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.sock"))
+	switch len(matches) {
+	case 0:
+		return "", ErrNotRunning
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(m), ".sock"))
+	}
+	return "", fmt.Errorf("agents are running on %s; pick one with --interface-name", strings.Join(names, ", "))
+}
+
+func newClient(path string) *Client {
+	return &Client{
+		path: path,
+		http: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}},
+	}
+}
+
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	return &status, c.get(ctx, "status", &status)
+}
+
+func (c *Client) NetMap(ctx context.Context) (*infra.Message, error) {
+	var msg infra.Message
+	return &msg, c.get(ctx, "netmap", &msg)
+}
+
+func (c *Client) Rules(ctx context.Context) (*Rules, error) {
+	var rules Rules
+	return &rules, c.get(ctx, "rules", &rules)
+}
+
+// Ping asks the agent to probe a peer; it returns once all probes are done.
+func (c *Client) Ping(ctx context.Context, req *PingRequest) (*PingResult, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var result PingResult
+	return &result, c.do(ctx, http.MethodPost, "ping", bytes.NewReader(body), &result)
+}
+
+func (c *Client) Services(ctx context.Context) ([]Service, error) {
+	var services []Service
+	return services, c.get(ctx, "expose", &services)
+}
+
+// Expose publishes a local service on the overlay address of the agent.
+func (c *Client) Expose(ctx context.Context, req *ExposeRequest) (*Service, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var service Service
+	return &service, c.do(ctx, http.MethodPost, "expose", bytes.NewReader(body), &service)
+}
+
+func (c *Client) Unexpose(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "expose/"+url.PathEscape(name), nil, &struct{}{})
+}
+
+func (c *Client) Forwards(ctx context.Context) ([]PortForward, error) {
+	var forwards []PortForward
+	return forwards, c.get(ctx, "forward", &forwards)
+}
+
+// Forward asks the agent to relay a local address to a port of a peer.
+func (c *Client) Forward(ctx context.Context, req *ForwardRequest) (*PortForward, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var forward PortForward
+	return &forward, c.do(ctx, http.MethodPost, "forward", bytes.NewReader(body), &forward)
+}
+
+func (c *Client) Unforward(ctx context.Context, listen string) error {
+	return c.do(ctx, http.MethodDelete, "forward/"+url.PathEscape(listen), nil, &struct{}{})
+}
+
+// Capture streams the packets captured by the agent to w as pcapng until
+// ctx is done or the agent ends the capture.
+func (c *Client) Capture(ctx context.Context, req *CaptureRequest, w io.Writer) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(ctx, http.MethodPost, "capture", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err = io.Copy(w, resp.Body); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, endpoint string, out any) error {
+	return c.do(ctx, http.MethodGet, endpoint, nil, out)
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, body io.Reader, out any) error {
+	resp, err := c.send(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send issues a request and returns the response once it succeeded; the
+// caller closes its body.
+func (c *Client) send(ctx context.Context, method, endpoint string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://wireflow/"+Version+"/"+endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("connect to %s: permission denied, run as root", c.path)
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, fmt.Errorf("%w (%s)", ErrNotRunning, c.path)
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var apiErr apiError
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("local API: %s", apiErr.Error)
+		}
+		return nil, fmt.Errorf("local API: %s", resp.Status)
+	}
+	return resp, nil
+}
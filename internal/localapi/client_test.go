@@ -0,0 +1,49 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localapi
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindSocket(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := findSocket(dir, ""); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("expected ErrNotRunning without agents, got %v", err)
+	}
+
+	touch := func(name string) {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touch("wf0.sock")
+	if path, err := findSocket(dir, ""); err != nil || path != filepath.Join(dir, "wf0.sock") {
+		t.Fatalf("single agent: got %s, %v", path, err)
+	}
+
+	touch("wf1.sock")
+	_, err := findSocket(dir, "")
+	if err == nil || !strings.Contains(err.Error(), "wf0, wf1") {
+		t.Fatalf("expected an ambiguity error naming both agents, got %v", err)
+	}
+	if path, err := findSocket(dir, "wf1"); err != nil || path != filepath.Join(dir, "wf1.sock") {
+		t.Fatalf("named agent: got %s, %v", path, err)
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"wireflow/internal/capture"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+)
+
+// Server serves a Backend on a Unix socket.
+type Server struct {
+	logger  *log.Logger
+	backend Backend
+}
+
+func NewServer(logger *log.Logger, backend Backend) *Server {
+	return &Server{logger: logger, backend: backend}
+}
+
+// Serve listens on path until ctx is done. A socket left behind by an agent
+// that did not shut down cleanly is replaced. Only the owner (root) may
+// connect: the network map names every peer of the network. The socket is
+// created under the umask before it can be chmod'ed, so its directory is
+// kept private too, including one left behind with a wider mode.
+func (s *Server) Serve(ctx context.Context, path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	if err = os.Chmod(path, 0o600); err != nil {
+		ln.Close() //nolint:errcheck
+		return err
+	}
+
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close() //nolint:errcheck
+	}()
+	s.logger.Debug("local API listening", "socket", path)
+	if err = srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler returns the HTTP routes of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /"+Version+"/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.backend.Status())
+	})
+	mux.HandleFunc("GET /"+Version+"/peers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.backend.Status().Peers)
+	})
+	mux.HandleFunc("GET /"+Version+"/netmap", func(w http.ResponseWriter, r *http.Request) {
+		msg := s.backend.NetMap()
+		if msg == nil {
+			writeError(w, http.StatusNotFound, "no network map applied yet")
+			return
+		}
+		writeJSON(w, redact(msg))
+	})
+	mux.HandleFunc("GET /"+Version+"/rules", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.backend.Rules())
+	})
+	mux.HandleFunc("POST /"+Version+"/ping", func(w http.ResponseWriter, r *http.Request) {
+		var req PingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid ping request: "+err.Error())
+			return
+		}
+		if req.Count == 0 {
+			req.Count = DefaultPingCount
+		}
+		if req.Peer == "" || req.Count < 0 || req.Count > MaxPingCount {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("ping needs a peer and a count between 1 and %d", MaxPingCount))
+			return
+		}
+		result, err := s.backend.Ping(r.Context(), &req)
+		switch {
+		case errors.Is(err, ErrPeerNotFound):
+			writeError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrPathUnavailable):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, errors.ErrUnsupported):
+			writeError(w, http.StatusNotImplemented, err.Error())
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		default:
+			writeJSON(w, result)
+		}
+	})
+	mux.HandleFunc("GET /"+Version+"/expose", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.backend.Services())
+	})
+	mux.HandleFunc("POST /"+Version+"/expose", func(w http.ResponseWriter, r *http.Request) {
+		var req ExposeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid expose request: "+err.Error())
+			return
+		}
+		if req.Protocol == "" {
+			req.Protocol = "tcp"
+		}
+		if req.ListenPort == 0 {
+			req.ListenPort = req.Port
+		}
+		if req.Name == "" {
+			req.Name = fmt.Sprintf("%s-%d", req.Protocol, req.Port)
+		}
+		switch {
+		case req.Protocol != "tcp":
+			writeError(w, http.StatusBadRequest, "only tcp services can be exposed")
+			return
+		case !validPort(req.Port) || !validPort(req.ListenPort):
+			writeError(w, http.StatusBadRequest, "ports must be between 1 and 65535")
+			return
+		}
+		service, err := s.backend.Expose(&req)
+		writeResult(w, service, err)
+	})
+	mux.HandleFunc("DELETE /"+Version+"/expose/{name}", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, struct{}{}, s.backend.Unexpose(r.PathValue("name")))
+	})
+	mux.HandleFunc("GET /"+Version+"/forward", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.backend.Forwards())
+	})
+	mux.HandleFunc("POST /"+Version+"/forward", func(w http.ResponseWriter, r *http.Request) {
+		var req ForwardRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid forward request: "+err.Error())
+			return
+		}
+		switch {
+		case req.Listen == "":
+			req.Listen = net.JoinHostPort("127.0.0.1", strconv.Itoa(req.Port))
+		case !strings.Contains(req.Listen, ":"):
+			req.Listen = net.JoinHostPort("127.0.0.1", req.Listen)
+		}
+		if req.Peer == "" || !validPort(req.Port) {
+			writeError(w, http.StatusBadRequest, "forward needs a peer and a port between 1 and 65535")
+			return
+		}
+		forward, err := s.backend.Forward(&req)
+		writeResult(w, forward, err)
+	})
+	mux.HandleFunc("DELETE /"+Version+"/forward/{listen}", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, struct{}{}, s.backend.Unforward(r.PathValue("listen")))
+	})
+	mux.HandleFunc("POST /"+Version+"/capture", func(w http.ResponseWriter, r *http.Request) {
+		var req CaptureRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid capture request: "+err.Error())
+			return
+		}
+		if req.Count < 0 {
+			writeError(w, http.StatusBadRequest, "capture count must not be negative")
+			return
+		}
+		if _, err := capture.ParseFilter(req.Filter); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		stream := &streamWriter{w: w}
+		err := s.backend.Capture(r.Context(), &req, stream)
+		switch {
+		case err == nil:
+		case !stream.started:
+			writeResult(w, nil, err)
+		case r.Context().Err() == nil:
+			// The status line is gone; all that is left is to cut the stream.
+			s.logger.Warn("capture ended with an error", "err", err)
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "unknown endpoint "+r.URL.Path)
+	})
+	return mux
+}
+
+// redact returns msg without the preshared keys of its peers and the TURN
+// credentials of the network.
+func redact(msg *infra.Message) *infra.Message {
+	out := *msg
+	strip := func(peers []*infra.Peer) []*infra.Peer {
+		stripped := make([]*infra.Peer, 0, len(peers))
+		for _, p := range peers {
+			cp := *p
+			cp.PresharedKey = ""
+			stripped = append(stripped, &cp)
+		}
+		return stripped
+	}
+	out.ComputedPeers = strip(msg.ComputedPeers)
+	if msg.Network != nil {
+		network := *msg.Network
+		network.Peers = strip(msg.Network.Peers)
+		network.ICEServers = make([]infra.ICEServer, 0, len(msg.Network.ICEServers))
+		for _, server := range msg.Network.ICEServers {
+			server.Credential = ""
+			network.ICEServers = append(network.ICEServers, server)
+		}
+		out.Network = &network
+	}
+	return &out
+}
+
+// streamWriter sends the pcapng stream of a capture: the status line goes
+// out with the first bytes, and every write is flushed to the client.
+type streamWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if !s.started {
+		s.started = true
+		s.w.Header().Set("Content-Type", "application/x-pcapng")
+		s.w.WriteHeader(http.StatusOK)
+	}
+	n, err := s.w.Write(p)
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// writeResult writes v, or the error mapped to its status code.
+func writeResult(w http.ResponseWriter, v any, err error) {
+	switch {
+	case errors.Is(err, ErrPeerNotFound), errors.Is(err, ErrServiceNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrServiceExists):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, v)
+	}
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(apiError{Error: msg}) //nolint:errcheck
+}
@@ -0,0 +1,283 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package localapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+)
+
+type fakeBackend struct {
+	netmap   *infra.Message
+	services map[string]Service
+	forwards []PortForward
+}
+
+func (b *fakeBackend) Status() *Status {
+	return &Status{
+		Interface:     "wf0",
+		ConfigVersion: "v7",
+		Peers:         []Peer{{AppID: "office", ProbeState: "connected", Transport: "ICE"}},
+	}
+}
+
+func (b *fakeBackend) NetMap() *infra.Message { return b.netmap }
+
+func (b *fakeBackend) Rules() *Rules {
+	return &Rules{Backend: "userspace", Applied: &infra.FirewallRule{PolicyName: "allow-office"}}
+}
+
+func (b *fakeBackend) Ping(_ context.Context, req *PingRequest) (*PingResult, error) {
+	if req.Peer != "office" {
+		return nil, ErrPeerNotFound
+	}
+	if req.Path == "WRRP" {
+		return nil, fmt.Errorf("%w: no relay", ErrPathUnavailable)
+	}
+	if req.Path == "DIRECT" {
+		return nil, fmt.Errorf("%w: userspace stack", errors.ErrUnsupported)
+	}
+	result := &PingResult{Peer: req.Peer, Path: "ICE"}
+	for seq := 1; seq <= req.Count; seq++ {
+		result.Replies = append(result.Replies, PingReply{Seq: seq, RTT: time.Millisecond})
+	}
+	return result, nil
+}
+
+func (b *fakeBackend) Services() []Service {
+	out := make([]Service, 0, len(b.services))
+	for _, s := range b.services {
+		out = append(out, s)
+	}
+	return out
+}
+
+func (b *fakeBackend) Expose(req *ExposeRequest) (*Service, error) {
+	if _, ok := b.services[req.Name]; ok {
+		return nil, ErrServiceExists
+	}
+	if b.services == nil {
+		b.services = make(map[string]Service)
+	}
+	s := Service{Name: req.Name, Protocol: req.Protocol, Address: fmt.Sprintf("10.0.0.1:%d", req.ListenPort)}
+	b.services[req.Name] = s
+	return &s, nil
+}
+
+func (b *fakeBackend) Unexpose(name string) error {
+	if _, ok := b.services[name]; !ok {
+		return ErrServiceNotFound
+	}
+	delete(b.services, name)
+	return nil
+}
+
+func (b *fakeBackend) Forwards() []PortForward { return b.forwards }
+
+func (b *fakeBackend) Forward(req *ForwardRequest) (*PortForward, error) {
+	if req.Peer != "office" {
+		return nil, ErrPeerNotFound
+	}
+	f := PortForward{Listen: req.Listen, Peer: req.Peer, Remote: fmt.Sprintf("10.0.0.2:%d", req.Port)}
+	b.forwards = append(b.forwards, f)
+	return &f, nil
+}
+
+func (b *fakeBackend) Unforward(listen string) error {
+	for i, f := range b.forwards {
+		if f.Listen == listen {
+			b.forwards = append(b.forwards[:i], b.forwards[i+1:]...)
+			return nil
+		}
+	}
+	return ErrServiceNotFound
+}
+
+func (b *fakeBackend) Capture(_ context.Context, req *CaptureRequest, w io.Writer) error {
+	if req.Peer != "" && req.Peer != "office" {
+		return ErrPeerNotFound
+	}
+	_, err := w.Write([]byte("pcapng"))
+	return err
+}
+
+func TestServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := &fakeBackend{}
+	path := filepath.Join(t.TempDir(), "wf0.sock")
+	done := make(chan error, 1)
+	go func() { done <- NewServer(log.GetLogger("localapi"), backend).Serve(ctx, path) }()
+
+	client := newClient(path)
+	var (
+		status *Status
+		err    error
+	)
+	for i := 0; i < 50; i++ {
+		if status, err = client.Status(ctx); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ConfigVersion != "v7" || len(status.Peers) != 1 || status.Peers[0].Transport != "ICE" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	rules, err := client.Rules(ctx)
+	if err != nil || rules.Backend != "userspace" || rules.Applied.PolicyName != "allow-office" {
+		t.Fatalf("unexpected rules %+v: %v", rules, err)
+	}
+
+	if _, err = client.NetMap(ctx); err == nil {
+		t.Fatal("expected an error before a network map is applied")
+	}
+	backend.netmap = &infra.Message{
+		ConfigVersion: "v7",
+		ComputedPeers: []*infra.Peer{{AppID: "office", PresharedKey: "secret"}},
+	}
+	msg, err := client.NetMap(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ComputedPeers[0].PresharedKey != "" {
+		t.Fatal("preshared keys must not leave the agent")
+	}
+	if backend.netmap.ComputedPeers[0].PresharedKey != "secret" {
+		t.Fatal("redacting must not modify the applied network map")
+	}
+
+	ping, err := client.Ping(ctx, &PingRequest{Peer: "office"})
+	if err != nil || len(ping.Replies) != DefaultPingCount || ping.Path != "ICE" {
+		t.Fatalf("unexpected ping %+v: %v", ping, err)
+	}
+	for _, req := range []*PingRequest{
+		{Peer: "lab"},
+		{Peer: "office", Path: "WRRP"},
+		{Peer: "office", Path: "DIRECT"},
+		{Peer: "office", Count: MaxPingCount + 1},
+	} {
+		if _, err = client.Ping(ctx, req); err == nil {
+			t.Fatalf("expected ping %+v to fail", req)
+		}
+	}
+
+	service, err := client.Expose(ctx, &ExposeRequest{Port: 5432})
+	if err != nil || service.Name != "tcp-5432" || service.Address != "10.0.0.1:5432" {
+		t.Fatalf("unexpected service %+v: %v", service, err)
+	}
+	if _, err = client.Expose(ctx, &ExposeRequest{Port: 5432}); err == nil {
+		t.Fatal("expected exposing a taken name to fail")
+	}
+	if _, err = client.Expose(ctx, &ExposeRequest{Protocol: "udp", Port: 53}); err == nil {
+		t.Fatal("expected exposing a udp service to fail")
+	}
+	if err = client.Unexpose(ctx, "tcp-5432"); err != nil {
+		t.Fatal(err)
+	}
+	if services, err := client.Services(ctx); err != nil || len(services) != 0 {
+		t.Fatalf("unexpected services %+v: %v", services, err)
+	}
+
+	forward, err := client.Forward(ctx, &ForwardRequest{Peer: "office", Port: 8080, Listen: "18080"})
+	if err != nil || forward.Listen != "127.0.0.1:18080" || forward.Remote != "10.0.0.2:8080" {
+		t.Fatalf("unexpected forward %+v: %v", forward, err)
+	}
+	if _, err = client.Forward(ctx, &ForwardRequest{Peer: "lab", Port: 8080}); err == nil {
+		t.Fatal("expected forwarding to an unknown peer to fail")
+	}
+	if err = client.Unforward(ctx, "127.0.0.1:18080"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.Unforward(ctx, "127.0.0.1:18080"); err == nil {
+		t.Fatal("expected removing an unknown forward to fail")
+	}
+
+	var pcap bytes.Buffer
+	if err = client.Capture(ctx, &CaptureRequest{Peer: "office"}, &pcap); err != nil || pcap.String() != "pcapng" {
+		t.Fatalf("unexpected capture %q: %v", pcap.String(), err)
+	}
+	for _, req := range []*CaptureRequest{
+		{Peer: "lab"},
+		{Filter: "port http"},
+		{Count: -1},
+	} {
+		if err = client.Capture(ctx, req, io.Discard); err == nil {
+			t.Fatalf("expected capture %+v to fail", req)
+		}
+	}
+
+	cancel()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Status(context.Background()); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("expected ErrNotRunning after shutdown, got %v", err)
+	}
+}
+
+func TestServeSocketPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permission bits do not apply")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A directory left behind with a wider mode is tightened before the
+	// socket appears in it.
+	dir := filepath.Join(t.TempDir(), "wireflow")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "wf0.sock")
+	go NewServer(log.GetLogger("localapi"), &fakeBackend{}).Serve(ctx, path) //nolint:errcheck
+
+	var (
+		info os.FileInfo
+		err  error
+	)
+	for i := 0; i < 50; i++ {
+		if info, err = os.Stat(path); err == nil && info.Mode().Perm() == 0o600 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode = %v", info.Mode().Perm())
+	}
+	if info, err = os.Stat(dir); err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o700 {
+		t.Fatalf("directory mode = %v", info.Mode().Perm())
+	}
+}
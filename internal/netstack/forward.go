@@ -0,0 +1,60 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"wireflow/internal/log"
+)
+
+// ParseForward parses an inbound forward of the form "port" or
+// "port=host:port": overlay TCP connections to port go to the target, which
+// defaults to the same port on localhost.
+func ParseForward(value string) (uint16, string, error) {
+	portStr, target, hasTarget := strings.Cut(value, "=")
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return 0, "", fmt.Errorf("invalid forward %q: bad port", value)
+	}
+	if !hasTarget {
+		return uint16(port), net.JoinHostPort("127.0.0.1", portStr), nil
+	}
+	if _, _, err = net.SplitHostPort(target); err != nil {
+		return 0, "", fmt.Errorf("invalid forward %q: %w", value, err)
+	}
+	return uint16(port), target, nil
+}
+
+// Forward accepts connections on l and relays each to target, opened with
+// dial, until ctx is done. Inbound forwards accept on the stack and dial the
+// host; outbound ones the other way round.
+func Forward(ctx context.Context, l net.Listener, dial DialFunc, target string, logger *log.Logger) error {
+	return serve(ctx, l, func(conn net.Conn) {
+		defer conn.Close()
+		dctx, cancel := context.WithTimeout(ctx, dialTimeout)
+		upstream, err := dial(dctx, "tcp", target)
+		cancel()
+		if err != nil {
+			logger.Debug("forward: dial failed", "target", target, "err", err)
+			return
+		}
+		defer upstream.Close()
+		pipe(conn, upstream)
+	})
+}
@@ -0,0 +1,299 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netstack runs the overlay on a userspace TCP/IP stack instead of a
+// kernel TUN device, so the agent needs neither root nor iptables. WireGuard
+// reads and writes IP packets through Stack, and the agent reaches the overlay
+// through the connections Stack opens.
+package netstack
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"golang.zx2c4.com/wireguard/tun"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+// nicID is the only NIC of the stack: the WireGuard device.
+const nicID tcpip.NICID = 1
+
+var _ tun.Device = (*Stack)(nil)
+
+// Stack is a tun.Device backed by a userspace TCP/IP stack. Unlike a kernel
+// interface its overlay address can be set and changed at any time.
+type Stack struct {
+	name     string
+	mtu      int
+	ep       *channel.Endpoint
+	stack    *stack.Stack
+	events   chan tun.Event
+	incoming chan *buffer.View
+	// notify is the registration of WriteNotify with ep; done is closed by
+	// Close, which unblocks a WriteNotify still waiting for a reader.
+	notify *channel.NotificationHandle
+	done   chan struct{}
+
+	mu        sync.Mutex
+	addr      netip.Prefix
+	closeOnce sync.Once
+}
+
+// New creates a stack named name with the given MTU and no address yet.
+func New(name string, mtu int) (*Stack, error) {
+	s := &Stack{
+		name: name,
+		mtu:  mtu,
+		ep:   channel.New(1024, uint32(mtu), ""),
+		stack: stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol, icmp.NewProtocol4, icmp.NewProtocol6},
+			HandleLocal:        true,
+		}),
+		events:   make(chan tun.Event, 10),
+		incoming: make(chan *buffer.View),
+		done:     make(chan struct{}),
+	}
+	sack := tcpip.TCPSACKEnabled(true)
+	if err := s.stack.SetTransportProtocolOption(tcp.ProtocolNumber, &sack); err != nil {
+		return nil, fmt.Errorf("netstack: enable TCP SACK: %v", err)
+	}
+	s.notify = s.ep.AddNotify(s)
+	if err := s.stack.CreateNIC(nicID, s.ep); err != nil {
+		return nil, fmt.Errorf("netstack: create NIC: %v", err)
+	}
+	// Everything leaves through WireGuard; its allowed IPs decide which peer
+	// gets a packet, or drop it.
+	s.stack.SetRouteTable([]tcpip.Route{
+		{Destination: header.IPv4EmptySubnet, NIC: nicID},
+		{Destination: header.IPv6EmptySubnet, NIC: nicID},
+	})
+	s.events <- tun.EventUp
+	return s, nil
+}
+
+// SetAddress replaces the overlay address of the stack.
+func (s *Stack) SetAddress(prefix netip.Prefix) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prefix == s.addr {
+		return nil
+	}
+	s.removeAddressLocked()
+
+	proto := ipv4.ProtocolNumber
+	if prefix.Addr().Is6() {
+		proto = ipv6.ProtocolNumber
+	}
+	if err := s.stack.AddProtocolAddress(nicID, tcpip.ProtocolAddress{
+		Protocol: proto,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   tcpip.AddrFromSlice(prefix.Addr().AsSlice()),
+			PrefixLen: prefix.Bits(),
+		},
+	}, stack.AddressProperties{}); err != nil {
+		return fmt.Errorf("netstack: add address %s: %v", prefix, err)
+	}
+	s.addr = prefix
+	return nil
+}
+
+// RemoveAddress removes the overlay address, if any.
+func (s *Stack) RemoveAddress() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeAddressLocked()
+}
+
+func (s *Stack) removeAddressLocked() {
+	if s.addr.IsValid() {
+		_ = s.stack.RemoveAddress(nicID, tcpip.AddrFromSlice(s.addr.Addr().AsSlice()))
+		s.addr = netip.Prefix{}
+	}
+}
+
+// Address returns the overlay address of the stack, invalid until it is set.
+func (s *Stack) Address() netip.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr.Addr()
+}
+
+// DialContext connects to address on the overlay. network is "tcp" or "udp"
+// (optionally suffixed with 4 or 6) and the host of address must be an IP.
+func (s *Stack) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	addrPort, err := parseAddrPort(address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	fa, proto := fullAddress(addrPort)
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return gonet.DialContextTCP(ctx, s.stack, fa, proto)
+	case "udp", "udp4", "udp6":
+		return gonet.DialUDP(s.stack, nil, &fa, proto)
+	default:
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+}
+
+// ListenTCP accepts overlay connections to port, whatever the overlay address
+// is at the time.
+func (s *Stack) ListenTCP(port uint16) (net.Listener, error) {
+	return gonet.ListenTCP(s.stack, tcpip.FullAddress{NIC: nicID, Port: port}, ipv4.ProtocolNumber)
+}
+
+// ListenUDP receives overlay datagrams sent to port.
+func (s *Stack) ListenUDP(port uint16) (net.PacketConn, error) {
+	return gonet.DialUDP(s.stack, &tcpip.FullAddress{NIC: nicID, Port: port}, nil, ipv4.ProtocolNumber)
+}
+
+// parseAddrPort parses "ip:port", tolerating an IPv6 zone-less bracketed host.
+func parseAddrPort(address string) (netip.AddrPort, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("netstack: %q is not an IP address", host)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("netstack: invalid port %q", portStr)
+	}
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), nil
+}
+
+func fullAddress(addrPort netip.AddrPort) (tcpip.FullAddress, tcpip.NetworkProtocolNumber) {
+	proto := ipv4.ProtocolNumber
+	if addrPort.Addr().Is6() {
+		proto = ipv6.ProtocolNumber
+	}
+	return tcpip.FullAddress{
+		NIC:  nicID,
+		Addr: tcpip.AddrFromSlice(addrPort.Addr().AsSlice()),
+		Port: addrPort.Port(),
+	}, proto
+}
+
+// Name implements tun.Device.
+func (s *Stack) Name() (string, error) {
+	return s.name, nil
+}
+
+// File implements tun.Device; a userspace stack has no file descriptor.
+func (s *Stack) File() *os.File {
+	return nil
+}
+
+// Events implements tun.Device.
+func (s *Stack) Events() <-chan tun.Event {
+	return s.events
+}
+
+// MTU implements tun.Device.
+func (s *Stack) MTU() (int, error) {
+	return s.mtu, nil
+}
+
+// BatchSize implements tun.Device.
+func (s *Stack) BatchSize() int {
+	return 1
+}
+
+// Read hands WireGuard the next packet the stack sends.
+func (s *Stack) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	var view *buffer.View
+	select {
+	case view = <-s.incoming:
+	case <-s.done:
+		return 0, os.ErrClosed
+	}
+	n, err := view.Read(bufs[0][offset:])
+	if err != nil {
+		return 0, err
+	}
+	sizes[0] = n
+	return 1, nil
+}
+
+// Write delivers packets decrypted by WireGuard to the stack.
+func (s *Stack) Write(bufs [][]byte, offset int) (int, error) {
+	for _, buf := range bufs {
+		packet := buf[offset:]
+		if len(packet) == 0 {
+			continue
+		}
+		pkb := stack.NewPacketBuffer(stack.PacketBufferOptions{Payload: buffer.MakeWithData(packet)})
+		switch packet[0] >> 4 {
+		case 4:
+			s.ep.InjectInbound(header.IPv4ProtocolNumber, pkb)
+		case 6:
+			s.ep.InjectInbound(header.IPv6ProtocolNumber, pkb)
+		default:
+			pkb.DecRef()
+			return 0, syscall.EAFNOSUPPORT
+		}
+		pkb.DecRef()
+	}
+	return len(bufs), nil
+}
+
+// WriteNotify implements channel.Notification: the stack queued a packet.
+func (s *Stack) WriteNotify() {
+	pkt := s.ep.Read()
+	if pkt == nil {
+		return
+	}
+	view := pkt.ToView()
+	pkt.DecRef()
+	select {
+	case s.incoming <- view:
+	case <-s.done:
+		view.Release()
+	}
+}
+
+// Close tears the stack down; pending reads return os.ErrClosed. The
+// notification is removed before anything is closed, and incoming is never
+// closed, so that a packet the stack sends meanwhile is dropped rather than
+// sent on a closed channel.
+func (s *Stack) Close() error {
+	s.closeOnce.Do(func() {
+		s.ep.RemoveNotify(s.notify)
+		close(s.done)
+		s.stack.RemoveNIC(nicID)
+		s.stack.Close()
+		close(s.events)
+		s.ep.Close()
+	})
+	return nil
+}
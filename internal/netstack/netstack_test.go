@@ -0,0 +1,232 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// link shuttles the packets one stack emits into the other, standing in for
+// WireGuard.
+func link(t *testing.T, from, to *Stack) {
+	go func() {
+		bufs := [][]byte{make([]byte, 2048)}
+		sizes := make([]int, 1)
+		for {
+			n, err := from.Read(bufs, sizes, 0)
+			if err != nil {
+				return
+			}
+			for i := 0; i < n; i++ {
+				if _, err := to.Write([][]byte{append([]byte(nil), bufs[i][:sizes[i]]...)}, 0); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+func newPair(t *testing.T) (*Stack, *Stack) {
+	t.Helper()
+	a, err := New("wf-a", 1420)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New("wf-b", 1420)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	if err := a.SetAddress(netip.MustParsePrefix("10.0.0.1/32")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetAddress(netip.MustParsePrefix("10.0.0.2/32")); err != nil {
+		t.Fatal(err)
+	}
+	link(t, a, b)
+	link(t, b, a)
+	return a, b
+}
+
+func echo(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			_, _ = io.Copy(conn, conn)
+		}()
+	}
+}
+
+func roundTrip(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("echo = %q, want ping", buf)
+	}
+}
+
+func TestStackTCP(t *testing.T) {
+	a, b := newPair(t)
+	l, err := b.ListenTCP(80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go echo(l)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := a.DialContext(ctx, "tcp", "10.0.0.2:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	roundTrip(t, conn)
+
+	// A new address takes effect without recreating the stack.
+	if err := a.SetAddress(netip.MustParsePrefix("10.0.0.3/32")); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Address(); got != netip.MustParseAddr("10.0.0.3") {
+		t.Fatalf("Address() = %s, want 10.0.0.3", got)
+	}
+}
+
+func TestStackCloseWhileSending(t *testing.T) {
+	s, err := New("wf-close", 1420)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.SetAddress(netip.MustParsePrefix("10.0.0.1/32")); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := s.DialContext(context.Background(), "udp", "10.0.0.2:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing reads the stack, so the stack's notification blocks handing
+	// the datagram over until Close.
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		_, _ = conn.Write([]byte("query"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("send still blocked after Close")
+	}
+	if _, err = s.Read([][]byte{make([]byte, 2048)}, make([]int, 1), 0); err == nil {
+		t.Fatal("expected Read to fail after Close")
+	}
+}
+
+func TestSOCKS5(t *testing.T) {
+	a, b := newPair(t)
+	l, err := b.ListenTCP(5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go echo(l)
+
+	proxy := &Proxy{
+		Dial: a.DialContext,
+		Resolve: func(ctx context.Context, host string) (netip.Addr, error) {
+			return netip.MustParseAddr("10.0.0.2"), nil
+		},
+	}
+	pl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go proxy.ServeSOCKS5(ctx, pl)
+
+	conn, err := net.Dial("tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Greeting with no authentication, then CONNECT db:5432.
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[1] != 0 {
+		t.Fatalf("greeting reply = %v, %v", reply, err)
+	}
+	req := []byte{5, 1, 0, 3, 2, 'd', 'b', 0x15, 0x38}
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	resp := make([]byte, 10)
+	if _, err := io.ReadFull(conn, resp); err != nil || resp[1] != 0 {
+		t.Fatalf("connect reply = %v, %v", resp, err)
+	}
+	roundTrip(t, conn)
+}
+
+func TestParseForward(t *testing.T) {
+	cases := []struct {
+		in     string
+		port   uint16
+		target string
+		ok     bool
+	}{
+		{"8080", 8080, "127.0.0.1:8080", true},
+		{"80=localhost:8080", 80, "localhost:8080", true},
+		{"0", 0, "", false},
+		{"http", 0, "", false},
+		{"80=localhost", 0, "", false},
+	}
+	for _, c := range cases {
+		port, target, err := ParseForward(c.in)
+		if (err == nil) != c.ok {
+			t.Errorf("ParseForward(%q) err = %v, want ok=%v", c.in, err, c.ok)
+			continue
+		}
+		if c.ok && (port != c.port || target != c.target) {
+			t.Errorf("ParseForward(%q) = %d, %q, want %d, %q", c.in, port, target, c.port, c.target)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+)
+
+var _ infra.RouteProvisioner = (*routeProvisioner)(nil)
+
+// errUnsupported is returned for features that need the host network stack.
+var errUnsupported = errors.New("not supported in netstack mode")
+
+// routeProvisioner applies the overlay address to the stack and leaves the
+// host untouched. Every overlay destination already routes to the stack's only
+// NIC, so route changes are no-ops; forwarding for other hosts is not possible.
+type routeProvisioner struct {
+	stack  *Stack
+	logger *log.Logger
+}
+
+// NewRouteProvisioner returns the RouteProvisioner of s.
+func NewRouteProvisioner(logger *log.Logger, s *Stack) infra.RouteProvisioner {
+	return &routeProvisioner{stack: s, logger: logger}
+}
+
+func (r *routeProvisioner) ApplyIP(action, address, name string) error {
+	switch action {
+	case "add":
+		if !strings.Contains(address, "/") {
+			address += "/32"
+		}
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			return fmt.Errorf("netstack: invalid address %q: %w", address, err)
+		}
+		return r.stack.SetAddress(prefix)
+	case "remove":
+		r.stack.RemoveAddress()
+	}
+	return nil
+}
+
+func (r *routeProvisioner) ApplyRoute(action, address, name string) error {
+	return nil
+}
+
+func (r *routeProvisioner) SetMTU(name string, mtu int) error {
+	r.logger.Debug("netstack MTU is fixed, ignoring change", "mtu", mtu)
+	return nil
+}
+
+func (r *routeProvisioner) ApplyExitNode(action, name string, bypass []string) error {
+	if action == "add" {
+		return fmt.Errorf("exit node: %w", errUnsupported)
+	}
+	return nil
+}
+
+func (r *routeProvisioner) ServeExitNode(action, name string) error {
+	if action == "add" {
+		return fmt.Errorf("serving as exit node: %w", errUnsupported)
+	}
+	return nil
+}
+
+func (r *routeProvisioner) ServeRoutes(name, source string, subnets []string) error {
+	if len(subnets) > 0 {
+		return fmt.Errorf("subnet routing: %w", errUnsupported)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+	"wireflow/internal/log"
+)
+
+// DialFunc opens a connection to address ("ip:port") on the overlay.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// ResolveFunc maps a host name to an overlay address.
+type ResolveFunc func(ctx context.Context, host string) (netip.Addr, error)
+
+// dialTimeout bounds how long a proxied connection waits for the overlay.
+const dialTimeout = 15 * time.Second
+
+// Proxy lets local applications reach the overlay without a TUN device. It
+// serves SOCKS5 (CONNECT, no authentication) and HTTP proxy requests, both
+// CONNECT tunnels and plain http:// requests, and opens the upstream
+// connections through Dial.
+type Proxy struct {
+	Dial    DialFunc
+	Resolve ResolveFunc
+	Logger  *log.Logger
+}
+
+// dial resolves the host of hostport when it is not an IP and dials it.
+func (p *Proxy) dial(ctx context.Context, hostport string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		if p.Resolve == nil {
+			return nil, fmt.Errorf("cannot resolve %s", host)
+		}
+		if addr, err = p.Resolve(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	return p.Dial(ctx, "tcp", net.JoinHostPort(addr.String(), port))
+}
+
+// ServeSOCKS5 accepts SOCKS5 clients on l until ctx is done.
+func (p *Proxy) ServeSOCKS5(ctx context.Context, l net.Listener) error {
+	return serve(ctx, l, func(conn net.Conn) { p.handleSOCKS5(ctx, conn) })
+}
+
+// ServeHTTP accepts HTTP proxy clients on l until ctx is done.
+func (p *Proxy) ServeHTTP(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { p.handleHTTP(ctx, w, r) }),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serve runs handle for every connection accepted on l until ctx is done.
+func serve(ctx context.Context, l net.Listener, handle func(net.Conn)) error {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go handle(conn)
+	}
+}
+
+// SOCKS5 constants from RFC 1928.
+const (
+	socks5Version      = 0x05
+	socks5NoAuth       = 0x00
+	socks5NoAcceptable = 0xff
+	socks5Connect      = 0x01
+	socks5AtypIPv4     = 0x01
+	socks5AtypDomain   = 0x03
+	socks5AtypIPv6     = 0x04
+
+	socks5Succeeded          = 0x00
+	socks5GeneralFailure     = 0x01
+	socks5HostUnreachable    = 0x04
+	socks5CommandUnsupported = 0x07
+	socks5AddrUnsupported    = 0x08
+)
+
+func (p *Proxy) handleSOCKS5(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	r := bufio.NewReader(conn)
+
+	// Greeting: VER NMETHODS METHODS...
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil || head[0] != socks5Version {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return
+	}
+	if !containsByte(methods, socks5NoAuth) {
+		_, _ = conn.Write([]byte{socks5Version, socks5NoAcceptable})
+		return
+	}
+	if _, err := conn.Write([]byte{socks5Version, socks5NoAuth}); err != nil {
+		return
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	var req [4]byte
+	if _, err := io.ReadFull(r, req[:]); err != nil || req[0] != socks5Version {
+		return
+	}
+	if req[1] != socks5Connect {
+		socks5Reply(conn, socks5CommandUnsupported)
+		return
+	}
+	var host string
+	switch req[3] {
+	case socks5AtypIPv4, socks5AtypIPv6:
+		size := 4
+		if req[3] == socks5AtypIPv6 {
+			size = 16
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return
+		}
+		addr, _ := netip.AddrFromSlice(b)
+		host = addr.String()
+	case socks5AtypDomain:
+		n, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		b := make([]byte, n)
+		if _, err = io.ReadFull(r, b); err != nil {
+			return
+		}
+		host = string(b)
+	default:
+		socks5Reply(conn, socks5AddrUnsupported)
+		return
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+
+	upstream, err := p.dial(ctx, target)
+	if err != nil {
+		p.Logger.Debug("socks5: dial failed", "target", target, "err", err)
+		socks5Reply(conn, socks5HostUnreachable)
+		return
+	}
+	defer upstream.Close()
+	socks5Reply(conn, socks5Succeeded)
+	_ = conn.SetDeadline(time.Time{})
+	pipe(&bufferedConn{Conn: conn, r: r}, upstream)
+}
+
+// socks5Reply sends a reply with an unspecified bound address.
+func socks5Reply(conn net.Conn, code byte) {
+	_, _ = conn.Write([]byte{socks5Version, code, 0x00, socks5AtypIPv4, 0, 0, 0, 0, 0, 0})
+}
+
+func containsByte(b []byte, c byte) bool {
+	for _, x := range b {
+		if x == c {
+			return true
+		}
+	}
+	return false
+}
+
+// hopHeaders are the hop-by-hop headers a proxy must not forward.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+func (p *Proxy) handleHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.handleConnect(ctx, w, r)
+		return
+	}
+	if !r.URL.IsAbs() || r.URL.Scheme != "http" {
+		http.Error(w, "only CONNECT and absolute http:// requests are proxied", http.StatusBadRequest)
+		return
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return p.dial(ctx, addr)
+		},
+		DisableKeepAlives: true,
+	}
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func (p *Proxy) handleConnect(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	target := r.Host
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "443")
+	}
+	upstream, err := p.dial(ctx, target)
+	if err != nil {
+		p.Logger.Debug("http connect: dial failed", "target", target, "err", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+	pipe(&bufferedConn{Conn: conn, r: rw.Reader}, upstream)
+}
+
+// bufferedConn reads through r, which may hold bytes already read from Conn.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// pipe copies between a and b until both directions are done.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	cp := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		// Half-close where supported so the other direction can finish.
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+	go cp(a, b)
+	go cp(b, a)
+	wg.Wait()
+}
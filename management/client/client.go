@@ -27,6 +27,8 @@ import (
 	"wireflow/management/dto"
 	"wireflow/management/transport"
 	"wireflow/pkg/utils"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 var (
@@ -38,6 +40,10 @@ type Client struct {
 	nats            infra.SignalService
 	getKeyManager   func() infra.KeyManager
 	getProbeFactory func() *transport.ProbeFactory
+
+	appId           string
+	port            int
+	advertiseRoutes []string
 }
 
 // ClientConfig holds the dependencies for NewClient. GetKeyManager and
@@ -47,15 +53,31 @@ type ClientConfig struct {
 	Nats            infra.SignalService
 	GetKeyManager   func() infra.KeyManager
 	GetProbeFactory func() *transport.ProbeFactory
+
+	// AppID, Port and AdvertiseRoutes describe the node in the network this
+	// client enrolls in. AppID and Port default to the agent configuration.
+	AppID           string
+	Port            int
+	AdvertiseRoutes []string
 }
 
 func NewClient(cfg *ClientConfig) (*Client, error) {
-	return &Client{
+	c := &Client{
 		logger:          log.GetLogger("ctrl-client"),
 		nats:            cfg.Nats,
 		getKeyManager:   cfg.GetKeyManager,
 		getProbeFactory: cfg.GetProbeFactory,
-	}, nil
+		appId:           cfg.AppID,
+		port:            cfg.Port,
+		advertiseRoutes: cfg.AdvertiseRoutes,
+	}
+	if c.appId == "" {
+		c.appId = config.Conf.AppId
+	}
+	if c.port == 0 {
+		c.port = config.Conf.WgPort
+	}
+	return c, nil
 }
 
 func (c *Client) GetNetMap(token string) (*infra.Message, error) {
@@ -66,7 +88,7 @@ func (c *Client) GetNetMap(token string) (*infra.Message, error) {
 		token = config.Conf.Token
 	}
 	request := &dto.PeerDto{
-		AppID:     config.Conf.AppId,
+		AppID:     c.appId,
 		PublicKey: c.getKeyManager().GetPublicKey().String(),
 		Token:     token,
 	}
@@ -88,7 +110,8 @@ func (c *Client) GetNetMap(token string) (*infra.Message, error) {
 	return &msg, nil
 }
 
-// Register will register device to wireflow center
+// Register will register device to wireflow center. Only the public key is
+// submitted; the private key is generated and kept by the node itself.
 func (c *Client) Register(ctx context.Context, token, interfaceName string) (*infra.Peer, error) {
 	if token == "" {
 		return nil, fmt.Errorf("token is empty")
@@ -105,14 +128,16 @@ func (c *Client) Register(ctx context.Context, token, interfaceName string) (*in
 	}
 
 	registryRequest := &dto.PeerDto{
-		Name:                config.Conf.AppId,
+		Name:                c.appId,
 		Hostname:            hostname,
 		InterfaceName:       interfaceName,
 		Platform:            runtime.GOOS,
-		AppID:               config.Conf.AppId,
+		AppID:               c.appId,
+		PublicKey:           c.getKeyManager().GetPublicKey().String(),
 		PersistentKeepalive: 25,
-		Port:                config.Conf.WgPort,
+		Port:                c.port,
 		Token:               token,
+		AdvertisedRoutes:    c.advertiseRoutes,
 	}
 
 	data, err := json.Marshal(registryRequest)
@@ -134,6 +159,100 @@ func (c *Client) Register(ctx context.Context, token, interfaceName string) (*in
 	return &node, nil
 }
 
+// RotateKey submits a freshly generated public key that replaces oldKey. The
+// control plane keeps accepting oldKey on remote peers for the network's grace
+// period, so tunnels stay up while they pick up the new key.
+func (c *Client) RotateKey(ctx context.Context, token string, oldKey, newKey wgtypes.Key) (*infra.Peer, error) {
+	if token == "" {
+		token = config.Conf.Token
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(&dto.PeerDto{
+		AppID:             c.appId,
+		PublicKey:         newKey.String(),
+		PreviousPublicKey: oldKey.String(),
+		Token:             token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = c.RequestNats(ctx, "wireflow.signals.peer", "rotateKey", data)
+	if err != nil {
+		return nil, fmt.Errorf("rotate key failed. %v", err)
+	}
+
+	var node infra.Peer
+	if err = json.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// TURNCredentials fetches short-lived credentials for the TURN relays of the
+// control plane.
+func (c *Client) TURNCredentials(ctx context.Context, token string) (*infra.TURNCredentials, error) {
+	if token == "" {
+		token = config.Conf.Token
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(&dto.PeerDto{
+		AppID:     c.appId,
+		PublicKey: c.getKeyManager().GetPublicKey().String(),
+		Token:     token,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = c.RequestNats(ctx, "wireflow.signals.peer", "turnCredentials", data)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds infra.TURNCredentials
+	if err = json.Unmarshal(data, &creds); err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+// Leave tells the control plane that this agent is shutting down, so it is
+// reported offline immediately rather than after missed heartbeats.
+func (c *Client) Leave(ctx context.Context, token string) error {
+	if token == "" {
+		token = config.Conf.Token
+	}
+
+	// The token and public key are known to every agent of the workspace;
+	// the signature proves that the leave comes from the peer itself.
+	keyManager := c.getKeyManager()
+	timestamp := time.Now().Unix()
+	signature, err := infra.SignWithKey(keyManager.GetKey(), infra.LeaveStatement(c.appId, keyManager.GetPublicKey(), timestamp))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&dto.PeerDto{
+		AppID:     c.appId,
+		PublicKey: keyManager.GetPublicKey().String(),
+		Token:     token,
+		Timestamp: timestamp,
+		Signature: signature,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.RequestNats(ctx, "wireflow.signals.peer", "leave", data)
+	return err
+}
+
 func (c *Client) RequestNats(ctx context.Context, subject, method string, data []byte) ([]byte, error) {
 	data, err := c.nats.Request(ctx, subject, method, data)
 	if err != nil {
@@ -35,12 +35,17 @@ var (
 
 type PeerController interface {
 	Register(ctx context.Context, request []byte) ([]byte, error)
+	RotateKey(ctx context.Context, request []byte) ([]byte, error)
+	TURNCredentials(ctx context.Context, request []byte) ([]byte, error)
+	Leave(ctx context.Context, request []byte) ([]byte, error)
+	Heartbeat(ctx context.Context, request []byte) ([]byte, error)
 	GetNetmap(ctx context.Context, request []byte) ([]byte, error)
 	CreateToken(ctx context.Context, request []byte) ([]byte, error)
 	UpdateStatus(ctx context.Context, status int) error
 
 	ListPeers(ctx context.Context, pageParam *dto.PageRequest) (*dto.PageResult[vo.PeerVo], error)
 	UpdatePeer(ctx context.Context, peerDto *dto.PeerDto) (*vo.PeerVo, error)
+	Connectivity(ctx context.Context) (*vo.ConnectivityMatrix, error)
 }
 
 func NewPeerController(client *resource.Client, st store.Store, presence *managementnats.NodePresenceStore) PeerController {
@@ -63,6 +68,10 @@ func (p *peerController) ListPeers(ctx context.Context, pageParam *dto.PageReque
 	return p.peerService.ListPeers(ctx, pageParam)
 }
 
+func (p *peerController) Connectivity(ctx context.Context) (*vo.ConnectivityMatrix, error) {
+	return p.peerService.Connectivity(ctx)
+}
+
 func (p *peerController) CreateToken(ctx context.Context, request []byte) ([]byte, error) {
 	var (
 		tokenDto dto.TokenDto
@@ -109,6 +118,52 @@ func (p *peerController) Register(ctx context.Context, request []byte) ([]byte,
 	return data, nil
 }
 
+func (p *peerController) RotateKey(ctx context.Context, request []byte) ([]byte, error) {
+	var req dto.PeerDto
+	if err := json.Unmarshal(request, &req); err != nil {
+		return nil, err
+	}
+	peer, err := p.peerService.RotateKey(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(peer)
+}
+
+func (p *peerController) TURNCredentials(ctx context.Context, request []byte) ([]byte, error) {
+	var req dto.PeerDto
+	if err := json.Unmarshal(request, &req); err != nil {
+		return nil, err
+	}
+	creds, err := p.peerService.TURNCredentials(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(creds)
+}
+
+func (p *peerController) Leave(ctx context.Context, request []byte) ([]byte, error) {
+	var req dto.PeerDto
+	if err := json.Unmarshal(request, &req); err != nil {
+		return nil, err
+	}
+	if err := p.peerService.Leave(ctx, &req); err != nil {
+		return nil, err
+	}
+	return []byte{}, nil
+}
+
+func (p *peerController) Heartbeat(ctx context.Context, request []byte) ([]byte, error) {
+	var req dto.HeartbeatDto
+	if err := json.Unmarshal(request, &req); err != nil {
+		return nil, err
+	}
+	if err := p.peerService.Heartbeat(ctx, &req); err != nil {
+		return nil, err
+	}
+	return []byte{}, nil
+}
+
 func (p *peerController) GetNetmap(ctx context.Context, request []byte) ([]byte, error) {
 	var (
 		peer dto.PeerDto
@@ -16,6 +16,7 @@ package dto
 
 import (
 	"time"
+	"wireflow/internal/infra"
 )
 
 type SearchParams struct {
@@ -37,8 +38,10 @@ type PeerDto struct {
 	Endpoint            string    `json:"endpoint,omitempty"`
 	PersistentKeepalive int       `json:"persistentKeepalive,omitempty"`
 	PublicKey           string    `json:"publicKey,omitempty"`
+	PreviousPublicKey   string    `json:"previousPublicKey,omitempty"` // key being replaced, set on rotateKey
 	PeerID              uint64    `json:"peerId,omitempty"`
 	AllowedIPs          string    `json:"allowedIps,omitempty"`
+	AdvertisedRoutes    []string  `json:"advertisedRoutes,omitempty"` // subnets offered for routing, set on register
 	RelayIP             string    `json:"relayIp,omitempty"`
 	TieBreaker          uint32    `json:"tieBreaker"`
 	Ufrag               string    `json:"ufrag"`
@@ -48,12 +51,23 @@ type PeerDto struct {
 	Version             uint64    `json:"version"`
 	LastUpdatedAt       time.Time `json:"lastUpdatedAt"`
 	Token               string    `json:"token,omitempty"`
+	Timestamp           int64     `json:"timestamp,omitempty"` // unix seconds the signature was made at, set on leave
+	Signature           []byte    `json:"signature,omitempty"` // infra.SignWithKey over infra.LeaveStatement, set on leave
 
 	Namespace   string            `json:"namespace,omitempty"`
 	Labels      map[string]string `json:"labels,omitempty"`
 	DisplayName string            `json:"displayName,omitempty"`
 }
 
+// HeartbeatDto is the periodic report of an agent. Token and PublicKey
+// authenticate it; a report without them is rejected.
+type HeartbeatDto struct {
+	AppID       string                 `json:"appId"`
+	Token       string                 `json:"token,omitempty"`
+	PublicKey   string                 `json:"publicKey,omitempty"`
+	Connections []infra.PeerConnection `json:"connections,omitempty"`
+}
+
 type TokenDto struct {
 	Namespace string `json:"namespace"`
 	Name      string `json:"name"`
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 	"wireflow/internal/infra"
 	"wireflow/internal/log"
@@ -67,10 +68,34 @@ type SignalHandler func(ctx context.Context, peerId infra.PeerID, packet *grpc.S
 type NatsSignalService struct {
 	log *log.Logger
 	nc  *natsgo.Conn
-	sub *natsgo.Subscription
+
+	mu   sync.Mutex
+	subs map[string]*natsgo.Subscription // by subject
+}
+
+// ServiceOption customises NewNatsService.
+type ServiceOption func(*serviceOptions)
+
+type serviceOptions struct {
+	retryOnFailedConnect bool
+}
+
+// WithRetryOnFailedConnect makes NewNatsService succeed even when the server is
+// unreachable. The connection keeps retrying in the background; subscriptions
+// made meanwhile are sent once it is established, and the reconnected handler
+// fires on that first successful connect.
+func WithRetryOnFailedConnect() ServiceOption {
+	return func(o *serviceOptions) {
+		o.retryOnFailedConnect = true
+	}
 }
 
-func NewNatsService(ctx context.Context, name, role, url string) (*NatsSignalService, error) {
+func NewNatsService(ctx context.Context, name, role, url string, options ...ServiceOption) (*NatsSignalService, error) {
+	var so serviceOptions
+	for _, o := range options {
+		o(&so)
+	}
+
 	clientName := fmt.Sprintf("wireflow-%s-%s-%d", role, name, time.Now().UnixNano())
 	// 1. 使用更稳健的连接配置
 	opts := []natsgo.Option{
@@ -81,6 +106,7 @@ func NewNatsService(ctx context.Context, name, role, url string) (*NatsSignalSer
 		natsgo.DisconnectErrHandler(func(nc *natsgo.Conn, err error) {
 			fmt.Printf("NATS disconnected: %v\n", err)
 		}),
+		natsgo.RetryOnFailedConnect(so.retryOnFailedConnect),
 	}
 
 	logger := log.GetLogger("nats-signal")
@@ -91,6 +117,19 @@ func NewNatsService(ctx context.Context, name, role, url string) (*NatsSignalSer
 		return nil, fmt.Errorf("nats connect: %w", err)
 	}
 
+	s := &NatsSignalService{
+		nc:  nc,
+		log: logger,
+	}
+
+	// The server is unreachable and the connection is retrying in the
+	// background. The stream is ensured by the management server, so there is
+	// nothing here that has to wait for it.
+	if so.retryOnFailedConnect && !nc.IsConnected() {
+		logger.Warn("NATS server unreachable, retrying in the background", "url", url)
+		return s, nil
+	}
+
 	// 3. 必须执行 Flush！
 	// 这一步会同步等待握手完成。如果你连到了 Telnet 端口，Flush 会立刻报错。
 	if err = nc.Flush(); err != nil {
@@ -98,11 +137,6 @@ func NewNatsService(ctx context.Context, name, role, url string) (*NatsSignalSer
 		return nil, fmt.Errorf("nats handshake failed (check if protocol is correct): %w", err)
 	}
 
-	s := &NatsSignalService{
-		nc: nc,
-	}
-	s.log = logger
-
 	// JetStream 初始化逻辑
 	js, err := jetstream.New(nc)
 	if err != nil {
@@ -150,14 +184,32 @@ func (s *NatsSignalService) Subscribe(subject string, onMessage SignalHandler) e
 		}
 	})
 
-	s.sub = sub
 	if err != nil {
 		return err
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs == nil {
+		s.subs = make(map[string]*natsgo.Subscription)
+	}
+	s.subs[subject] = sub
 	return nil
 }
 
+// Unsubscribe stops delivering the messages of subject, as subscribed with
+// Subscribe.
+func (s *NatsSignalService) Unsubscribe(subject string) error {
+	s.mu.Lock()
+	sub := s.subs[subject]
+	delete(s.subs, subject)
+	s.mu.Unlock()
+	if sub == nil {
+		return nil
+	}
+	return sub.Unsubscribe()
+}
+
 func (s *NatsSignalService) Flush() error {
 	return s.nc.Flush()
 }
@@ -221,6 +273,11 @@ func (s *NatsSignalService) SetReconnectedHandler(fn func()) {
 	})
 }
 
+// IsConnected reports whether the connection to the NATS server is currently up.
+func (s *NatsSignalService) IsConnected() bool {
+	return s.nc.IsConnected()
+}
+
 // Close drains in-flight messages and closes the NATS connection, immediately
 // notifying the server to remove all subscriptions for this client.
 func (s *NatsSignalService) Close() error {
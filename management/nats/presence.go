@@ -17,6 +17,7 @@ package nats
 import (
 	"sync"
 	"time"
+	"wireflow/internal/infra"
 )
 
 // offlineThreshold is how long since the last heartbeat before a node is considered offline.
@@ -24,16 +25,21 @@ import (
 const offlineThreshold = 90 * time.Second
 
 // NodePresenceStore is a thread-safe in-memory store that tracks the last
-// heartbeat timestamp for each agent node identified by its AppID.
+// heartbeat timestamp for each agent node identified by its AppID, and the
+// tunnel states the node reported with it.
 type NodePresenceStore struct {
-	mu sync.RWMutex
-	m  map[string]time.Time // appId -> lastHeartbeat
+	mu      sync.RWMutex
+	m       map[string]time.Time              // appId -> lastHeartbeat
+	left    map[string]struct{}               // appIds that announced a graceful leave
+	reports map[string][]infra.PeerConnection // appId -> last connection report
 }
 
 // NewNodePresenceStore creates an empty NodePresenceStore.
 func NewNodePresenceStore() *NodePresenceStore {
 	return &NodePresenceStore{
-		m: make(map[string]time.Time),
+		m:       make(map[string]time.Time),
+		left:    make(map[string]struct{}),
+		reports: make(map[string][]infra.PeerConnection),
 	}
 }
 
@@ -41,25 +47,58 @@ func NewNodePresenceStore() *NodePresenceStore {
 func (s *NodePresenceStore) Update(appId string) {
 	s.mu.Lock()
 	s.m[appId] = time.Now()
+	delete(s.left, appId)
 	s.mu.Unlock()
 }
 
+// MarkOffline reports appId as offline right away, without waiting for the
+// offline threshold. The last-seen time is kept; the next heartbeat brings
+// the node back online.
+func (s *NodePresenceStore) MarkOffline(appId string) {
+	s.mu.Lock()
+	if _, ok := s.m[appId]; !ok {
+		s.m[appId] = time.Now()
+	}
+	s.left[appId] = struct{}{}
+	delete(s.reports, appId)
+	s.mu.Unlock()
+}
+
+// SetConnections records the tunnel states appId reported with its last
+// heartbeat.
+func (s *NodePresenceStore) SetConnections(appId string, peers []infra.PeerConnection) {
+	s.mu.Lock()
+	s.reports[appId] = peers
+	s.mu.Unlock()
+}
+
+// Connections returns the tunnel states appId last reported. ok is false
+// when the node never reported or has announced a leave since.
+func (s *NodePresenceStore) Connections(appId string) (peers []infra.PeerConnection, ok bool) {
+	s.mu.RLock()
+	peers, ok = s.reports[appId]
+	s.mu.RUnlock()
+	return peers, ok
+}
+
 // GetStatus returns the online status and last-seen time for the given appId.
 //
 // Possible status values:
 //   - "online"  — heartbeat received within the last 90 seconds
-//   - "offline" — heartbeat was received before, but longer than 90 seconds ago
+//   - "offline" — heartbeat was received before, but longer than 90 seconds ago,
+//     or the node announced a graceful leave since its last heartbeat
 //   - "pending" — no heartbeat ever received (node registered but never connected)
 func (s *NodePresenceStore) GetStatus(appId string) (status string, lastSeen *time.Time) {
 	s.mu.RLock()
 	t, ok := s.m[appId]
+	_, left := s.left[appId]
 	s.mu.RUnlock()
 
 	if !ok {
 		return "pending", nil
 	}
 
-	if time.Since(t) < offlineThreshold {
+	if !left && time.Since(t) < offlineThreshold {
 		return "online", &t
 	}
 	return "offline", &t
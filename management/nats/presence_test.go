@@ -0,0 +1,49 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"testing"
+	"wireflow/internal/infra"
+)
+
+func TestNodePresenceConnections(t *testing.T) {
+	s := NewNodePresenceStore()
+	if _, ok := s.Connections("office"); ok {
+		t.Fatal("a node that never reported has connections")
+	}
+
+	s.Update("office")
+	s.SetConnections("office", []infra.PeerConnection{{AppID: "lab", Transport: "ICE"}})
+	peers, ok := s.Connections("office")
+	if !ok || len(peers) != 1 || peers[0].AppID != "lab" {
+		t.Fatalf("Connections = %v, %v", peers, ok)
+	}
+
+	// The last report replaces the previous one; an empty one is a report.
+	s.SetConnections("office", nil)
+	if peers, ok = s.Connections("office"); !ok || len(peers) != 0 {
+		t.Fatalf("Connections after an empty report = %v, %v", peers, ok)
+	}
+
+	s.SetConnections("office", []infra.PeerConnection{{AppID: "lab"}})
+	s.MarkOffline("office")
+	if _, ok = s.Connections("office"); ok {
+		t.Fatal("a node that left still has connections")
+	}
+	if status, _ := s.GetStatus("office"); status != "offline" {
+		t.Fatalf("status after leaving = %s, want offline", status)
+	}
+}
@@ -40,26 +40,16 @@ func (c *Client) Register(ctx context.Context, namespace string, e *dto.PeerDto)
 		key  wgtypes.Key
 	)
 
-	log.Info("Get node", "node", e)
-	err = c.Get(ctx, types.NamespacedName{
-		Namespace: namespace,
-		Name:      e.AppID,
-	}, &node)
-
-	var peerId infra.PeerID
-	if err != nil && errors.IsNotFound(err) {
-		key, err = wgtypes.GeneratePrivateKey()
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		key, err = wgtypes.ParseKey(node.Spec.PrivateKey)
-		if err != nil {
-			return nil, err
-		}
+	// The private key is generated and kept by the agent; only its public key
+	// is ever submitted, so it must be present and well-formed.
+	if e.PublicKey == "" {
+		return nil, fmt.Errorf("public key is required")
+	}
+	if key, err = wgtypes.ParseKey(e.PublicKey); err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
 	}
 
-	peerId = infra.FromKey(key.PublicKey())
+	peerId := infra.FromKey(key)
 
 	log.Info("Updating default net...")
 	// 使用SSA模式
@@ -83,9 +73,10 @@ func (c *Client) Register(ctx context.Context, namespace string, e *dto.PeerDto)
 			AppId:         e.AppID,
 			Platform:      e.Platform,
 			InterfaceName: e.InterfaceName,
-			PrivateKey:    key.String(),
-			PublicKey:     key.PublicKey().String(),
+			PublicKey:     key.String(),
 			PeerId:        fmt.Sprintf("%d", peerId.ToUint64()),
+			// 本字段由 agent 独占（SSA），不带 --advertise-routes 重启即撤回通告
+			AdvertisedRoutes: e.AdvertisedRoutes,
 		},
 
 		Status: v1alpha1.WireflowPeerStatus{
@@ -99,15 +90,86 @@ func (c *Client) Register(ctx context.Context, namespace string, e *dto.PeerDto)
 
 	log.Info("Register node success", "node", node)
 	return &infra.Peer{
-		AppID:      node.Spec.AppId,
-		Address:    node.Status.AllocatedAddress,
-		PrivateKey: node.Spec.PrivateKey,
-		PublicKey:  node.Spec.PublicKey,
-		PeerID:     peerId.ToUint64(),
-		NetworkId:  namespace,
+		AppID:     node.Spec.AppId,
+		Address:   node.Status.AllocatedAddress,
+		PublicKey: node.Spec.PublicKey,
+		PeerID:    peerId.ToUint64(),
+		NetworkId: namespace,
 	}, err
 }
 
+// RotateKey replaces the registered public key of a peer with one the agent
+// has just generated. The replaced key is kept in status so that remote peers
+// continue to accept it for the network's grace period.
+func (c *Client) RotateKey(ctx context.Context, namespace string, e *dto.PeerDto) (*infra.Peer, error) {
+	log := logf.FromContext(ctx)
+	var (
+		node   v1alpha1.WireflowPeer
+		newKey wgtypes.Key
+		err    error
+	)
+
+	if e.PreviousPublicKey == "" || e.PublicKey == "" {
+		return nil, fmt.Errorf("both the previous and the new public key are required")
+	}
+	if newKey, err = wgtypes.ParseKey(e.PublicKey); err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	if err = c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: e.AppID}, &node); err != nil {
+		return nil, err
+	}
+
+	peerId := infra.FromKey(newKey)
+	switch node.Spec.PublicKey {
+	case newKey.String():
+		// The agent retried after losing our reply; the rotation already happened.
+	case e.PreviousPublicKey:
+		grace := v1alpha1.DefaultKeyRotationGracePeriod
+		if node.Spec.Network != nil {
+			var network v1alpha1.WireflowNetwork
+			if err = c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: *node.Spec.Network}, &network); err == nil {
+				grace = network.Spec.KeyRotation.GetGracePeriod()
+			}
+		}
+
+		node.Spec.PublicKey = newKey.String()
+		node.Spec.PeerId = fmt.Sprintf("%d", peerId.ToUint64())
+		if err = c.Update(ctx, &node); err != nil {
+			return nil, err
+		}
+
+		now := v1.Now()
+		expiresAt := v1.NewTime(now.Add(grace))
+		kr := node.Status.KeyRotation
+		if kr == nil {
+			kr = &v1alpha1.KeyRotationStatus{}
+		}
+		kr.Pending = false
+		kr.RequestedAt = nil
+		kr.PreviousPublicKey = e.PreviousPublicKey
+		kr.PreviousKeyExpiresAt = &expiresAt
+		kr.KeyCreatedAt = &now
+		kr.LastRotationTime = &now
+		kr.Rotations++
+		node.Status.KeyRotation = kr
+		if err = c.Status().Update(ctx, &node); err != nil {
+			return nil, err
+		}
+		log.Info("Rotated peer key", "namespace", namespace, "name", node.Name, "gracePeriod", grace)
+	default:
+		return nil, fmt.Errorf("previous public key does not match the registered key")
+	}
+
+	return &infra.Peer{
+		AppID:     node.Spec.AppId,
+		Address:   node.Status.AllocatedAddress,
+		PublicKey: node.Spec.PublicKey,
+		PeerID:    peerId.ToUint64(),
+		NetworkId: namespace,
+	}, nil
+}
+
 // UpdateNodeStatus used to update node status
 func (c *Client) UpdateNodeStatus(ctx context.Context, namespace, name string, updateFunc func(status *v1alpha1.WireflowPeerStatus)) error {
 	logger := logf.FromContext(ctx)
@@ -194,7 +256,6 @@ func (c *Client) GetNetworkMap(ctx context.Context, tokenStr, name string) (*inf
 	return message, nil
 }
 
-
 // CreateNetwork create a network
 func (c *Client) CreateNetwork(ctx context.Context, networkId, cidr string) (*v1alpha1.WireflowNetwork, error) {
 	var (
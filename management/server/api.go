@@ -59,6 +59,7 @@ func (s *Server) apiRouter() error {
 	peerApi.Use(middleware.AuthMiddleware())
 	{
 		peerApi.GET("/list", s.tenantMiddleware.Handle(), s.listPeers)
+		peerApi.GET("/connectivity", s.tenantMiddleware.Handle(), s.peerConnectivity)
 		peerApi.PUT("/update", s.updatePeer)
 	}
 
@@ -189,6 +190,16 @@ func (s *Server) listPeers(c *gin.Context) {
 	resp.OK(c, data)
 }
 
+// peerConnectivity returns the connectivity matrix of the workspace.
+func (s *Server) peerConnectivity(c *gin.Context) {
+	data, err := s.peerController.Connectivity(c.Request.Context())
+	if err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	resp.OK(c, data)
+}
+
 func (s *Server) updatePeer(c *gin.Context) {
 	var req dto.PeerDto
 	err := c.ShouldBindJSON(&req)
@@ -25,7 +25,9 @@ import (
 	"wireflow/internal/log"
 	"wireflow/internal/store"
 	"wireflow/management/controller"
+	"wireflow/management/dto"
 	"wireflow/management/llm"
+	"wireflow/management/models"
 	managementnats "wireflow/management/nats"
 	"wireflow/management/resource"
 	"wireflow/management/server/middleware"
@@ -221,9 +223,12 @@ func (s *Server) Start(ctx context.Context) error {
 	//注册nats service
 	routes := map[string]Handler{
 		// agent ↔ server (peer signaling)
-		"wireflow.signals.peer.register":  s.Register,
-		"wireflow.signals.peer.GetNetMap": s.GetNetMap,
-		"wireflow.signals.peer.heartbeat": s.Heartbeat,
+		"wireflow.signals.peer.register":        s.Register,
+		"wireflow.signals.peer.GetNetMap":       s.GetNetMap,
+		"wireflow.signals.peer.heartbeat":       s.Heartbeat,
+		"wireflow.signals.peer.rotateKey":       s.RotateKey,
+		"wireflow.signals.peer.turnCredentials": s.TURNCredentials,
+		"wireflow.signals.peer.leave":           s.Leave,
 
 		// CLI ↔ server (service/admin plane)
 		"wireflow.signals.service.info":             s.Info,
@@ -275,6 +280,59 @@ func (s *Server) GetNetMap(content []byte) ([]byte, error) {
 	return s.peerController.GetNetmap(ctx, content)
 }
 
+// RotateKey handles a key rotation submitted by an agent. Agents talk to the
+// server over NATS rather than HTTP, so the audit entry is written here instead
+// of by the audit middleware.
+func (s *Server) RotateKey(content []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	data, err := s.peerController.RotateKey(ctx, content)
+
+	var req dto.PeerDto
+	_ = json.Unmarshal(content, &req)
+	entry := models.AuditLog{
+		UserName:     req.AppID,
+		Action:       "ROTATE",
+		Resource:     "peer",
+		ResourceName: req.AppID,
+		Scope:        fmt.Sprintf("WireGuard key: %s → %s", req.PreviousPublicKey, req.PublicKey),
+		Status:       "success",
+		StatusCode:   200,
+	}
+	if err != nil {
+		entry.Status = "failed"
+		entry.StatusCode = 400
+		entry.Detail = err.Error()
+	} else {
+		var peer infra.Peer
+		if json.Unmarshal(data, &peer) == nil && s.store != nil {
+			if ws, wsErr := s.store.Workspaces().GetByNamespace(ctx, peer.NetworkId); wsErr == nil {
+				entry.WorkspaceID = ws.ID
+			}
+		}
+	}
+	if s.auditService != nil {
+		s.auditService.Log(entry)
+	}
+
+	return data, err
+}
+
+// TURNCredentials issues short-lived TURN credentials to an agent.
+func (s *Server) TURNCredentials(content []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.peerController.TURNCredentials(ctx, content)
+}
+
+// Leave marks an agent offline as soon as it announces that it is stopping.
+func (s *Server) Leave(content []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.peerController.Leave(ctx, content)
+}
+
 func (s *Server) Info(content []byte) ([]byte, error) {
 	serverInfo := version.Get()
 	data, err := json.Marshal(serverInfo)
@@ -307,19 +365,13 @@ func (s *Server) CreateToken(content []byte) ([]byte, error) {
 	return json.Marshal(map[string]string{"token": token})
 }
 
-// Heartbeat handles periodic heartbeat requests from agent nodes and updates
-// the in-memory presence store so ListPeers can report real-time online status.
+// Heartbeat handles periodic heartbeat requests from agent nodes: it updates
+// the in-memory presence store so ListPeers can report real-time online
+// status, and records the tunnel states the node reports.
 func (s *Server) Heartbeat(content []byte) ([]byte, error) {
-	var payload struct {
-		AppID string `json:"appId"`
-	}
-	if err := json.Unmarshal(content, &payload); err != nil {
-		return nil, err
-	}
-	if payload.AppID != "" {
-		s.presence.Update(payload.AppID)
-	}
-	return []byte{}, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.peerController.Heartbeat(ctx, content)
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
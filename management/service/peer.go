@@ -18,7 +18,9 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
+	"wireflow/internal/config"
 	"wireflow/internal/infra"
 	"wireflow/internal/log"
 	"wireflow/internal/store"
@@ -26,7 +28,9 @@ import (
 	managementnats "wireflow/management/nats"
 	"wireflow/management/resource"
 	"wireflow/management/vo"
+	"wireflow/turn"
 
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -43,6 +47,10 @@ var (
 
 type PeerService interface {
 	Register(ctx context.Context, dto *dto.PeerDto) (*infra.Peer, error)
+	RotateKey(ctx context.Context, dto *dto.PeerDto) (*infra.Peer, error)
+	TURNCredentials(ctx context.Context, dto *dto.PeerDto) (*infra.TURNCredentials, error)
+	Leave(ctx context.Context, dto *dto.PeerDto) error
+	Heartbeat(ctx context.Context, hb *dto.HeartbeatDto) error
 	UpdateStatus(ctx context.Context, status int) error
 	GetNetmap(ctx context.Context, namespace string, appId string) (*infra.Message, error)
 	CreateToken(ctx context.Context, tokenDto *dto.TokenDto) ([]byte, error)
@@ -51,6 +59,7 @@ type PeerService interface {
 	//Peer tenant
 	ListPeers(ctx context.Context, pageParam *dto.PageRequest) (*dto.PageResult[vo.PeerVo], error)
 	UpdatePeer(ctx context.Context, peerDto *dto.PeerDto) (*vo.PeerVo, error)
+	Connectivity(ctx context.Context) (*vo.ConnectivityMatrix, error)
 }
 
 type peerService struct {
@@ -58,6 +67,7 @@ type peerService struct {
 	client   *resource.Client
 	store    store.Store
 	presence *managementnats.NodePresenceStore
+	leaves   leaveGuard
 }
 
 const displayNameAnnotation = "wireflow.io/display-name"
@@ -296,26 +306,274 @@ func (p *peerService) Register(ctx context.Context, dto *dto.PeerDto) (*infra.Pe
 	return node, nil
 }
 
+// RotateKey swaps the public key of an already registered peer. The caller must
+// present a valid enrollment token and the key that is being replaced.
+func (p *peerService) RotateKey(ctx context.Context, dto *dto.PeerDto) (*infra.Peer, error) {
+	tokenValid, token, err := p.checkToken(ctx, dto.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tokenValid {
+		return nil, fmt.Errorf("token is invalid")
+	}
+
+	return p.client.RotateKey(ctx, token.Namespace, dto)
+}
+
+// TURNCredentials issues short-lived TURN credentials to a registered peer.
+// The peer proves who it is with its enrollment token and current public key;
+// unlike registration this does not count as a use of the token.
+func (p *peerService) TURNCredentials(ctx context.Context, dto *dto.PeerDto) (*infra.TURNCredentials, error) {
+	cfg := config.GlobalConfig.TURN
+	var urls []string
+	for _, u := range strings.Split(cfg.URLs, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 || cfg.Secret == "" {
+		return nil, fmt.Errorf("TURN relay is not configured")
+	}
+
+	if _, err := p.authenticatePeer(ctx, dto.Token, dto.AppID, dto.PublicKey); err != nil {
+		return nil, err
+	}
+
+	username, password, expires := turn.NewCredentials(cfg.Secret, dto.AppID, cfg.TTL, time.Now())
+	return &infra.TURNCredentials{
+		Servers:   []infra.ICEServer{{URLs: urls, Username: username, Credential: password}},
+		ExpiresAt: expires,
+	}, nil
+}
+
+// leaveMaxSkew bounds how old (or how far in the future) a signed leave may
+// be. Within it, leaveGuard stops the same leave from being replayed.
+const leaveMaxSkew = 60 * time.Second
+
+// leaveGuard remembers the newest leave accepted from each peer.
+type leaveGuard struct {
+	mu   sync.Mutex
+	last map[string]int64
+}
+
+// accept reports whether a leave signed at timestamp is newer than any
+// accepted from appId before, and records it if so.
+func (g *leaveGuard) accept(appId string, timestamp int64, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.last == nil {
+		g.last = make(map[string]int64)
+	}
+	for id, ts := range g.last {
+		if now.Sub(time.Unix(ts, 0)) > leaveMaxSkew {
+			delete(g.last, id)
+		}
+	}
+	if timestamp <= g.last[appId] {
+		return false
+	}
+	g.last[appId] = timestamp
+	return true
+}
+
+// verifyLeave checks that a leave was signed by the holder of the private key
+// of dto.PublicKey, recently, and only once. The token and public key alone
+// are known to every agent of the workspace.
+func (p *peerService) verifyLeave(dto *dto.PeerDto, now time.Time) error {
+	publicKey, err := wgtypes.ParseKey(dto.PublicKey)
+	if err != nil {
+		return fmt.Errorf("leave: %w", err)
+	}
+	if skew := now.Sub(time.Unix(dto.Timestamp, 0)); skew > leaveMaxSkew || skew < -leaveMaxSkew {
+		return fmt.Errorf("leave: stale announcement (%s)", skew)
+	}
+	if !infra.VerifyWithKey(publicKey, infra.LeaveStatement(dto.AppID, publicKey, dto.Timestamp), dto.Signature) {
+		return fmt.Errorf("leave: bad signature")
+	}
+	if !p.leaves.accept(dto.AppID, dto.Timestamp, now) {
+		return fmt.Errorf("leave: replayed announcement")
+	}
+	return nil
+}
+
+// Leave records that a peer is shutting down, so it shows as offline right
+// away instead of after the heartbeat timeout. Its tunnels go down with it.
+func (p *peerService) Leave(ctx context.Context, dto *dto.PeerDto) error {
+	if err := p.verifyLeave(dto, time.Now()); err != nil {
+		return err
+	}
+	peer, err := p.authenticatePeer(ctx, dto.Token, dto.AppID, dto.PublicKey)
+	if err != nil {
+		return err
+	}
+	if p.presence != nil {
+		p.presence.MarkOffline(dto.AppID)
+	}
+	summary := peer.Status.ConnectionSummary
+	return p.patchConnectionSummary(ctx, peer, v1alpha1.ConnectionSummary{Total: summary.Total, Disconnected: summary.Total})
+}
+
+// Heartbeat keeps the presence of a peer alive and records the state of its
+// tunnels. Only an authenticated report counts, so that nobody can keep
+// another peer online after it left; the connection summary in the peer
+// status is patched only when it changed.
+func (p *peerService) Heartbeat(ctx context.Context, hb *dto.HeartbeatDto) error {
+	if hb.AppID == "" || p.presence == nil {
+		return nil
+	}
+	peer, err := p.authenticatePeer(ctx, hb.Token, hb.AppID, hb.PublicKey)
+	if err != nil {
+		return err
+	}
+	p.presence.Update(hb.AppID)
+	p.presence.SetConnections(hb.AppID, hb.Connections)
+	return p.patchConnectionSummary(ctx, peer, connectionSummary(hb.Connections, time.Now()))
+}
+
+// connectionSummary counts the reported tunnels that are up at now.
+func connectionSummary(peers []infra.PeerConnection, now time.Time) v1alpha1.ConnectionSummary {
+	summary := v1alpha1.ConnectionSummary{Total: len(peers)}
+	for _, c := range peers {
+		if c.Connected(now) {
+			summary.Connected++
+		}
+	}
+	summary.Disconnected = summary.Total - summary.Connected
+	return summary
+}
+
+func (p *peerService) patchConnectionSummary(ctx context.Context, peer *v1alpha1.WireflowPeer, summary v1alpha1.ConnectionSummary) error {
+	if peer.Status.ConnectionSummary == summary {
+		return nil
+	}
+	original := peer.DeepCopy()
+	peer.Status.ConnectionSummary = summary
+	return p.client.Status().Patch(ctx, peer, client.MergeFrom(original))
+}
+
+// Connectivity returns the tunnel states the online peers of the workspace
+// in ctx last reported, as a sparse matrix of reporting peer to remote peer.
+func (p *peerService) Connectivity(ctx context.Context) (*vo.ConnectivityMatrix, error) {
+	workspaceId, _ := ctx.Value(infra.WorkspaceKey).(string)
+	workspace, err := p.store.Workspaces().GetByID(ctx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	var peerList v1alpha1.WireflowPeerList
+	if err = p.client.GetAPIReader().List(ctx, &peerList, client.InNamespace(workspace.Namespace)); err != nil {
+		return nil, err
+	}
+
+	matrix := &vo.ConnectivityMatrix{
+		Peers: make([]vo.ConnectivityPeer, 0, len(peerList.Items)),
+		Links: make([]vo.ConnectivityLink, 0),
+	}
+	members := make(map[string]struct{}, len(peerList.Items))
+	for _, n := range peerList.Items {
+		members[n.Spec.AppId] = struct{}{}
+	}
+	now := time.Now()
+	for _, n := range peerList.Items {
+		cp := vo.ConnectivityPeer{
+			AppID:       n.Spec.AppId,
+			Name:        n.Name,
+			DisplayName: n.GetAnnotations()[displayNameAnnotation],
+			Address:     n.Status.AllocatedAddress,
+			Summary:     n.Status.ConnectionSummary,
+		}
+		if p.presence != nil {
+			cp.Status, _ = p.presence.GetStatus(n.Spec.AppId)
+		}
+		matrix.Peers = append(matrix.Peers, cp)
+
+		// An offline peer's last report says nothing about its tunnels now.
+		if cp.Status != "online" {
+			continue
+		}
+		conns, _ := p.presence.Connections(n.Spec.AppId)
+		for _, c := range conns {
+			if _, ok := members[c.AppID]; !ok {
+				continue
+			}
+			link := vo.ConnectivityLink{
+				From:      n.Spec.AppId,
+				To:        c.AppID,
+				Connected: c.Connected(now),
+				Transport: c.Transport,
+				ICEState:  c.ICEState,
+				RxBytes:   c.RxBytes,
+				TxBytes:   c.TxBytes,
+			}
+			if !c.LastHandshake.IsZero() {
+				t := c.LastHandshake.Format(time.RFC3339)
+				link.LastHandshake = &t
+			}
+			matrix.Links = append(matrix.Links, link)
+		}
+	}
+	return matrix, nil
+}
+
+// authenticatePeer checks that token is a valid enrollment token and
+// publicKey the current key of the peer appId in its namespace, and returns
+// that peer.
+func (p *peerService) authenticatePeer(ctx context.Context, tokenStr, appId, publicKey string) (*v1alpha1.WireflowPeer, error) {
+	token, err := p.lookupToken(ctx, tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	var peer v1alpha1.WireflowPeer
+	if err = p.client.Get(ctx, types.NamespacedName{Namespace: token.Namespace, Name: appId}, &peer); err != nil {
+		return nil, err
+	}
+	if publicKey == "" || peer.Spec.PublicKey != publicKey {
+		return nil, fmt.Errorf("public key does not match peer %s", appId)
+	}
+	return &peer, nil
+}
+
 func (p *peerService) checkToken(ctx context.Context, tokenStr string) (bool, *v1alpha1.WireflowEnrollmentToken, error) {
+	token, err := p.lookupToken(ctx, tokenStr)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latestToken := &v1alpha1.WireflowEnrollmentToken{}
+		if err = p.client.GetCache().Get(ctx, client.ObjectKeyFromObject(token), latestToken); err != nil {
+			return err
+		}
+		latestToken.Status.UsedCount++
+		return p.client.Status().Update(ctx, latestToken)
+	}); err != nil {
+		return false, nil, err
+	}
+
+	return true, token, nil
+}
+
+// lookupToken finds the enrollment token tokenStr.
+func (p *peerService) lookupToken(ctx context.Context, tokenStr string) (*v1alpha1.WireflowEnrollmentToken, error) {
 	if tokenStr == "" {
-		return false, nil, fmt.Errorf("token is empty")
+		return nil, fmt.Errorf("token is empty")
 	}
 
 	var list v1alpha1.WireflowEnrollmentTokenList
 	err := p.client.List(ctx, &list, client.MatchingFields{"status.token": tokenStr})
 	if err != nil {
-		return false, nil, fmt.Errorf("get token failed: %v", err)
+		return nil, fmt.Errorf("get token failed: %v", err)
 	}
 	if len(list.Items) == 0 {
 		// 兼容旧数据：回退到 spec.token
 		err = p.client.List(ctx, &list, client.MatchingFields{"spec.token": tokenStr})
 		if err != nil {
-			return false, nil, fmt.Errorf("get token failed: %v", err)
+			return nil, fmt.Errorf("get token failed: %v", err)
 		}
 	}
 
 	if len(list.Items) == 0 {
-		return false, nil, fmt.Errorf("token not exists")
+		return nil, fmt.Errorf("token not exists")
 	}
 
 	var token *v1alpha1.WireflowEnrollmentToken
@@ -326,21 +584,9 @@ func (p *peerService) checkToken(ctx context.Context, tokenStr string) (bool, *v
 	}
 
 	if token == nil {
-		return false, nil, fmt.Errorf("token not exists")
+		return nil, fmt.Errorf("token not exists")
 	}
-
-	if err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		latestToken := &v1alpha1.WireflowEnrollmentToken{}
-		if err = p.client.GetCache().Get(ctx, client.ObjectKeyFromObject(token), latestToken); err != nil {
-			return err
-		}
-		latestToken.Status.UsedCount++
-		return p.client.Status().Update(ctx, latestToken)
-	}); err != nil {
-		return false, nil, err
-	}
-
-	return true, token, nil
+	return token, nil
 }
 
 func (p *peerService) bootstrap(ctx context.Context, nsName string) error {
@@ -1,9 +1,25 @@
 package service
 
 import (
+	"context"
 	"testing"
+	"time"
+	"wireflow/api/v1alpha1"
 	"wireflow/internal/config"
+	"wireflow/internal/infra"
+	"wireflow/internal/store"
+	"wireflow/management/dto"
+	"wireflow/management/models"
+	managementnats "wireflow/management/nats"
+	"wireflow/management/resource"
 	"wireflow/pkg/utils"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 func TestToken(t *testing.T) {
@@ -36,3 +52,170 @@ func TestToken(t *testing.T) {
 
 	})
 }
+
+func TestConnectionSummary(t *testing.T) {
+	now := time.Now()
+	summary := connectionSummary([]infra.PeerConnection{
+		{AppID: "office", Transport: "ICE", LastHandshake: now.Add(-30 * time.Second)},
+		{AppID: "lab", Transport: "WRRP", LastHandshake: now.Add(-infra.HandshakeTimeout)},
+		{AppID: "laptop", ICEState: "Checking"},
+	}, now)
+	want := v1alpha1.ConnectionSummary{Total: 3, Connected: 1, Disconnected: 2}
+	if summary != want {
+		t.Fatalf("connectionSummary = %+v, want %+v", summary, want)
+	}
+	if summary = connectionSummary(nil, now); summary != (v1alpha1.ConnectionSummary{}) {
+		t.Fatalf("connectionSummary(nil) = %+v, want zero", summary)
+	}
+}
+
+// readerManager serves GetAPIReader from a client; the rest of
+// manager.Manager is not used by the tests.
+type readerManager struct {
+	manager.Manager
+	reader client.Reader
+}
+
+func (m readerManager) GetAPIReader() client.Reader { return m.reader }
+
+// workspaceStore resolves every workspace to one namespace.
+type workspaceStore struct {
+	store.Store
+	store.WorkspaceRepository
+	namespace string
+}
+
+func (s *workspaceStore) Workspaces() store.WorkspaceRepository { return s }
+
+func (s *workspaceStore) GetByID(context.Context, string) (*models.Workspace, error) {
+	return &models.Workspace{Namespace: s.namespace}, nil
+}
+
+func TestConnectivity(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	peer := func(namespace, appId string) *v1alpha1.WireflowPeer {
+		return &v1alpha1.WireflowPeer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: appId},
+			Spec:       v1alpha1.WireflowPeerSpec{AppId: appId},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		peer("ws", "office"), peer("ws", "lab"), peer("ws", "laptop"), peer("ws", "new"),
+		peer("other", "stranger"),
+	).Build()
+
+	now := time.Now()
+	presence := managementnats.NewNodePresenceStore()
+	presence.Update("office")
+	presence.SetConnections("office", []infra.PeerConnection{
+		{AppID: "lab", Transport: "ICE", LastHandshake: now.Add(-10 * time.Second), RxBytes: 10, TxBytes: 20},
+		{AppID: "laptop", ICEState: "Checking"},
+		// A peer of another workspace, or one deleted since, has no row.
+		{AppID: "stranger", Transport: "ICE", LastHandshake: now},
+	})
+	presence.Update("lab")
+	presence.SetConnections("lab", []infra.PeerConnection{{AppID: "office", Transport: "ICE", LastHandshake: now}})
+	// An offline peer's last report is stale.
+	presence.Update("laptop")
+	presence.SetConnections("laptop", []infra.PeerConnection{{AppID: "office", Transport: "WRRP", LastHandshake: now}})
+	presence.MarkOffline("laptop")
+
+	p := &peerService{
+		client:   &resource.Client{Client: c, Manager: readerManager{reader: c}},
+		store:    &workspaceStore{namespace: "ws"},
+		presence: presence,
+	}
+	matrix, err := p.Connectivity(context.WithValue(context.Background(), infra.WorkspaceKey, "ws-id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := make(map[string]string, len(matrix.Peers))
+	for _, peer := range matrix.Peers {
+		status[peer.AppID] = peer.Status
+	}
+	wantStatus := map[string]string{"office": "online", "lab": "online", "laptop": "offline", "new": "pending"}
+	if len(status) != len(wantStatus) {
+		t.Fatalf("peers %v, want %v", status, wantStatus)
+	}
+	for appId, want := range wantStatus {
+		if status[appId] != want {
+			t.Errorf("status of %s = %q, want %q", appId, status[appId], want)
+		}
+	}
+
+	type link struct {
+		from, to  string
+		connected bool
+	}
+	var links []link
+	for _, l := range matrix.Links {
+		links = append(links, link{l.From, l.To, l.Connected})
+		if l.From == "office" && l.To == "lab" && (l.LastHandshake == nil || l.RxBytes != 10 || l.TxBytes != 20) {
+			t.Errorf("office to lab lost its counters: %+v", l)
+		}
+	}
+	want := map[link]bool{{"office", "lab", true}: true, {"office", "laptop", false}: true, {"lab", "office", true}: true}
+	if len(links) != len(want) {
+		t.Fatalf("links %v, want %v", links, want)
+	}
+	for _, l := range links {
+		if !want[l] {
+			t.Errorf("unexpected link %+v", l)
+		}
+	}
+}
+
+func TestVerifyLeave(t *testing.T) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	leave := func(signer wgtypes.Key, at time.Time) *dto.PeerDto {
+		sig, err := infra.SignWithKey(signer, infra.LeaveStatement("laptop", key.PublicKey(), at.Unix()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &dto.PeerDto{AppID: "laptop", PublicKey: key.PublicKey().String(), Timestamp: at.Unix(), Signature: sig}
+	}
+
+	p := &peerService{}
+	if err = p.verifyLeave(leave(other, now), now); err == nil {
+		t.Fatal("a leave signed by another key must be rejected")
+	}
+	if err = p.verifyLeave(leave(key, now.Add(-2*leaveMaxSkew)), now); err == nil {
+		t.Fatal("a stale leave must be rejected")
+	}
+	signed := leave(key, now)
+	if err = p.verifyLeave(signed, now); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.verifyLeave(signed, now); err == nil {
+		t.Fatal("a replayed leave must be rejected")
+	}
+	if err = p.verifyLeave(leave(key, now.Add(time.Second)), now.Add(time.Second)); err != nil {
+		t.Fatalf("a later leave must be accepted: %v", err)
+	}
+}
+
+func TestHeartbeatRequiresAuthentication(t *testing.T) {
+	presence := managementnats.NewNodePresenceStore()
+	presence.Update("laptop")
+	presence.MarkOffline("laptop")
+
+	p := &peerService{presence: presence}
+	if err := p.Heartbeat(context.Background(), &dto.HeartbeatDto{AppID: "laptop"}); err == nil {
+		t.Fatal("expected an unauthenticated heartbeat to be rejected")
+	}
+	if status, _ := presence.GetStatus("laptop"); status == "online" {
+		t.Fatal("an unauthenticated heartbeat brought a peer that left back online")
+	}
+}
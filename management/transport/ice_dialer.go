@@ -19,6 +19,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -60,6 +62,18 @@ type iceDialer struct {
 	showLog             bool
 	getLocalPeer        func() *infra.Peer
 	onPeerReceived      func(peer infra.Peer)
+	iceServers          *ICEServers
+
+	// A session whose selected pair uses a TURN relay outlives Dial: the
+	// agent keeps the allocation and, when it is ours, iceConn carries the
+	// WireGuard traffic through relays. established is true while such a
+	// session is up; renomination to a direct pair reports it via onUpgrade,
+	// and failure asks the probe to restart via onRestart.
+	relays      *infra.RelayConns
+	iceConn     *ice.Conn
+	established atomic.Bool
+	onUpgrade   func(t infra.Transport)
+	onRestart   func()
 
 	// offerReady is closed when the first remote candidate OFFER is received,
 	// signalling Dial() that it can call StartDial/StartAccept + AwaitConnect.
@@ -87,7 +101,15 @@ type ICEDialerConfig struct {
 	// updates (Address, AllowedIPs) are always reflected in SYN/ACK peer info.
 	GetLocalPeer   func() *infra.Peer
 	OnPeerReceived func(peer infra.Peer)
-	ShowLog        bool
+	// ICEServers are the STUN and TURN servers the agent gathers with.
+	ICEServers *ICEServers
+	// Relays carries WireGuard traffic through TURN allocations of this node.
+	Relays *infra.RelayConns
+	// OnUpgrade is called when a relayed session moves to a direct pair.
+	OnUpgrade func(t infra.Transport)
+	// OnRestart is called when a relayed session fails after Dial returned.
+	OnRestart func()
+	ShowLog   bool
 }
 
 func (i *iceDialer) Handle(ctx context.Context, remoteId infra.PeerIdentity, packet *grpc.SignalPacket) error {
@@ -143,7 +165,7 @@ func (i *iceDialer) Handle(ctx context.Context, remoteId infra.PeerIdentity, pac
 		// will be handled by the fresh dialer.
 		if existingAgent != nil {
 			i.log.Debug("SYN on active agent — remote restarted, forcing close", "remoteId", remoteId)
-			i.Close() //nolint:errcheck
+			i.closeSession()
 			return nil
 		}
 
@@ -215,6 +237,10 @@ func NewIceDialer(cfg *ICEDialerConfig) infra.Dialer {
 		showLog:                cfg.ShowLog,
 		getLocalPeer:           cfg.GetLocalPeer,
 		onPeerReceived:         cfg.OnPeerReceived,
+		iceServers:             cfg.ICEServers,
+		relays:                 cfg.Relays,
+		onUpgrade:              cfg.OnUpgrade,
+		onRestart:              cfg.OnRestart,
 		offerReady:             make(chan struct{}),
 		closeChan:              make(chan struct{}),
 		cancel:                 func() {}, // no-op until Prepare sets a real one
@@ -305,7 +331,14 @@ func (i *iceDialer) Dial(ctx context.Context) (infra.Transport, error) {
 		if err = i.agent.AwaitConnect(dialCtx); err != nil {
 			return nil, err
 		}
-		remoteAddr := iceConn.RemoteAddr().String()
+		transport := &ICETransport{remoteAddr: iceConn.RemoteAddr().String(), transportType: infra.ICE}
+		if pair, err := i.agent.GetSelectedCandidatePair(); err == nil && pair != nil {
+			transport = newICETransport(pair.Local, pair.Remote)
+			transport.rtt = time.Duration(pair.CurrentRoundTripTime() * float64(time.Second))
+		}
+		if transport.Relayed() {
+			return i.keepRelayed(iceConn, transport)
+		}
 		// Close the ICE conn and dialer after a brief delay to let final STUN
 		// checks complete.  Calling i.Close() sets closed=true and clears i.agent,
 		// so any late SYN retries from the remote's ticker are dropped rather than
@@ -315,10 +348,75 @@ func (i *iceDialer) Dial(ctx context.Context) (infra.Transport, error) {
 			iceConn.Close() //nolint:errcheck
 			i.Close()       //nolint:errcheck
 		}()
-		return &ICETransport{remoteAddr: remoteAddr}, nil
+		return transport, nil
 	}
 }
 
+// keepRelayed keeps the agent of a relayed session open: the TURN
+// allocation, and the permissions the remote relay grants us, live only as
+// long as the agents on both ends. WireGuard traffic goes through iceConn
+// when the relay is ours and straight to the remote relay otherwise.
+func (i *iceDialer) keepRelayed(iceConn *ice.Conn, transport *ICETransport) (infra.Transport, error) {
+	i.mu.Lock()
+	if i.closed.Load() {
+		i.mu.Unlock()
+		iceConn.Close() //nolint:errcheck
+		return nil, ErrDialerClosed
+	}
+	i.iceConn = iceConn
+	i.mu.Unlock()
+
+	if transport.Type() == infra.TURN {
+		if i.relays == nil {
+			return nil, fmt.Errorf("iceDialer: no relay routing for TURN candidate pair %s", transport.candidatePair)
+		}
+		i.relays.Add(i.remoteId.ID().ToUint64(), iceConn)
+	}
+	i.established.Store(true)
+	i.log.Info("connected through TURN relay", "remoteId", i.remoteId, "pair", transport.candidatePair)
+	return transport, nil
+}
+
+// upgrade hands a relayed session over to the direct pair renomination
+// found. Like any direct path it no longer needs the agent afterwards.
+func (i *iceDialer) upgrade(local, remote ice.Candidate) {
+	if !i.established.CompareAndSwap(true, false) {
+		return
+	}
+	transport := newICETransport(local, remote)
+	i.log.Info("relayed connection upgraded to a direct path", "remoteId", i.remoteId, "pair", transport.candidatePair)
+	go func() {
+		if i.onUpgrade != nil {
+			i.onUpgrade(transport)
+		}
+		time.Sleep(500 * time.Millisecond)
+		i.Close() //nolint:errcheck
+	}()
+}
+
+// newICETransport describes the path of a selected candidate pair.
+func newICETransport(local, remote ice.Candidate) *ICETransport {
+	t := &ICETransport{
+		remoteAddr:    net.JoinHostPort(remote.Address(), strconv.Itoa(remote.Port())),
+		candidatePair: describeCandidatePair(local, remote),
+		transportType: infra.ICE,
+		relayed:       local.Type() == ice.CandidateTypeRelay || remote.Type() == ice.CandidateTypeRelay,
+	}
+	if local.Type() == ice.CandidateTypeRelay {
+		t.transportType = infra.TURN
+	}
+	return t
+}
+
+// describeCandidatePair renders a candidate pair as
+// "host 192.168.1.5:51820 <-> srflx 203.0.113.7:40112".
+func describeCandidatePair(local, remote ice.Candidate) string {
+	describe := func(c ice.Candidate) string {
+		return fmt.Sprintf("%s %s", c.Type(), net.JoinHostPort(c.Address(), strconv.Itoa(c.Port())))
+	}
+	return describe(local) + " <-> " + describe(remote)
+}
+
 func (i *iceDialer) Type() infra.DialerType {
 	return infra.ICE_DIALER
 }
@@ -343,6 +441,14 @@ func (i *iceDialer) networkTypes() []ice.NetworkType {
 	return types
 }
 
+// stunURLs returns the servers a new agent gathers with.
+func (i *iceDialer) stunURLs() []*stun.URI {
+	if i.iceServers == nil {
+		return nil
+	}
+	return i.iceServers.URLs()
+}
+
 func (i *iceDialer) getAgent(remoteId infra.PeerIdentity) (*ice.Agent, error) {
 	f := logging.NewDefaultLoggerFactory()
 	if i.showLog {
@@ -378,11 +484,14 @@ func (i *iceDialer) getAgent(remoteId infra.PeerIdentity) (*ice.Agent, error) {
 		ice.WithUDPMux(i.udpMux()),
 		ice.WithUDPMuxSrflx(i.filteringMux.UDPMuxSrflx()),
 		ice.WithNetworkTypes(i.networkTypes()),
-		ice.WithUrls([]*stun.URI{
-			{Scheme: stun.SchemeTypeSTUN, Host: "stun.wireflow.run", Port: 3478},
-		}),
+		ice.WithUrls(i.stunURLs()),
 		ice.WithLoggerFactory(f),
-		ice.WithCandidateTypes([]ice.CandidateType{ice.CandidateTypeHost, ice.CandidateTypeServerReflexive}),
+		// Relay candidates only appear when the servers include TURN. Pion
+		// accepts them after the others had their chance, and renomination
+		// moves a relayed session to a direct pair once one checks out.
+		ice.WithCandidateTypes([]ice.CandidateType{ice.CandidateTypeHost, ice.CandidateTypeServerReflexive, ice.CandidateTypeRelay}),
+		ice.WithRenomination(ice.DefaultNominationValueGenerator()),
+		ice.WithAutomaticRenomination(0),
 		ice.WithDisconnectedTimeout(disconnectedTimeout),
 		ice.WithFailedTimeout(failedTimeout),
 	)
@@ -399,8 +508,17 @@ func (i *iceDialer) getAgent(remoteId infra.PeerIdentity) (*ice.Agent, error) {
 		// that built-in recovery and triggers a full SYN restart cycle which
 		// cascades to the remote side as well, causing the connect/disconnect loop.
 		if s == ice.ConnectionStateFailed {
-			i.Close() //nolint:errcheck
+			i.closeSession()
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	if err = iceAgent.OnSelectedCandidatePairChange(func(local, remote ice.Candidate) {
+		if !i.established.Load() || local.Type() == ice.CandidateTypeRelay || remote.Type() == ice.CandidateTypeRelay {
+			return
 		}
+		i.upgrade(local, remote)
 	}); err != nil {
 		return nil, err
 	}
@@ -475,6 +593,16 @@ func (i *iceDialer) sendPacket(ctx context.Context, remoteId infra.PeerIdentity,
 	return i.sender(ctx, remoteId.ID(), data)
 }
 
+// closeSession closes the dialer. A relayed session that outlived Dial has
+// nothing waiting on closeChan any more, so it asks the probe to restart.
+func (i *iceDialer) closeSession() {
+	established := i.established.Swap(false)
+	i.Close() //nolint:errcheck
+	if established && i.onRestart != nil {
+		go i.onRestart()
+	}
+}
+
 func (i *iceDialer) Close() error {
 	i.log.Debug("closing ice", "remoteId", i.remoteId)
 	i.closeOnce.Do(func() {
@@ -482,8 +610,17 @@ func (i *iceDialer) Close() error {
 		i.mu.Lock()
 		agent := i.agent
 		i.agent = nil
+		iceConn := i.iceConn
+		i.iceConn = nil
 		i.mu.Unlock()
 
+		if iceConn != nil {
+			if i.relays != nil {
+				i.relays.Remove(i.remoteId.ID().ToUint64(), iceConn)
+			}
+			iceConn.Close() //nolint:errcheck
+		}
+
 		// Unblock Dial(): it will return ErrDialerClosed, discover() will fail,
 		// and onFailure will call probe.restart() — the single restart path.
 		close(i.closeChan)
@@ -503,9 +640,35 @@ var (
 
 type ICETransport struct {
 	remoteAddr string
+	// candidatePair and rtt are the pair ICE selected and its round-trip
+	// time when the connection was established.
+	candidatePair string
+	rtt           time.Duration
+	// transportType is TURN when the local candidate is a relay of ours;
+	// relayed is set when either candidate is a relay.
+	transportType infra.TransportType
+	relayed       bool
+}
+
+// Relayed reports whether the path runs through a TURN relay on either end.
+func (i *ICETransport) Relayed() bool {
+	return i.relayed
+}
+
+// CandidatePair describes the candidate pair ICE selected.
+func (i *ICETransport) CandidatePair() string {
+	return i.candidatePair
+}
+
+// RTT returns the round-trip time ICE measured on the selected pair.
+func (i *ICETransport) RTT() time.Duration {
+	return i.rtt
 }
 
 func (i *ICETransport) Priority() uint8 {
+	if i.relayed {
+		return infra.PriorityTURN
+	}
 	return infra.PriorityDirect
 }
 
@@ -526,5 +689,5 @@ func (i *ICETransport) RemoteAddr() string {
 }
 
 func (i *ICETransport) Type() infra.TransportType {
-	return infra.ICE
+	return i.transportType
 }
@@ -0,0 +1,139 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"wireflow/internal/infra"
+
+	"github.com/pion/stun/v3"
+)
+
+// ICEServers is the list of STUN and TURN servers ICE agents are created
+// with. The network map can replace the configured defaults at any time;
+// agents created afterwards, including those of probes that restart, use the
+// new list while established connections are left alone. TURN relays of the
+// control plane, whose credentials expire, are kept apart and added on top.
+type ICEServers struct {
+	mu       sync.RWMutex
+	defaults []*stun.URI
+	network  []*stun.URI
+	relays   []*stun.URI
+	urls     []*stun.URI
+	// source is what network was parsed from, to detect changes.
+	source []infra.ICEServer
+}
+
+// NewICEServers returns the server list configured on the agent: a comma
+// separated list of URLs, where a bare "host:port" is a STUN server. An
+// empty list disables server-reflexive candidates, as air-gapped sites need.
+func NewICEServers(defaults string) (*ICEServers, error) {
+	var servers []infra.ICEServer
+	for _, url := range strings.Split(defaults, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			servers = append(servers, infra.ICEServer{URLs: []string{url}})
+		}
+	}
+	urls, err := parseICEServers(servers)
+	if err != nil {
+		return nil, err
+	}
+	return &ICEServers{defaults: urls, network: urls, urls: urls}, nil
+}
+
+// Set replaces the servers with those of the network map; an empty list
+// restores the defaults. Invalid URLs are skipped and reported in the error.
+// It reports whether the list changed.
+func (s *ICEServers) Set(servers []infra.ICEServer) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.EqualFunc(servers, s.source, func(a, b infra.ICEServer) bool {
+		return slices.Equal(a.URLs, b.URLs) && a.Username == b.Username && a.Credential == b.Credential
+	}) {
+		return false, nil
+	}
+
+	s.source = servers
+	var err error
+	if len(servers) == 0 {
+		s.network = s.defaults
+	} else {
+		s.network, err = parseICEServers(servers)
+	}
+	s.urls = slices.Concat(s.network, s.relays)
+	return true, err
+}
+
+// SetRelays replaces the TURN relays of the control plane, typically with
+// fresh credentials. Invalid URLs are skipped and reported in the error.
+func (s *ICEServers) SetRelays(servers []infra.ICEServer) error {
+	relays, err := parseICEServers(servers)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.relays = relays
+	s.urls = slices.Concat(s.network, s.relays)
+	return err
+}
+
+// URLs returns the servers new ICE agents use.
+func (s *ICEServers) URLs() []*stun.URI {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.urls
+}
+
+func (s *ICEServers) String() string {
+	urls := s.URLs()
+	names := make([]string, 0, len(urls))
+	for _, u := range urls {
+		names = append(names, u.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func parseICEServers(servers []infra.ICEServer) ([]*stun.URI, error) {
+	var (
+		urls []*stun.URI
+		errs []string
+	)
+	for _, server := range servers {
+		for _, raw := range server.URLs {
+			if scheme, _, _ := strings.Cut(raw, ":"); !slices.Contains([]string{"stun", "stuns", "turn", "turns"}, scheme) {
+				raw = "stun:" + raw
+			}
+			u, err := stun.ParseURI(raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", raw, err))
+				continue
+			}
+			if u.Scheme == stun.SchemeTypeTURN || u.Scheme == stun.SchemeTypeTURNS {
+				// A network map restored from the cache carries no TURN
+				// credentials; the server is of no use until they arrive.
+				if server.Username == "" {
+					continue
+				}
+				u.Username, u.Password = server.Username, server.Credential
+			}
+			urls = append(urls, u)
+		}
+	}
+	if len(errs) > 0 {
+		return urls, fmt.Errorf("invalid ICE servers: %s", strings.Join(errs, "; "))
+	}
+	return urls, nil
+}
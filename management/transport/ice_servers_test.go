@@ -0,0 +1,81 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"testing"
+	"wireflow/internal/infra"
+)
+
+func TestICEServers(t *testing.T) {
+	servers, err := NewICEServers("stun.wireflow.run:3478, stun:stun.example.com:3478")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := servers.String(); got != "stun:stun.wireflow.run:3478,stun:stun.example.com:3478" {
+		t.Fatalf("unexpected defaults %q", got)
+	}
+
+	network := []infra.ICEServer{
+		{URLs: []string{"stun:10.0.0.1:3478"}},
+		{URLs: []string{"turn:10.0.0.2:3478?transport=udp"}, Username: "wf", Credential: "secret"},
+	}
+	changed, err := servers.Set(network)
+	if err != nil || !changed {
+		t.Fatalf("Set: changed=%v err=%v", changed, err)
+	}
+	urls := servers.URLs()
+	if len(urls) != 2 || urls[0].Host != "10.0.0.1" || urls[1].Username != "wf" || urls[1].Password != "secret" {
+		t.Fatalf("unexpected servers %v", urls)
+	}
+	if changed, _ = servers.Set(network); changed {
+		t.Fatal("the same list must not count as a change")
+	}
+
+	// A bad URL is reported without dropping the valid ones.
+	changed, err = servers.Set([]infra.ICEServer{{URLs: []string{"stun:10.0.0.1:3478", "turn:"}}})
+	if err == nil || !changed || len(servers.URLs()) != 1 {
+		t.Fatalf("expected the valid server and an error, got %v: %v", servers.URLs(), err)
+	}
+
+	// TURN servers without credentials, as restored from the cache, are skipped.
+	changed, err = servers.Set([]infra.ICEServer{{URLs: []string{"stun:10.0.0.1:3478", "turn:10.0.0.2:3478"}}})
+	if err != nil || !changed || len(servers.URLs()) != 1 {
+		t.Fatalf("expected only the STUN server, got %v: %v", servers.URLs(), err)
+	}
+
+	if changed, _ = servers.Set(nil); !changed || len(servers.URLs()) != 2 {
+		t.Fatalf("an empty list must restore the defaults, got %v", servers.URLs())
+	}
+
+	// Relays of the control plane come on top of whichever list is in use.
+	if err = servers.SetRelays([]infra.ICEServer{{URLs: []string{"turn:10.0.0.3:3478"}, Username: "1700000000:a", Credential: "pw"}}); err != nil {
+		t.Fatal(err)
+	}
+	if urls = servers.URLs(); len(urls) != 3 || urls[2].Host != "10.0.0.3" || urls[2].Username != "1700000000:a" {
+		t.Fatalf("relay not added: %v", urls)
+	}
+	if _, err = servers.Set(network); err != nil || len(servers.URLs()) != 3 {
+		t.Fatalf("relay lost on network change: %v: %v", servers.URLs(), err)
+	}
+	if err = servers.SetRelays(nil); err != nil || len(servers.URLs()) != 2 {
+		t.Fatalf("relay not removed: %v: %v", servers.URLs(), err)
+	}
+
+	empty, err := NewICEServers("")
+	if err != nil || len(empty.URLs()) != 0 {
+		t.Fatalf("expected no servers, got %v: %v", empty.URLs(), err)
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"wireflow/internal/grpc"
+	"wireflow/internal/infra"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"google.golang.org/protobuf/proto"
+)
+
+// A network with lazy connections configures a WireGuard entry for every
+// peer but connects to a peer only when WireGuard first sends to it, or when
+// the peer signals; a connection that stays idle is torn down again. This
+// keeps large meshes, where most peers never talk to each other, from
+// running an ICE session per pair.
+const (
+	// idleCheckInterval is how often WatchIdle reads the WireGuard counters.
+	idleCheckInterval = 10 * time.Second
+	// deadPathTimeout is how long a lazy connection may send without
+	// receiving anything before its path is considered lost. WireGuard
+	// answers received data within 10s, with a keepalive if nothing else.
+	deadPathTimeout = 30 * time.Second
+)
+
+// SetLazy switches between connecting to every peer right away and
+// connecting on demand. A lazy connection that carries no traffic for
+// idleTimeout is torn down; zero keeps it. It reports whether the mode
+// changed. Switching to lazy keeps the existing connections, which WatchIdle
+// tears down once idle; switching back connects every parked peer.
+func (f *ProbeFactory) SetLazy(lazy bool, idleTimeout time.Duration) bool {
+	f.idleTimeout.Store(int64(idleTimeout))
+	if f.lazy.Swap(lazy) == lazy {
+		return false
+	}
+	if !lazy {
+		for _, identity := range f.parked() {
+			go f.connect(identity)
+		}
+	}
+	return true
+}
+
+// parked returns the known remote peers that have no probe.
+func (f *ProbeFactory) parked() []infra.PeerIdentity {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var identities []infra.PeerIdentity
+	for _, peer := range f.peerManager.GetAll() {
+		if peer.AppID == f.localId.AppID || f.probes[peer.AppID] != nil {
+			continue
+		}
+		key, err := wgtypes.ParseKey(peer.PublicKey)
+		if err != nil {
+			continue
+		}
+		identities = append(identities, infra.NewPeerIdentity(peer.AppID, key))
+	}
+	return identities
+}
+
+// Lazy reports whether peers are connected on demand.
+func (f *ProbeFactory) Lazy() bool {
+	return f.lazy.Load()
+}
+
+// Park configures the WireGuard entry of peer without connecting to it. The
+// entry's endpoint is LazyFakeAddrPort, so the first packet WireGuard sends
+// to the peer starts a probe. A peer with a probe keeps it.
+func (f *ProbeFactory) Park(peer *infra.Peer) error {
+	f.mu.RLock()
+	_, ok := f.probes[peer.AppID]
+	f.mu.RUnlock()
+	if ok {
+		return nil
+	}
+	return f.configureParked(peer)
+}
+
+// park closes the probe of the peer with appId and parks the peer.
+func (f *ProbeFactory) park(appId string) {
+	f.Remove(appId)
+	peer := f.peerManager.GetPeer(appId)
+	if peer == nil {
+		return
+	}
+	if err := f.configureParked(peer); err != nil {
+		f.log.Warn("failed to park peer", "remoteId", appId, "err", err)
+	}
+}
+
+func (f *ProbeFactory) configureParked(peer *infra.Peer) error {
+	provisioner := f.getProvisioner()
+	if provisioner == nil || peer.Address == nil {
+		return nil
+	}
+	key, err := wgtypes.ParseKey(peer.PublicKey)
+	if err != nil {
+		return fmt.Errorf("peer %s: %w", peer.AppID, err)
+	}
+	allowedIPs := peer.AllowedIPs
+	if allowedIPs == "" {
+		allowedIPs = fmt.Sprintf("%s/32", *peer.Address)
+	}
+	if err = provisioner.AddPeer(&infra.SetPeer{
+		PublicKey:    peer.PublicKey,
+		PresharedKey: presharedKey(peer.PresharedKey),
+		AllowedIPs:   allowedIPs,
+		Endpoint:     infra.LazyFakeAddrPort(infra.FromKey(key).ToUint64()).String(),
+	}); err != nil {
+		return err
+	}
+	if err = provisioner.ApplyRoute("add", *peer.Address, provisioner.GetIfaceName()); err != nil {
+		return err
+	}
+	for _, route := range peer.Routes {
+		if err = provisioner.ApplyRoute("add", route, provisioner.GetIfaceName()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectOnDemand is called by the bind when WireGuard sends to a parked
+// peer. It connects whatever the current mode: a peer parked before the
+// network stopped being lazy still has to be reached.
+func (f *ProbeFactory) connectOnDemand(remoteId uint64) {
+	identity, ok := f.peerManager.GetIdentity(infra.FromUint64(remoteId))
+	if !ok {
+		return
+	}
+	f.mu.RLock()
+	_, ok = f.probes[identity.AppID]
+	f.mu.RUnlock()
+	if ok {
+		return
+	}
+	go f.connect(identity)
+}
+
+// connect starts a probe to a parked peer. Only the initiator of a pair
+// sends SYN, so a responder asks the peer to connect with a SYN of its own.
+func (f *ProbeFactory) connect(remoteId infra.PeerIdentity) {
+	probe, created, err := f.getOrCreate(remoteId)
+	if err != nil || !created {
+		return
+	}
+	f.log.Info("connecting to parked peer", "remoteId", remoteId.AppID)
+	_ = probe.Start(context.Background(), remoteId)
+	if isInitiator(probe.localId, remoteId) {
+		return
+	}
+	packet := &grpc.SignalPacket{
+		Type:     grpc.PacketType_HANDSHAKE_SYN,
+		Dialer:   grpc.DialerType_ICE,
+		SenderId: probe.localId.ID().ToUint64(),
+	}
+	data, err := proto.Marshal(packet)
+	if err != nil {
+		return
+	}
+	if err = f.signal.Send(context.Background(), remoteId.ID(), data); err != nil {
+		f.log.Warn("failed to ask peer to connect", "remoteId", remoteId.AppID, "err", err)
+	}
+}
+
+// handleLazy runs before a signal packet reaches the probe of a lazy peer
+// and reports whether it consumed the packet. A probe created for the packet
+// is started. A SYN from a peer that is not the initiator is the request
+// sent by connect: the probe is (re)started, which sends the real SYN.
+func (f *ProbeFactory) handleLazy(probe *Probe, created bool, remoteId infra.PeerIdentity, packet *grpc.SignalPacket) bool {
+	wake := packet.Type == grpc.PacketType_HANDSHAKE_SYN && packet.Dialer == grpc.DialerType_ICE &&
+		isInitiator(probe.localId, remoteId)
+	switch {
+	case created:
+		_ = probe.Start(context.Background(), remoteId)
+	case wake && !probe.running.Load():
+		// Connected, or waiting to retry: the peer has lost the
+		// connection, set it up again.
+		probe.restart()
+	}
+	return wake
+}
+
+// WatchIdle tears down the lazy connections that carried no traffic for the
+// idle timeout, and restarts those whose path stopped answering. It runs
+// until ctx is done.
+func (f *ProbeFactory) WatchIdle(ctx context.Context) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	tracker := newIdleTracker()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !f.lazy.Load() {
+			tracker.reset()
+			continue
+		}
+		f.checkIdle(tracker, time.Now())
+	}
+}
+
+func (f *ProbeFactory) checkIdle(tracker *idleTracker, now time.Time) {
+	provisioner := f.getProvisioner()
+	if provisioner == nil {
+		return
+	}
+	stats, err := provisioner.DeviceStats()
+	if err != nil {
+		f.log.Warn("idle check: cannot read device stats", "err", err)
+		return
+	}
+
+	f.mu.RLock()
+	probes := make(map[string]*Probe, len(f.probes))
+	for appId, probe := range f.probes {
+		probes[appId] = probe
+	}
+	f.mu.RUnlock()
+
+	counters := make(map[string]*infra.PeerStats, len(probes))
+	for appId, probe := range probes {
+		if probe.State().State != "connected" {
+			continue
+		}
+		if s := stats.Peers[probe.remoteId.PublicKey.String()]; s != nil {
+			counters[appId] = s
+		}
+	}
+
+	idle, dead := tracker.observe(now, counters, time.Duration(f.idleTimeout.Load()))
+	for _, appId := range idle {
+		f.log.Info("connection idle, closing it", "remoteId", appId)
+		f.park(appId)
+	}
+	for _, appId := range dead {
+		f.log.Info("connection stopped answering, reconnecting", "remoteId", appId)
+		probes[appId].restart()
+	}
+}
+
+// idleTracker follows the WireGuard counters of lazy connections.
+type idleTracker struct {
+	peers map[string]*activity
+}
+
+type activity struct {
+	rx, tx int64
+	// activeAt is when either counter last moved. unanswered is when tx
+	// first moved since rx last did; zero while the peer answers.
+	activeAt   time.Time
+	unanswered time.Time
+}
+
+func newIdleTracker() *idleTracker {
+	return &idleTracker{peers: make(map[string]*activity)}
+}
+
+func (t *idleTracker) reset() {
+	clear(t.peers)
+}
+
+// observe records the counters of the connected peers, keyed by AppID, and
+// returns the peers idle for idleTimeout and those whose path is dead.
+func (t *idleTracker) observe(now time.Time, counters map[string]*infra.PeerStats, idleTimeout time.Duration) (idle, dead []string) {
+	for appId := range t.peers {
+		if _, ok := counters[appId]; !ok {
+			delete(t.peers, appId)
+		}
+	}
+
+	for appId, s := range counters {
+		a := t.peers[appId]
+		if a == nil || s.RxBytes < a.rx || s.TxBytes < a.tx {
+			// A new connection, or one whose WireGuard entry was replaced.
+			t.peers[appId] = &activity{rx: s.RxBytes, tx: s.TxBytes, activeAt: now}
+			continue
+		}
+		rxMoved, txMoved := s.RxBytes != a.rx, s.TxBytes != a.tx
+		a.rx, a.tx = s.RxBytes, s.TxBytes
+		if rxMoved || txMoved {
+			a.activeAt = now
+		}
+		switch {
+		case rxMoved:
+			a.unanswered = time.Time{}
+		case txMoved && a.unanswered.IsZero():
+			a.unanswered = now
+		}
+
+		switch {
+		case idleTimeout > 0 && now.Sub(a.activeAt) >= idleTimeout:
+			idle = append(idle, appId)
+			delete(t.peers, appId)
+		case !a.unanswered.IsZero() && now.Sub(a.unanswered) >= deadPathTimeout:
+			dead = append(dead, appId)
+			delete(t.peers, appId)
+		}
+	}
+	sort.Strings(idle)
+	sort.Strings(dead)
+	return idle, dead
+}
@@ -0,0 +1,101 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"slices"
+	"testing"
+	"time"
+	"wireflow/internal/infra"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestIdleTracker(t *testing.T) {
+	tracker := newIdleTracker()
+	start := time.Now()
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	stats := func(rx, tx int64) *infra.PeerStats { return &infra.PeerStats{RxBytes: rx, TxBytes: tx} }
+
+	// First sight of both connections.
+	idle, dead := tracker.observe(at(0), map[string]*infra.PeerStats{
+		"busy":   stats(100, 100),
+		"silent": stats(100, 100),
+		"lost":   stats(100, 100),
+	}, time.Minute)
+	if len(idle) != 0 || len(dead) != 0 {
+		t.Fatalf("got idle %v, dead %v on first sight", idle, dead)
+	}
+
+	// "busy" exchanges traffic, "lost" sends without an answer.
+	idle, dead = tracker.observe(at(20*time.Second), map[string]*infra.PeerStats{
+		"busy":   stats(200, 200),
+		"silent": stats(100, 100),
+		"lost":   stats(100, 200),
+	}, time.Minute)
+	if len(idle) != 0 || len(dead) != 0 {
+		t.Fatalf("got idle %v, dead %v after 20s", idle, dead)
+	}
+
+	idle, dead = tracker.observe(at(time.Minute), map[string]*infra.PeerStats{
+		"busy":   stats(300, 300),
+		"silent": stats(100, 100),
+		"lost":   stats(100, 300),
+	}, time.Minute)
+	if !slices.Equal(idle, []string{"silent"}) {
+		t.Fatalf("idle = %v, want [silent]", idle)
+	}
+	if !slices.Equal(dead, []string{"lost"}) {
+		t.Fatalf("dead = %v, want [lost]", dead)
+	}
+
+	// Counters that went back belong to a new WireGuard entry.
+	tracker.observe(at(70*time.Second), map[string]*infra.PeerStats{"busy": stats(0, 0)}, time.Minute)
+	idle, _ = tracker.observe(at(100*time.Second), map[string]*infra.PeerStats{"busy": stats(0, 0)}, time.Minute)
+	if len(idle) != 0 {
+		t.Fatalf("reset connection reported idle: %v", idle)
+	}
+
+	// A zero timeout keeps idle connections.
+	idle, _ = tracker.observe(at(time.Hour), map[string]*infra.PeerStats{"busy": stats(0, 0)}, 0)
+	if len(idle) != 0 {
+		t.Fatalf("idle connection closed without a timeout: %v", idle)
+	}
+}
+
+func TestParked(t *testing.T) {
+	peers := infra.NewPeerManager()
+	for _, appId := range []string{"self", "connected", "parked", "keyless"} {
+		peer := &infra.Peer{AppID: appId}
+		if appId != "keyless" {
+			key, err := wgtypes.GeneratePrivateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			peer.PublicKey = key.PublicKey().String()
+		}
+		peers.AddPeer(appId, peer)
+	}
+	f := &ProbeFactory{
+		localId:     infra.PeerIdentity{AppID: "self"},
+		peerManager: peers,
+		probes:      map[string]*Probe{"connected": {}},
+	}
+
+	parked := f.parked()
+	if len(parked) != 1 || parked[0].AppID != "parked" {
+		t.Fatalf("parked = %v, want only the peer without a probe", parked)
+	}
+}
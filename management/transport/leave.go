@@ -0,0 +1,168 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+	"wireflow/internal/grpc"
+	"wireflow/internal/infra"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"google.golang.org/protobuf/proto"
+)
+
+// leaveMaxSkew bounds how old (or how far in the future) a LEAVE announcement
+// may be. It limits how long a captured announcement can be replayed to tear
+// down a connection that has since come back.
+const leaveMaxSkew = 60 * time.Second
+
+// leaveNotice is the payload of a LEAVE packet.
+type leaveNotice struct {
+	Timestamp int64  `json:"timestamp"`
+	MAC       []byte `json:"mac"`
+}
+
+// leaveMAC authenticates a LEAVE announcement from sender to receiver. It is
+// keyed by the X25519 shared secret of their WireGuard keys, which only the two
+// of them can compute; privateKey belongs to whichever side is calling and
+// remoteKey is the other side's public key.
+func leaveMAC(privateKey, remoteKey, sender, receiver wgtypes.Key, timestamp int64) ([]byte, error) {
+	shared, err := curve25519.X25519(privateKey[:], remoteKey[:])
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(shared)
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte("wireflow leave"))
+	mac.Write(sender[:])
+	mac.Write(receiver[:])
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(timestamp))
+	mac.Write(ts[:])
+	return mac.Sum(nil), nil
+}
+
+// newLeavePacket builds the LEAVE announcement that local sends to remote.
+func newLeavePacket(privateKey wgtypes.Key, local, remote wgtypes.Key, now time.Time) (*grpc.SignalPacket, error) {
+	mac, err := leaveMAC(privateKey, remote, local, remote, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(&leaveNotice{Timestamp: now.Unix(), MAC: mac})
+	if err != nil {
+		return nil, err
+	}
+	return &grpc.SignalPacket{
+		Type:     grpc.PacketType_LEAVE,
+		SenderId: infra.FromKey(local).ToUint64(),
+		Payload:  &grpc.SignalPacket_Message{Message: &grpc.Message{Content: content}},
+	}, nil
+}
+
+// verifyLeavePacket checks that packet is a fresh LEAVE announcement from
+// remote addressed to local.
+func verifyLeavePacket(privateKey wgtypes.Key, local, remote wgtypes.Key, packet *grpc.SignalPacket, now time.Time) error {
+	var notice leaveNotice
+	if err := json.Unmarshal(packet.GetMessage().GetContent(), &notice); err != nil {
+		return fmt.Errorf("leave: unmarshal: %w", err)
+	}
+	if skew := now.Sub(time.Unix(notice.Timestamp, 0)); skew > leaveMaxSkew || skew < -leaveMaxSkew {
+		return fmt.Errorf("leave: stale announcement (%s)", skew)
+	}
+	want, err := leaveMAC(privateKey, remote, remote, local, notice.Timestamp)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(want, notice.MAC) {
+		return fmt.Errorf("leave: bad signature")
+	}
+	return nil
+}
+
+// AnnounceLeave tells every known peer that this node is going away, so they
+// drop the connection right away instead of waiting for it to time out.
+// Delivery is best effort: a peer that misses it falls back to the timeout.
+func (p *ProbeFactory) AnnounceLeave(ctx context.Context) {
+	if p.keyManager == nil {
+		return
+	}
+	p.mu.RLock()
+	localId := p.localId
+	p.mu.RUnlock()
+	privateKey := p.keyManager.GetKey()
+	now := time.Now()
+
+	for _, peer := range p.peerManager.GetAll() {
+		if peer.AppID == localId.AppID || peer.PublicKey == "" {
+			continue
+		}
+		remoteKey, err := wgtypes.ParseKey(peer.PublicKey)
+		if err != nil || remoteKey == localId.PublicKey {
+			continue
+		}
+		packet, err := newLeavePacket(privateKey, localId.PublicKey, remoteKey, now)
+		if err != nil {
+			p.log.Warn("leave: build announcement failed", "remoteId", peer.AppID, "err", err)
+			continue
+		}
+		data, err := proto.Marshal(packet)
+		if err != nil {
+			continue
+		}
+		if err = p.signal.Send(ctx, infra.FromKey(remoteKey), data); err != nil {
+			p.log.Debug("leave: announcement not sent", "remoteId", peer.AppID, "err", err)
+		}
+	}
+}
+
+// handleLeave tears down the connection to a peer that announced it is
+// leaving. The peer stays in the PeerManager, so a SYN it sends when it comes
+// back creates a fresh probe as usual.
+func (p *ProbeFactory) handleLeave(remoteId infra.PeerIdentity, packet *grpc.SignalPacket) error {
+	if p.keyManager == nil {
+		return nil
+	}
+	p.mu.RLock()
+	localId := p.localId
+	p.mu.RUnlock()
+	if err := verifyLeavePacket(p.keyManager.GetKey(), localId.PublicKey, remoteId.PublicKey, packet, time.Now()); err != nil {
+		return fmt.Errorf("peer %s: %w", remoteId.AppID, err)
+	}
+
+	p.log.Info("peer left, closing connection", "remoteId", remoteId.AppID)
+	// A lazy peer is parked, so that it reconnects once it is back and
+	// traffic asks for it.
+	if p.lazy.Load() {
+		p.park(remoteId.AppID)
+		return nil
+	}
+	p.Remove(remoteId.AppID)
+	if provisioner := p.getProvisioner(); provisioner != nil {
+		if err := provisioner.RemovePeer(&infra.SetPeer{
+			PublicKey: remoteId.PublicKey.String(),
+			Remove:    true,
+		}); err != nil {
+			return fmt.Errorf("peer %s left: remove WireGuard peer: %w", remoteId.AppID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestLeavePacket(t *testing.T) {
+	alice, _ := wgtypes.GeneratePrivateKey()
+	bob, _ := wgtypes.GeneratePrivateKey()
+	mallory, _ := wgtypes.GeneratePrivateKey()
+	now := time.Now()
+
+	packet, err := newLeavePacket(alice, alice.PublicKey(), bob.PublicKey(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob verifies with his own private key and Alice's public key.
+	if err = verifyLeavePacket(bob, bob.PublicKey(), alice.PublicKey(), packet, now.Add(5*time.Second)); err != nil {
+		t.Fatalf("valid announcement rejected: %v", err)
+	}
+
+	// The announcement is bound to its receiver and to its sender.
+	carol, _ := wgtypes.GeneratePrivateKey()
+	if err = verifyLeavePacket(carol, carol.PublicKey(), alice.PublicKey(), packet, now); err == nil {
+		t.Fatal("announcement for bob accepted by another peer")
+	}
+	forged, _ := newLeavePacket(mallory, alice.PublicKey(), bob.PublicKey(), now)
+	if err = verifyLeavePacket(bob, bob.PublicKey(), alice.PublicKey(), forged, now); err == nil {
+		t.Fatal("announcement signed with another key accepted")
+	}
+
+	if err = verifyLeavePacket(bob, bob.PublicKey(), alice.PublicKey(), packet, now.Add(2*leaveMaxSkew)); err == nil {
+		t.Fatal("stale announcement accepted")
+	}
+}
@@ -68,6 +68,9 @@ type Probe struct {
 	onSuccess        func(transport infra.Transport) error
 	onFailure        func(error) error
 	currentTransport infra.Transport
+	// icePath is the last direct path ICE established in this session, kept
+	// even while WRRP carries the traffic so diagnostics can compare both.
+	icePath *ICETransport
 }
 
 func (p *Probe) Handle(ctx context.Context, remoteId infra.PeerIdentity, packet *grpc.SignalPacket) error {
@@ -100,11 +103,18 @@ func (p *Probe) restart() {
 		p.onBeforeRestart()
 	}
 	p.mu.Lock()
+	p.state = ice.ConnectionStateChecking
+	p.icePath = nil
+	// A relayed session keeps its dialer open; it must not outlive the restart.
+	old := p.iceDialer
 	p.iceDialer = p.newIceDialer()
 	if p.newWrrpDialer != nil {
 		p.wrrpDialer = p.newWrrpDialer()
 	}
 	p.mu.Unlock()
+	if old != nil {
+		old.Close() //nolint:errcheck
+	}
 	// Increment epoch to invalidate any in-flight discover() goroutine.
 	// The goroutine will see a changed epoch, discard its result, and exit
 	// without calling onSuccess/onFailure — so the fresh Start() below is
@@ -180,6 +190,7 @@ func (p *Probe) Start(ctx context.Context, remoteId infra.PeerIdentity) error {
 
 		p.mu.Lock()
 		p.currentTransport = t
+		p.state = ice.ConnectionStateConnected
 		p.mu.Unlock()
 		if err = p.onSuccess(t); err != nil {
 			p.updateState(ice.ConnectionStateFailed)
@@ -196,7 +207,75 @@ func (p *Probe) Ping(ctx context.Context) error {
 }
 
 func (p *Probe) updateState(state ice.ConnectionState) {
+	p.mu.Lock()
 	p.state = state
+	p.mu.Unlock()
+}
+
+// ProbeState is a point-in-time view of a probe, as reported by the local API.
+type ProbeState struct {
+	// State is "connecting", "connected" or "failed".
+	State string `json:"state"`
+	// Transport carries the WireGuard traffic once connected: ICE or WRRP.
+	Transport string `json:"transport,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	// CandidatePair is the pair ICE selected when Transport is ICE.
+	CandidatePair string `json:"candidatePair,omitempty"`
+	// ICEState is the state of the ICE session: Checking, Connected,
+	// Failed, ...; empty before the session starts.
+	ICEState string `json:"iceState,omitempty"`
+}
+
+// Path is one way of reaching the remote peer. Endpoint is the WireGuard
+// endpoint that sends traffic along it.
+type Path struct {
+	Transport string `json:"transport"`
+	// Protocol is what a WRRP relay is reached over: tcp or quic.
+	Protocol      string        `json:"protocol,omitempty"`
+	Endpoint      string        `json:"endpoint"`
+	CandidatePair string        `json:"candidatePair,omitempty"`
+	RTT           time.Duration `json:"rtt,omitempty"`
+}
+
+// State reports how far the probe got in connecting to the remote peer.
+func (p *Probe) State() ProbeState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var iceState string
+	if p.state != ice.ConnectionStateUnknown {
+		iceState = p.state.String()
+	}
+	switch {
+	case p.state == ice.ConnectionStateFailed:
+		return ProbeState{State: "failed", ICEState: iceState}
+	case p.state == ice.ConnectionStateConnected && p.currentTransport != nil:
+		state := ProbeState{
+			State:     "connected",
+			Transport: p.currentTransport.Type().String(),
+			Endpoint:  p.currentTransport.RemoteAddr(),
+			ICEState:  iceState,
+		}
+		if it, ok := p.currentTransport.(*ICETransport); ok {
+			state.CandidatePair = it.CandidatePair()
+		}
+		return state
+	}
+	return ProbeState{State: "connecting", ICEState: iceState}
+}
+
+// icePathInfo returns the direct path of the session, if ICE found one.
+func (p *Probe) icePathInfo() (Path, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.icePath == nil {
+		return Path{}, false
+	}
+	return Path{
+		Transport:     p.icePath.Type().String(),
+		Endpoint:      p.icePath.RemoteAddr(),
+		CandidatePair: p.icePath.CandidatePair(),
+		RTT:           p.icePath.RTT(),
+	}, true
 }
 
 // discover races ICE and WRRP dialers concurrently and returns whichever
@@ -242,6 +321,11 @@ func (p *Probe) discover(ctx context.Context) (infra.Transport, error) {
 			errs <- err
 			return
 		}
+		if it, ok := t.(*ICETransport); ok {
+			p.mu.Lock()
+			p.icePath = it
+			p.mu.Unlock()
+		}
 		result <- t
 		// Only upgrade when WRRP already owns the active transport.
 		// When ICE wins the race discover() returns it directly and
@@ -304,6 +388,19 @@ func (p *Probe) discover(ctx context.Context) (infra.Transport, error) {
 	}
 }
 
+// handleICEUpgrade switches a relayed ICE session over to the direct pair
+// it moved to.
+func (p *Probe) handleICEUpgrade(t infra.Transport) {
+	if it, ok := t.(*ICETransport); ok {
+		p.mu.Lock()
+		p.icePath = it
+		p.mu.Unlock()
+	}
+	if err := p.handleUpgradeTransport(t); err != nil {
+		p.log.Error("Upgrade transport failed", err)
+	}
+}
+
 func (p *Probe) handleUpgradeTransport(newTransport infra.Transport) error {
 	p.log.Debug("Upgrade transport....", "newTransport", newTransport)
 	p.mu.Lock()
@@ -313,6 +410,7 @@ func (p *Probe) handleUpgradeTransport(newTransport infra.Transport) error {
 	if p.currentTransport == nil || newTransport.Priority() > p.currentTransport.Priority() {
 		old := p.currentTransport
 		p.currentTransport = newTransport
+		p.state = ice.ConnectionStateConnected
 
 		// 延迟关闭旧连接，确保缓冲区数据发完
 		if old != nil {
@@ -19,14 +19,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"sync"
 	"sync/atomic"
 	"time"
+	"wireflow/internal/config"
 	"wireflow/internal/grpc"
 	"wireflow/internal/infra"
 	"wireflow/internal/log"
 
 	"github.com/pion/ice/v4"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 type ProbeFactory struct {
@@ -42,6 +45,10 @@ type ProbeFactory struct {
 	getProvisioner func() infra.Provisioner
 	getOnMessage   func() func(context.Context, *infra.Message) error
 	getWrrp        func() infra.Wrrp
+	onConnected    func(peer *infra.Peer)
+	iceServers     *ICEServers
+	relays         *infra.RelayConns
+	keyManager     infra.KeyManager
 
 	log *log.Logger
 
@@ -50,6 +57,11 @@ type ProbeFactory struct {
 
 	FilteringMux  *infra.FilteringUDPMux
 	FilteringMux6 *infra.FilteringUDPMux
+
+	// lazy is set when the network connects peers on demand; see Park.
+	lazy        atomic.Bool
+	idleTimeout atomic.Int64
+	onDemand    *infra.OnDemand
 }
 
 type ProbeFactoryConfig struct {
@@ -61,11 +73,21 @@ type ProbeFactoryConfig struct {
 	FilteringMux  *infra.FilteringUDPMux
 	FilteringMux6 *infra.FilteringUDPMux
 	GetProvisioner         func() infra.Provisioner
-	ShowLog                bool
+	// OnConnected is called, on its own goroutine, each time the transport
+	// to a peer is established or replaced.
+	OnConnected func(peer *infra.Peer)
+	ICEServers  *ICEServers
+	// Relays carries WireGuard traffic through TURN allocations of this node.
+	Relays *infra.RelayConns
+	// KeyManager signs and verifies LEAVE announcements between peers.
+	KeyManager infra.KeyManager
+	// OnDemand reports the traffic to peers that are not connected yet.
+	OnDemand *infra.OnDemand
+	ShowLog  bool
 }
 
 func NewProbeFactory(cfg *ProbeFactoryConfig) *ProbeFactory {
-	return &ProbeFactory{
+	f := &ProbeFactory{
 		log:                    log.GetLogger("probe-factory"),
 		localId:                cfg.LocalId,
 		signal:                 cfg.Signal,
@@ -77,7 +99,16 @@ func NewProbeFactory(cfg *ProbeFactoryConfig) *ProbeFactory {
 		FilteringMux6: cfg.FilteringMux6,
 		getProvisioner:         cfg.GetProvisioner,
 		getOnMessage:           cfg.GetOnMessage,
+		onConnected:            cfg.OnConnected,
+		iceServers:             cfg.ICEServers,
+		relays:                 cfg.Relays,
+		keyManager:             cfg.KeyManager,
+		onDemand:               cfg.OnDemand,
+	}
+	if f.onDemand != nil {
+		f.onDemand.SetConnect(f.connectOnDemand)
 	}
+	return f
 }
 
 func (f *ProbeFactory) Register(remoteId infra.PeerIdentity, probe *Probe) {
@@ -85,12 +116,18 @@ func (f *ProbeFactory) Register(remoteId infra.PeerIdentity, probe *Probe) {
 }
 
 func (f *ProbeFactory) Get(remoteId infra.PeerIdentity) (*Probe, error) {
+	probe, _, err := f.getOrCreate(remoteId)
+	return probe, err
+}
+
+// getOrCreate is Get, and also reports whether the probe was just created.
+func (f *ProbeFactory) getOrCreate(remoteId infra.PeerIdentity) (*Probe, bool, error) {
 	// Fast path: probe already exists, read lock is sufficient.
 	f.mu.RLock()
 	probe := f.probes[remoteId.AppID]
 	f.mu.RUnlock()
 	if probe != nil {
-		return probe, nil
+		return probe, false, nil
 	}
 
 	// Slow path: create a new probe under write lock.
@@ -98,9 +135,71 @@ func (f *ProbeFactory) Get(remoteId infra.PeerIdentity) (*Probe, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	if probe = f.probes[remoteId.AppID]; probe != nil {
-		return probe, nil
+		return probe, false, nil
+	}
+	probe, err := f.NewProbe(remoteId)
+	return probe, err == nil, err
+}
+
+// States returns the state of every probe, keyed by remote AppID.
+func (f *ProbeFactory) States() map[string]ProbeState {
+	f.mu.RLock()
+	probes := make(map[string]*Probe, len(f.probes))
+	for appId, probe := range f.probes {
+		probes[appId] = probe
+	}
+	f.mu.RUnlock()
+
+	states := make(map[string]ProbeState, len(probes))
+	for appId, probe := range probes {
+		states[appId] = probe.State()
+	}
+	return states
+}
+
+// Paths returns the paths available to the peer with appId: the direct path
+// once ICE established one, and the WRRP relay whenever a relay client runs.
+func (f *ProbeFactory) Paths(appId string) []Path {
+	f.mu.RLock()
+	probe := f.probes[appId]
+	f.mu.RUnlock()
+	if probe == nil {
+		return nil
+	}
+
+	var paths []Path
+	if path, ok := probe.icePathInfo(); ok {
+		if path.Transport == infra.TURN.String() {
+			path.Endpoint = infra.RelayFakeAddrPort(probe.remoteId.ID().ToUint64()).String()
+		}
+		paths = append(paths, path)
+	}
+	if config.Conf.EnableWrrp && f.getWrrp != nil {
+		if wrrp := f.getWrrp(); wrrp != nil {
+			paths = append(paths, Path{
+				Transport: infra.WRRP.String(),
+				Protocol:  wrrp.Protocol(),
+				Endpoint:  infra.WrrpFakeAddrPort(probe.remoteId.ID().ToUint64()).String(),
+			})
+		}
+	}
+	return paths
+}
+
+// SetLocalId switches the local identity after a key rotation. Existing probes
+// were built around the old identity, so they are closed and dropped; the next
+// AddPeer for each remote peer creates a fresh probe. WireGuard peer entries
+// are left in place so established sessions keep flowing in the meantime.
+func (f *ProbeFactory) SetLocalId(localId infra.PeerIdentity) {
+	f.mu.Lock()
+	f.localId = localId
+	probes := f.probes
+	f.probes = make(map[string]*Probe)
+	f.mu.Unlock()
+
+	for _, probe := range probes {
+		probe.Close()
 	}
-	return f.NewProbe(remoteId)
 }
 
 func (f *ProbeFactory) Remove(appId string) {
@@ -116,13 +215,49 @@ func (f *ProbeFactory) Remove(appId string) {
 	}
 }
 
+// muxRefreshGrace keeps the replaced ICE muxes open after Reconnect so
+// sessions still on them can finish while the new ones are gathered.
+const muxRefreshGrace = 5 * time.Second
+
+// Reconnect re-runs ICE with every peer after the underlay network changed.
+// The muxes are refreshed first so that candidates are gathered from the
+// current host addresses, then each probe restarts after a random delay up
+// to jitter, which spreads the new offers instead of signalling all peers at
+// once.
+func (f *ProbeFactory) Reconnect(jitter time.Duration) {
+	for _, mux := range []*infra.FilteringUDPMux{f.FilteringMux, f.FilteringMux6} {
+		if mux != nil {
+			mux.Refresh(jitter + muxRefreshGrace)
+		}
+	}
+
+	f.mu.RLock()
+	probes := make([]*Probe, 0, len(f.probes))
+	for _, probe := range f.probes {
+		probes = append(probes, probe)
+	}
+	f.mu.RUnlock()
+
+	for _, probe := range probes {
+		var delay time.Duration
+		if jitter > 0 {
+			delay = rand.N(jitter)
+		}
+		time.AfterFunc(delay, probe.restart)
+	}
+}
+
 func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
+	// Callers hold p.mu; capture the identity so a later SetLocalId does not
+	// change it underneath this probe's dialers.
+	localId := p.localId
+
 	// getLocalPeer reads the local peer's current info from the peer manager.
 	// Called at dialer construction time (including on each restart) so that a
 	// late-arriving Address/AllowedIPs assignment (from ApplyFullConfig) is
 	// picked up rather than a stale nil captured at probe creation time.
 	getLocalPeer := func() *infra.Peer {
-		lp := p.peerManager.GetPeer(p.localId.AppID)
+		lp := p.peerManager.GetPeer(localId.AppID)
 		if lp != nil && lp.AllowedIPs == "" && lp.Address != nil {
 			lpCopy := *lp
 			lpCopy.AllowedIPs = fmt.Sprintf("%s/32", *lp.Address)
@@ -163,8 +298,9 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 			allowedIPs = fmt.Sprintf("%s/32", *peer.Address)
 		}
 		if err := provisioner.AddPeer(&infra.SetPeer{
-			PublicKey:  remoteId.PublicKey.String(),
-			AllowedIPs: allowedIPs,
+			PublicKey:    remoteId.PublicKey.String(),
+			PresharedKey: presharedKey(peer.PresharedKey),
+			AllowedIPs:   allowedIPs,
 		}); err != nil {
 			p.log.Warn("onPeerKnown: AddPeer failed", "remoteId", remoteId.AppID, "err", err)
 			peerKnownDone.Store(false) // allow retry
@@ -174,10 +310,32 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 			p.log.Warn("onPeerKnown: ApplyRoute failed", "remoteId", remoteId.AppID, "err", err)
 			// ApplyRoute failure is non-fatal: onEndpointReady will retry (ip route replace is idempotent).
 		}
+		for _, route := range peer.Routes {
+			if err := provisioner.ApplyRoute("add", route, provisioner.GetIfaceName()); err != nil {
+				p.log.Warn("onPeerKnown: subnet route failed", "remoteId", remoteId.AppID, "route", route, "err", err)
+			}
+		}
 		p.log.Info("peer known, pre-configured WG entry", "remoteId", remoteId.AppID, "allowedIPs", allowedIPs)
 	}
 
 	onPeerReceived := func(peer infra.Peer) {
+		// The PSK is assigned by the control plane, never by the remote peer:
+		// keep the one from the network map. So are the exit node role and
+		// the approved subnet routes, which widen the peer's AllowedIPs.
+		peer.PresharedKey = ""
+		peer.ExitNode = false
+		peer.Routes = nil
+		if known := p.peerManager.GetPeer(peer.AppID); known != nil {
+			peer.PresharedKey = known.PresharedKey
+			if known.ExitNode {
+				peer.ExitNode = true
+				peer.AllowedIPs = infra.ExitNodeAllowedIPs(peer.AllowedIPs)
+			}
+			if len(known.Routes) > 0 {
+				peer.Routes = known.Routes
+				peer.AllowedIPs = infra.AppendAllowedIPs(peer.AllowedIPs, known.Routes...)
+			}
+		}
 		mu.Lock()
 		p.peerManager.AddPeer(peer.AppID, &peer)
 		remotePeer = &peer
@@ -191,7 +349,7 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 	var probe *Probe
 	makeWrrpDialer := func() infra.Dialer {
 		return NewWrrpDialer(&WrrpDialerConfig{
-			LocalId:        p.localId,
+			LocalId:        localId,
 			RemoteId:       remoteId,
 			Wrrp:           p.getWrrp(),
 			Sender:         p.signal.Send,
@@ -203,7 +361,7 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 
 	probe = &Probe{
 		log:      p.log,
-		localId:  p.localId,
+		localId:  localId,
 		remoteId: remoteId,
 		signal:   p.signal,
 		state:    ice.ConnectionStateNew,
@@ -228,8 +386,10 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 			p.log.Info("connection established", "transportType", transport.Type(), "remoteAddr", transport.RemoteAddr())
 			// Only the initiator drives WireGuard keepalives to avoid both ends
 			// simultaneously sending Handshake Initiations (causes ~90 s stall).
+			// A lazy connection sends none: its traffic alone tells when it
+			// has gone idle.
 			persistentKA := 0
-			if isInitiator(p.localId, remoteId) {
+			if isInitiator(localId, remoteId) && !p.lazy.Load() {
 				persistentKA = infra.PersistentKeepalive
 			}
 			allowedIPs := rp.AllowedIPs
@@ -240,18 +400,27 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 			// AllowedIPs is re-applied (idempotent with replace_allowed_ips=true).
 			setPeer := &infra.SetPeer{
 				PublicKey:            remoteId.PublicKey.String(),
+				PresharedKey:         presharedKey(rp.PresharedKey),
 				PersistentKeepalived: persistentKA,
 				AllowedIPs:           allowedIPs,
 			}
-			if transport.Type() == infra.WRRP {
+			switch transport.Type() {
+			case infra.WRRP:
 				setPeer.Endpoint = infra.WrrpFakeAddrPort(remoteId.ID().ToUint64()).String()
-			} else {
+			case infra.TURN:
+				setPeer.Endpoint = infra.RelayFakeAddrPort(remoteId.ID().ToUint64()).String()
+			default:
 				setPeer.Endpoint = transport.RemoteAddr()
 			}
 			if err := provisioner.AddPeer(setPeer); err != nil {
 				p.log.Error("onEndpointReady: AddPeer failed", err)
 				return err
 			}
+			if p.onDemand != nil {
+				if err := p.onDemand.Flush(remoteId.ID().ToUint64(), setPeer.Endpoint); err != nil {
+					p.log.Warn("onEndpointReady: pending handshake not sent", "remoteId", remoteId.AppID, "err", err)
+				}
+			}
 
 			// ApplyRoute is idempotent (ip route replace); re-run in case
 			// onPeerKnown was skipped because the provisioner was not ready yet.
@@ -259,8 +428,21 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 				p.log.Error("onEndpointReady: ApplyRoute failed", err)
 				return err
 			}
+			for _, route := range rp.Routes {
+				if err := provisioner.ApplyRoute("add", route, provisioner.GetIfaceName()); err != nil {
+					p.log.Error("onEndpointReady: subnet route failed", err, "route", route)
+					return err
+				}
+			}
 
-			return provisioner.SetupNAT(provisioner.GetIfaceName())
+			if err := provisioner.SetupNAT(provisioner.GetIfaceName()); err != nil {
+				return err
+			}
+			if p.onConnected != nil {
+				peer := *rp
+				go p.onConnected(&peer)
+			}
+			return nil
 		},
 		onFailure: func(err error) error {
 			// ErrDialerClosed: the iceDialer was explicitly shut down because
@@ -290,6 +472,12 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 			// server drive the next attempt via PeersRemoved/PeersAdded.
 			if elapsed >= 60*time.Second {
 				p.log.Info("peer unreachable for 60s, closing probe", "remoteId", remoteId.AppID)
+				// A lazy peer is parked instead: the next packet to it
+				// tries again.
+				if p.lazy.Load() {
+					p.park(remoteId.AppID)
+					return nil
+				}
 				p.Remove(remoteId.AppID)
 				return nil
 			}
@@ -301,15 +489,20 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 	}
 
 	// makeIceDialer creates a fresh iceDialer for each connection attempt.
-	// Restart is driven entirely by onFailure above — the dialer itself has
-	// no restart callback, eliminating the double-restart race condition.
+	// Until Dial returns, restart is driven entirely by onFailure above.
+	// Only a relayed session, which keeps its agent afterwards, restarts the
+	// probe itself when it fails, and reports its upgrade to a direct pair.
 	makeIceDialer := func() infra.Dialer {
 		return NewIceDialer(&ICEDialerConfig{
-			LocalId:                p.localId,
+			LocalId:                localId,
 			RemoteId:               remoteId,
 			Sender:                 p.signal.Send,
 			GetLocalPeer:           getLocalPeer,
 			OnPeerReceived:         onPeerReceived,
+			ICEServers:             p.iceServers,
+			Relays:                 p.relays,
+			OnUpgrade:              probe.handleICEUpgrade,
+			OnRestart:              probe.restart,
 			FilteringMux: p.FilteringMux,
 			// FilteringMux6: p.FilteringMux6, // IPv6 ICE disabled until e2e tests pass
 			ShowLog:                p.showLog,
@@ -340,6 +533,15 @@ func (p *ProbeFactory) NewProbe(remoteId infra.PeerIdentity) (*Probe, error) {
 	return probe, nil
 }
 
+// presharedKey returns the UAPI value for a peer's PSK. An all-zero key clears
+// a PSK left over from an earlier configuration.
+func presharedKey(psk string) string {
+	if psk == "" {
+		return wgtypes.Key{}.String()
+	}
+	return psk
+}
+
 // Handle is the NATS SignalHandler boundary: remoteId is PeerID from packet.SenderId.
 // It resolves to a full PeerIdentity via PeerManager before passing down.
 func (p *ProbeFactory) Handle(ctx context.Context, remoteId infra.PeerID, packet *grpc.SignalPacket) error {
@@ -365,10 +567,16 @@ func (p *ProbeFactory) Handle(ctx context.Context, remoteId infra.PeerID, packet
 		p.log.Warn("dropping signal packet from unknown peer, config not yet applied", "remoteId", remoteId)
 		return nil
 	}
-	probe, err := p.Get(remoteIdentity)
+	if packet.Type == grpc.PacketType_LEAVE {
+		return p.handleLeave(remoteIdentity, packet)
+	}
+	probe, created, err := p.getOrCreate(remoteIdentity)
 	if err != nil {
 		return err
 	}
+	if p.lazy.Load() && p.handleLazy(probe, created, remoteIdentity, packet) {
+		return nil
+	}
 	return probe.Handle(ctx, remoteIdentity, packet)
 }
 
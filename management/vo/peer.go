@@ -2,6 +2,7 @@ package vo
 
 import (
 	"time"
+	"wireflow/api/v1alpha1"
 )
 
 type PeerVo struct {
@@ -39,3 +40,35 @@ type PeerVo struct {
 	// DisplayName is the user-defined alias for this node, stored as a K8s annotation.
 	DisplayName string `json:"displayName,omitempty"`
 }
+
+// ConnectivityMatrix is the tunnel state between the peers of a workspace, as
+// reported by the peers themselves. Links is sparse: only online peers
+// report, and a link appears once per direction.
+type ConnectivityMatrix struct {
+	Peers []ConnectivityPeer `json:"peers"`
+	Links []ConnectivityLink `json:"links"`
+}
+
+// ConnectivityPeer is one row and column of the matrix.
+type ConnectivityPeer struct {
+	AppID       string  `json:"appId"`
+	Name        string  `json:"name"`
+	DisplayName string  `json:"displayName,omitempty"`
+	Address     *string `json:"address,omitempty"`
+	// Status is the presence from heartbeats: "online", "offline" or "pending".
+	Status  string                     `json:"status,omitempty"`
+	Summary v1alpha1.ConnectionSummary `json:"summary"`
+}
+
+// ConnectivityLink is the tunnel from one peer to another as From sees it.
+type ConnectivityLink struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Connected bool   `json:"connected"`
+	Transport string `json:"transport,omitempty"`
+	ICEState  string `json:"iceState,omitempty"`
+	// LastHandshake is the RFC3339 time of the last WireGuard handshake.
+	LastHandshake *string `json:"lastHandshake,omitempty"`
+	RxBytes       int64   `json:"rxBytes"`
+	TxBytes       int64   `json:"txBytes"`
+}
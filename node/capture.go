@@ -0,0 +1,222 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"wireflow/internal/capture"
+	"wireflow/internal/config"
+	"wireflow/internal/infra"
+	"wireflow/internal/localapi"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// peerTableRefresh is how often a capture picks up peers and endpoints that
+// changed while it runs.
+const peerTableRefresh = 2 * time.Second
+
+// Capture taps the TUN device, and the bind when req.Underlay is set, and
+// streams the selected packets to w as pcapng. Packets are annotated with the
+// peer they belong to.
+func (c *Node) Capture(ctx context.Context, req *localapi.CaptureRequest, w io.Writer) error {
+	filter, err := capture.ParseFilter(req.Filter)
+	if err != nil {
+		return err
+	}
+	opts := capture.Options{
+		Filter:    filter,
+		Underlay:  req.Underlay,
+		Count:     req.Count,
+		Interface: c.Name,
+	}
+	if req.Peer != "" {
+		peer := c.findPeer(req.Peer)
+		if peer == nil {
+			return fmt.Errorf("%w: %s", localapi.ErrPeerNotFound, req.Peer)
+		}
+		opts.Peer = peerName(peer)
+	}
+	if device, err := c.provisioner.DeviceStats(); err == nil {
+		opts.Port = uint16(device.ListenPort)
+	}
+
+	resolver := &peerResolver{}
+	resolver.refresh(c)
+	opts.Resolver = resolver
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(peerTableRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				resolver.refresh(c)
+			}
+		}
+	}()
+
+	session := capture.NewSession(opts)
+	remove := c.taps.Add(session)
+	defer remove()
+	c.logger.Info("packet capture started", "peer", req.Peer, "filter", filter.String(), "underlay", req.Underlay)
+	defer c.logger.Info("packet capture stopped")
+	return session.Run(ctx, w)
+}
+
+// peerName labels a peer in captures.
+func peerName(p *infra.Peer) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.AppID
+}
+
+// peerResolver maps the packets of a capture to peers. The table is swapped
+// whole, so lookups on the data path take no lock.
+type peerResolver struct {
+	table atomic.Pointer[peerTable]
+}
+
+type peerPrefix struct {
+	prefix netip.Prefix
+	name   string
+}
+
+type peerTable struct {
+	// prefixes are the AllowedIPs of the peers.
+	prefixes []peerPrefix
+	// endpoints are the current WireGuard endpoints of the peers.
+	endpoints map[netip.AddrPort]string
+	// ids are the RemoteIds carried by relayed and parked endpoints.
+	ids map[uint64]string
+}
+
+func (r *peerResolver) refresh(c *Node) {
+	table := &peerTable{
+		endpoints: make(map[netip.AddrPort]string),
+		ids:       make(map[uint64]string),
+	}
+	var stats map[string]*infra.PeerStats
+	if device, err := c.provisioner.DeviceStats(); err == nil {
+		stats = device.Peers
+	}
+	for _, p := range c.manager.peerManager.GetAll() {
+		if c.current != nil && p.AppID == c.current.AppID {
+			continue
+		}
+		name := peerName(p)
+		allowedIPs := p.AllowedIPs
+		if allowedIPs == "" && p.Address != nil {
+			allowedIPs = *p.Address + "/32"
+		}
+		for _, s := range strings.Split(allowedIPs, ",") {
+			if prefix, err := netip.ParsePrefix(strings.TrimSpace(s)); err == nil {
+				table.prefixes = append(table.prefixes, peerPrefix{prefix: prefix.Masked(), name: name})
+			}
+		}
+		if key, err := wgtypes.ParseKey(p.PublicKey); err == nil {
+			table.ids[infra.FromKey(key).ToUint64()] = name
+		}
+		if s := stats[p.PublicKey]; s != nil {
+			if ep, err := netip.ParseAddrPort(s.Endpoint); err == nil {
+				table.endpoints[unmapAddrPort(ep)] = name
+			}
+		}
+	}
+	r.table.Store(table)
+}
+
+// OverlayPeer returns the peer whose most specific AllowedIPs prefix holds
+// addr.
+func (r *peerResolver) OverlayPeer(addr netip.Addr) string {
+	table := r.table.Load()
+	if table == nil {
+		return ""
+	}
+	name, bits := "", -1
+	for _, p := range table.prefixes {
+		if p.prefix.Bits() > bits && p.prefix.Contains(addr) {
+			name, bits = p.name, p.prefix.Bits()
+		}
+	}
+	return name
+}
+
+// UnderlayPeer returns the peer reached at endpoint.
+func (r *peerResolver) UnderlayPeer(endpoint netip.AddrPort) string {
+	table := r.table.Load()
+	if table == nil {
+		return ""
+	}
+	addr := endpoint.Addr()
+	if infra.IsWrrpFakeAddr(addr) || infra.IsRelayFakeAddr(addr) || infra.IsLazyFakeAddr(addr) {
+		return table.ids[infra.RemoteIdFromWrrpFakeAddr(addr)]
+	}
+	return table.endpoints[unmapAddrPort(endpoint)]
+}
+
+func unmapAddrPort(ap netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+// CaptureOptions select what `wireflow capture` records.
+type CaptureOptions struct {
+	Peer     string
+	Filter   string
+	Underlay bool
+	Count    int
+	// Output is the pcapng file to write, "-" for stdout.
+	Output string
+}
+
+// CapturePackets asks the running agent for a packet capture and writes it
+// to opts.Output until interrupted or opts.Count packets were captured.
+func CapturePackets(flags *config.Config, opts CaptureOptions) error {
+	client, err := localapi.NewClient(flags.InterfaceName)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	out := os.Stdout
+	if opts.Output != "-" {
+		if out, err = os.Create(opts.Output); err != nil {
+			return err
+		}
+		defer out.Close()
+		fmt.Fprintf(os.Stderr, "Capturing to %s, press Ctrl-C to stop\n", opts.Output)
+	}
+	return client.Capture(ctx, &localapi.CaptureRequest{
+		Peer:     opts.Peer,
+		Filter:   opts.Filter,
+		Underlay: opts.Underlay,
+		Count:    opts.Count,
+	}, out)
+}
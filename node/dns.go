@@ -0,0 +1,207 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"wireflow/dns"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+)
+
+// overlayDNS serves the overlay zone of the network map on the address of
+// this node, and points the resolver of the host at it for the zone.
+type overlayDNS struct {
+	logger  *log.Logger
+	journal *infra.Journal
+	iface   string
+	// system are the resolvers of the host, read before any change to them.
+	system []string
+
+	mu     sync.Mutex
+	server *dns.LinkDNS
+	addr   netip.Addr
+	// domains are the routing domains split DNS is configured for, comma
+	// separated.
+	domains string
+	// split reverts the split DNS configuration of domains.
+	split *infra.Mutation
+}
+
+func newOverlayDNS(logger *log.Logger, journal *infra.Journal, iface string) *overlayDNS {
+	return &overlayDNS{
+		logger:  logger,
+		journal: journal,
+		iface:   iface,
+		system:  dns.SystemResolvers(),
+	}
+}
+
+// reconcile applies the DNS zone of msg. The server follows the address of
+// this node, which may only arrive with a later network map.
+func (d *overlayDNS) reconcile(msg *infra.Message) {
+	if d == nil || msg.Current == nil || msg.Current.Address == nil {
+		return
+	}
+	addr, err := netip.ParseAddr(*msg.Current.Address)
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.server == nil || d.addr != addr {
+		// The host resolver points at the old address.
+		d.revertSplit()
+		d.domains = ""
+		d.stopServer()
+		server := dns.NewNativeDNS(&dns.DNSConfig{
+			ListenAddress: net.JoinHostPort(addr.String(), "53"),
+			Logger:        d.logger,
+		})
+		if err = server.Start(); err != nil {
+			d.logger.Error("failed to start overlay DNS", err, "addr", addr)
+			return
+		}
+		d.server, d.addr = server, addr
+	}
+
+	var zone *dns.Zone
+	var domains []string
+	upstreams, forwarders := d.system, map[string][]string(nil)
+	if msg.Network != nil && msg.Network.DNS != nil {
+		conf := msg.Network.DNS
+		zone = d.buildZone(msg)
+		domains = routingDomains(conf)
+		if len(conf.Servers) > 0 {
+			upstreams = conf.Servers
+		}
+		forwarders = make(map[string][]string, len(conf.Forwarders))
+		for _, f := range conf.Forwarders {
+			forwarders[f.Domain] = f.Servers
+		}
+	}
+	d.server.SetZone(zone)
+	d.server.SetUpstreams(upstreams)
+	d.server.SetForwarders(forwarders)
+
+	key := strings.Join(domains, ",")
+	if key == d.domains {
+		return
+	}
+	d.revertSplit()
+	d.domains = key
+	if len(domains) == 0 {
+		d.logger.Info("overlay DNS zone withdrawn")
+		return
+	}
+	m, err := dns.ConfigureSplitDNS(d.journal, d.iface, addr, domains)
+	if m.Kind != "" {
+		d.split = &m
+	}
+	if err != nil {
+		d.logger.Warn("overlay DNS serves the zone, but the host resolver could not be pointed at it", "domains", key, "server", addr, "err", err)
+		return
+	}
+	d.logger.Info("overlay DNS configured", "domains", key, "server", addr, "names", zone.Len())
+}
+
+// buildZone names every peer of the network, this node included, by its
+// name and its app id, next to the custom records of the network.
+func (d *overlayDNS) buildZone(msg *infra.Message) *dns.Zone {
+	zone := dns.NewZone(msg.Network.DNS.Domain)
+	peers := append([]*infra.Peer{msg.Current}, msg.Network.Peers...)
+	seen := make(map[string]struct{}, len(peers))
+	for _, peer := range peers {
+		if peer.Address == nil {
+			continue
+		}
+		addr, err := netip.ParseAddr(*peer.Address)
+		if err != nil {
+			continue
+		}
+		labels := []string{infra.DNSLabel(peer.Name), infra.DNSLabel(peer.AppID)}
+		for _, label := range slices.Compact(labels) {
+			if _, dup := seen[label]; dup || label == "" {
+				continue
+			}
+			seen[label] = struct{}{}
+			zone.Add(label, addr)
+		}
+	}
+
+	for _, r := range msg.Network.DNS.Records {
+		for _, value := range r.Values {
+			record := dns.Record{Name: r.Name + ".", Type: r.Type, TTL: int(r.TTL), Data: value}
+			if err := zone.AddRecord(record); err != nil {
+				d.logger.Warn("ignoring invalid DNS record", "name", r.Name, "type", r.Type, "err", err)
+			}
+		}
+	}
+	return zone
+}
+
+// routingDomains are the domains the host resolver sends to the overlay
+// DNS: the zone, the forwarded domains and the names of records outside
+// the zone.
+func routingDomains(conf *infra.DNSConfig) []string {
+	domains := []string{conf.Domain}
+	for _, f := range conf.Forwarders {
+		domains = append(domains, f.Domain)
+	}
+	for _, r := range conf.Records {
+		if r.Name != conf.Domain && !strings.HasSuffix(r.Name, "."+conf.Domain) {
+			domains = append(domains, r.Name)
+		}
+	}
+	slices.Sort(domains)
+	return slices.Compact(domains)
+}
+
+// close stops the server and reverts the split DNS configuration.
+func (d *overlayDNS) close() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.revertSplit()
+	d.stopServer()
+}
+
+func (d *overlayDNS) revertSplit() {
+	if d.split == nil {
+		return
+	}
+	if err := d.journal.Revert(*d.split); err != nil {
+		d.logger.Warn("failed to revert split DNS", "err", err)
+	}
+	d.split = nil
+}
+
+func (d *overlayDNS) stopServer() {
+	if d.server == nil {
+		return
+	}
+	if err := d.server.Stop(); err != nil {
+		d.logger.Debug("overlay DNS stop failed", "err", err)
+	}
+	d.server = nil
+}
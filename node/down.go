@@ -0,0 +1,89 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"wireflow/internal/config"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+)
+
+// stopTimeout bounds how long Down waits for a stopped agent to finish
+// reverting its host changes.
+const stopTimeout = 10 * time.Second
+
+// Down stops the running agent, which reverts its host changes as it exits.
+// With purge, whatever is still recorded in the mutation journal — left by an
+// agent that crashed or was killed — is reverted too, so the host ends up clean
+// even when no agent is running.
+func Down(flags *config.Config, purge bool) error {
+	stopErr := Stop(flags)
+	if !purge {
+		return stopErr
+	}
+
+	// Additional networks keep their journals in their own state directories.
+	paths, err := filepath.Glob(filepath.Join(networkStateDir("*"), infra.JournalFileName))
+	if err != nil {
+		return err
+	}
+	paths = append([]string{filepath.Join(config.GetConfigDir(), infra.JournalFileName)}, paths...)
+	if stopErr == nil {
+		// The agent removes each journal once everything it records is
+		// reverted; one still there after the wait was left unfinished.
+		for _, path := range waitForRemoval(paths, stopTimeout) {
+			fmt.Printf("the agent left %s behind\n", path)
+		}
+	} else {
+		fmt.Printf("no running agent was stopped: %v\n", stopErr)
+	}
+
+	n := 0
+	for _, path := range paths {
+		journal, err := infra.OpenJournal(path, log.GetLogger("down"))
+		if err != nil {
+			return err
+		}
+		n += journal.Len()
+		if err = journal.Undo(); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("reverted %d leftover host changes\n", n)
+	return nil
+}
+
+// waitForRemoval waits up to timeout for every file of paths to disappear and
+// returns those that are still there.
+func waitForRemoval(paths []string, timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+	for {
+		var left []string
+		for _, path := range paths {
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				left = append(left, path)
+			}
+		}
+		if len(left) == 0 || !time.Now().Before(deadline) {
+			return left
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWaitForRemoval(t *testing.T) {
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "journal.json")
+	extra := filepath.Join(dir, "networks", "staging", "journal.json")
+	for _, path := range []string{primary, extra} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("[]"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The primary journal is removed while waiting; the one of the additional
+	// network is not, and is reported.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Remove(primary) //nolint:errcheck
+	}()
+	left := waitForRemoval([]string{primary, extra}, time.Second)
+	if !slices.Equal(left, []string{extra}) {
+		t.Fatalf("left = %v, want [%s]", left, extra)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+)
+
+// exitNodeRouter keeps the exit node state of the host in line with the
+// network map: routing all traffic through the peer chosen with --exit-node
+// while the control plane offers it, and forwarding traffic for others while
+// this node is advertised as an exit node itself.
+type exitNodeRouter struct {
+	logger      *log.Logger
+	provisioner infra.Provisioner
+	// name is the --exit-node peer, by name or app id; empty when unused.
+	name string
+	// endpoints are the control plane and relay URLs that must stay
+	// reachable outside the tunnel.
+	endpoints []string
+
+	mu      sync.Mutex
+	active  string // app id of the exit node in use
+	missing bool   // the chosen exit node is not offered by the network map
+	serving bool
+}
+
+func newExitNodeRouter(logger *log.Logger, provisioner infra.Provisioner, name string, endpoints ...string) *exitNodeRouter {
+	return &exitNodeRouter{
+		logger:      logger,
+		provisioner: provisioner,
+		name:        name,
+		endpoints:   endpoints,
+	}
+}
+
+// peer returns the peer as this node uses it: ExitNode stays set only on the
+// chosen exit node, whose AllowedIPs then include the default routes.
+func (r *exitNodeRouter) peer(peer *infra.Peer) *infra.Peer {
+	if !peer.ExitNode {
+		return peer
+	}
+	cp := *peer
+	if r.selected(peer) {
+		cp.AllowedIPs = infra.ExitNodeAllowedIPs(peer.AllowedIPs)
+	} else {
+		cp.ExitNode = false
+	}
+	return &cp
+}
+
+func (r *exitNodeRouter) selected(peer *infra.Peer) bool {
+	return r.name != "" && peer.ExitNode && (peer.Name == r.name || peer.AppID == r.name)
+}
+
+// reconcile applies the exit node state of msg and reports whether this node
+// currently routes its internet traffic through an exit node.
+func (r *exitNodeRouter) reconcile(msg *infra.Message) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if msg.Current != nil && msg.Current.ExitNode != r.serving {
+		action := "delete"
+		if msg.Current.ExitNode {
+			action = "add"
+		}
+		if err := r.provisioner.ServeExitNode(action, r.provisioner.GetIfaceName()); err != nil {
+			r.logger.Error("failed to update exit node forwarding", err, "action", action)
+		} else {
+			r.serving = msg.Current.ExitNode
+		}
+	}
+
+	if r.name == "" {
+		return false
+	}
+	var chosen *infra.Peer
+	for _, peer := range msg.ComputedPeers {
+		if r.selected(peer) {
+			chosen = peer
+			break
+		}
+	}
+
+	if chosen == nil && !r.missing {
+		r.logger.Warn("exit node not available: not advertised or not allowed by policy", "exitNode", r.name)
+	}
+	r.missing = chosen == nil
+
+	switch {
+	case chosen != nil && chosen.AppID == r.active:
+	case chosen == nil && r.active == "":
+	default:
+		if r.active != "" {
+			if err := r.provisioner.ApplyExitNode("delete", r.provisioner.GetIfaceName(), nil); err != nil {
+				r.logger.Error("failed to remove exit node routing", err)
+			}
+			r.logger.Info("stopped routing through exit node, internet traffic uses the local network again", "appId", r.active)
+			r.active = ""
+		}
+		if chosen == nil {
+			break
+		}
+		if err := r.provisioner.ApplyExitNode("add", r.provisioner.GetIfaceName(), r.bypass(msg)); err != nil {
+			r.logger.Error("failed to route through exit node", err, "exitNode", r.name)
+			break
+		}
+		r.active = chosen.AppID
+		r.logger.Info("routing internet traffic through exit node", "name", chosen.Name, "appId", chosen.AppID)
+	}
+	return r.active != ""
+}
+
+// bypass resolves the hosts of the control plane and relay endpoints.
+// Lookups happen before the default route moves into the tunnel.
+func (r *exitNodeRouter) bypass(msg *infra.Message) []string {
+	endpoints := append([]string{}, r.endpoints...)
+	if msg.Current != nil {
+		endpoints = append(endpoints, msg.Current.WrrpUrl)
+	}
+
+	var addrs []string
+	seen := make(map[string]struct{})
+	for _, endpoint := range endpoints {
+		// NATS accepts a comma-separated server list.
+		for _, e := range strings.Split(endpoint, ",") {
+			host := endpointHost(e)
+			if host == "" {
+				continue
+			}
+			ips, err := net.LookupIP(host)
+			if err != nil {
+				r.logger.Warn("cannot resolve endpoint to keep outside the exit node", "host", host, "err", err)
+				continue
+			}
+			for _, ip := range ips {
+				if _, ok := seen[ip.String()]; !ok {
+					seen[ip.String()] = struct{}{}
+					addrs = append(addrs, ip.String())
+				}
+			}
+		}
+	}
+	return addrs
+}
+
+// endpointHost returns the host of a URL ("nats://host:4222") or of an
+// address ("host:6266").
+func endpointHost(endpoint string) string {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return ""
+	}
+	if strings.Contains(endpoint, "://") {
+		if u, err := url.Parse(endpoint); err == nil {
+			return u.Hostname()
+		}
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(endpoint); err == nil {
+		return host
+	}
+	return endpoint
+}
@@ -0,0 +1,98 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"wireflow/internal/infra"
+)
+
+// fakeProvisioner records what the node programs. Routes are widened the
+// way the host provisioners do, so tests see which routes peers share.
+// Methods a test does not expect panic through the nil embedded interface.
+type fakeProvisioner struct {
+	infra.Provisioner
+
+	mu      sync.Mutex
+	routes  []string
+	removed []string
+	mtu     int
+	stats   *infra.DeviceStats
+	// keys are the private keys set up on the device; setupFailures fail
+	// that many SetupInterface calls first.
+	keys          []string
+	setupFailures int
+}
+
+func (p *fakeProvisioner) SetupInterface(conf *infra.DeviceConfig) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.setupFailures > 0 {
+		p.setupFailures--
+		return errors.New("device busy")
+	}
+	p.keys = append(p.keys, conf.PrivateKey)
+	return nil
+}
+
+func (p *fakeProvisioner) ApplyRoute(action, address, name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cidr := infra.GetCidrFromIP(address)
+	switch action {
+	case "add":
+		if !slices.Contains(p.routes, cidr) {
+			p.routes = append(p.routes, cidr)
+		}
+	case "delete":
+		p.routes = slices.DeleteFunc(p.routes, func(r string) bool { return r == cidr })
+	}
+	return nil
+}
+
+func (p *fakeProvisioner) RemovePeer(peer *infra.SetPeer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removed = append(p.removed, peer.PublicKey)
+	return nil
+}
+
+func (p *fakeProvisioner) GetIfaceName() string {
+	return "wf0"
+}
+
+func (p *fakeProvisioner) SetMTU(name string, mtu int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mtu = mtu
+	return nil
+}
+
+func (p *fakeProvisioner) DeviceStats() (*infra.DeviceStats, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stats == nil {
+		return &infra.DeviceStats{}, nil
+	}
+	return p.stats, nil
+}
+
+func (p *fakeProvisioner) hasRoute(cidr string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Contains(p.routes, cidr)
+}
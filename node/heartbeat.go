@@ -17,32 +17,40 @@ package node
 import (
 	"context"
 	"encoding/json"
+	"sync"
 	"time"
-	"wireflow/internal/config"
+	"wireflow/internal/infra"
 	"wireflow/internal/log"
+	"wireflow/management/dto"
 )
 
 const heartbeatInterval = 30 * time.Second
 const heartbeatTimeout = 5 * time.Second
 
-type heartbeatPayload struct {
-	AppID string `json:"appId"`
-}
+// heartbeatSettle collects the connections that come up together, after a
+// network change, into one early heartbeat.
+const heartbeatSettle = time.Second
 
 // StartHeartbeat sends a periodic heartbeat to the management server via NATS
-// so the server can track the node's online status.
-// It runs until ctx is cancelled and is safe to run in a goroutine.
+// so the server can track the node's online status. Each heartbeat carries
+// the state of the tunnel to every remote peer, from which the server
+// derives whether the node's tunnels are actually up.
+// It runs until ctx is cancelled or the node stops, and is safe to run in a
+// goroutine.
 func (c *Node) StartHeartbeat(ctx context.Context) {
-	logger := log.GetLogger("heartbeat")
-	appId := config.Conf.AppId
-
-	data, err := json.Marshal(heartbeatPayload{AppID: appId})
-	if err != nil {
-		logger.Error("marshal heartbeat payload failed", err)
+	ctx, done := c.heartbeatRun.start(ctx)
+	if ctx == nil {
 		return
 	}
+	defer done()
+	logger := log.GetLogger("heartbeat")
 
 	send := func() {
+		data, err := json.Marshal(c.heartbeat())
+		if err != nil {
+			logger.Error("marshal heartbeat payload failed", err)
+			return
+		}
 		hbCtx, cancel := context.WithTimeout(ctx, heartbeatTimeout)
 		defer cancel()
 		if _, err := c.ctrClient.RequestNats(hbCtx, "wireflow.signals.peer", "heartbeat", data); err != nil {
@@ -56,12 +64,87 @@ func (c *Node) StartHeartbeat(ctx context.Context) {
 	ticker := time.NewTicker(heartbeatInterval)
 	defer ticker.Stop()
 
+	var early <-chan time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
 			send()
+		case <-c.heartbeatNow:
+			if early == nil {
+				early = time.After(heartbeatSettle)
+			}
+		case <-early:
+			early = nil
+			send()
 		}
 	}
 }
+
+// heartbeatRun tracks the running StartHeartbeat.
+type heartbeatRun struct {
+	mu      sync.Mutex
+	stopped bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// start derives the context of a heartbeat loop and returns the function the
+// loop calls when it returns. It returns a nil context once stop was called.
+func (h *heartbeatRun) start(ctx context.Context) (context.Context, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped {
+		return nil, nil
+	}
+	ctx, h.cancel = context.WithCancel(ctx)
+	done := make(chan struct{})
+	h.done = done
+	return ctx, func() { close(done) }
+}
+
+// stop cancels the heartbeat loop and waits until it returned, so that no
+// heartbeat is in flight afterwards. A loop started later does not run.
+func (h *heartbeatRun) stop() {
+	h.mu.Lock()
+	h.stopped = true
+	cancel, done := h.cancel, h.done
+	h.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// reportNow schedules an early heartbeat. It never blocks.
+func (c *Node) reportNow() {
+	select {
+	case c.heartbeatNow <- struct{}{}:
+	default:
+	}
+}
+
+// heartbeat builds the heartbeat payload from the same view of the peers as
+// the local status API.
+func (c *Node) heartbeat() *dto.HeartbeatDto {
+	status := c.Status()
+	hb := &dto.HeartbeatDto{
+		AppID:       c.appId,
+		Token:       c.token,
+		PublicKey:   status.PublicKey,
+		Connections: make([]infra.PeerConnection, 0, len(status.Peers)),
+	}
+	for _, p := range status.Peers {
+		hb.Connections = append(hb.Connections, infra.PeerConnection{
+			AppID:         p.AppID,
+			Transport:     p.Transport,
+			ICEState:      p.ICEState,
+			Endpoint:      p.Endpoint,
+			LastHandshake: p.LastHandshake,
+			RxBytes:       p.RxBytes,
+			TxBytes:       p.TxBytes,
+		})
+	}
+	return hb
+}
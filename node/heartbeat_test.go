@@ -0,0 +1,51 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatRunStop(t *testing.T) {
+	var h heartbeatRun
+	var running atomic.Bool
+	started := make(chan struct{})
+	go func() {
+		ctx, done := h.start(context.Background())
+		defer done()
+		running.Store(true)
+		close(started)
+		<-ctx.Done()
+		// A heartbeat still in flight finishes before stop returns.
+		time.Sleep(10 * time.Millisecond)
+		running.Store(false)
+	}()
+	<-started
+
+	h.stop()
+	if running.Load() {
+		t.Fatal("stop returned while the heartbeat loop was still running")
+	}
+	if ctx, _ := h.start(context.Background()); ctx != nil {
+		t.Fatal("a heartbeat loop started after stop")
+	}
+	// Stopping twice, or a node whose heartbeat never ran, does not block.
+	h.stop()
+	var idle heartbeatRun
+	idle.stop()
+}
@@ -0,0 +1,117 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"net/netip"
+	"sort"
+	"wireflow/internal/infra"
+	"wireflow/internal/localapi"
+)
+
+var _ localapi.Backend = (*Node)(nil)
+
+// Status reports the node for the local API: its identity, the applied
+// config version and, per remote peer, the probe state merged with the
+// WireGuard device counters.
+func (c *Node) Status() *localapi.Status {
+	status := &localapi.Status{
+		Interface: c.Name,
+		Offline:   c.offline.Load(),
+		Firewall:  c.provisioner.Name(),
+		Peers:     make([]localapi.Peer, 0),
+	}
+	if c.current != nil {
+		status.AppID = c.current.AppID
+		status.NetworkID = c.current.NetworkId
+	}
+	if msg := c.netmap.Last(); msg != nil {
+		status.ConfigVersion = msg.ConfigVersion
+		if msg.Current != nil {
+			status.Name = msg.Current.Name
+			if msg.Current.Address != nil {
+				status.Address = *msg.Current.Address
+			}
+		}
+	}
+	if c.manager.keyManager != nil {
+		status.PublicKey = c.manager.keyManager.GetPublicKey().String()
+	}
+
+	device, err := c.provisioner.DeviceStats()
+	if err != nil {
+		c.logger.Warn("local API: cannot read device stats", "err", err)
+		device = &infra.DeviceStats{}
+	}
+	status.ListenPort = device.ListenPort
+
+	probes := c.probeFactory.States()
+	for _, p := range c.manager.peerManager.GetAll() {
+		if p.PublicKey == status.PublicKey || (c.current != nil && p.AppID == c.current.AppID) {
+			continue
+		}
+		peer := localapi.Peer{
+			Name:       p.Name,
+			AppID:      p.AppID,
+			PublicKey:  p.PublicKey,
+			AllowedIPs: p.AllowedIPs,
+			ExitNode:   p.ExitNode,
+			Routes:     p.Routes,
+		}
+		if p.Address != nil {
+			peer.Address = *p.Address
+		}
+		if probe, ok := probes[p.AppID]; ok {
+			peer.ProbeState = probe.State
+			peer.Transport = probe.Transport
+			peer.Endpoint = probe.Endpoint
+			peer.ICEState = probe.ICEState
+		}
+		if stats := device.Peers[p.PublicKey]; stats != nil {
+			// A parked peer of a lazy network has a placeholder endpoint.
+			if stats.Endpoint != "" && !isLazyEndpoint(stats.Endpoint) {
+				peer.Endpoint = stats.Endpoint
+			}
+			peer.LastHandshake = stats.LastHandshake
+			peer.RxBytes = stats.RxBytes
+			peer.TxBytes = stats.TxBytes
+		}
+		status.Peers = append(status.Peers, peer)
+	}
+	sort.Slice(status.Peers, func(i, j int) bool { return status.Peers[i].AppID < status.Peers[j].AppID })
+	return status
+}
+
+// NetMap returns the network map last applied.
+func (c *Node) NetMap() *infra.Message {
+	return c.netmap.Last()
+}
+
+// Rules returns the firewall rules last provisioned and the backend that
+// enforces them.
+func (c *Node) Rules() *localapi.Rules {
+	rules := &localapi.Rules{Backend: c.provisioner.Name()}
+	if c.messageHandler != nil {
+		rules.Applied = c.messageHandler.AppliedRules()
+	}
+	return rules
+}
+
+// isLazyEndpoint reports whether endpoint is the placeholder of a peer that
+// is connected on demand.
+func isLazyEndpoint(endpoint string) bool {
+	addr, err := netip.ParseAddrPort(endpoint)
+	return err == nil && infra.IsLazyFakeAddr(addr.Addr())
+}
@@ -17,13 +17,19 @@ package node
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
+	"time"
 	"wireflow/internal/infra"
 	"wireflow/internal/log"
+	"wireflow/management/transport"
 )
 
 type Handler interface {
 	HandleEvent(ctx context.Context, msg *infra.Message) error
 	ApplyFullConfig(ctx context.Context, msg *infra.Message) error
+	// AppliedRules returns the firewall rules last provisioned, nil before
+	// the first network map with rules.
+	AppliedRules() *infra.FirewallRule
 }
 
 // event handler for wireflow to handle event from management
@@ -31,13 +37,32 @@ type MessageHandler struct {
 	deviceManager infra.NodeInterface
 	logger        *log.Logger
 	provisioner   infra.Provisioner
+	keyManager    infra.KeyManager
+	netmap        *infra.NetworkMapCache
+	exitNode      *exitNodeRouter
+	subnets       *subnetRouter
+	mtu           *mtuTuner
+	iceServers    *transport.ICEServers
+	dns           *overlayDNS
+	probes        *transport.ProbeFactory
+	services      *services
+	applied       atomic.Pointer[infra.FirewallRule]
 }
 
-func NewMessageHandler(e infra.NodeInterface, logger *log.Logger, provisioner infra.Provisioner) *MessageHandler {
+func NewMessageHandler(e infra.NodeInterface, logger *log.Logger, provisioner infra.Provisioner, keyManager infra.KeyManager, netmap *infra.NetworkMapCache, exitNode *exitNodeRouter, mtu *mtuTuner, iceServers *transport.ICEServers, dns *overlayDNS, probes *transport.ProbeFactory, services *services) *MessageHandler {
 	return &MessageHandler{
 		deviceManager: e,
 		logger:        logger,
 		provisioner:   provisioner,
+		keyManager:    keyManager,
+		netmap:        netmap,
+		exitNode:      exitNode,
+		subnets:       newSubnetRouter(log.GetLogger("subnet-router"), provisioner),
+		mtu:           mtu,
+		iceServers:    iceServers,
+		dns:           dns,
+		probes:        probes,
+		services:      services,
 	}
 }
 
@@ -54,6 +79,9 @@ func (h *MessageHandler) HandleEvent(ctx context.Context, msg *infra.Message) er
 		"version", msg.ConfigVersion,
 		"incremental", msg.Changes != nil)
 
+	// 连接模式需在处理新增 peer 之前确定
+	h.applyConnectionMode(msg)
+
 	// 2. 增量处理逻辑 (Fast Path)
 	// 只有当 Changes 不为 nil 且确实有变化时，才执行精细化的设备操作
 	if msg.Changes != nil && msg.Changes.HasChanges() {
@@ -76,10 +104,13 @@ func (h *MessageHandler) HandleEvent(ctx context.Context, msg *infra.Message) er
 			}
 		}
 
-		// --- 密钥变更（预留逻辑） ---
+		// --- 密钥变更 ---
+		// 控制面要求轮换的是当前公钥时才执行；轮换完成前推送的旧消息会带着已被替换的公钥，直接忽略
 		if msg.Changes.KeyChanged {
-			h.logger.Info("WireGuard key rotation detected", "pub_key", msg.Current.PublicKey)
-			// 这里可以触发本地密钥重生成或更新逻辑
+			if err := h.rotateKey(ctx, msg); err != nil {
+				// 轮换失败不影响本次配置下发，控制面保持 Pending，下一次推送会重试
+				h.logger.Error("failed to rotate WireGuard key", err)
+			}
 		}
 
 		// --- Peer 新增 ---
@@ -90,7 +121,7 @@ func (h *MessageHandler) HandleEvent(ctx context.Context, msg *infra.Message) er
 					continue
 				}
 				h.logger.Debug("adding peer", "peer_id", peer.PeerID, "endpoint", peer.Endpoint)
-				if err := h.deviceManager.AddPeer(peer); err != nil {
+				if err := h.deviceManager.AddPeer(h.exitNode.peer(peer)); err != nil {
 					// 记录错误但不中断，尝试处理后续 Peer
 					h.logger.Error("failed to add peer", err, "peer_id", peer.PeerID)
 				}
@@ -145,33 +176,163 @@ func (h *MessageHandler) ApplyFullConfig(ctx context.Context, msg *infra.Message
 	}
 
 	//设置Peers
+	h.applyConnectionMode(msg)
 	if err = h.applyRemotePeers(ctx, msg); err != nil {
 		h.logger.Error("failed to sync remote peers", err)
 		return err
 	}
 
-	if err = h.applyFirewallRules(ctx, msg); err != nil {
+	// 快照即期望状态：移除不再下发的 peer（策略撤销、错过的增量消息、NATS 重连期间的变更）。
+	// 空消息（ConfigMap 尚未创建）不代表期望状态，跳过。
+	if msg.Current != nil {
+		h.removeStalePeers(msg)
+	}
+
+	// 出口节点：路由切换需在防火墙规则之前确定，出站放行依赖其结果
+	internetEgress := h.exitNode.reconcile(msg)
+	h.subnets.reconcile(msg)
+	h.mtu.reconcile(msg)
+	h.applyICEServers(msg)
+	h.dns.reconcile(msg)
+	h.services.reconcile(msg)
+
+	if err = h.applyFirewallRules(ctx, msg, internetEgress); err != nil {
 		h.logger.Error("failed to apply firewall rules", err)
 		return err
 	}
 
+	// 缓存最后一次成功应用的快照，控制面不可达时据此启动数据面。
+	if msg.Current != nil {
+		if err = h.netmap.Save(msg); err != nil {
+			h.logger.Warn("failed to cache network map", "err", err)
+		}
+	}
+
 	h.logger.Debug("full config reconciled", "version", msg.ConfigVersion)
 	return nil
 }
 
+// applyICEServers switches to the STUN/TURN servers of the network, or back
+// to the configured ones when it names none. Connections already established
+// keep their path; probes pick up the servers when they next (re)start.
+func (h *MessageHandler) applyICEServers(msg *infra.Message) {
+	if msg.Current == nil {
+		return
+	}
+	var servers []infra.ICEServer
+	if msg.Network != nil {
+		servers = msg.Network.ICEServers
+	}
+	changed, err := h.iceServers.Set(servers)
+	if err != nil {
+		h.logger.Warn("ignoring invalid ICE servers of the network", "err", err)
+	}
+	if changed {
+		h.logger.Info("ICE servers updated", "servers", h.iceServers.String())
+	}
+}
+
+// applyConnectionMode switches between connecting to every peer right away
+// and connecting on demand, as the network asks.
+func (h *MessageHandler) applyConnectionMode(msg *infra.Message) {
+	if msg.Current == nil || h.probes == nil {
+		return
+	}
+	var (
+		lazy        bool
+		idleTimeout time.Duration
+	)
+	if msg.Network != nil && msg.Network.Lazy != nil {
+		lazy = true
+		idleTimeout = time.Duration(msg.Network.Lazy.IdleTimeout) * time.Second
+	}
+	if h.probes.SetLazy(lazy, idleTimeout) {
+		h.logger.Info("connection mode changed", "lazy", lazy, "idleTimeout", idleTimeout)
+	}
+}
+
+func (h *MessageHandler) rotateKey(ctx context.Context, msg *infra.Message) error {
+	if h.keyManager == nil || msg.Current.PublicKey != h.keyManager.GetPublicKey().String() {
+		return nil
+	}
+	h.logger.Info("WireGuard key rotation requested", "pub_key", msg.Current.PublicKey)
+	return h.deviceManager.RotateKey(ctx)
+}
+
 func (h *MessageHandler) applyRemotePeers(ctx context.Context, msg *infra.Message) error {
 	for _, peer := range msg.ComputedPeers {
 		// add peer to peers cached and probe start
-		if err := h.deviceManager.AddPeer(peer); err != nil {
+		if err := h.deviceManager.AddPeer(h.exitNode.peer(peer)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (h *MessageHandler) applyFirewallRules(ctx context.Context, msg *infra.Message) error {
+// removeStalePeers diffs the desired peers of a full snapshot against what the
+// node knows about and what is configured on the WireGuard device, and tears
+// down everything that is no longer wanted. Failures are logged rather than
+// returned so that one stubborn peer does not block the rest of the config.
+func (h *MessageHandler) removeStalePeers(msg *infra.Message) {
+	now := time.Now().Unix()
+	desired := make(map[string]struct{}, len(msg.ComputedPeers))
+	desiredKeys := make(map[string]struct{}, len(msg.ComputedPeers))
+	for _, peer := range msg.ComputedPeers {
+		desired[peer.AppID] = struct{}{}
+		desiredKeys[peer.PublicKey] = struct{}{}
+		// A rotated key stays on the device until its grace window ends.
+		if peer.PreviousPublicKey != "" && peer.PreviousKeyExpiresAt > now {
+			desiredKeys[peer.PreviousPublicKey] = struct{}{}
+		}
+	}
+
+	for _, peer := range h.deviceManager.ListPeers() {
+		if peer.AppID == msg.Current.AppID {
+			continue
+		}
+		if _, ok := desired[peer.AppID]; ok {
+			continue
+		}
+		h.logger.Info("removing stale peer", "appId", peer.AppID, "peer_id", peer.PeerID)
+		if err := h.deviceManager.RemovePeer(peer); err != nil {
+			h.logger.Error("failed to remove stale peer", err, "appId", peer.AppID)
+		}
+	}
+
+	// The device may still hold entries the peer table has lost track of,
+	// e.g. after a probe was torn down mid-handshake.
+	keys, err := h.provisioner.PeerKeys()
+	if err != nil {
+		h.logger.Error("failed to list WireGuard peers", err)
+		return
+	}
+	for _, key := range keys {
+		if _, ok := desiredKeys[key]; ok {
+			continue
+		}
+		h.logger.Info("removing stale WireGuard peer", "pub_key", key)
+		if err = h.provisioner.RemovePeer(&infra.SetPeer{
+			Remove:    true,
+			PublicKey: key,
+		}); err != nil {
+			h.logger.Error("failed to remove stale WireGuard peer", err, "pub_key", key)
+		}
+	}
+}
+
+func (h *MessageHandler) applyFirewallRules(ctx context.Context, msg *infra.Message, internetEgress bool) error {
 	if msg.ComputedRules == nil {
 		return nil
 	}
-	return h.provisioner.Provision(msg.ComputedRules)
+	rule := *msg.ComputedRules
+	rule.InternetEgress = internetEgress
+	if err := h.provisioner.Provision(&rule); err != nil {
+		return err
+	}
+	h.applied.Store(&rule)
+	return nil
+}
+
+func (h *MessageHandler) AppliedRules() *infra.FirewallRule {
+	return h.applied.Load()
 }
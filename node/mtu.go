@@ -0,0 +1,223 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/netip"
+	"sync"
+	"time"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+	"wireflow/management/transport"
+)
+
+// pmtuProbes is how many echo requests a probe size gets before it counts as
+// not getting through.
+const pmtuProbes = 2
+
+// mtuTuner keeps the interface MTU at the value the network asks for,
+// lowered by the framing of the relays a peer is, or may fall back to being,
+// reached through. With path MTU discovery
+// it also probes every peer once its transport is up and lowers the MTU to
+// the largest packet that still reached the peer without fragmentation.
+//
+// The interface MTU caps the probes, so a lowered MTU is only raised again
+// when the network changes it or the constraining peer reconnects.
+type mtuTuner struct {
+	logger      *log.Logger
+	provisioner infra.Provisioner
+	discover    bool
+	transports  transports
+
+	mu         sync.Mutex
+	configured int
+	applied    int
+	// paths holds the path MTU probed for peers that need less than the
+	// interface MTU, keyed by app id.
+	paths   map[string]int
+	probing map[string]bool
+}
+
+// transports reports the transport of every peer and the paths it may
+// switch to; *transport.ProbeFactory implements it.
+type transports interface {
+	States() map[string]transport.ProbeState
+	Paths(appId string) []transport.Path
+}
+
+func newMTUTuner(logger *log.Logger, provisioner infra.Provisioner, discover bool, transports transports) *mtuTuner {
+	return &mtuTuner{
+		logger:      logger,
+		provisioner: provisioner,
+		discover:    discover,
+		transports:  transports,
+		configured:  infra.DefaultMTU,
+		applied:     infra.DefaultMTU,
+		paths:       make(map[string]int),
+		probing:     make(map[string]bool),
+	}
+}
+
+// reconcile applies the MTU of msg and forgets probes of peers that left.
+func (t *mtuTuner) reconcile(msg *infra.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	configured := infra.DefaultMTU
+	if msg.Network != nil && msg.Network.Mtu != 0 {
+		if msg.Network.Mtu < infra.MinMTU {
+			t.logger.Warn("ignoring network MTU below the minimum", "mtu", msg.Network.Mtu, "min", infra.MinMTU)
+		} else {
+			configured = msg.Network.Mtu
+		}
+	}
+	if configured != t.configured {
+		t.logger.Info("network MTU changed", "from", t.configured, "to", configured)
+		t.configured = configured
+	}
+
+	present := make(map[string]struct{}, len(msg.ComputedPeers))
+	for _, peer := range msg.ComputedPeers {
+		present[peer.AppID] = struct{}{}
+	}
+	for appId := range t.paths {
+		if _, ok := present[appId]; !ok {
+			delete(t.paths, appId)
+		}
+	}
+	t.apply()
+}
+
+// onConnected runs when the transport to peer is established or replaced.
+// The previous probe of the peer no longer holds, so it is dropped and the
+// new path probed.
+func (t *mtuTuner) onConnected(peer *infra.Peer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.paths, peer.AppID)
+	t.apply()
+
+	if !t.discover || peer.Address == nil || t.probing[peer.AppID] {
+		return
+	}
+	t.probing[peer.AppID] = true
+	go t.probe(peer.AppID, *peer.Address)
+}
+
+// apply sets the interface MTU the configuration, the transports and the
+// probes call for; t.mu must be held. Every path a peer has counts, not only
+// the one in use: the probes switch paths without asking the tuner, and
+// packets sized for a direct path would not fit the relay it falls back to.
+func (t *mtuTuner) apply() {
+	overhead := 0
+	for appId, state := range t.transports.States() {
+		overhead = max(overhead, transportOverhead(state.Transport))
+		for _, path := range t.transports.Paths(appId) {
+			overhead = max(overhead, transportOverhead(path.Transport))
+		}
+	}
+	mtu := t.configured - overhead
+	for _, limit := range t.paths {
+		mtu = min(mtu, limit)
+	}
+	mtu = max(mtu, infra.MinMTU)
+	if mtu == t.applied {
+		return
+	}
+	if err := t.provisioner.SetMTU(t.provisioner.GetIfaceName(), mtu); err != nil {
+		t.logger.Error("failed to set interface MTU", err, "mtu", mtu)
+		return
+	}
+	t.logger.Info("interface MTU updated", "from", t.applied, "to", mtu)
+	t.applied = mtu
+}
+
+// transportOverhead is the framing a transport adds to every packet on top of
+// the UDP path WireGuard assumes.
+func transportOverhead(transport string) int {
+	switch transport {
+	case infra.WRRP.String():
+		return infra.WrrpOverhead
+	case infra.TURN.String():
+		return infra.TurnOverhead
+	}
+	return 0
+}
+
+// probe searches the largest packet that reaches the peer at addr, between
+// MinMTU and the current interface MTU. Peers that do not answer even the
+// smallest probe, for example because their policy drops ICMP, leave the MTU
+// alone.
+func (t *mtuTuner) probe(appId, addr string) {
+	defer func() {
+		t.mu.Lock()
+		delete(t.probing, appId)
+		t.mu.Unlock()
+	}()
+
+	dst, err := netip.ParseAddr(addr)
+	if err != nil {
+		return
+	}
+	dst = dst.Unmap()
+	conn, err := listenICMP(dst)
+	if err != nil {
+		t.logger.Warn("path MTU discovery unavailable", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	t.mu.Lock()
+	ceiling := t.applied
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	id, seq := rand.N(1<<16), 0
+	reaches := func(size int) bool {
+		for i := 0; i < pmtuProbes; i++ {
+			seq++
+			if _, err := echo(ctx, conn, dst, id, seq, size); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	if reaches(ceiling) {
+		return
+	}
+	if !reaches(infra.MinMTU) {
+		t.logger.Debug("path MTU probe got no reply, leaving the MTU alone", "appId", appId)
+		return
+	}
+	low, high := infra.MinMTU, ceiling
+	for high-low > 8 && ctx.Err() == nil {
+		mid := (low + high) / 2
+		if reaches(mid) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	t.logger.Info("path to peer drops full-size packets", "appId", appId, "interfaceMtu", ceiling, "pathMtu", low)
+	t.mu.Lock()
+	t.paths[appId] = low
+	t.apply()
+	t.mu.Unlock()
+}
@@ -0,0 +1,171 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+	"wireflow/management/transport"
+)
+
+// fakeTransports reports a fixed transport and set of paths per peer.
+type fakeTransports struct {
+	states map[string]transport.ProbeState
+	paths  map[string][]transport.Path
+}
+
+func (f *fakeTransports) States() map[string]transport.ProbeState { return f.states }
+
+func (f *fakeTransports) Paths(appId string) []transport.Path { return f.paths[appId] }
+
+func newTestTuner(transports *fakeTransports) (*mtuTuner, *fakeProvisioner) {
+	provisioner := &fakeProvisioner{}
+	return newMTUTuner(log.GetLogger("mtu"), provisioner, false, transports), provisioner
+}
+
+func TestMTUTunerApply(t *testing.T) {
+	direct := transport.ProbeState{State: "connected", Transport: infra.ICE.String()}
+	tests := []struct {
+		name       string
+		configured int
+		states     map[string]transport.ProbeState
+		paths      map[string][]transport.Path
+		probed     map[string]int
+		want       int
+	}{
+		{
+			name:       "direct peers keep the configured MTU",
+			configured: 1400,
+			states:     map[string]transport.ProbeState{"a": direct},
+			paths:      map[string][]transport.Path{"a": {{Transport: infra.ICE.String()}}},
+			want:       1400,
+		},
+		{
+			name:       "a relayed peer lowers it by the WRRP header",
+			configured: 1400,
+			states: map[string]transport.ProbeState{
+				"a": direct,
+				"b": {State: "connected", Transport: infra.WRRP.String()},
+			},
+			want: 1400 - infra.WrrpOverhead,
+		},
+		{
+			name:       "a TURN path lowers it by the TURN framing",
+			configured: 1400,
+			states:     map[string]transport.ProbeState{"a": {State: "connected", Transport: infra.TURN.String()}},
+			want:       1400 - infra.TurnOverhead,
+		},
+		{
+			name:       "a fallback path counts before it is used",
+			configured: 1400,
+			states:     map[string]transport.ProbeState{"a": direct},
+			paths: map[string][]transport.Path{"a": {
+				{Transport: infra.ICE.String()},
+				{Transport: infra.WRRP.String()},
+			}},
+			want: 1400 - infra.WrrpOverhead,
+		},
+		{
+			name:       "the largest overhead wins",
+			configured: 1400,
+			states: map[string]transport.ProbeState{
+				"a": {State: "connected", Transport: infra.WRRP.String()},
+				"b": {State: "connected", Transport: infra.TURN.String()},
+			},
+			want: 1400 - infra.TurnOverhead,
+		},
+		{
+			name:       "a probed path below the interface MTU lowers it",
+			configured: 1400,
+			states:     map[string]transport.ProbeState{"a": direct},
+			probed:     map[string]int{"a": 1200},
+			want:       1200,
+		},
+		{
+			name:       "never below the minimum",
+			configured: infra.MinMTU,
+			states:     map[string]transport.ProbeState{"a": {State: "connected", Transport: infra.WRRP.String()}},
+			want:       infra.MinMTU,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tuner, provisioner := newTestTuner(&fakeTransports{states: tt.states, paths: tt.paths})
+			tuner.configured = tt.configured
+			for appId, mtu := range tt.probed {
+				tuner.paths[appId] = mtu
+			}
+			tuner.mu.Lock()
+			tuner.apply()
+			tuner.mu.Unlock()
+			if tuner.applied != tt.want {
+				t.Fatalf("applied %d, want %d", tuner.applied, tt.want)
+			}
+			if tt.want != infra.DefaultMTU && provisioner.mtu != tt.want {
+				t.Fatalf("interface MTU %d, want %d", provisioner.mtu, tt.want)
+			}
+		})
+	}
+}
+
+func TestMTUTunerReconcile(t *testing.T) {
+	tuner, provisioner := newTestTuner(&fakeTransports{})
+	peers := []*infra.Peer{{AppID: "a"}, {AppID: "b"}}
+
+	tests := []struct {
+		name string
+		msg  *infra.Message
+		want int
+	}{
+		{
+			name: "the network sets the MTU",
+			msg:  &infra.Message{Network: &infra.Network{Mtu: 1420}, ComputedPeers: peers},
+			want: 1420,
+		},
+		{
+			name: "an MTU below the minimum is ignored",
+			msg:  &infra.Message{Network: &infra.Network{Mtu: 100}, ComputedPeers: peers},
+			want: infra.DefaultMTU,
+		},
+		{
+			name: "no network MTU restores the default",
+			msg:  &infra.Message{ComputedPeers: peers},
+			want: infra.DefaultMTU,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tuner.reconcile(tt.msg)
+			if tuner.applied != tt.want || provisioner.mtu != tt.want {
+				t.Fatalf("applied %d, interface %d, want %d", tuner.applied, provisioner.mtu, tt.want)
+			}
+		})
+	}
+
+	// The probe of a peer that leaves no longer limits the MTU.
+	tuner.paths["b"] = 1000
+	tuner.reconcile(&infra.Message{Network: &infra.Network{Mtu: 1400}, ComputedPeers: peers})
+	if tuner.applied != 1000 {
+		t.Fatalf("applied %d with a probed peer, want 1000", tuner.applied)
+	}
+	tuner.reconcile(&infra.Message{Network: &infra.Network{Mtu: 1400}, ComputedPeers: peers[:1]})
+	if tuner.applied != 1400 {
+		t.Fatalf("applied %d after the probed peer left, want 1400", tuner.applied)
+	}
+	if _, ok := tuner.paths["b"]; ok {
+		t.Fatal("probe of a departed peer kept")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"wireflow/internal/config"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+	"wireflow/internal/netstack"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// checkNetstack rejects the options that need the host network stack.
+func checkNetstack(flags *config.Config) error {
+	switch {
+	case flags.ExitNode != "":
+		return fmt.Errorf("--exit-node is not available with --netstack")
+	case len(flags.AdvertiseRoutes) > 0:
+		return fmt.Errorf("--advertise-routes is not available with --netstack")
+	case flags.EnableDNS:
+		return fmt.Errorf("--enable-dns is not available with --netstack; the proxies resolve peer names")
+	case len(flags.Networks) > 0:
+		return fmt.Errorf("--join is not available with --netstack")
+	case flags.PMTUDiscovery:
+		return fmt.Errorf("--pmtu-discovery is not available with --netstack; the probes need host ICMP sockets")
+	}
+	switch flags.Firewall {
+	case "", "auto", infra.FirewallUserspace:
+		return nil
+	}
+	return fmt.Errorf("--firewall %s is not available with --netstack", flags.Firewall)
+}
+
+// serveNetstack starts the SOCKS5 and HTTP proxies into the overlay and the
+// inbound port forwards of a node running on the userspace stack.
+func (c *Node) serveNetstack(ctx context.Context, g *errgroup.Group, flags *config.Config) error {
+	logger := log.GetLogger("netstack")
+	proxy := &netstack.Proxy{
+		Dial:    c.stack.DialContext,
+		Resolve: c.resolveOverlay,
+		Logger:  logger,
+	}
+
+	listeners := []struct {
+		addr  string
+		serve func(context.Context, net.Listener) error
+	}{
+		{flags.Socks5Listen, proxy.ServeSOCKS5},
+		{flags.HTTPProxyListen, proxy.ServeHTTP},
+	}
+	for _, l := range listeners {
+		if l.addr == "" {
+			continue
+		}
+		ln, err := net.Listen("tcp", l.addr)
+		if err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+		serve := l.serve
+		g.Go(func() error { return serve(ctx, ln) })
+		logger.Info("proxy listening", "addr", ln.Addr())
+	}
+
+	for _, value := range flags.NetstackForwards {
+		port, target, err := netstack.ParseForward(value)
+		if err != nil {
+			return err
+		}
+		ln, err := c.stack.ListenTCP(port)
+		if err != nil {
+			return fmt.Errorf("forward %d: %w", port, err)
+		}
+		var d net.Dialer
+		g.Go(func() error { return netstack.Forward(ctx, ln, d.DialContext, target, logger) })
+		logger.Info("forwarding overlay port", "port", port, "target", target)
+	}
+	return nil
+}
+
+// resolveOverlay resolves host for the proxies. Peer names, bare or inside
+// the network's DNS zone, map to their overlay address; anything else goes
+// to the system resolver.
+func (c *Node) resolveOverlay(ctx context.Context, host string) (netip.Addr, error) {
+	name := strings.ToLower(strings.TrimSuffix(host, "."))
+	if msg := c.netmap.Last(); msg != nil {
+		label := name
+		if msg.Network != nil && msg.Network.DNS != nil && msg.Network.DNS.Domain != "" {
+			label = strings.TrimSuffix(name, "."+msg.Network.DNS.Domain)
+		}
+		if !strings.Contains(label, ".") {
+			peers := msg.ComputedPeers
+			if msg.Current != nil {
+				peers = append([]*infra.Peer{msg.Current}, peers...)
+			}
+			for _, peer := range peers {
+				if peer.Address == nil || (infra.DNSLabel(peer.Name) != label && infra.DNSLabel(peer.AppID) != label) {
+					continue
+				}
+				if addr, err := netip.ParseAddr(*peer.Address); err == nil {
+					return addr, nil
+				}
+			}
+		}
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip4", name)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addrs[0].Unmap(), nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"wireflow/internal/config"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+)
+
+// networkNamePattern restricts network names to what is safe as a directory name.
+var networkNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// ParseNetworkFlag parses a --join value of the form name=token.
+func ParseNetworkFlag(value string) (config.NetworkConfig, error) {
+	name, token, ok := strings.Cut(value, "=")
+	if !ok || name == "" || token == "" {
+		return config.NetworkConfig{}, fmt.Errorf("invalid --join %q, expected name=token", value)
+	}
+	return config.NetworkConfig{Name: name, Token: token}, nil
+}
+
+// networkStateDir is where an additional network keeps its private key,
+// mutation journal and network map cache, apart from those of the primary one.
+func networkStateDir(name string) string {
+	return filepath.Join(config.GetConfigDir(), "networks", name)
+}
+
+// appIDFileName is the file in a network's state directory holding the app id
+// the agent registered with in that network.
+const appIDFileName = "app-id"
+
+// networkAppID returns the app id the agent registers with in the network
+// kept in dir. The server names the peer resource, the presence entry and the
+// heartbeat reports after the app id, so each network gets one of its own,
+// derived from the agent's: two enrollments in the same workspace would
+// otherwise overwrite each other. It is persisted on first use so that the
+// registration survives a later change of the agent's app id.
+func networkAppID(dir, appId, name string) (string, error) {
+	path := filepath.Join(dir, appIDFileName)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("read app id of network %q: %w", name, err)
+	}
+
+	id := name
+	if appId != "" {
+		id = appId + "-" + name
+	}
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(path, []byte(id+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("save app id of network %q: %w", name, err)
+	}
+	return id, nil
+}
+
+// nodeConfigs returns one NodeConfig per network the agent joins: the one of
+// --token first, then every entry of flags.Networks. Each additional network
+// gets its own app id, interface, port and state directory, so it registers as
+// a peer of its own and its routes and firewall rules stay apart. The exit node and
+// advertised routes only apply to the primary network.
+func nodeConfigs(flags *config.Config, logger *log.Logger) ([]*NodeConfig, error) {
+	primary := &NodeConfig{
+		Logger:        logger,
+		Port:          flags.WgPort,
+		InterfaceName: flags.InterfaceName,
+		Token:         flags.Token,
+		ShowLog:       flags.EnableSysLog,
+		Flags:         flags,
+	}
+	cfgs := []*NodeConfig{primary}
+
+	primaryIface := flags.InterfaceName
+	if primaryIface == "" {
+		primaryIface = infra.DefaultInterfaceName
+	}
+	names := make(map[string]bool)
+	ifaces := map[string]bool{primaryIface: true}
+	ports := map[int]bool{flags.WgPort: true}
+	for i, n := range flags.Networks {
+		if !networkNamePattern.MatchString(n.Name) {
+			return nil, fmt.Errorf("network %q: name must be lowercase letters, digits and dashes", n.Name)
+		}
+		if names[n.Name] {
+			return nil, fmt.Errorf("network %q is listed twice", n.Name)
+		}
+		names[n.Name] = true
+		if n.Token == "" {
+			return nil, fmt.Errorf("network %q: token is empty", n.Name)
+		}
+
+		iface := n.InterfaceName
+		if iface == "" {
+			iface = fmt.Sprintf("wf%d", i+1)
+		}
+		port := n.WgPort
+		if port == 0 {
+			port = flags.WgPort + i + 1
+		}
+		if ifaces[iface] {
+			return nil, fmt.Errorf("network %q: interface %s is already in use", n.Name, iface)
+		}
+		if ports[port] {
+			return nil, fmt.Errorf("network %q: port %d is already in use", n.Name, port)
+		}
+		ifaces[iface], ports[port] = true, true
+
+		stateDir := networkStateDir(n.Name)
+		appId, err := networkAppID(stateDir, flags.AppId, n.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		netFlags := *flags
+		netFlags.AppId = appId
+		netFlags.Token = n.Token
+		netFlags.InterfaceName = iface
+		netFlags.WgPort = port
+		netFlags.ExitNode = ""
+		netFlags.AdvertiseRoutes = nil
+		netFlags.Networks = nil
+		cfgs = append(cfgs, &NodeConfig{
+			Logger:        &log.Logger{Logger: logger.With("network", n.Name)},
+			Port:          port,
+			InterfaceName: iface,
+			Token:         n.Token,
+			AppID:         appId,
+			Network:       n.Name,
+			ShowLog:       flags.EnableSysLog,
+			StateDir:      stateDir,
+			Flags:         &netFlags,
+		})
+	}
+	return cfgs, nil
+}
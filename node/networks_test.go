@@ -0,0 +1,100 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"path/filepath"
+	"testing"
+	"wireflow/internal/config"
+	"wireflow/internal/log"
+)
+
+func TestNodeConfigs(t *testing.T) {
+	t.Setenv("WIREFLOW_CONFIG_DIR", t.TempDir())
+	logger := log.GetLogger("node-test")
+	flags := &config.Config{
+		AppId:           "laptop",
+		WgPort:          51820,
+		Token:           "primary-token",
+		ExitNode:        "gateway",
+		AdvertiseRoutes: []string{"192.168.1.0/24"},
+		Networks: []config.NetworkConfig{
+			{Name: "office", Token: "office-token"},
+			{Name: "lab", Token: "lab-token", InterfaceName: "wflab", WgPort: 52000},
+		},
+	}
+
+	cfgs, err := nodeConfigs(flags, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfgs) != 3 {
+		t.Fatalf("got %d configs, want 3", len(cfgs))
+	}
+	if cfgs[0].Token != "primary-token" || cfgs[0].AppID != "" || cfgs[0].Network != "" || cfgs[0].StateDir != "" {
+		t.Fatalf("unexpected primary config %+v", cfgs[0])
+	}
+	want := []struct {
+		appId, iface string
+		port         int
+	}{
+		{"laptop-office", "wf1", 51821},
+		{"laptop-lab", "wflab", 52000},
+	}
+	for i, w := range want {
+		cfg := cfgs[i+1]
+		name := flags.Networks[i].Name
+		if cfg.Network != name {
+			t.Errorf("network %s: named %q", name, cfg.Network)
+		}
+		if cfg.AppID != w.appId || cfg.Flags.AppId != w.appId {
+			t.Errorf("network %s: app id %q, want %q", name, cfg.AppID, w.appId)
+		}
+		if cfg.InterfaceName != w.iface || cfg.Port != w.port {
+			t.Errorf("network %s: interface %s port %d, want %s %d", name, cfg.InterfaceName, cfg.Port, w.iface, w.port)
+		}
+		if cfg.StateDir != filepath.Join(config.GetConfigDir(), "networks", name) {
+			t.Errorf("network %s: state dir %s", name, cfg.StateDir)
+		}
+		if cfg.Flags.ExitNode != "" || cfg.Flags.AdvertiseRoutes != nil {
+			t.Errorf("network %s inherits the exit node or routes of the primary one", name)
+		}
+	}
+
+	// The app id of a network is kept when the agent's own changes.
+	renamed := *flags
+	renamed.AppId = "workstation"
+	cfgs, err = nodeConfigs(&renamed, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfgs[1].AppID != "laptop-office" {
+		t.Fatalf("app id changed to %q", cfgs[1].AppID)
+	}
+
+	for _, networks := range [][]config.NetworkConfig{
+		{{Name: "Office", Token: "t"}},
+		{{Name: "office", Token: "t"}, {Name: "office", Token: "t"}},
+		{{Name: "office"}},
+		{{Name: "office", Token: "t", InterfaceName: "wf0"}},
+		{{Name: "office", Token: "t", WgPort: 51820}},
+	} {
+		bad := *flags
+		bad.Networks = networks
+		if _, err = nodeConfigs(&bad, logger); err == nil {
+			t.Errorf("expected networks %+v to be rejected", networks)
+		}
+	}
+}
@@ -21,15 +21,19 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 	"wireflow/internal"
 	"wireflow/internal/config"
 	"wireflow/internal/infra"
 	"wireflow/internal/log"
+	"wireflow/internal/netstack"
 	ctrclient "wireflow/management/client"
 	"wireflow/management/nats"
 	"wireflow/management/transport"
-	"wireflow/pkg/utils"
 	"wireflow/wrrper"
 
 	wg "golang.zx2c4.com/wireguard/device"
@@ -50,7 +54,7 @@ type Node struct {
 	iface       *wg.Device
 	bind        *infra.DefaultBind
 	provisioner infra.Provisioner
-	natsService infra.SignalService
+	natsService *nats.NatsSignalService
 
 	// GetNetworkMap is set externally after NewAgent returns and before Start
 	// is called. It fetches the current network topology from the control plane.
@@ -67,10 +71,49 @@ type Node struct {
 	current    *infra.Peer
 	wrrpClient infra.Wrrp
 
+	appId          string
 	token          string
 	callback       func(message *infra.Message) error // nolint
 	messageHandler Handler
 
+	// keyPath is where the WireGuard private key is persisted; rotating guards
+	// against a second rotation starting while one is in flight.
+	keyPath  string
+	rotating atomic.Bool
+
+	// netmap caches the last applied network map. offline is set while the
+	// node runs from that cache because the control plane could not be reached.
+	netmap  *infra.NetworkMapCache
+	offline atomic.Bool
+
+	// journal records every route, address and firewall change made on this
+	// host so that Stop can revert them.
+	journal *infra.Journal
+
+	// mtu keeps the interface MTU in line with the network and the paths
+	// to the peers.
+	mtu *mtuTuner
+	// iceServers are the STUN/TURN servers of new ICE agents.
+	iceServers *transport.ICEServers
+	// relays carries WireGuard traffic of ICE sessions relayed through the
+	// local TURN allocation.
+	relays *infra.RelayConns
+	// dns is the overlay DNS, nil unless --enable-dns is set.
+	dns *overlayDNS
+	// stack is the userspace TCP/IP stack standing in for the TUN device,
+	// nil unless --netstack is set.
+	stack *netstack.Stack
+	// services are the local services exposed on the overlay and the local
+	// ports forwarded to peers through the local API.
+	services services
+	// heartbeatNow asks StartHeartbeat for an early heartbeat, so the server
+	// learns a new path to a peer without waiting for the next tick.
+	heartbeatNow chan struct{}
+	// heartbeatRun lets Stop end StartHeartbeat before the node says goodbye.
+	heartbeatRun heartbeatRun
+	// taps observe the overlay and underlay traffic for packet captures.
+	taps *infra.Taps
+
 	DeviceManager *DeviceManager
 }
 
@@ -82,7 +125,17 @@ type NodeConfig struct {
 	ForceRelay    bool
 	ShowLog       bool
 	Token         string
-	Flags         *config.Config
+	// AppID is the name of the node in its network; empty means the app-id
+	// of the agent configuration.
+	AppID string
+	// Network is the name of an additional network joined with --join;
+	// empty for the primary one.
+	Network string
+	// StateDir holds the private key, mutation journal and network map cache
+	// of the node; empty means the config directory. Each network joined by
+	// the agent has its own.
+	StateDir string
+	Flags    *config.Config
 }
 
 // NewNode constructs and wires a fully operational Node instance.
@@ -91,11 +144,13 @@ type NodeConfig struct {
 //
 // Phase 1 — Network foundation (no business dependencies)
 //
-//	TUN device → UDP sockets → FilteringUDPMux (v4/v6) → NATS signal service
+//	Revert changes left by a previous run → TUN device → UDP sockets → FilteringUDPMux (v4/v6) → NATS signal service
 //
 // Phase 2 — Identity and signaling (depends on phase 1)
 //
-//	Register with control plane → derive PrivateKey → build KeyManager/PeerIdentity
+//	Load (or generate) the local PrivateKey → build KeyManager → register the
+//	PublicKey with the control plane (or fall back to the cached network map
+//	when it is unreachable) → build PeerIdentity
 //	→ create ProbeFactory (Provisioner is nil at this point, wired in phase 3)
 //	→ subscribe NATS topic → wire ControlClient → optional WRRP relay client
 //
@@ -122,15 +177,83 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 	// ── Phase 1: Network foundation ──────────────────────────────────────────
 
 	node = new(Node)
+	node.appId = cfg.AppID
+	if node.appId == "" {
+		node.appId = config.Conf.AppId
+	}
+	stateDir := cfg.StateDir
+	if stateDir == "" {
+		stateDir = config.GetConfigDir()
+	}
 	node.manager.peerManager = infra.NewPeerManager()
 	node.logger = cfg.Logger
 	node.manager.turnManager = new(internal.TurnManager)
+	node.heartbeatNow = make(chan struct{}, 1)
 
-	// TUN device: the OS virtual NIC that serves as WireGuard's L3 ingress/egress.
-	node.Name, iface, err = infra.CreateTUN(infra.DefaultMTU, cfg.Logger)
+	// Mutation journal: an agent that crashed or was killed never reverted its
+	// routes and firewall rules; do it now, before this run adds its own.
+	node.journal, err = infra.OpenJournal(filepath.Join(stateDir, infra.JournalFileName), cfg.Logger)
 	if err != nil {
 		return nil, err
 	}
+	if n := node.journal.Len(); n > 0 {
+		cfg.Logger.Info("reverting host changes left by a previous run", "count", n)
+		if err = node.journal.Undo(); err != nil {
+			return nil, err
+		}
+	}
+
+	// TUN device: the OS virtual NIC that serves as WireGuard's L3 ingress/egress.
+	// In netstack mode a userspace TCP/IP stack takes its place and the host
+	// network is never touched.
+	if cfg.Flags.Netstack {
+		if err = checkNetstack(cfg.Flags); err != nil {
+			return nil, err
+		}
+		node.Name = cfg.InterfaceName
+		if node.Name == "" {
+			node.Name = infra.DefaultInterfaceName
+		}
+		if node.stack, err = netstack.New(node.Name, infra.DefaultMTU); err != nil {
+			return nil, err
+		}
+		iface = node.stack
+	} else {
+		node.Name, iface, err = infra.CreateTUN(cfg.InterfaceName, infra.DefaultMTU, cfg.Logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// With the userspace firewall, policy is enforced on every packet crossing
+	// the TUN device instead of in the host firewall. Netstack mode has no host
+	// firewall to use.
+	var packetFilter *infra.PacketFilter
+	switch cfg.Flags.Firewall {
+	case "", "auto":
+		if node.stack != nil {
+			packetFilter = infra.NewPacketFilter()
+		}
+	case infra.FirewallUserspace:
+		packetFilter = infra.NewPacketFilter()
+	default:
+		return nil, fmt.Errorf("unknown firewall backend %q", cfg.Flags.Firewall)
+	}
+
+	// Captures see what crosses the device and, with the userspace firewall,
+	// the packets it denied.
+	node.taps = infra.NewTaps()
+	if packetFilter != nil {
+		iface = infra.NewFilteredTUN(iface, packetFilter, node.taps)
+	} else {
+		iface = infra.NewTappedTUN(iface, node.taps)
+	}
+
+	// Routing through an exit node moves the default route into the tunnel;
+	// the marked underlay sockets keep using the host's routes.
+	if cfg.Flags.ExitNode != "" {
+		infra.SetSocketMark(infra.ExitNodeMark)
+	}
 
 	// UDP sockets: ICE candidate gathering and WireGuard encapsulated packets
 	// share the same port (default 51820). FilteringUDPMux is the sole reader
@@ -163,8 +286,9 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 	}
 
 	// NATS signal service: exchanges ICE signaling messages (SYN/ACK/Offer/Answer)
-	// with the control plane and remote peers.
-	natsSignalService, err := nats.NewNatsService(ctx, config.Conf.AppId, "client", config.Conf.SignalingURL)
+	// with the control plane and remote peers. An unreachable server is not
+	// fatal: the connection keeps retrying while the node runs from its cache.
+	natsSignalService, err := nats.NewNatsService(ctx, node.appId, "client", config.Conf.SignalingURL, nats.WithRetryOnFailedConnect())
 	if err != nil {
 		return nil, err
 	}
@@ -172,6 +296,19 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 
 	// ── Phase 2: Identity and signaling ──────────────────────────────────────
 
+	// The WireGuard private key is generated on first start and persisted in the
+	// config directory. It never leaves this host: the control plane only ever
+	// learns the derived public key, which Register submits below.
+	node.keyPath = filepath.Join(stateDir, infra.PrivateKeyFileName)
+	privateKey, err = infra.LoadOrCreatePrivateKey(node.keyPath)
+	if err != nil {
+		return nil, err
+	}
+	// KeyManager holds the WireGuard private key and exposes it to the Bind
+	// layer so it can perform AEAD peer matching during the handshake.
+	node.manager.keyManager = infra.NewKeyManager(privateKey)
+	node.netmap = infra.NewNetworkMapCache(filepath.Join(stateDir, infra.NetworkMapFileName), node.manager.keyManager)
+
 	// ControlClient communicates with the management service for registration
 	// and network topology retrieval. GetKeyManager and GetProbeFactory are
 	// closures on the node pointer; they resolve lazily after their targets
@@ -184,25 +321,20 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 		GetProbeFactory: func() *transport.ProbeFactory {
 			return node.probeFactory
 		},
+		AppID:           node.appId,
+		Port:            cfg.Port,
+		AdvertiseRoutes: cfg.Flags.AdvertiseRoutes,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Register announces this node to the control plane and receives back the
-	// assigned WireGuard private key, allocated IP, and WRRP relay URL.
-	node.current, err = node.ctrClient.Register(ctx, cfg.Token, node.Name)
-	if err != nil {
-		return nil, err
-	}
-
-	privateKey, err = utils.ParseKey(node.current.PrivateKey)
+	// Register announces this node and its public key to the control plane and
+	// receives back the allocated IP and WRRP relay URL.
+	node.current, err = node.register(ctx, cfg.Token)
 	if err != nil {
 		return nil, err
 	}
-	// KeyManager holds the WireGuard private key and exposes it to the Bind
-	// layer so it can perform AEAD peer matching during the handshake.
-	node.manager.keyManager = infra.NewKeyManager(privateKey)
 
 	// PeerIdentity is this node's unique signaling identity: AppID + PublicKey.
 	// isInitiator() compares two PeerIdentities numerically to deterministically
@@ -218,12 +350,26 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 	// closures that capture the node pointer: they resolve lazily at call time
 	// so they always see the values assigned in phase 3, without any two-phase
 	// Configure() call.
+	// STUN/TURN servers: those configured on the agent until the network map
+	// brings its own.
+	node.iceServers, err = transport.NewICEServers(cfg.Flags.TurnServerURL)
+	if err != nil {
+		return nil, err
+	}
+	node.relays = infra.NewRelayConns()
+	// onDemand connects the peers of a lazy network when WireGuard first
+	// sends to them.
+	onDemand := infra.NewOnDemand()
 	node.probeFactory = transport.NewProbeFactory(&transport.ProbeFactoryConfig{
 		LocalId:                localIdentity,
 		Signal:                 natsSignalService,
 		PeerManager:            node.manager.peerManager,
 		FilteringMux:  filteringMux,
 		FilteringMux6: filteringMux6,
+		ICEServers:    node.iceServers,
+		Relays:        node.relays,
+		KeyManager:    node.manager.keyManager,
+		OnDemand:      onDemand,
 		ShowLog:                cfg.ShowLog,
 		GetProvisioner: func() infra.Provisioner {
 			return node.provisioner
@@ -237,6 +383,12 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 		GetWrrp: func() infra.Wrrp {
 			return wrrp
 		},
+		OnConnected: func(peer *infra.Peer) {
+			if node.mtu != nil {
+				node.mtu.onConnected(peer)
+			}
+			node.reportNow()
+		},
 	})
 
 	// Subscribe to this node's NATS signaling subject. All incoming ICE and
@@ -282,6 +434,9 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 		V6Conn:          v6conn,
 		WrrpClient:      wrrp,
 		KeyManager:      node.manager.keyManager,
+		Relays:       node.relays,
+		OnDemand:     onDemand,
+		Taps:         node.taps,
 	})
 
 	wgLogLevel := wg.LogLevelError
@@ -295,15 +450,33 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 	// Provisioner abstracts all OS network-stack mutations: IP address assignment,
 	// routing table entries, iptables rules, and WireGuard peer configuration.
 	// It must be created after the WireGuard device because it holds a reference to it.
-	node.provisioner = infra.NewProvisioner(infra.NewRouteProvisioner(cfg.Logger),
-		infra.NewRuleProvisioner(cfg.Logger, node.Name), &infra.Params{
+	var ruleProvisioner infra.RuleProvisioner
+	if packetFilter != nil {
+		ruleProvisioner = infra.NewUserspaceRuleProvisioner(cfg.Logger, packetFilter)
+	} else {
+		ruleProvisioner = infra.NewRuleProvisioner(cfg.Logger, node.Name, cfg.Network, node.journal)
+	}
+	routeProvisioner := infra.NewRouteProvisioner(cfg.Logger, cfg.Network, node.journal)
+	if node.stack != nil {
+		routeProvisioner = netstack.NewRouteProvisioner(cfg.Logger, node.stack)
+	}
+	node.provisioner = infra.NewProvisioner(routeProvisioner,
+		ruleProvisioner, &infra.Params{
 			Device:    node.iface,
 			IfaceName: node.Name,
 		})
 
 	// MessageHandler processes topology change events pushed by the control plane
 	// (peers added/removed, configuration updates) and applies them via Provisioner.
-	node.messageHandler = NewMessageHandler(node, log.GetLogger("event-handler"), node.provisioner)
+	exitNode := newExitNodeRouter(log.GetLogger("exit-node"), node.provisioner, cfg.Flags.ExitNode,
+		cfg.Flags.SignalingURL, cfg.Flags.WrrperURL, cfg.Flags.WrrpQuicURL)
+	node.mtu = newMTUTuner(log.GetLogger("mtu"), node.provisioner, cfg.Flags.PMTUDiscovery, node.probeFactory)
+	node.services.logger = log.GetLogger("services")
+	node.services.userspace = node.stack != nil
+	if cfg.Flags.EnableDNS {
+		node.dns = newOverlayDNS(log.GetLogger("dns"), node.journal, node.Name)
+	}
+	node.messageHandler = NewMessageHandler(node, log.GetLogger("event-handler"), node.provisioner, node.manager.keyManager, node.netmap, exitNode, node.mtu, node.iceServers, node.dns, node.probeFactory, &node.services)
 
 	node.DeviceManager = NewDeviceManager(log.GetLogger("device-manager"), node.iface, make(chan struct{}))
 	node.token = cfg.Token
@@ -312,29 +485,90 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 	// This covers the case where wireflow-aio restarts and loses all node state.
 	// The handler reads GetNetworkMap at call time (not at setup time), so it
 	// works even though GetNetworkMap is assigned externally after NewAgent returns.
+	// With a server that was down at startup this also fires on the first
+	// successful connect, bringing a node that booted from its cache in sync.
 	natsSignalService.SetReconnectedHandler(func() {
-		ctx := context.Background()
-		peer, err := node.ctrClient.Register(ctx, node.token, node.Name)
-		if err != nil {
-			node.logger.Error("NATS reconnect: re-register failed", err)
-			return
+		if err := node.resync(context.Background()); err != nil {
+			node.logger.Error("NATS reconnect: resync failed", err)
 		}
-		node.current = peer
+	})
 
-		if node.GetNetworkMap == nil {
-			return
+	return node, err
+}
+
+// register announces the node to the control plane. When that fails and a
+// previous run cached a network map, the node identity is taken from the
+// cache instead so the data plane can come up during a control-plane outage.
+func (c *Node) register(ctx context.Context, token string) (*infra.Peer, error) {
+	err := fmt.Errorf("signaling server unreachable")
+	if c.natsService.IsConnected() {
+		var peer *infra.Peer
+		if peer, err = c.ctrClient.Register(ctx, token, c.Name); err == nil {
+			return peer, nil
 		}
-		remoteCfg, err := node.GetNetworkMap()
-		if err != nil {
-			node.logger.Error("NATS reconnect: re-fetch network map failed", err)
+	}
+
+	cached, cacheErr := c.netmap.Load()
+	if cacheErr != nil {
+		c.logger.Warn("ignoring cached network map", "err", cacheErr)
+	}
+	if cached == nil || cached.Current == nil {
+		return nil, err
+	}
+	c.logger.Warn("control plane unreachable, starting from cached network map",
+		"err", err, "version", cached.ConfigVersion)
+	c.offline.Store(true)
+	return cached.Current, nil
+}
+
+// resync registers with the control plane again and applies the full network
+// map it returns.
+func (c *Node) resync(ctx context.Context) error {
+	peer, err := c.ctrClient.Register(ctx, c.token, c.Name)
+	if err != nil {
+		return fmt.Errorf("re-register: %w", err)
+	}
+	c.current = peer
+
+	if c.GetNetworkMap == nil {
+		return nil
+	}
+	remoteCfg, err := c.GetNetworkMap()
+	if err != nil {
+		return fmt.Errorf("re-fetch network map: %w", err)
+	}
+	if err = c.messageHandler.ApplyFullConfig(ctx, remoteCfg); err != nil {
+		return fmt.Errorf("re-apply config: %w", err)
+	}
+	if c.offline.CompareAndSwap(true, false) {
+		c.logger.Info("control plane reachable again, network map reconciled", "version", remoteCfg.ConfigVersion)
+	}
+	return nil
+}
+
+// retryControlPlane keeps trying to resync a node that started from its cached
+// network map until it succeeds or ctx is cancelled. While NATS is down the
+// reconnected handler does the work, so attempts are only made when it is up
+// but the management server did not answer.
+func (c *Node) retryControlPlane(ctx context.Context) {
+	backoff := 2 * time.Second
+	for c.offline.Load() {
+		select {
+		case <-ctx.Done():
 			return
+		case <-time.After(backoff):
 		}
-		if err = node.messageHandler.ApplyFullConfig(ctx, remoteCfg); err != nil {
-			node.logger.Error("NATS reconnect: re-apply config failed", err)
+		if backoff < time.Minute {
+			backoff *= 2
 		}
-	})
 
-	return node, err
+		if !c.offline.Load() || !c.natsService.IsConnected() {
+			continue
+		}
+		if err := c.resync(ctx); err != nil {
+			c.logger.Warn("control plane still unreachable", "err", err)
+		}
+	}
 }
 
 // Start brings up the WireGuard data plane and applies the initial network
@@ -342,9 +576,14 @@ func NewNode(ctx context.Context, cfg *NodeConfig) (*Node, error) {
 //
 // Call order:
 //  1. Bring the WireGuard device up (begin sending/receiving UDP packets).
-//  2. Write the WireGuard private key and interface settings to the OS.
-//  3. Fetch the current network topology via GetNetworkMap.
+//  2. Write the locally held WireGuard private key and interface settings.
+//  3. Fetch the current network topology via GetNetworkMap, falling back to
+//     the cached map when the control plane is unreachable.
 //  4. Add all remote peers to WireGuard and establish initial routes.
+//  5. Rotate the key if the control plane asked for it while we were offline.
+//
+// A node started from its cache keeps retrying the control plane in the
+// background and reconciles once it gets through.
 //
 // Must be called after NewAgent returns and after GetNetworkMap has been set.
 func (c *Node) Start(ctx context.Context) error {
@@ -353,24 +592,73 @@ func (c *Node) Start(ctx context.Context) error {
 	}
 
 	if err := c.provisioner.SetupInterface(&infra.DeviceConfig{
-		PrivateKey: c.current.PrivateKey,
+		PrivateKey: c.manager.keyManager.GetKey().String(),
 	}); err != nil {
 		return err
 	}
 
-	remoteCfg, err := c.GetNetworkMap()
+	remoteCfg, err := c.initialNetworkMap()
 	if err != nil {
 		return err
 	}
 
-	return c.messageHandler.ApplyFullConfig(ctx, remoteCfg)
+	if err = c.messageHandler.ApplyFullConfig(ctx, remoteCfg); err != nil {
+		return err
+	}
+
+	if c.offline.Load() {
+		go c.retryControlPlane(ctx)
+		return nil
+	}
+
+	// A rotation requested while the agent was offline is not pushed again, it
+	// is only visible in the snapshot.
+	if remoteCfg.Changes != nil && remoteCfg.Changes.KeyChanged && remoteCfg.Current != nil &&
+		remoteCfg.Current.PublicKey == c.manager.keyManager.GetPublicKey().String() {
+		if err = c.RotateKey(ctx); err != nil {
+			c.logger.Error("failed to rotate WireGuard key", err)
+		}
+	}
+	return nil
+}
+
+// initialNetworkMap returns the network map Start applies: the control plane's
+// when it answers, otherwise the one cached by the last successful apply.
+func (c *Node) initialNetworkMap() (*infra.Message, error) {
+	if !c.offline.Load() {
+		remoteCfg, err := c.GetNetworkMap()
+		if err == nil {
+			return remoteCfg, nil
+		}
+		cached, cacheErr := c.netmap.Load()
+		if cacheErr != nil {
+			c.logger.Warn("ignoring cached network map", "err", cacheErr)
+		}
+		if cached == nil {
+			return nil, err
+		}
+		c.logger.Warn("network map unavailable, starting from cache", "err", err, "version", cached.ConfigVersion)
+		c.offline.Store(true)
+		return cached, nil
+	}
+	return c.netmap.Last(), nil
 }
 
-// Stop gracefully shuts down the Agent. It drains the NATS connection first
+// leaveTimeout bounds how long Stop waits to announce the leave.
+const leaveTimeout = 2 * time.Second
+
+// Stop gracefully shuts down the Agent. It first announces the leave, so the
+// server reports this node offline and peers drop their connections to it
+// without waiting for timeouts. It then drains the NATS connection
 // so the server immediately removes this node's subscriptions, preventing
 // "no responders" errors on peer reconnect attempts. Then it closes the
-// WireGuard device, releasing the TUN interface and UDP sockets.
+// WireGuard device, releasing the TUN interface and UDP sockets, and finally
+// reverts every host change recorded in the journal. The firewall goes last so
+// that the interface is never up without it.
 func (c *Node) Stop() error {
+	// A heartbeat sent after the leave would mark the node online again.
+	c.heartbeatRun.stop()
+	c.announceLeave()
 	if c.wrrpClient != nil {
 		if err := c.wrrpClient.Close(); err != nil {
 			c.logger.Warn("wrrp client close failed", "err", err)
@@ -381,8 +669,30 @@ func (c *Node) Stop() error {
 			c.logger.Warn("nats drain failed", "err", err)
 		}
 	}
+	c.services.close()
 	c.iface.Close()
-	return nil
+	c.dns.close()
+
+	if err := c.provisioner.Cleanup(); err != nil {
+		c.logger.Warn("firewall cleanup failed", "err", err)
+	}
+	return c.journal.Undo()
+}
+
+// announceLeave tells the management server and every known peer that this
+// node is stopping. Both are best effort; the NATS drain in Stop flushes the
+// peer announcements.
+func (c *Node) announceLeave() {
+	ctx, cancel := context.WithTimeout(context.Background(), leaveTimeout)
+	defer cancel()
+	if c.probeFactory != nil {
+		c.probeFactory.AnnounceLeave(ctx)
+	}
+	if c.ctrClient != nil {
+		if err := c.ctrClient.Leave(ctx, c.token); err != nil {
+			c.logger.Debug("leave not acknowledged by server", "err", err)
+		}
+	}
 }
 
 // SetConfig updates the WireGuard device configuration via the kernel IPC
@@ -414,10 +724,26 @@ func (c *Node) close() {
 // then writes the WireGuard peer configuration via ControlClient. If the peer
 // is this node itself (matching public key), the WireGuard write is skipped.
 func (c *Node) AddPeer(peer *infra.Peer) error {
+	if old := c.manager.peerManager.GetPeer(peer.AppID); old != nil && peer.AppID != c.current.AppID {
+		switch {
+		case old.PublicKey != "" && old.PublicKey != peer.PublicKey:
+			c.rekeyPeer(old, peer)
+		case old.PresharedKey != peer.PresharedKey, old.ExitNode != peer.ExitNode,
+			!slices.Equal(old.Routes, peer.Routes):
+			// The probe programs the PSK and AllowedIPs into WireGuard; rebuild
+			// it so they are applied with the rest of the peer entry.
+			c.probeFactory.Remove(peer.AppID)
+			c.deleteRoutes(old.Routes, peer.Routes)
+		}
+	}
 	c.manager.peerManager.AddPeer(peer.AppID, peer)
 	if peer.PublicKey == c.current.PublicKey {
 		return nil
 	}
+	// In a lazy network the peer is connected once traffic asks for it.
+	if c.probeFactory.Lazy() {
+		return c.probeFactory.Park(peer)
+	}
 	return c.ctrClient.AddPeer(peer)
 }
 
@@ -435,17 +761,161 @@ func (c *Node) AddPeer(peer *infra.Peer) error {
 //}
 
 // RemovePeer evicts a remote peer from the local node. It closes and removes
-// the associated Probe (stopping reconnection attempts), then deletes the
-// WireGuard peer configuration. A new Probe will be created automatically
-// when the control plane pushes a PeersAdded event for this peer again.
+// the associated Probe (stopping reconnection attempts), forgets the peer,
+// deletes its subnet routes and finally the WireGuard peer configuration. A
+// new Probe will be created automatically when the control plane hands this
+// peer out again.
 func (c *Node) RemovePeer(peer *infra.Peer) error {
 	c.probeFactory.Remove(peer.AppID)
+
+	// The overlay address needs no route of its own: ApplyRoute widens it to
+	// the overlay subnet, which is shared by every peer on the interface.
+	if known := c.manager.peerManager.GetPeer(peer.AppID); known != nil {
+		c.deleteRoutes(known.Routes, nil)
+		c.manager.peerManager.RemovePeer(peer.AppID)
+	}
+
 	return c.provisioner.RemovePeer(&infra.SetPeer{
 		Remove:    true,
 		PublicKey: peer.PublicKey,
 	})
 }
 
+// deleteRoutes removes the subnet routes in routes that are not in keep.
+func (c *Node) deleteRoutes(routes, keep []string) {
+	for _, route := range routes {
+		if slices.Contains(keep, route) {
+			continue
+		}
+		if err := c.provisioner.ApplyRoute("delete", route, c.Name); err != nil {
+			c.logger.Warn("failed to delete subnet route", "route", route, "err", err)
+		}
+	}
+}
+
+func (c *Node) ListPeers() []*infra.Peer {
+	return c.manager.peerManager.GetAll()
+}
+
+// rekeyPeer handles a remote peer that has rotated its key. The probe built
+// for the old identity is dropped so AddPeer creates one for the new key. The
+// WireGuard entry of the old key stays on the device for as long as the
+// network accepts it (PreviousKeyExpiresAt), so the remote side can still
+// complete a handshake it began under the old key; removeStalePeers drops it
+// with the first full snapshot after the window ends. An old key the control
+// plane no longer vouches for is removed at once.
+func (c *Node) rekeyPeer(old, peer *infra.Peer) {
+	c.logger.Info("remote peer rotated its key", "appId", peer.AppID, "old", old.PublicKey, "new", peer.PublicKey)
+	c.probeFactory.Remove(peer.AppID)
+	if peer.PreviousPublicKey == old.PublicKey && peer.PreviousKeyExpiresAt > time.Now().Unix() {
+		return
+	}
+	if err := c.provisioner.RemovePeer(&infra.SetPeer{
+		Remove:    true,
+		PublicKey: old.PublicKey,
+	}); err != nil {
+		c.logger.Warn("failed to remove rotated peer key", "appId", peer.AppID, "err", err)
+	}
+}
+
+// RotateKey replaces the local WireGuard key. The new private key is generated
+// and persisted locally; only its public key is sent to the control plane,
+// which hands it to remote peers. The device is then switched to the new key
+// in place — peers and endpoints stay configured, so tunnels re-handshake
+// instead of dropping. Once the control plane accepted the key there is no
+// way back, so switching the device is retried until it succeeds.
+//
+// The WRRP relay session keeps the identity it was opened with until the
+// agent restarts.
+func (c *Node) RotateKey(ctx context.Context) error {
+	if !c.rotating.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer c.rotating.Store(false)
+
+	oldKey := c.manager.keyManager.GetKey()
+	newKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+
+	// Persist first: should the agent die after the control plane accepted the
+	// new public key, it must come back with the matching private key.
+	if err = infra.SavePrivateKey(c.keyPath, newKey); err != nil {
+		return err
+	}
+	if _, err = c.ctrClient.RotateKey(ctx, c.token, oldKey.PublicKey(), newKey.PublicKey()); err != nil {
+		if restoreErr := infra.SavePrivateKey(c.keyPath, oldKey); restoreErr != nil {
+			c.logger.Error("failed to restore previous private key", restoreErr)
+		}
+		return err
+	}
+
+	c.manager.keyManager.UpdateKey(newKey)
+	if err = c.applyKey(ctx, newKey); err != nil {
+		return err
+	}
+
+	// Remote peers address signaling to the new identity once they learn the
+	// new key. What they still send to the old one is for a key the device no
+	// longer has.
+	localIdentity := infra.NewPeerIdentity(c.current.AppID, newKey.PublicKey())
+	if err = c.natsService.Subscribe(fmt.Sprintf("%s.%s", "wireflow.signals.peers", localIdentity), c.probeFactory.Handle); err != nil {
+		return err
+	}
+	oldIdentity := infra.NewPeerIdentity(c.current.AppID, oldKey.PublicKey())
+	if err = c.natsService.Unsubscribe(fmt.Sprintf("%s.%s", "wireflow.signals.peers", oldIdentity)); err != nil {
+		c.logger.Warn("failed to unsubscribe the signaling of the previous key", "err", err)
+	}
+	c.probeFactory.SetLocalId(localIdentity)
+
+	current := *c.current
+	current.PublicKey = newKey.PublicKey().String()
+	current.PeerID = localIdentity.ID().ToUint64()
+	c.current = &current
+	c.manager.peerManager.AddPeer(current.AppID, &current)
+
+	// The cached network map is signed with the old key; re-sign it so a
+	// restart before the next update can still boot from it.
+	if cached := c.netmap.Last(); cached != nil {
+		snapshot := *cached
+		snapshot.Current = &current
+		if err = c.netmap.Save(&snapshot); err != nil {
+			c.logger.Warn("failed to re-sign cached network map", "err", err)
+		}
+	}
+
+	c.logger.Info("WireGuard key rotated", "old", oldKey.PublicKey().String(), "new", current.PublicKey)
+	return nil
+}
+
+// Backoff between attempts to switch the device to a rotated key.
+const (
+	applyKeyBackoffMin = time.Second
+	applyKeyBackoffMax = 30 * time.Second
+)
+
+// applyKey switches the device to key, retrying until it succeeds or ctx is
+// done. The control plane and the key file already hold key, so the device is
+// the only place left with the previous one; should ctx end first, the next
+// start comes up with key from the file.
+func (c *Node) applyKey(ctx context.Context, key wgtypes.Key) error {
+	backoff := applyKeyBackoffMin
+	for {
+		err := c.provisioner.SetupInterface(&infra.DeviceConfig{PrivateKey: key.String()})
+		if err == nil {
+			return nil
+		}
+		c.logger.Warn("failed to switch the device to the rotated key, retrying", "err", err, "in", backoff)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("switch device to rotated key: %w", err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, applyKeyBackoffMax)
+	}
+}
+
 func (c *Node) RemoveAllPeers() {
 	c.provisioner.RemoveAllPeers()
 }
@@ -0,0 +1,125 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+	"wireflow/management/transport"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// newTestNode returns a node wired to provisioner, with no device behind it.
+func newTestNode(provisioner infra.Provisioner) *Node {
+	c := &Node{
+		Name:         "wf0",
+		logger:       log.GetLogger("node-test"),
+		provisioner:  provisioner,
+		probeFactory: &transport.ProbeFactory{},
+	}
+	c.manager.peerManager = infra.NewPeerManager()
+	return c
+}
+
+func TestRemovePeerKeepsSharedRoutes(t *testing.T) {
+	provisioner := &fakeProvisioner{}
+	c := newTestNode(provisioner)
+
+	office := &infra.Peer{AppID: "office", PublicKey: "office-key", Address: ptr("10.0.0.2"), Routes: []string{"192.168.10.0/24"}}
+	lab := &infra.Peer{AppID: "lab", PublicKey: "lab-key", Address: ptr("10.0.0.3"), Routes: []string{"192.168.20.0/24"}}
+	for _, p := range []*infra.Peer{office, lab} {
+		c.manager.peerManager.AddPeer(p.AppID, p)
+		for _, route := range append([]string{*p.Address}, p.Routes...) {
+			if err := provisioner.ApplyRoute("add", route, c.Name); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := c.RemovePeer(&infra.Peer{AppID: "office", PublicKey: "office-key"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !provisioner.hasRoute("10.0.0.0/24") {
+		t.Fatal("removing one peer deleted the overlay route of the others")
+	}
+	if !provisioner.hasRoute("192.168.20.0/24") {
+		t.Fatal("removing one peer deleted the subnet route of another")
+	}
+	if provisioner.hasRoute("192.168.10.0/24") {
+		t.Fatal("subnet route of the removed peer left behind")
+	}
+	if c.manager.peerManager.GetPeer("office") != nil || c.manager.peerManager.GetPeer("lab") == nil {
+		t.Fatal("wrong peer forgotten")
+	}
+	if len(provisioner.removed) != 1 || provisioner.removed[0] != "office-key" {
+		t.Fatalf("removed WireGuard peers %v", provisioner.removed)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestRekeyPeer(t *testing.T) {
+	old := &infra.Peer{AppID: "office", PublicKey: "old-key"}
+	cases := []struct {
+		name    string
+		peer    *infra.Peer
+		removed bool
+	}{
+		{"within the grace window", &infra.Peer{AppID: "office", PublicKey: "new-key", PreviousPublicKey: "old-key",
+			PreviousKeyExpiresAt: time.Now().Add(time.Hour).Unix()}, false},
+		{"grace window over", &infra.Peer{AppID: "office", PublicKey: "new-key", PreviousPublicKey: "old-key",
+			PreviousKeyExpiresAt: time.Now().Add(-time.Minute).Unix()}, true},
+		{"no grace window", &infra.Peer{AppID: "office", PublicKey: "new-key"}, true},
+	}
+	for _, tc := range cases {
+		provisioner := &fakeProvisioner{}
+		c := newTestNode(provisioner)
+		c.rekeyPeer(old, tc.peer)
+		if removed := len(provisioner.removed) == 1 && provisioner.removed[0] == "old-key"; removed != tc.removed {
+			t.Errorf("%s: removed WireGuard peers %v", tc.name, provisioner.removed)
+		}
+	}
+}
+
+func TestApplyKeyRetries(t *testing.T) {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provisioner := &fakeProvisioner{setupFailures: 1}
+	c := newTestNode(provisioner)
+	if err = c.applyKey(context.Background(), key); err != nil {
+		t.Fatal(err)
+	}
+	if len(provisioner.keys) != 1 || provisioner.keys[0] != key.String() {
+		t.Fatalf("device keys %v", provisioner.keys)
+	}
+
+	provisioner = &fakeProvisioner{setupFailures: 100}
+	c = newTestNode(provisioner)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = c.applyKey(ctx, key); err == nil {
+		t.Fatal("expected applyKey to give up when the context ends")
+	}
+}
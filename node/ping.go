@@ -0,0 +1,378 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"wireflow/internal/config"
+	"wireflow/internal/infra"
+	"wireflow/internal/localapi"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	pingInterval = time.Second
+	pingTimeout  = 2 * time.Second
+	// icmpEchoOverhead and icmp6EchoOverhead are the IP and ICMP echo
+	// headers in front of the data.
+	icmpEchoOverhead  = 28
+	icmp6EchoOverhead = 48
+)
+
+// Ping sends ICMP echo requests through the tunnel to the overlay address of
+// a peer. A forced path pins the WireGuard endpoint of the peer to that path
+// while the probes run and restores it afterwards. Only the outbound leg is
+// pinned: replies come back along whatever path the remote peer uses.
+// The probes use a host ICMP socket, so a node on the userspace stack, whose
+// overlay is not routed by the host, cannot ping.
+func (c *Node) Ping(ctx context.Context, req *localapi.PingRequest) (*localapi.PingResult, error) {
+	if c.stack != nil {
+		return nil, fmt.Errorf("%w: ping is not available with --netstack", errors.ErrUnsupported)
+	}
+	peer := c.findPeer(req.Peer)
+	if peer == nil || peer.Address == nil {
+		return nil, fmt.Errorf("%w: %s", localapi.ErrPeerNotFound, req.Peer)
+	}
+
+	state := c.probeFactory.States()[peer.AppID]
+	result := &localapi.PingResult{
+		Peer:          peer.Name,
+		AppID:         peer.AppID,
+		Address:       *peer.Address,
+		Transport:     state.Transport,
+		Path:          state.Transport,
+		CandidatePair: state.CandidatePair,
+	}
+	for _, p := range c.probeFactory.Paths(peer.AppID) {
+		result.Paths = append(result.Paths, localapi.Path{
+			Transport:     p.Transport,
+			Protocol:      p.Protocol,
+			Endpoint:      p.Endpoint,
+			CandidatePair: p.CandidatePair,
+			RTT:           p.RTT,
+		})
+	}
+	if stats := c.peerStats(peer.PublicKey); stats != nil {
+		result.Endpoint = stats.Endpoint
+	}
+
+	if req.Path != "" && !strings.EqualFold(req.Path, state.Transport) {
+		var forced *localapi.Path
+		for i := range result.Paths {
+			if strings.EqualFold(result.Paths[i].Transport, req.Path) {
+				forced = &result.Paths[i]
+			}
+		}
+		if forced == nil {
+			return nil, fmt.Errorf("%w: no %s path to %s", localapi.ErrPathUnavailable, strings.ToUpper(req.Path), peer.Name)
+		}
+		// WireGuard cannot clear an endpoint, so without one to go back to
+		// the forced path would outlive the ping.
+		previous := result.Endpoint
+		if previous == "" {
+			previous = activeEndpoint(result.Paths, state.Transport)
+		}
+		if previous == "" {
+			return nil, fmt.Errorf("%w: the current path to %s is unknown and could not be restored", localapi.ErrPathUnavailable, peer.Name)
+		}
+		if err := c.provisioner.SetPeerEndpoint(peer.PublicKey, forced.Endpoint); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := c.provisioner.SetPeerEndpoint(peer.PublicKey, previous); err != nil {
+				c.logger.Warn("failed to restore peer endpoint after ping", "appId", peer.AppID, "err", err)
+			}
+		}()
+		result.Path, result.Endpoint, result.CandidatePair = forced.Transport, forced.Endpoint, forced.CandidatePair
+	}
+
+	replies, err := pingAddr(ctx, *peer.Address, req.Count)
+	if err != nil {
+		return nil, err
+	}
+	result.Replies = replies
+	if stats := c.peerStats(peer.PublicKey); stats != nil {
+		result.LastHandshake = stats.LastHandshake
+	}
+	return result, nil
+}
+
+// activeEndpoint returns the endpoint of the path carrying transport.
+func activeEndpoint(paths []localapi.Path, transport string) string {
+	for _, p := range paths {
+		if transport != "" && strings.EqualFold(p.Transport, transport) {
+			return p.Endpoint
+		}
+	}
+	return ""
+}
+
+// findPeer returns the remote peer with the given name or app id.
+func (c *Node) findPeer(nameOrID string) *infra.Peer {
+	for _, p := range c.manager.peerManager.GetAll() {
+		if c.current != nil && p.AppID == c.current.AppID {
+			continue
+		}
+		if p.AppID == nameOrID || p.Name == nameOrID {
+			return p
+		}
+	}
+	return nil
+}
+
+func (c *Node) peerStats(publicKey string) *infra.PeerStats {
+	stats, err := c.provisioner.DeviceStats()
+	if err != nil {
+		return nil
+	}
+	return stats.Peers[publicKey]
+}
+
+// listenICMP opens the raw ICMP socket that reaches dst.
+func listenICMP(dst netip.Addr) (*icmp.PacketConn, error) {
+	if dst.Is4() || dst.Is4In6() {
+		return icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	}
+	return icmp.ListenPacket("ip6:ipv6-icmp", "::")
+}
+
+// pingAddr sends count echo requests to addr, one per pingInterval.
+func pingAddr(ctx context.Context, addr string, count int) ([]localapi.PingReply, error) {
+	dst, err := netip.ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	dst = dst.Unmap()
+	conn, err := listenICMP(dst)
+	if err != nil {
+		return nil, fmt.Errorf("open ICMP socket: %w", err)
+	}
+	defer conn.Close()
+
+	id := rand.N(1 << 16)
+	replies := make([]localapi.PingReply, 0, count)
+	for seq := 1; seq <= count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+				return replies, nil
+			case <-time.After(pingInterval):
+			}
+		}
+		reply := localapi.PingReply{Seq: seq}
+		if rtt, err := echo(ctx, conn, dst, id, seq, 0); err != nil {
+			reply.Error = err.Error()
+		} else {
+			reply.RTT = rtt
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// echo sends one echo request and waits for its reply. A non-zero size pads
+// the request to an IP packet of that many bytes. The raw socket sees every
+// ICMP packet of the host, so replies are matched on source, id and sequence
+// number.
+func echo(ctx context.Context, conn *icmp.PacketConn, dst netip.Addr, id, seq, size int) (time.Duration, error) {
+	var (
+		request, reply icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+		proto, header            = 1, icmpEchoOverhead
+	)
+	if dst.Is6() {
+		request, reply = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		proto, header = 58, icmp6EchoOverhead
+	}
+	data := []byte("wireflow ping")
+	if size > header+len(data) {
+		data = append(data, make([]byte, size-header-len(data))...)
+	}
+	msg := icmp.Message{
+		Type: request,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: data},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	deadline := start.Add(pingTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err = conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+	if _, err = conn.WriteTo(b, &net.IPAddr{IP: dst.AsSlice()}); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return 0, fmt.Errorf("timeout")
+			}
+			return 0, err
+		}
+		if ip, ok := from.(*net.IPAddr); !ok || !ip.IP.Equal(dst.AsSlice()) {
+			continue
+		}
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil || m.Type != reply {
+			continue
+		}
+		if e, ok := m.Body.(*icmp.Echo); ok && e.ID == id && e.Seq == seq {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// PingOptions select how `wireflow ping` probes and reports.
+type PingOptions struct {
+	Count int
+	// Path forces ICE or WRRP; empty uses the active path.
+	Path string
+	JSON bool
+}
+
+// PingPeer asks the running agent to probe peer and prints the result.
+func PingPeer(flags *config.Config, peer string, opts PingOptions) error {
+	client, err := localapi.NewClient(flags.InterfaceName)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !opts.JSON {
+		fmt.Printf("PING %s", peer)
+		if opts.Path != "" {
+			fmt.Printf(" over %s", strings.ToUpper(opts.Path))
+		}
+		fmt.Println()
+	}
+	result, err := client.Ping(ctx, &localapi.PingRequest{Peer: peer, Count: opts.Count, Path: opts.Path})
+	if err != nil {
+		return err
+	}
+	if opts.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	printPing(os.Stdout, result)
+	return nil
+}
+
+// printPing writes the result of a ping the way `wireflow ping` shows it.
+func printPing(w io.Writer, r *localapi.PingResult) {
+	transport := pathLabel(r.Paths, r.Transport)
+	if transport == "" {
+		transport = "not connected"
+	}
+	fmt.Fprintf(w, "Peer      : %s (%s) %s\n", r.Peer, r.AppID, r.Address)
+	fmt.Fprintf(w, "Transport : %s\n", transport)
+	if r.Path != "" && r.Path != r.Transport {
+		fmt.Fprintf(w, "Forced    : %s (outbound only)\n", pathLabel(r.Paths, r.Path))
+	}
+	if r.Endpoint != "" {
+		fmt.Fprintf(w, "Endpoint  : %s\n", r.Endpoint)
+	}
+	if r.CandidatePair != "" {
+		fmt.Fprintf(w, "ICE pair  : %s\n", r.CandidatePair)
+	}
+	handshake := "never"
+	if !r.LastHandshake.IsZero() {
+		handshake = formatDuration(time.Since(r.LastHandshake)) + " ago"
+	}
+	fmt.Fprintf(w, "Handshake : %s\n\n", handshake)
+
+	var received int
+	var min, max, sum time.Duration
+	for _, reply := range r.Replies {
+		if reply.Error != "" {
+			fmt.Fprintf(w, "seq=%d %s\n", reply.Seq, reply.Error)
+			continue
+		}
+		fmt.Fprintf(w, "seq=%d time=%s\n", reply.Seq, formatRTT(reply.RTT))
+		if received == 0 || reply.RTT < min {
+			min = reply.RTT
+		}
+		if reply.RTT > max {
+			max = reply.RTT
+		}
+		sum += reply.RTT
+		received++
+	}
+
+	sent := len(r.Replies)
+	fmt.Fprintf(w, "\n--- %s ping statistics ---\n", r.Peer)
+	if sent == 0 {
+		fmt.Fprintln(w, "no probes sent")
+		return
+	}
+	fmt.Fprintf(w, "%d sent, %d received, %d%% loss", sent, received, (sent-received)*100/sent)
+	if received > 0 {
+		fmt.Fprintf(w, ", rtt min/avg/max = %s/%s/%s", formatRTT(min), formatRTT(sum/time.Duration(received)), formatRTT(max))
+	}
+	fmt.Fprintln(w)
+
+	if len(r.Paths) > 0 {
+		fmt.Fprintln(w, "\nPaths:")
+		for _, p := range r.Paths {
+			fmt.Fprintf(w, "  %-9s %s", pathLabel(r.Paths, p.Transport), p.Endpoint)
+			if p.CandidatePair != "" {
+				fmt.Fprintf(w, "  [%s]", p.CandidatePair)
+			}
+			if p.RTT > 0 {
+				fmt.Fprintf(w, "  ICE rtt %s", formatRTT(p.RTT))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// pathLabel names transport the way the paths show it: a WRRP relay with
+// the protocol it is reached over, e.g. WRRP/QUIC.
+func pathLabel(paths []localapi.Path, transport string) string {
+	for _, p := range paths {
+		if p.Protocol != "" && strings.EqualFold(p.Transport, transport) {
+			return transport + "/" + strings.ToUpper(p.Protocol)
+		}
+	}
+	return transport
+}
+
+func formatRTT(d time.Duration) string {
+	return fmt.Sprintf("%.2f ms", float64(d.Microseconds())/1000)
+}
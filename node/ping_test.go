@@ -0,0 +1,105 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"wireflow/internal/localapi"
+)
+
+func TestPingAddr(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := pingAddr(ctx, "not-an-address", 1); err == nil {
+		t.Fatal("expected an invalid address to fail")
+	}
+	for _, addr := range []string{"127.0.0.1", "::1", "::ffff:127.0.0.1"} {
+		t.Run(addr, func(t *testing.T) {
+			replies, err := pingAddr(ctx, addr, 1)
+			if err != nil {
+				t.Skipf("no raw ICMP socket: %v", err)
+			}
+			if len(replies) != 1 {
+				t.Fatalf("got %d replies, want 1", len(replies))
+			}
+			for i, reply := range replies {
+				if reply.Seq != i+1 || reply.Error != "" {
+					t.Fatalf("unexpected reply %+v", reply)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintPing(t *testing.T) {
+	var out bytes.Buffer
+	printPing(&out, &localapi.PingResult{
+		Peer:      "office",
+		AppID:     "app-1",
+		Address:   "10.0.0.2",
+		Transport: "ICE",
+		Path:      "WRRP",
+		Endpoint:  "[fd77:7272:7000::1]:51820",
+		Replies: []localapi.PingReply{
+			{Seq: 1, RTT: 2 * time.Millisecond},
+			{Seq: 2, Error: "timeout"},
+			{Seq: 3, RTT: 4 * time.Millisecond},
+		},
+		Paths: []localapi.Path{
+			{Transport: "ICE", Endpoint: "192.0.2.1:51820", CandidatePair: "host<->srflx", RTT: time.Millisecond},
+			{Transport: "WRRP", Protocol: "quic", Endpoint: "[fd77:7272:7000::1]:51820"},
+		},
+	})
+
+	for _, want := range []string{
+		"Peer      : office (app-1) 10.0.0.2\n",
+		"Transport : ICE\n",
+		"Forced    : WRRP/QUIC (outbound only)\n",
+		"Handshake : never\n",
+		"seq=1 time=2.00 ms\n",
+		"seq=2 timeout\n",
+		"3 sent, 2 received, 33% loss, rtt min/avg/max = 2.00 ms/3.00 ms/4.00 ms\n",
+		"  ICE       192.0.2.1:51820  [host<->srflx]  ICE rtt 1.00 ms\n",
+		"  WRRP/QUIC [fd77:7272:7000::1]:51820\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	printPing(&out, &localapi.PingResult{Peer: "lab"})
+	if !strings.Contains(out.String(), "Transport : not connected\n") || !strings.Contains(out.String(), "no probes sent\n") {
+		t.Fatalf("unexpected output for an unconnected peer:\n%s", out.String())
+	}
+}
+
+func TestActiveEndpoint(t *testing.T) {
+	paths := []localapi.Path{
+		{Transport: "ICE", Endpoint: "192.0.2.1:51820"},
+		{Transport: "WRRP", Endpoint: "[fd77:7272:7000::1]:51820"},
+	}
+	if got := activeEndpoint(paths, "WRRP"); got != "[fd77:7272:7000::1]:51820" {
+		t.Fatalf("activeEndpoint(WRRP) = %q", got)
+	}
+	if got := activeEndpoint(paths, ""); got != "" {
+		t.Fatalf("activeEndpoint of an unconnected peer = %q, want none", got)
+	}
+}
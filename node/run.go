@@ -28,9 +28,9 @@ import (
 	"strings"
 	"syscall"
 	"time"
-	"wireflow/dns"
 	"wireflow/internal/config"
 	"wireflow/internal/infra"
+	"wireflow/internal/localapi"
 	"wireflow/internal/log"
 	"wireflow/internal/telemetry"
 
@@ -49,41 +49,70 @@ func Start(ctx context.Context, flags *config.Config) error {
 		return startDaemon(flags, logger)
 	}
 
-	agentCfg := &NodeConfig{
-		Logger:        logger,
-		Port:          flags.WgPort,
-		InterfaceName: flags.InterfaceName,
-		Token:         flags.Token,
-		ShowLog:       flags.EnableSysLog,
-		Flags:         flags,
-	}
-
-	// 写 PID 文件，让 wireflow stop 能发 SIGTERM
-	pidPath := pidFilePath(flags.InterfaceName)
-	if err := writePIDFile(pidPath); err != nil {
-		logger.Warn("failed to write PID file", "err", err)
-	} else {
-		defer os.Remove(pidPath)
+	cfgs, err := nodeConfigs(flags, logger)
+	if err != nil {
+		return err
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	g, gCtx := errgroup.WithContext(ctx)
 
-	if flags.EnableDNS {
-		go func() {
-			nativeDNS := dns.NewNativeDNS(&dns.DNSConfig{})
-			if err := nativeDNS.Start(); err != nil {
-				logger.Error("DNS start failed", err)
+	// Every joined network runs as a node of its own; one failing to start
+	// stops those already running.
+	var nodes []*Node
+	stop := func() {
+		for _, c := range nodes {
+			if stopErr := c.Stop(); stopErr != nil {
+				c.logger.Warn("wireflow stop error", "err", stopErr)
 			}
-		}()
+		}
+	}
+	for _, cfg := range cfgs {
+		c, err := startNode(gCtx, g, cfg)
+		if c != nil {
+			nodes = append(nodes, c)
+			// 每个接口写一份 PID 文件，wireflow stop 按任一接口名都能找到本进程
+			pidPath := pidFilePath(c.Name)
+			if err := writePIDFile(pidPath); err != nil {
+				logger.Warn("failed to write PID file", "err", err)
+			} else {
+				defer os.Remove(pidPath)
+			}
+		}
+		if err != nil {
+			cancel()
+			stop()
+			return err
+		}
 	}
 
-	c, err := NewNode(gCtx, agentCfg)
+	logger.Info("wireflow started", "networks", len(nodes))
+
+	if err = g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
+		logger.Error("wireflow exited with error", err)
+	}
+
+	stop()
+	logger.Info("wireflow shutting down")
+
+	return nil
+}
+
+// startNode brings up the node of one network and adds its long-running
+// tasks to g. The node is returned even when a later step fails, so that the
+// caller can stop it.
+func startNode(ctx context.Context, g *errgroup.Group, cfg *NodeConfig) (*Node, error) {
+	flags := cfg.Flags
+	logger := cfg.Logger
+
+	c, err := NewNode(ctx, cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	c.GetNetworkMap = func() (*infra.Message, error) {
-		msg, err := c.ctrClient.GetNetMap(flags.Token)
+		msg, err := c.ctrClient.GetNetMap(c.token)
 		if err != nil {
 			logger.Error("get network map failed", err)
 			return nil, err
@@ -91,12 +120,15 @@ func Start(ctx context.Context, flags *config.Config) error {
 		return msg, nil
 	}
 
-	if err = c.Start(gCtx); err != nil {
-		return err
+	if err = c.Start(ctx); err != nil {
+		return c, err
 	}
 
 	// Start heartbeat so the management server can track online status.
-	go c.StartHeartbeat(gCtx)
+	go c.StartHeartbeat(ctx)
+	go c.StartTURNCredentials(ctx)
+	go c.watchUnderlay(ctx)
+	go c.probeFactory.WatchIdle(ctx)
 
 	logger.Debug("Interface name", "name", c.Name)
 
@@ -115,27 +147,41 @@ func Start(ctx context.Context, flags *config.Config) error {
 				networkID = c.current.NetworkId
 			}
 			collector.SetIdentity(telemetry.Identity{
-				PeerID:    flags.AppId,
+				PeerID:    c.appId,
 				NetworkID: networkID,
 				Interface: c.GetDeviceName(),
 			})
-			g.Go(func() error { return collector.Run(gCtx) })
+			g.Go(func() error { return collector.Run(ctx) })
 		}
 	}
 
+	// The local API only serves introspection; the agent runs on without it.
+	g.Go(func() error {
+		if err := localapi.NewServer(log.GetLogger("localapi"), c).Serve(ctx, localapi.SocketPath(c.Name)); err != nil {
+			logger.Warn("local API unavailable", "err", err)
+		}
+		return nil
+	})
+
+	// A rootless netstack node has no kernel interface for wg(8) to manage;
+	// it is reached through its proxies instead.
+	if c.stack != nil {
+		return c, c.serveNetstack(ctx, g, flags)
+	}
+
 	fileUAPI, err := ipc.UAPIOpen(c.Name)
 	if err != nil {
-		return fmt.Errorf("failed to open UAPI socket: %w", err)
+		return c, fmt.Errorf("failed to open UAPI socket: %w", err)
 	}
 
 	uapi, err := ipc.UAPIListen(c.Name, fileUAPI)
 	if err != nil {
-		return fmt.Errorf("failed to listen on UAPI socket: %w", err)
+		return c, fmt.Errorf("failed to listen on UAPI socket: %w", err)
 	}
 
 	g.Go(func() error {
 		go func() {
-			<-gCtx.Done()
+			<-ctx.Done()
 			uapi.Close()
 		}()
 
@@ -143,8 +189,8 @@ func Start(ctx context.Context, flags *config.Config) error {
 			conn, err := uapi.Accept()
 			if err != nil {
 				select {
-				case <-gCtx.Done():
-					return gCtx.Err()
+				case <-ctx.Done():
+					return ctx.Err()
 				default:
 					return fmt.Errorf("ipc accept error: %w", err)
 				}
@@ -156,18 +202,7 @@ func Start(ctx context.Context, flags *config.Config) error {
 		}
 	})
 
-	logger.Info("wireflow started")
-
-	if err = g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
-		logger.Error("wireflow exited with error", err)
-	}
-
-	if stopErr := c.Stop(); stopErr != nil {
-		logger.Warn("wireflow stop error", "err", stopErr)
-	}
-	logger.Info("wireflow shutting down")
-
-	return nil
+	return c, nil
 }
 
 // startDaemon forks the current process as a background daemon and exits the parent.
@@ -275,10 +310,6 @@ func Stop(flags *config.Config) error {
 	return nil
 }
 
-func Status(flags *config.Config) error {
-	return PrintStatus(flags.InterfaceName)
-}
-
 func pidFilePath(iface string) string {
 	return fmt.Sprintf("/var/run/wireguard/%s.pid", iface)
 }
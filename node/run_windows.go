@@ -23,9 +23,9 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"wireflow/dns"
 	"wireflow/internal/config"
 	"wireflow/internal/infra"
+	"wireflow/internal/localapi"
 	"wireflow/internal/log"
 	"golang.zx2c4.com/wireguard/ipc"
 	"golang.zx2c4.com/wireguard/wgctrl"
@@ -42,6 +42,14 @@ func Start(ctx context.Context, flags *config.Config) error {
 
 	logger := log.GetLogger("wireflow")
 
+	// 多网络依赖每个网络独立的 wintun 适配器，暂未支持。
+	if len(flags.Networks) > 0 {
+		return fmt.Errorf("joining several networks is not supported on Windows yet")
+	}
+	if flags.Netstack {
+		return fmt.Errorf("netstack mode is not supported on Windows yet")
+	}
+
 	// peers config to wireGuard
 	agentCfg := &NodeConfig{
 		Logger:        logger,
@@ -139,15 +147,6 @@ func Start(ctx context.Context, flags *config.Config) error {
 		}
 	}
 
-	// enable DNS
-	if flags.EnableDNS {
-		go func() {
-			nativeDNS := dns.NewNativeDNS(&dns.DNSConfig{})
-			nativeDNS.Start()
-			fmt.Println("Dns started")
-		}()
-	}
-
 	c, err := NewNode(ctx, agentCfg)
 	if err != nil {
 		return err
@@ -170,6 +169,7 @@ func Start(ctx context.Context, flags *config.Config) error {
 
 	// Start heartbeat so the management server can track online status.
 	go c.StartHeartbeat(ctx)
+	go c.StartTURNCredentials(ctx)
 
 	// open UAPI file
 	logger.Debug("Interface name", "name", c.Name)
@@ -189,12 +189,19 @@ func Start(ctx context.Context, flags *config.Config) error {
 			go c.DeviceManager.IpcHandle(conn)
 		}
 	}()
+	go func() {
+		if err := localapi.NewServer(log.GetLogger("localapi"), c).Serve(ctx, localapi.SocketPath(c.Name)); err != nil {
+			logger.Warn("local API unavailable", "err", err)
+		}
+	}()
 	logger.Info("wireflow started")
 
 	<-ctx.Done()
 	uapi.Close()
 
-	c.close()
+	if stopErr := c.Stop(); stopErr != nil {
+		logger.Warn("wireflow stop error", "err", stopErr)
+	}
 	logger.Info("wireflow shutting down")
 	return err
 }
@@ -224,10 +231,6 @@ func Stop(flags *config.Config) error {
 
 }
 
-func Status(flags *config.Config) error {
-	return PrintStatus(flags.InterfaceName)
-}
-
 // stop wireflow daemon via sock file
 func stopViaPIDFile(interfaceName string) error {
 	// get sock
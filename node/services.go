@@ -0,0 +1,414 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"wireflow/internal/config"
+	"wireflow/internal/infra"
+	"wireflow/internal/localapi"
+	"wireflow/internal/log"
+	"wireflow/internal/netstack"
+)
+
+// services are the local services a node publishes on its overlay address
+// and the local ports it forwards to peers. Each runs on its own listener
+// until it is removed or the node stops.
+type services struct {
+	mu     sync.Mutex
+	logger *log.Logger
+	// userspace is set when the services listen on the userspace stack,
+	// whose listeners accept on any overlay address.
+	userspace bool
+	exposed   map[string]*exposedService
+	forwards  map[string]*portForward
+}
+
+type exposedService struct {
+	info   localapi.Service
+	port   int
+	cancel context.CancelFunc
+}
+
+type portForward struct {
+	info localapi.PortForward
+	// spec is the listen address as requested, e.g. localhost:18080.
+	spec   string
+	cancel context.CancelFunc
+}
+
+// close stops every listener.
+func (s *services) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, e := range s.exposed {
+		e.cancel()
+		delete(s.exposed, name)
+	}
+	for listen, f := range s.forwards {
+		f.cancel()
+		delete(s.forwards, listen)
+	}
+}
+
+// serve relays the connections accepted on ln to the target of e until e is
+// canceled; s.mu must be held.
+func (s *services) serve(e *exposedService, ln net.Listener) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.info.Address = ln.Addr().String()
+	e.cancel = cancel
+	name, target := e.info.Name, e.info.Target
+	var d net.Dialer
+	go func() {
+		if err := netstack.Forward(ctx, ln, d.DialContext, target, s.logger); err != nil {
+			s.logger.Warn("exposed service stopped", "name", name, "err", err)
+		}
+	}()
+}
+
+// reconcile moves the exposed services to the overlay address of msg. A
+// listener stays on the address it was bound to, so when the control plane
+// assigns another one each service is bound again, on the same port.
+func (s *services) reconcile(msg *infra.Message) {
+	if s == nil || s.userspace || msg.Current == nil || msg.Current.Address == nil {
+		return
+	}
+	address := *msg.Current.Address
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, e := range s.exposed {
+		host, port, err := net.SplitHostPort(e.info.Address)
+		if err != nil || host == address {
+			continue
+		}
+		ln, err := net.Listen("tcp", net.JoinHostPort(address, port))
+		if err != nil {
+			s.logger.Error("cannot move exposed service to the new overlay address", err, "name", name, "address", address)
+			continue
+		}
+		e.cancel()
+		s.serve(e, ln)
+		s.logger.Info("exposed service moved to the new overlay address", "name", name, "address", e.info.Address)
+	}
+}
+
+// Services lists the exposed services with the sources the firewall policy
+// currently admits to each.
+func (c *Node) Services() []localapi.Service {
+	rules := c.Rules().Applied
+	c.services.mu.Lock()
+	defer c.services.mu.Unlock()
+	out := make([]localapi.Service, 0, len(c.services.exposed))
+	for _, e := range c.services.exposed {
+		service := e.info
+		if rules != nil {
+			service.Policy = rules.PolicyName
+			service.AllowedFrom = rules.IngressSources(service.Protocol, e.port)
+		}
+		out = append(out, service)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Expose accepts connections on a port of the overlay address and relays
+// them to the service on localhost. The listener sits behind the interface
+// like any other overlay socket, so the firewall policy decides which peers
+// reach it. It follows the node to a new overlay address (see reconcile).
+func (c *Node) Expose(req *localapi.ExposeRequest) (*localapi.Service, error) {
+	c.services.mu.Lock()
+	if _, ok := c.services.exposed[req.Name]; ok {
+		c.services.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", localapi.ErrServiceExists, req.Name)
+	}
+	ln, err := c.listenOverlay(req.ListenPort)
+	if err != nil {
+		c.services.mu.Unlock()
+		return nil, err
+	}
+	target := net.JoinHostPort("127.0.0.1", strconv.Itoa(req.Port))
+	if c.services.exposed == nil {
+		c.services.exposed = make(map[string]*exposedService)
+	}
+	e := &exposedService{
+		info: localapi.Service{
+			Name:     req.Name,
+			Protocol: req.Protocol,
+			Target:   target,
+		},
+		port: req.ListenPort,
+	}
+	c.services.exposed[req.Name] = e
+	c.services.serve(e, ln)
+	c.services.mu.Unlock()
+	c.logger.Info("service exposed on the overlay", "name", req.Name, "address", ln.Addr(), "target", target)
+
+	for _, service := range c.Services() {
+		if service.Name == req.Name {
+			return &service, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", localapi.ErrServiceNotFound, req.Name)
+}
+
+// Unexpose stops publishing the service called name.
+func (c *Node) Unexpose(name string) error {
+	c.services.mu.Lock()
+	defer c.services.mu.Unlock()
+	e, ok := c.services.exposed[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", localapi.ErrServiceNotFound, name)
+	}
+	e.cancel()
+	delete(c.services.exposed, name)
+	c.logger.Info("service no longer exposed", "name", name)
+	return nil
+}
+
+// Forwards lists the local ports relayed to peers.
+func (c *Node) Forwards() []localapi.PortForward {
+	c.services.mu.Lock()
+	defer c.services.mu.Unlock()
+	out := make([]localapi.PortForward, 0, len(c.services.forwards))
+	for _, f := range c.services.forwards {
+		out = append(out, f.info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Listen < out[j].Listen })
+	return out
+}
+
+// Forward accepts connections on a local address and relays them through
+// the tunnel to a port of a peer. Host routing is left alone: the overlay
+// address is reached over the interface, or the userspace stack, and the
+// firewall policy applies to the relayed connections as to any other.
+func (c *Node) Forward(req *localapi.ForwardRequest) (*localapi.PortForward, error) {
+	peer := c.findPeer(req.Peer)
+	if peer == nil || peer.Address == nil {
+		return nil, fmt.Errorf("%w: %s", localapi.ErrPeerNotFound, req.Peer)
+	}
+
+	c.services.mu.Lock()
+	defer c.services.mu.Unlock()
+	for _, f := range c.services.forwards {
+		if f.spec == req.Listen {
+			return nil, fmt.Errorf("%w: %s", localapi.ErrServiceExists, req.Listen)
+		}
+	}
+	ln, err := net.Listen("tcp", req.Listen)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &portForward{
+		info: localapi.PortForward{
+			Listen: ln.Addr().String(),
+			Peer:   peer.Name,
+			AppID:  peer.AppID,
+			Remote: net.JoinHostPort(*peer.Address, strconv.Itoa(req.Port)),
+		},
+		spec:   req.Listen,
+		cancel: cancel,
+	}
+	if c.services.forwards == nil {
+		c.services.forwards = make(map[string]*portForward)
+	}
+	c.services.forwards[f.info.Listen] = f
+
+	go func() {
+		if err := netstack.Forward(ctx, ln, c.dialOverlay, f.info.Remote, c.logger); err != nil {
+			c.logger.Warn("port forward stopped", "listen", f.info.Listen, "err", err)
+		}
+	}()
+	c.logger.Info("forwarding local port to peer", "listen", f.info.Listen, "peer", peer.Name, "remote", f.info.Remote)
+	info := f.info
+	return &info, nil
+}
+
+// Unforward stops the forward on listen, as requested or as bound.
+func (c *Node) Unforward(listen string) error {
+	c.services.mu.Lock()
+	defer c.services.mu.Unlock()
+	for key, f := range c.services.forwards {
+		if key == listen || f.spec == listen {
+			f.cancel()
+			delete(c.services.forwards, key)
+			c.logger.Info("port forward removed", "listen", key)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", localapi.ErrServiceNotFound, listen)
+}
+
+// listenOverlay listens on port of the overlay address of the node.
+func (c *Node) listenOverlay(port int) (net.Listener, error) {
+	if c.stack != nil {
+		return c.stack.ListenTCP(uint16(port))
+	}
+	msg := c.netmap.Last()
+	if msg == nil || msg.Current == nil || msg.Current.Address == nil {
+		return nil, errors.New("no overlay address assigned yet")
+	}
+	return net.Listen("tcp", net.JoinHostPort(*msg.Current.Address, strconv.Itoa(port)))
+}
+
+// dialOverlay opens a connection to an overlay address.
+func (c *Node) dialOverlay(ctx context.Context, network, address string) (net.Conn, error) {
+	if c.stack != nil {
+		return c.stack.DialContext(ctx, network, address)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, address)
+}
+
+// ParseExposeSpec parses the service of `wireflow expose`: "tcp:5432" or a
+// bare port.
+func ParseExposeSpec(spec string) (string, int, error) {
+	protocol, portStr, ok := strings.Cut(spec, ":")
+	if !ok {
+		protocol, portStr = "tcp", spec
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid service %q: want tcp:<port>", spec)
+	}
+	protocol = strings.ToLower(protocol)
+	if protocol != "tcp" {
+		return "", 0, fmt.Errorf("invalid service %q: only tcp services can be exposed", spec)
+	}
+	return protocol, port, nil
+}
+
+// ParseForwardSpec parses the remote end of `wireflow forward`:
+// "<peer>:<port>".
+func ParseForwardSpec(spec string) (string, int, error) {
+	i := strings.LastIndex(spec, ":")
+	if i <= 0 {
+		return "", 0, fmt.Errorf("invalid forward %q: want <peer>:<port>", spec)
+	}
+	port, err := strconv.Atoi(spec[i+1:])
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid forward %q: bad port", spec)
+	}
+	return spec[:i], port, nil
+}
+
+// ExposeService publishes req through the running agent, or lists the
+// exposed services when req is nil.
+func ExposeService(flags *config.Config, req *localapi.ExposeRequest, jsonOut bool) error {
+	client, err := localapi.NewClient(flags.InterfaceName)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	services, err := client.Services(ctx)
+	if req != nil {
+		var service *localapi.Service
+		if service, err = client.Expose(ctx, req); err == nil {
+			services = []localapi.Service{*service}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if jsonOut {
+		return printJSON(services)
+	}
+	if len(services) == 0 {
+		fmt.Println("no services exposed")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tADDRESS\tTARGET\tALLOWED-FROM") //nolint:errcheck
+	for _, s := range services {
+		allowed := strings.Join(s.AllowedFrom, ",")
+		switch {
+		case s.Policy == "":
+			allowed = "any (no policy applied yet)"
+		case allowed == "":
+			allowed = "none (policy " + s.Policy + " admits no peer)"
+		}
+		fmt.Fprintf(w, "%s\t%s/%s\t%s\t%s\n", s.Name, s.Address, s.Protocol, s.Target, allowed) //nolint:errcheck
+	}
+	return w.Flush()
+}
+
+// ForwardPort relays a local address to a peer through the running agent,
+// or lists the forwards when req is nil.
+func ForwardPort(flags *config.Config, req *localapi.ForwardRequest, jsonOut bool) error {
+	client, err := localapi.NewClient(flags.InterfaceName)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	forwards, err := client.Forwards(ctx)
+	if req != nil {
+		var forward *localapi.PortForward
+		if forward, err = client.Forward(ctx, req); err == nil {
+			forwards = []localapi.PortForward{*forward}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if jsonOut {
+		return printJSON(forwards)
+	}
+	if len(forwards) == 0 {
+		fmt.Println("no ports forwarded")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "LISTEN\tPEER\tREMOTE") //nolint:errcheck
+	for _, f := range forwards {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Listen, f.Peer, f.Remote) //nolint:errcheck
+	}
+	return w.Flush()
+}
+
+// RemoveService stops an exposed service (forward false) or a port forward
+// in the running agent.
+func RemoveService(flags *config.Config, key string, forward bool) error {
+	client, err := localapi.NewClient(flags.InterfaceName)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if forward {
+		return client.Unforward(ctx, key)
+	}
+	return client.Unexpose(ctx, key)
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,105 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+	"wireflow/internal/infra"
+	"wireflow/internal/localapi"
+	"wireflow/internal/log"
+)
+
+func TestParseExposeSpec(t *testing.T) {
+	tests := []struct {
+		spec     string
+		protocol string
+		port     int
+		wantErr  bool
+	}{
+		{spec: "tcp:5432", protocol: "tcp", port: 5432},
+		{spec: "TCP:80", protocol: "tcp", port: 80},
+		{spec: "8080", protocol: "tcp", port: 8080},
+		{spec: "tcp:65535", protocol: "tcp", port: 65535},
+		{spec: "udp:53", wantErr: true},
+		{spec: "tcp:0", wantErr: true},
+		{spec: "tcp:65536", wantErr: true},
+		{spec: "tcp:", wantErr: true},
+		{spec: "tcp:db", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		protocol, port, err := ParseExposeSpec(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseExposeSpec(%q) = %s, %d; want an error", tt.spec, protocol, port)
+			}
+			continue
+		}
+		if err != nil || protocol != tt.protocol || port != tt.port {
+			t.Errorf("ParseExposeSpec(%q) = %s, %d, %v; want %s, %d", tt.spec, protocol, port, err, tt.protocol, tt.port)
+		}
+	}
+}
+
+func TestServicesFollowOverlayAddress(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs all of 127.0.0.0/8 on the loopback interface")
+	}
+	s := &services{logger: log.GetLogger("services-test")}
+	defer s.close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	e := &exposedService{info: localapi.Service{Name: "db", Protocol: "tcp", Target: "127.0.0.1:1"}}
+	s.mu.Lock()
+	s.exposed = map[string]*exposedService{"db": e}
+	s.serve(e, ln)
+	s.mu.Unlock()
+
+	moved := "127.0.0.2"
+	s.reconcile(&infra.Message{Current: &infra.Peer{Address: &moved}})
+
+	s.mu.Lock()
+	address := e.info.Address
+	s.mu.Unlock()
+	if want := net.JoinHostPort(moved, port); address != want {
+		t.Fatalf("address = %s, want %s", address, want)
+	}
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		t.Fatalf("new address does not accept: %v", err)
+	}
+	conn.Close() //nolint:errcheck
+
+	// The listener on the old address is closed once its service moved.
+	old := net.JoinHostPort("127.0.0.1", port)
+	for i := 0; ; i++ {
+		conn, err = net.DialTimeout("tcp", old, time.Second)
+		if err != nil {
+			break
+		}
+		conn.Close() //nolint:errcheck
+		if i == 50 {
+			t.Fatal("old address still accepts")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
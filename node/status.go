@@ -15,16 +15,145 @@
 package node
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
+	"wireflow/internal/config"
+	"wireflow/internal/localapi"
 
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
-const handshakeActiveThreshold = 3 * time.Minute
+const (
+	handshakeActiveThreshold = 3 * time.Minute
+	statusWatchInterval      = 2 * time.Second
+)
+
+// StatusOptions select how `wireflow status` reports.
+type StatusOptions struct {
+	// JSON prints the local API status object instead of text.
+	JSON bool
+	// Watch keeps refreshing until interrupted.
+	Watch bool
+}
+
+// Status queries the running agent over its local API. Agents without the
+// API (older versions) are reported from the WireGuard device alone.
+func Status(flags *config.Config, opts StatusOptions) error {
+	client, err := localapi.NewClient(flags.InterfaceName)
+	if err == nil {
+		_, err = client.Status(context.Background())
+	}
+	if errors.Is(err, localapi.ErrNotRunning) && !opts.JSON && !opts.Watch {
+		return PrintStatus(flags.InterfaceName)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(statusWatchInterval)
+	defer ticker.Stop()
+	for {
+		status, err := client.Status(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if opts.JSON {
+			enc := json.NewEncoder(os.Stdout)
+			if !opts.Watch {
+				enc.SetIndent("", "  ")
+			}
+			if err := enc.Encode(status); err != nil {
+				return err
+			}
+		} else {
+			if opts.Watch {
+				// Clear the screen and move the cursor home.
+				fmt.Print("\033[H\033[2J")
+			}
+			printAgentStatus(status)
+		}
+
+		if !opts.Watch {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func printAgentStatus(s *localapi.Status) {
+	fmt.Printf("Interface : %s\n", s.Interface)
+	if s.Name != "" {
+		fmt.Printf("Name      : %s\n", s.Name)
+	}
+	if s.Address != "" {
+		fmt.Printf("Address   : %s\n", s.Address)
+	}
+	fmt.Printf("Public Key: %s\n", s.PublicKey)
+	fmt.Printf("Port      : %d\n", s.ListenPort)
+	fmt.Printf("Network   : %s (config %s)\n", s.NetworkID, s.ConfigVersion)
+	fmt.Printf("Firewall  : %s\n", s.Firewall)
+	if s.Offline {
+		fmt.Println("Control   : offline, running on the cached network map")
+	}
+
+	connected := 0
+	for _, p := range s.Peers {
+		if p.ProbeState == "connected" {
+			connected++
+		}
+	}
+	fmt.Printf("\nPeers: %d total, %d connected\n", len(s.Peers), connected)
+
+	for _, p := range s.Peers {
+		handshake := "never"
+		if !p.LastHandshake.IsZero() {
+			handshake = formatDuration(time.Since(p.LastHandshake)) + " ago"
+		}
+		state := p.ProbeState
+		if state == "" {
+			state = "idle"
+		}
+		if p.Transport != "" {
+			state += " via " + p.Transport
+		}
+		endpoint := p.Endpoint
+		if endpoint == "" {
+			endpoint = "(none)"
+		}
+
+		fmt.Printf("\n  Peer      : %s (%s)\n", p.Name, p.AppID)
+		fmt.Printf("  Address   : %s\n", p.Address)
+		fmt.Printf("  Endpoint  : %s\n", endpoint)
+		fmt.Printf("  Handshake : %s\n", handshake)
+		fmt.Printf("  Traffic   : ↑ %s  ↓ %s\n", formatBytes(p.TxBytes), formatBytes(p.RxBytes))
+		if p.ExitNode {
+			fmt.Printf("  Exit node : yes\n")
+		}
+		if len(p.Routes) > 0 {
+			fmt.Printf("  Routes    : %s\n", strings.Join(p.Routes, ", "))
+		}
+		fmt.Printf("  Status    : %s\n", state)
+	}
+}
 
 // PrintStatus prints the current WireGuard interface and peer status to stdout.
 func PrintStatus(interfaceName string) error {
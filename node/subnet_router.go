@@ -0,0 +1,80 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"strings"
+	"sync"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+)
+
+// subnetRouter forwards traffic from the overlay into the subnets the control
+// plane has approved for this node (--advertise-routes).
+type subnetRouter struct {
+	logger      *log.Logger
+	provisioner infra.Provisioner
+
+	mu      sync.Mutex
+	serving string // source and subnets currently served
+}
+
+func newSubnetRouter(logger *log.Logger, provisioner infra.Provisioner) *subnetRouter {
+	return &subnetRouter{logger: logger, provisioner: provisioner}
+}
+
+// reconcile serves the routes of msg.Current, replacing what was served
+// before. Routes only arrive once approved and free of overlaps.
+func (r *subnetRouter) reconcile(msg *infra.Message) {
+	if msg.Current == nil {
+		return
+	}
+	var source string
+	routes := msg.Current.Routes
+	if len(routes) > 0 {
+		source = overlaySource(msg)
+	}
+	if source == "" {
+		routes = nil
+	}
+	state := source + " " + strings.Join(routes, ",")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if state == r.serving {
+		return
+	}
+	if err := r.provisioner.ServeRoutes(r.provisioner.GetIfaceName(), source, routes); err != nil {
+		r.logger.Error("failed to serve subnet routes", err, "routes", routes)
+		return
+	}
+	r.serving = state
+	if len(routes) > 0 {
+		r.logger.Info("serving subnet routes", "routes", routes, "source", source)
+	} else {
+		r.logger.Info("stopped serving subnet routes")
+	}
+}
+
+// overlaySource is the overlay network the forwarded traffic comes from.
+func overlaySource(msg *infra.Message) string {
+	if msg.Network != nil && msg.Network.Address != "" {
+		return msg.Network.Address
+	}
+	if msg.Current.Address != nil {
+		return infra.GetCidrFromIP(*msg.Current.Address)
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"time"
+	"wireflow/internal/log"
+)
+
+const (
+	turnCredentialsRetry    = 30 * time.Second
+	turnCredentialsMaxRetry = 10 * time.Minute
+	turnCredentialsMinWait  = 30 * time.Second
+)
+
+// StartTURNCredentials keeps short-lived credentials for the TURN relay of
+// the management server, so ICE agents gather relay candidates. Credentials
+// are renewed well before they expire; a server without a relay just makes
+// the node retry now and then.
+// It runs until ctx is cancelled and is safe to run in a goroutine.
+func (c *Node) StartTURNCredentials(ctx context.Context) {
+	logger := log.GetLogger("turn")
+	retry := turnCredentialsRetry
+	var expires time.Time
+	active := false
+
+	for {
+		wait := retry
+		creds, err := c.ctrClient.TURNCredentials(ctx, c.token)
+		switch {
+		case err != nil:
+			// A management server without a relay is a normal setup.
+			logger.Debug("no TURN credentials", "err", err, "retry", retry)
+			retry = min(retry*2, turnCredentialsMaxRetry)
+			if active && time.Now().After(expires) {
+				// Expired credentials only make ICE agents fail allocations.
+				_ = c.iceServers.SetRelays(nil)
+				logger.Warn("TURN credentials expired, relay candidates disabled", "err", err)
+				active = false
+			}
+		default:
+			retry = turnCredentialsRetry
+			if err = c.iceServers.SetRelays(creds.Servers); err != nil {
+				logger.Warn("invalid TURN relay from management server", "err", err)
+				break
+			}
+			expires = creds.ExpiresAt
+			if !active {
+				logger.Info("TURN relay enabled", "expiresAt", creds.ExpiresAt)
+				active = true
+			}
+			wait = max(time.Until(creds.ExpiresAt)*4/5, turnCredentialsMinWait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"time"
+	"wireflow/internal/infra"
+	"wireflow/internal/log"
+)
+
+// roamJitter spreads the ICE restarts after an underlay change, so the peers
+// do not all receive an offer in the same instant.
+const roamJitter = 500 * time.Millisecond
+
+// watchUnderlay re-runs ICE with every peer when the host network under the
+// tunnels changes, e.g. when the machine moves to another Wi-Fi or a VPN
+// comes up. Without it a peer is reconnected only once its path has timed
+// out. The new endpoints reach the server with the heartbeat sent when the
+// peers are connected again.
+func (c *Node) watchUnderlay(ctx context.Context) {
+	logger := log.GetLogger("underlay")
+	ignore := func(iface string) bool { return iface == c.Name }
+	err := infra.WatchUnderlay(ctx, logger, ignore, func(u infra.Underlay) {
+		logger.Info("underlay network changed, reconnecting peers", "routes", u.Routes, "addrs", u.Addrs)
+		c.probeFactory.Reconnect(roamJitter)
+	})
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		logger.Debug("underlay changes are not watched on this platform")
+	case err != nil:
+		logger.Warn("cannot watch the underlay network", "err", err)
+	}
+}
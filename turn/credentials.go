@@ -0,0 +1,64 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turn
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCredentialTTL is how long issued credentials stay valid when no TTL
+// is configured.
+const DefaultCredentialTTL = time.Hour
+
+// NewCredentials issues short-lived credentials for user following the TURN
+// REST API convention: the username is "<expiry unix time>:<user>" and the
+// password is the base64 HMAC-SHA1 of the username keyed with secret. The
+// server verifies them with the same secret, so no per-user state is needed.
+func NewCredentials(secret, user string, ttl time.Duration, now time.Time) (username, password string, expires time.Time) {
+	if ttl <= 0 {
+		ttl = DefaultCredentialTTL
+	}
+	expires = now.Add(ttl).Truncate(time.Second)
+	username = strconv.FormatInt(expires.Unix(), 10) + ":" + user
+	return username, credentialPassword(secret, username), expires
+}
+
+// CredentialPassword returns the password of username when it was issued with
+// secret by NewCredentials and has not expired yet.
+func CredentialPassword(secret, username string, now time.Time) (string, bool) {
+	if secret == "" {
+		return "", false
+	}
+	expiry, _, ok := strings.Cut(username, ":")
+	if !ok {
+		return "", false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || !now.Before(time.Unix(unix, 0)) {
+		return "", false
+	}
+	return credentialPassword(secret, username), true
+}
+
+func credentialPassword(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
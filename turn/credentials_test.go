@@ -0,0 +1,54 @@
+// Copyright 2025 The Wireflow Authors, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turn
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCredentials(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	username, password, expires := NewCredentials("s3cret", "peer-a", 10*time.Minute, now)
+
+	if !strings.HasSuffix(username, ":peer-a") {
+		t.Fatalf("username %q does not name the peer", username)
+	}
+	if want := now.Add(10 * time.Minute); !expires.Equal(want) {
+		t.Fatalf("expires = %v, want %v", expires, want)
+	}
+
+	got, ok := CredentialPassword("s3cret", username, now.Add(time.Minute))
+	if !ok || got != password {
+		t.Fatalf("valid credentials rejected: %q, %v", got, ok)
+	}
+	if got, ok = CredentialPassword("other", username, now); ok && got == password {
+		t.Fatal("credentials accepted with another secret")
+	}
+	if _, ok = CredentialPassword("s3cret", username, expires); ok {
+		t.Fatal("expired credentials accepted")
+	}
+	if _, ok = CredentialPassword("s3cret", "peer-a", now); ok {
+		t.Fatal("username without expiry accepted")
+	}
+	if _, ok = CredentialPassword("", username, now); ok {
+		t.Fatal("credentials accepted without a secret")
+	}
+
+	if _, _, expires = NewCredentials("s3cret", "peer-a", 0, now); !expires.Equal(now.Add(DefaultCredentialTTL)) {
+		t.Fatalf("default ttl not applied: %v", expires)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"net"
 	"strconv"
+	"time"
 	"wireflow/internal/config"
 	"wireflow/internal/log"
 
@@ -33,6 +34,7 @@ type TurnServer struct {
 	port     int
 	publicIP string
 	users    []*config.User
+	secret   string
 }
 
 type TurnServerConfig struct {
@@ -40,6 +42,9 @@ type TurnServerConfig struct {
 	PublicIP string
 	Port     int
 	Users    []*config.User
+	// Secret verifies the short-lived credentials the management server
+	// issues to peers (see NewCredentials). Empty accepts Users only.
+	Secret string
 }
 
 func NewTurnServer(cfg *TurnServerConfig) *TurnServer {
@@ -48,6 +53,7 @@ func NewTurnServer(cfg *TurnServerConfig) *TurnServer {
 		port:     cfg.Port,
 		publicIP: cfg.PublicIP,
 		users:    cfg.Users,
+		secret:   cfg.Secret,
 	}
 }
 
@@ -65,8 +71,14 @@ func (ts *TurnServer) Start(ctx context.Context) error {
 	s, err := turn.NewServer(turn.ServerConfig{
 		Realm: realm,
 		AuthHandler: func(username, _ string, _ net.Addr) ([]byte, bool) {
-			key, ok := authKeys[username]
-			return key, ok
+			if key, ok := authKeys[username]; ok {
+				return key, true
+			}
+			password, ok := CredentialPassword(ts.secret, username, time.Now())
+			if !ok {
+				return nil, false
+			}
+			return turn.GenerateAuthKey(username, realm, password), true
 		},
 		PacketConnConfigs: []turn.PacketConnConfig{
 			{
@@ -31,6 +31,7 @@ type TurnServerConfig struct {
 	PublicIP string
 	Port     int
 	Users    []*config.User
+	Secret   string
 }
 
 type TurnServer struct{}
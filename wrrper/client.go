@@ -82,6 +82,10 @@ func (c *WRRPClient) RemoteAddr() net.Addr {
 	return c.Conn.RemoteAddr()
 }
 
+func (c *WRRPClient) Protocol() string {
+	return "tcp"
+}
+
 func NewWrrpClient(ctx context.Context, localID infra.PeerID, url string, onMessage func(ctx context.Context, remoteId infra.PeerID, packet *grpc.SignalPacket) error) (*WRRPClient, error) {
 	ctx, cancel := context.WithCancel(ctx)
 	c := &WRRPClient{
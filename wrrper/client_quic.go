@@ -132,6 +132,11 @@ func (c *QUICWRRPClient) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
 
+// Protocol reports that the relay is reached over QUIC.
+func (c *QUICWRRPClient) Protocol() string {
+	return "quic"
+}
+
 // Send transmits a WRRP frame (header + data) as a QUIC datagram.
 func (c *QUICWRRPClient) Send(ctx context.Context, targetId uint64, wrrpType uint8, data []byte) error {
 	header := &wrrp.Header{